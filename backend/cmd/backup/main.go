@@ -0,0 +1,116 @@
+// backup 导出或恢复用户账户的完整备份（与 /api/v2/backup 使用相同的 JSON 格式）。
+//
+// 用法：
+//
+//	go run ./cmd/backup export -user alice -o alice.json
+//	go run ./cmd/backup restore -user bob -mode merge -i alice.json
+//
+// -user 可以是用户名、整数ID或 UUID；省略 -o / -i 时使用标准输出 / 标准输入。
+// 数据库连接使用与服务相同的 DB_* 环境变量。
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/TodoList/config"
+	"github.com/TodoList/models"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: backup export -user <user> [-o file]")
+	fmt.Fprintln(os.Stderr, "       backup restore -user <user> [-mode merge|replace] [-i file]")
+	os.Exit(2)
+}
+
+// resolveUser 把用户名、整数ID或 UUID 解析为用户ID
+func resolveUser(users *models.UserModel, ref string) (int, error) {
+	id, err := users.ResolveUserID(ref)
+	if !errors.Is(err, models.ErrInvalidID) {
+		return id, err
+	}
+	user, err := users.GetUserByUsername(ref)
+	if err != nil {
+		return 0, err
+	}
+	return user.ID, nil
+}
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	command := os.Args[1]
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	userRef := fs.String("user", "", "username, id or uuid of the account")
+	output := fs.String("o", "", "write the backup to this file instead of stdout")
+	input := fs.String("i", "", "read the backup from this file instead of stdin")
+	mode := fs.String("mode", models.RestoreModeMerge, "restore mode: merge or replace")
+	fs.Parse(os.Args[2:])
+	if *userRef == "" || (command != "export" && command != "restore") {
+		usage()
+	}
+
+	db, err := config.ConnectDB()
+	if err != nil {
+		log.Fatalf("连接数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	userID, err := resolveUser(models.NewUserModel(db), *userRef)
+	if err != nil {
+		log.Fatalf("查找用户失败: %v", err)
+	}
+	backups := models.NewBackupModel(db)
+
+	switch command {
+	case "export":
+		backup, err := backups.Export(userID)
+		if err != nil {
+			log.Fatalf("导出失败: %v", err)
+		}
+		var w io.Writer = os.Stdout
+		if *output != "" {
+			f, err := os.Create(*output)
+			if err != nil {
+				log.Fatalf("创建文件失败: %v", err)
+			}
+			defer f.Close()
+			w = f
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(backup); err != nil {
+			log.Fatalf("写入备份失败: %v", err)
+		}
+		log.Printf("已导出用户 %s：%d 个待办事项", backup.Profile.Username, len(backup.Todos))
+
+	case "restore":
+		var r io.Reader = os.Stdin
+		if *input != "" {
+			f, err := os.Open(*input)
+			if err != nil {
+				log.Fatalf("打开文件失败: %v", err)
+			}
+			defer f.Close()
+			r = f
+		}
+		var backup models.Backup
+		if err := json.NewDecoder(r).Decode(&backup); err != nil {
+			log.Fatalf("读取备份失败: %v", err)
+		}
+		report, err := backups.Restore(userID, &backup, *mode)
+		if err != nil {
+			log.Fatalf("恢复失败: %v", err)
+		}
+		data, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(data))
+	}
+}
@@ -0,0 +1,210 @@
+// benchsteps 对比逐条加载步骤（N+1）与批量加载步骤的查询次数和耗时。
+//
+// 用法：
+//
+//	go run ./cmd/benchsteps -todos 500 -steps 5 -runs 20
+//
+// 数据库连接使用与服务相同的 DB_* 环境变量。工具会创建一个临时用户并写入
+// 测试数据，结束时删除该用户（级联删除其待办事项和步骤）。
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/TodoList/config"
+	"github.com/TodoList/models"
+	"github.com/lib/pq"
+)
+
+// queryCount 通过计数驱动执行的查询次数
+var queryCount int64
+
+// countingDriver 包装 pq 驱动，统计每条发往数据库的语句
+type countingDriver struct {
+	pq.Driver
+}
+
+func (d countingDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &countingConn{conn}, nil
+}
+
+// countingConn 只暴露 database/sql 需要的接口，查询和执行都会计数
+type countingConn struct {
+	driver.Conn
+}
+
+func (c *countingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	atomic.AddInt64(&queryCount, 1)
+	return c.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+}
+
+func (c *countingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	atomic.AddInt64(&queryCount, 1)
+	return c.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+}
+
+func (c *countingConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+}
+
+func init() {
+	sql.Register("postgres-counting", countingDriver{})
+}
+
+// scenario 一种加载方式
+type scenario struct {
+	name string
+	run  func(m *models.TodoModel, userID int) error
+}
+
+var scenarios = []scenario{
+	{"legacy per-todo steps", func(m *models.TodoModel, userID int) error {
+		todos, err := m.GetTodos(userID, false)
+		if err != nil {
+			return err
+		}
+		for i := range todos {
+			if todos[i].Steps, err = m.GetStepsByTodoID(todos[i].ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{"batched steps", func(m *models.TodoModel, userID int) error {
+		_, err := m.GetTodos(userID, true)
+		return err
+	}},
+	{"without steps", func(m *models.TodoModel, userID int) error {
+		_, err := m.GetTodos(userID, false)
+		return err
+	}},
+	{"first page, include=steps", func(m *models.TodoModel, userID int) error {
+		_, _, err := m.ListTodos(userID, models.PageRequest{}, true)
+		return err
+	}},
+}
+
+// seed 创建临时用户，并写入 todos 个待办事项，每个带 steps 个步骤
+func seed(db *sql.DB, todos, steps int) (int, error) {
+	var userID int
+	err := db.QueryRow(
+		`INSERT INTO users (username, password, email, created_at)
+		 VALUES ($1, 'x', 'bench@example.invalid', NOW()) RETURNING id`,
+		fmt.Sprintf("bench_%d", time.Now().UnixNano()),
+	).Scan(&userID)
+	if err != nil {
+		return 0, fmt.Errorf("create bench user failed: %w", err)
+	}
+
+	_, err = db.Exec(
+		`INSERT INTO todos (task, description, priority, user_id, created_at, updated_at)
+		 SELECT 'bench todo ' || n, 'seeded by benchsteps',
+		        (ARRAY['high', 'medium', 'low'])[1 + n % 3], $1, NOW(), NOW()
+		 FROM generate_series(1, $2) AS n`,
+		userID, todos,
+	)
+	if err == nil {
+		_, err = db.Exec(
+			`INSERT INTO steps (todo_id, content, completed)
+			 SELECT t.id, 'step ' || s, s % 2 = 0
+			 FROM todos t, generate_series(1, $2) AS s
+			 WHERE t.user_id = $1`,
+			userID, steps,
+		)
+	}
+	if err != nil {
+		cleanup(db, userID)
+		return 0, fmt.Errorf("seed todos failed: %w", err)
+	}
+	return userID, nil
+}
+
+// cleanup 删除临时用户及其数据
+func cleanup(db *sql.DB, userID int) {
+	if _, err := db.Exec("DELETE FROM users WHERE id = $1", userID); err != nil {
+		log.Printf("删除测试用户 %d 失败: %v", userID, err)
+	}
+}
+
+// percentile 返回已排序耗时的百分位数
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(float64(len(sorted)-1)*p)]
+}
+
+func main() {
+	todos := flag.Int("todos", 500, "number of seeded todos")
+	steps := flag.Int("steps", 5, "number of steps per todo")
+	runs := flag.Int("runs", 20, "runs per scenario")
+	flag.Parse()
+
+	db, err := sql.Open("postgres-counting", config.DefaultDBConfig().ConnectionString())
+	if err != nil {
+		log.Fatalf("连接数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.Ping(); err != nil {
+		log.Fatalf("数据库连接测试失败: %v", err)
+	}
+
+	userID, err := seed(db, *todos, *steps)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// log.Fatal 不会执行 defer，先删除测试数据再退出
+	err = benchmark(models.NewTodoModel(db), userID, *todos, *steps, *runs)
+	cleanup(db, userID)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// benchmark 依次运行每种加载方式并输出查询次数和耗时
+func benchmark(model *models.TodoModel, userID, todos, steps, runs int) error {
+	fmt.Printf("%d todos × %d steps, %d runs\n\n", todos, steps, runs)
+	fmt.Printf("%-28s %10s %12s %12s %12s\n", "scenario", "queries/op", "mean", "p50", "p95")
+
+	for _, s := range scenarios {
+		// 预热一次，建立连接并填充缓存
+		if err := s.run(model, userID); err != nil {
+			log.Printf("%s 执行失败: %v", s.name, err)
+			continue
+		}
+
+		durations := make([]time.Duration, 0, runs)
+		atomic.StoreInt64(&queryCount, 0)
+		var total time.Duration
+		for i := 0; i < runs; i++ {
+			start := time.Now()
+			if err := s.run(model, userID); err != nil {
+				return fmt.Errorf("%s 执行失败: %w", s.name, err)
+			}
+			elapsed := time.Since(start)
+			durations = append(durations, elapsed)
+			total += elapsed
+		}
+		queries := float64(atomic.LoadInt64(&queryCount)) / float64(runs)
+
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		fmt.Printf("%-28s %10.1f %12s %12s %12s\n", s.name, queries,
+			(total / time.Duration(runs)).Round(time.Microsecond),
+			percentile(durations, 0.5).Round(time.Microsecond),
+			percentile(durations, 0.95).Round(time.Microsecond))
+	}
+	return nil
+}
@@ -50,6 +50,23 @@ func main() {
 	migrationFiles := []string{
 		"migrations/add_enhanced_fields.sql",
 		"migrations/add_verification_system.sql",
+		"migrations/add_workflow_states.sql",
+		"migrations/add_custom_fields.sql",
+		"migrations/add_tag_catalog.sql",
+		"migrations/add_categories.sql",
+		"migrations/add_saved_filters.sql",
+		"migrations/add_full_text_search.sql",
+		"migrations/add_todo_versions.sql",
+		"migrations/add_undo_entries.sql",
+		"migrations/add_idempotency_keys.sql",
+		"migrations/add_todo_events.sql",
+		"migrations/add_sync_changes.sql",
+		"migrations/add_public_uuids.sql",
+		"migrations/add_calendar_feeds.sql",
+		"migrations/add_caldav.sql",
+		"migrations/add_import_jobs.sql",
+		"migrations/add_webhooks.sql",
+		"migrations/add_inbound_mail.sql",
 	}
 
 	for _, file := range migrationFiles {
@@ -126,12 +126,815 @@ func InitSchema(db *sql.DB) error {
 		CREATE INDEX IF NOT EXISTS idx_todos_created_at ON todos(created_at);
 		CREATE INDEX IF NOT EXISTS idx_todos_tags ON todos USING GIN(tags);
 		CREATE INDEX IF NOT EXISTS idx_steps_todo_id ON steps(todo_id);
+
+		-- 工作流状态（看板列）
+		CREATE TABLE IF NOT EXISTS workflow_states (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+			key VARCHAR(30) NOT NULL,
+			name VARCHAR(50) NOT NULL,
+			position INTEGER NOT NULL DEFAULT 0,
+			counts_as_done BOOLEAN NOT NULL DEFAULT FALSE,
+			wip_limit INTEGER,
+			color VARCHAR(20),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (user_id, key)
+		);
+
+		ALTER TABLE todos
+		ADD COLUMN IF NOT EXISTS status VARCHAR(30);
+
+		ALTER TABLE todos
+		ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMP;
+
+		CREATE TABLE IF NOT EXISTS todo_status_transitions (
+			id SERIAL PRIMARY KEY,
+			todo_id INTEGER REFERENCES todos(id) ON DELETE CASCADE,
+			from_status VARCHAR(30),
+			to_status VARCHAR(30) NOT NULL,
+			transitioned_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_todos_status ON todos(user_id, status);
+		CREATE INDEX IF NOT EXISTS idx_todo_status_transitions_todo_id ON todo_status_transitions(todo_id);
+
+		-- 用户自定义字段
+		CREATE TABLE IF NOT EXISTS custom_field_definitions (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+			key VARCHAR(30) NOT NULL,
+			name VARCHAR(50) NOT NULL,
+			type VARCHAR(20) NOT NULL,
+			options JSONB DEFAULT '[]'::jsonb,
+			required BOOLEAN NOT NULL DEFAULT FALSE,
+			position INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (user_id, key)
+		);
+
+		ALTER TABLE todos
+		ADD COLUMN IF NOT EXISTS custom_fields JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+		CREATE INDEX IF NOT EXISTS idx_todos_custom_fields ON todos USING GIN(custom_fields);
+
+		-- 标签目录
+		CREATE TABLE IF NOT EXISTS tags (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+			name VARCHAR(30) NOT NULL,
+			color VARCHAR(20),
+			description TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (user_id, name)
+		);
+
+		-- 把已有待办事项中使用的标签登记到标签目录
+		INSERT INTO tags (user_id, name)
+		SELECT DISTINCT todos.user_id, t.name
+		FROM todos, jsonb_array_elements_text(
+			CASE WHEN jsonb_typeof(todos.tags) = 'array' THEN todos.tags ELSE '[]'::jsonb END
+		) AS t(name)
+		WHERE todos.user_id IS NOT NULL AND length(t.name) BETWEEN 1 AND 30
+		ON CONFLICT (user_id, name) DO NOTHING;
+
+		-- 用户管理的分类
+		CREATE TABLE IF NOT EXISTS categories (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+			name VARCHAR(20) NOT NULL,
+			icon VARCHAR(20),
+			color VARCHAR(20),
+			default_priority VARCHAR(10),
+			position INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (user_id, name)
+		);
+
+		-- 为还没有分类的用户创建默认分类（与 models.defaultCategories 保持一致）
+		INSERT INTO categories (user_id, name, icon, color, default_priority, position)
+		SELECT users.id, d.name, d.icon, d.color, 'medium', d.position
+		FROM users
+		CROSS JOIN (VALUES
+			('work', '💼', '#1890ff', 0),
+			('personal', '🏠', '#52c41a', 1),
+			('study', '📚', '#722ed1', 2),
+			('health', '❤️', '#f5222d', 3)
+		) AS d(name, icon, color, position)
+		WHERE NOT EXISTS (SELECT 1 FROM categories WHERE categories.user_id = users.id)
+		ON CONFLICT (user_id, name) DO NOTHING;
+
+		-- 登记已有待办事项中使用的其他分类
+		INSERT INTO categories (user_id, name, position)
+		SELECT DISTINCT user_id, category, 100
+		FROM todos
+		WHERE user_id IS NOT NULL AND category IS NOT NULL AND category <> ''
+		ON CONFLICT (user_id, name) DO NOTHING;
+
+		-- 保存的过滤器（智能列表）
+		CREATE TABLE IF NOT EXISTS saved_filters (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+			name VARCHAR(50) NOT NULL,
+			icon VARCHAR(20),
+			criteria JSONB NOT NULL DEFAULT '{}',
+			pinned BOOLEAN NOT NULL DEFAULT FALSE,
+			position INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (user_id, name)
+		);
+
+		-- 撤销记录：保存一次修改前的待办事项快照和修改后的版本号
+		CREATE TABLE IF NOT EXISTS undo_entries (
+			id SERIAL PRIMARY KEY,
+			token VARCHAR(64) NOT NULL UNIQUE,
+			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+			action VARCHAR(30) NOT NULL,
+			items JSONB NOT NULL DEFAULT '[]',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			expires_at TIMESTAMP NOT NULL,
+			used_at TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_undo_entries_user_expires ON undo_entries(user_id, expires_at);
+
+		-- 幂等键：保存请求摘要和响应，重试时重放响应
+		CREATE TABLE IF NOT EXISTS idempotency_keys (
+			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+			idempotency_key VARCHAR(255) NOT NULL,
+			request_hash CHAR(64) NOT NULL,
+			status_code INTEGER,
+			response_headers JSONB,
+			response_body BYTEA,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			expires_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (user_id, idempotency_key)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires ON idempotency_keys(expires_at);
+
+		-- 变更事件日志：短期保存，供 SSE 断线重连（Last-Event-ID）时补发。
+		-- user_id 不设外键：删除用户时级联删除待办事项仍会写入事件
+		CREATE TABLE IF NOT EXISTS todo_events (
+			id BIGSERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			type VARCHAR(30) NOT NULL,
+			todo_id INTEGER NOT NULL,
+			step_id INTEGER,
+			version INTEGER,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_todo_events_user_id ON todo_events(user_id, id);
+		CREATE INDEX IF NOT EXISTS idx_todo_events_created_at ON todo_events(created_at);
+
+		-- 离线客户端生成的ID，同步时用于幂等地创建待办事项和步骤
+		ALTER TABLE todos ADD COLUMN IF NOT EXISTS client_id VARCHAR(64);
+		ALTER TABLE steps ADD COLUMN IF NOT EXISTS client_id VARCHAR(64);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_todos_client_id ON todos(user_id, client_id) WHERE client_id IS NOT NULL;
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_steps_client_id ON steps(todo_id, client_id) WHERE client_id IS NOT NULL;
+
+		-- 同步序列：每个用户一个单调递增的变更序号
+		CREATE TABLE IF NOT EXISTS sync_sequences (
+			user_id INTEGER PRIMARY KEY,
+			last_seq BIGINT NOT NULL DEFAULT 0
+		);
+
+		-- 同步变更：每个待办事项、步骤和标签最近一次变更的序号，删除时保留为墓碑
+		CREATE TABLE IF NOT EXISTS sync_changes (
+			user_id INTEGER NOT NULL,
+			entity VARCHAR(10) NOT NULL,
+			entity_id INTEGER NOT NULL,
+			seq BIGINT NOT NULL,
+			deleted BOOLEAN NOT NULL DEFAULT FALSE,
+			PRIMARY KEY (user_id, entity, entity_id)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_sync_changes_seq ON sync_changes(user_id, seq);
+
+		-- 日历订阅：每个用户一个私密的 .ics 订阅令牌，轮换后旧链接失效
+		CREATE TABLE IF NOT EXISTS calendar_feeds (
+			user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			token VARCHAR(64) NOT NULL UNIQUE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+
+		-- 应用专用密码：CalDAV 等不支持 JWT 的客户端使用，只保存 SHA-256 摘要
+		CREATE TABLE IF NOT EXISTS app_passwords (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name VARCHAR(50) NOT NULL,
+			password_hash CHAR(64) NOT NULL UNIQUE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			last_used_at TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_app_passwords_user_id ON app_passwords(user_id);
+
+		-- CalDAV 客户端创建的对象：客户端选择的资源名和 iCalendar UID 与默认值（<uuid>.ics、<uuid>）不同时记录映射
+		CREATE TABLE IF NOT EXISTS caldav_objects (
+			todo_id INTEGER PRIMARY KEY REFERENCES todos(id) ON DELETE CASCADE,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name VARCHAR(255) NOT NULL,
+			uid VARCHAR(255) NOT NULL,
+			UNIQUE (user_id, name)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_caldav_objects_uid ON caldav_objects(user_id, uid);
+
+		-- 导入任务：从 Todoist、Microsoft To Do、todo.txt 异步导入的进度和报告
+		CREATE TABLE IF NOT EXISTS import_jobs (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			source VARCHAR(20) NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			total INTEGER NOT NULL DEFAULT 0,
+			processed INTEGER NOT NULL DEFAULT 0,
+			created INTEGER NOT NULL DEFAULT 0,
+			skipped INTEGER NOT NULL DEFAULT 0,
+			failed INTEGER NOT NULL DEFAULT 0,
+			error TEXT,
+			undo_token VARCHAR(64),
+			report JSONB,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			started_at TIMESTAMP,
+			finished_at TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_import_jobs_user_id ON import_jobs(user_id, id);
+
+		-- Webhook 订阅：user_id 为空表示管理员配置的、接收所有用户事件的订阅；events 为空表示所有事件
+		CREATE TABLE IF NOT EXISTS webhooks (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+			url TEXT NOT NULL,
+			secret VARCHAR(64) NOT NULL,
+			events TEXT[] NOT NULL DEFAULT '{}',
+			description VARCHAR(100) NOT NULL DEFAULT '',
+			enabled BOOLEAN NOT NULL DEFAULT TRUE,
+			consecutive_failures INTEGER NOT NULL DEFAULT 0,
+			disabled_reason TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_webhooks_user_id ON webhooks(user_id);
+
+		-- Webhook 投递队列，同时作为投递日志：pending 的投递按 next_attempt_at 重试
+		CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id BIGSERIAL PRIMARY KEY,
+			webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+			event_type VARCHAR(30) NOT NULL,
+			payload JSONB NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			locked_until TIMESTAMP,
+			response_code INTEGER,
+			response_body TEXT,
+			error TEXT,
+			duration_ms INTEGER,
+			redelivery_of BIGINT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			last_attempt_at TIMESTAMP,
+			delivered_at TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id, id);
+		CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_pending ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+
+		-- 已经发送过 todo.overdue 事件的待办事项和截止时间，截止时间修改后再次过期时重新发送
+		CREATE TABLE IF NOT EXISTS webhook_overdue_notices (
+			todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+			due_date TIMESTAMP NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (todo_id, due_date)
+		);
+
+		-- 收件地址：发往 <token>@域名 的邮件会成为该用户的待办事项，令牌就是凭据
+		CREATE TABLE IF NOT EXISTS inbound_mail_addresses (
+			user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			token VARCHAR(64) NOT NULL UNIQUE,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+
+		-- 待办事项的附件，目前来自邮件
+		CREATE TABLE IF NOT EXISTS todo_attachments (
+			id SERIAL PRIMARY KEY,
+			todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+			filename VARCHAR(255) NOT NULL,
+			content_type VARCHAR(255) NOT NULL,
+			size INTEGER NOT NULL,
+			data BYTEA NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_todo_attachments_todo_id ON todo_attachments(todo_id);
 	`)
 
 	if err != nil {
 		return fmt.Errorf("failed to create tables: %w", err)
 	}
 
+	// 触发器：保持 status、done、completed_at 一致，并记录状态流转
+	_, err = db.Exec(`
+		CREATE OR REPLACE FUNCTION sync_todo_status() RETURNS trigger AS $$
+		DECLARE
+			state_done BOOLEAN;
+			status_set BOOLEAN;
+			done_changed BOOLEAN;
+		BEGIN
+			IF TG_OP = 'INSERT' THEN
+				status_set := NEW.status IS NOT NULL;
+				done_changed := FALSE;
+			ELSE
+				status_set := NEW.status IS NOT NULL AND NEW.status IS DISTINCT FROM OLD.status;
+				done_changed := NEW.done IS DISTINCT FROM OLD.done;
+			END IF;
+
+			-- 显式修改了状态：完成标记跟随状态
+			IF status_set THEN
+				SELECT counts_as_done INTO state_done
+				FROM workflow_states WHERE user_id = NEW.user_id AND key = NEW.status;
+				IF FOUND THEN
+					NEW.done := state_done;
+				END IF;
+			-- 只修改了完成标记（或没有状态）：状态跟随完成标记
+			ELSIF NEW.status IS NULL OR (done_changed AND NOT EXISTS (
+				SELECT 1 FROM workflow_states
+				WHERE user_id = NEW.user_id AND key = NEW.status AND counts_as_done = NEW.done
+			)) THEN
+				NEW.status := (
+					SELECT key FROM workflow_states
+					WHERE user_id = NEW.user_id AND counts_as_done = NEW.done
+					ORDER BY position, id LIMIT 1
+				);
+				IF NEW.status IS NULL THEN
+					NEW.status := CASE WHEN NEW.done THEN 'done' ELSE 'backlog' END;
+				END IF;
+			END IF;
+
+			IF TG_OP = 'INSERT' THEN
+				NEW.status_changed_at := COALESCE(NEW.status_changed_at, NOW());
+				IF NEW.done THEN
+					NEW.completed_at := COALESCE(NEW.completed_at, NOW());
+				ELSE
+					NEW.completed_at := NULL;
+				END IF;
+			ELSE
+				IF NEW.status IS DISTINCT FROM OLD.status THEN
+					NEW.status_changed_at := NOW();
+				END IF;
+				IF NEW.done AND NOT OLD.done THEN
+					NEW.completed_at := NOW();
+				ELSIF NOT NEW.done THEN
+					NEW.completed_at := NULL;
+				END IF;
+			END IF;
+
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		CREATE OR REPLACE FUNCTION record_todo_status_transition() RETURNS trigger AS $$
+		BEGIN
+			IF TG_OP = 'INSERT' THEN
+				INSERT INTO todo_status_transitions (todo_id, from_status, to_status, transitioned_at)
+				VALUES (NEW.id, NULL, NEW.status, NEW.status_changed_at);
+			ELSIF NEW.status IS DISTINCT FROM OLD.status THEN
+				INSERT INTO todo_status_transitions (todo_id, from_status, to_status, transitioned_at)
+				VALUES (NEW.id, OLD.status, NEW.status, NEW.status_changed_at);
+			END IF;
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		DROP TRIGGER IF EXISTS trg_todos_sync_status ON todos;
+		CREATE TRIGGER trg_todos_sync_status
+			BEFORE INSERT OR UPDATE ON todos
+			FOR EACH ROW EXECUTE FUNCTION sync_todo_status();
+
+		DROP TRIGGER IF EXISTS trg_todos_status_transition ON todos;
+		CREATE TRIGGER trg_todos_status_transition
+			AFTER INSERT OR UPDATE OF status ON todos
+			FOR EACH ROW EXECUTE FUNCTION record_todo_status_transition();
+
+		-- 为旧数据回填状态
+		UPDATE todos SET status = CASE WHEN done THEN 'done' ELSE 'backlog' END
+		WHERE status IS NULL;
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create status triggers: %w", err)
+	}
+
+	// 全文搜索：维护 todos.search_vector（任务、标签、描述、步骤），中日韩文字按一元/二元n-gram切分
+	_, err = db.Exec(`
+		CREATE OR REPLACE FUNCTION cjk_ngrams(input TEXT) RETURNS TEXT AS $$
+		DECLARE
+			run TEXT;
+			grams TEXT[] := '{}';
+			i INTEGER;
+		BEGIN
+			FOR run IN
+				SELECT (regexp_matches(COALESCE(input, ''), '[\u3040-\u30ff\u3400-\u4dbf\u4e00-\u9fff\uac00-\ud7af]+', 'g'))[1]
+			LOOP
+				FOR i IN 1..char_length(run) LOOP
+					grams := grams || substr(run, i, 1);
+					IF i < char_length(run) THEN
+						grams := grams || substr(run, i, 2);
+					END IF;
+				END LOOP;
+			END LOOP;
+			RETURN array_to_string(grams, ' ');
+		END;
+		$$ LANGUAGE plpgsql IMMUTABLE;
+
+		CREATE OR REPLACE FUNCTION search_document(input TEXT) RETURNS tsvector AS $$
+			SELECT to_tsvector('simple', COALESCE(input, '') || ' ' || cjk_ngrams(input));
+		$$ LANGUAGE sql IMMUTABLE;
+
+		CREATE OR REPLACE FUNCTION todo_search_vector(p_id INTEGER, p_task TEXT, p_description TEXT, p_tags JSONB)
+		RETURNS tsvector AS $$
+		DECLARE
+			steps_text TEXT;
+			tags_text TEXT;
+		BEGIN
+			SELECT string_agg(content, ' ') INTO steps_text FROM steps WHERE todo_id = p_id;
+			IF jsonb_typeof(p_tags) = 'array' THEN
+				SELECT string_agg(value, ' ') INTO tags_text FROM jsonb_array_elements_text(p_tags);
+			END IF;
+			RETURN setweight(search_document(p_task), 'A')
+				|| setweight(search_document(tags_text), 'B')
+				|| setweight(search_document(p_description), 'C')
+				|| setweight(search_document(steps_text), 'D');
+		END;
+		$$ LANGUAGE plpgsql STABLE;
+
+		CREATE OR REPLACE FUNCTION update_todo_search_vector() RETURNS trigger AS $$
+		BEGIN
+			NEW.search_vector := todo_search_vector(NEW.id, NEW.task, NEW.description, NEW.tags);
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		-- 步骤变化时把所属待办事项的 search_vector 置空，由 todos 上的触发器重新计算
+		CREATE OR REPLACE FUNCTION refresh_todo_search_vector() RETURNS trigger AS $$
+		BEGIN
+			IF TG_OP = 'INSERT' THEN
+				UPDATE todos SET search_vector = NULL WHERE id = NEW.todo_id;
+			ELSIF TG_OP = 'DELETE' THEN
+				UPDATE todos SET search_vector = NULL WHERE id = OLD.todo_id;
+			ELSE
+				UPDATE todos SET search_vector = NULL WHERE id IN (OLD.todo_id, NEW.todo_id);
+			END IF;
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		ALTER TABLE todos ADD COLUMN IF NOT EXISTS search_vector tsvector;
+		CREATE INDEX IF NOT EXISTS idx_todos_search_vector ON todos USING GIN (search_vector);
+		CREATE INDEX IF NOT EXISTS idx_steps_search ON steps USING GIN (search_document(content));
+
+		DROP TRIGGER IF EXISTS trg_todos_search_vector ON todos;
+		CREATE TRIGGER trg_todos_search_vector
+			BEFORE INSERT OR UPDATE OF task, description, tags, search_vector ON todos
+			FOR EACH ROW EXECUTE FUNCTION update_todo_search_vector();
+
+		DROP TRIGGER IF EXISTS trg_steps_search_vector ON steps;
+		CREATE TRIGGER trg_steps_search_vector
+			AFTER INSERT OR UPDATE OF content, todo_id OR DELETE ON steps
+			FOR EACH ROW EXECUTE FUNCTION refresh_todo_search_vector();
+
+		-- 为旧数据回填搜索向量
+		UPDATE todos SET search_vector = NULL WHERE search_vector IS NULL;
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create search triggers: %w", err)
+	}
+
+	// 乐观并发控制：todos.version 在每次写入时递增，用于 ETag 和 If-Match
+	_, err = db.Exec(`
+		ALTER TABLE todos ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
+		-- 除 search_vector 外任何列变化都递增版本号；调用方显式递增时保持不变
+		CREATE OR REPLACE FUNCTION bump_todo_version() RETURNS trigger AS $$
+		BEGIN
+			IF (to_jsonb(NEW) - 'search_vector' - 'version') IS DISTINCT FROM (to_jsonb(OLD) - 'search_vector' - 'version') THEN
+				NEW.version := OLD.version + 1;
+			END IF;
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		-- 步骤属于待办事项的表示，步骤变化时递增所属待办事项的版本号
+		CREATE OR REPLACE FUNCTION touch_todo_version() RETURNS trigger AS $$
+		BEGIN
+			IF TG_OP = 'INSERT' THEN
+				UPDATE todos SET version = version + 1 WHERE id = NEW.todo_id;
+			ELSIF TG_OP = 'DELETE' THEN
+				UPDATE todos SET version = version + 1 WHERE id = OLD.todo_id;
+			ELSE
+				UPDATE todos SET version = version + 1 WHERE id IN (OLD.todo_id, NEW.todo_id);
+			END IF;
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		DROP TRIGGER IF EXISTS trg_todos_version ON todos;
+		CREATE TRIGGER trg_todos_version
+			BEFORE UPDATE ON todos
+			FOR EACH ROW EXECUTE FUNCTION bump_todo_version();
+
+		DROP TRIGGER IF EXISTS trg_steps_todo_version ON steps;
+		CREATE TRIGGER trg_steps_todo_version
+			AFTER INSERT OR UPDATE OR DELETE ON steps
+			FOR EACH ROW EXECUTE FUNCTION touch_todo_version();
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create version triggers: %w", err)
+	}
+
+	// 触发器：待办事项和步骤的每次写入都记录到事件日志，并通过 NOTIFY 通知所有实例
+	_, err = db.Exec(`
+		CREATE OR REPLACE FUNCTION notify_todo_event(
+			owner_id INTEGER, event_type TEXT, event_todo_id INTEGER, event_step_id INTEGER, event_version INTEGER
+		) RETURNS void AS $$
+		DECLARE
+			logged todo_events%ROWTYPE;
+		BEGIN
+			INSERT INTO todo_events (user_id, type, todo_id, step_id, version)
+			VALUES (owner_id, event_type, event_todo_id, event_step_id, event_version)
+			RETURNING * INTO logged;
+
+			-- 与其他 TIMESTAMP 列一样按 UTC 输出
+			PERFORM pg_notify('todo_events', json_build_object(
+				'id', logged.id,
+				'userId', logged.user_id,
+				'type', logged.type,
+				'todoId', logged.todo_id,
+				'stepId', logged.step_id,
+				'version', logged.version,
+				'createdAt', to_char(logged.created_at, 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"')
+			)::text);
+		END;
+		$$ LANGUAGE plpgsql;
+
+		CREATE OR REPLACE FUNCTION publish_todo_event() RETURNS trigger AS $$
+		BEGIN
+			IF TG_OP = 'DELETE' THEN
+				IF OLD.user_id IS NOT NULL THEN
+					PERFORM notify_todo_event(OLD.user_id, 'todo.deleted', OLD.id, NULL, OLD.version);
+				END IF;
+			-- 只有 search_vector 变化时版本号不变，不发布事件
+			ELSIF NEW.user_id IS NOT NULL AND (TG_OP = 'INSERT' OR NEW.version <> OLD.version) THEN
+				PERFORM notify_todo_event(
+					NEW.user_id,
+					CASE TG_OP WHEN 'INSERT' THEN 'todo.created' ELSE 'todo.updated' END,
+					NEW.id, NULL, NEW.version
+				);
+			END IF;
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		CREATE OR REPLACE FUNCTION publish_step_event() RETURNS trigger AS $$
+		DECLARE
+			step_todo_id INTEGER;
+			changed_step_id INTEGER;
+			owner_id INTEGER;
+		BEGIN
+			IF TG_OP = 'DELETE' THEN
+				step_todo_id := OLD.todo_id;
+				changed_step_id := OLD.id;
+			ELSE
+				step_todo_id := NEW.todo_id;
+				changed_step_id := NEW.id;
+			END IF;
+
+			-- 随待办事项级联删除的步骤找不到所属待办事项，由 todo.deleted 事件覆盖
+			SELECT user_id INTO owner_id FROM todos WHERE id = step_todo_id;
+			IF owner_id IS NOT NULL THEN
+				PERFORM notify_todo_event(
+					owner_id,
+					'step.' || CASE TG_OP WHEN 'INSERT' THEN 'created' WHEN 'UPDATE' THEN 'updated' ELSE 'deleted' END,
+					step_todo_id, changed_step_id, NULL
+				);
+			END IF;
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		DROP TRIGGER IF EXISTS trg_todos_events ON todos;
+		CREATE TRIGGER trg_todos_events
+			AFTER INSERT OR UPDATE OR DELETE ON todos
+			FOR EACH ROW EXECUTE FUNCTION publish_todo_event();
+
+		DROP TRIGGER IF EXISTS trg_steps_events ON steps;
+		CREATE TRIGGER trg_steps_events
+			AFTER INSERT OR UPDATE OR DELETE ON steps
+			FOR EACH ROW EXECUTE FUNCTION publish_step_event();
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create event triggers: %w", err)
+	}
+
+	// 触发器：待办事项、步骤和标签的每次写入都分配用户的下一个同步序号
+	_, err = db.Exec(`
+		-- 同一用户的写入在 sync_sequences 的行锁上串行化，序号顺序与提交顺序一致
+		CREATE OR REPLACE FUNCTION record_sync_change(
+			owner_id INTEGER, change_entity TEXT, change_entity_id INTEGER, is_deleted BOOLEAN
+		) RETURNS void AS $$
+		DECLARE
+			next_seq BIGINT;
+		BEGIN
+			INSERT INTO sync_sequences (user_id, last_seq) VALUES (owner_id, 1)
+			ON CONFLICT (user_id) DO UPDATE SET last_seq = sync_sequences.last_seq + 1
+			RETURNING last_seq INTO next_seq;
+
+			INSERT INTO sync_changes (user_id, entity, entity_id, seq, deleted)
+			VALUES (owner_id, change_entity, change_entity_id, next_seq, is_deleted)
+			ON CONFLICT (user_id, entity, entity_id)
+			DO UPDATE SET seq = EXCLUDED.seq, deleted = EXCLUDED.deleted;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		CREATE OR REPLACE FUNCTION sync_todo_change() RETURNS trigger AS $$
+		BEGIN
+			IF TG_OP = 'DELETE' THEN
+				IF OLD.user_id IS NOT NULL THEN
+					PERFORM record_sync_change(OLD.user_id, 'todo', OLD.id, TRUE);
+				END IF;
+			-- 只有 search_vector 变化时版本号不变，不需要同步
+			ELSIF NEW.user_id IS NOT NULL AND (TG_OP = 'INSERT' OR NEW.version <> OLD.version) THEN
+				PERFORM record_sync_change(NEW.user_id, 'todo', NEW.id, FALSE);
+			END IF;
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		CREATE OR REPLACE FUNCTION sync_step_change() RETURNS trigger AS $$
+		DECLARE
+			step_todo_id INTEGER;
+			changed_step_id INTEGER;
+			owner_id INTEGER;
+		BEGIN
+			IF TG_OP = 'DELETE' THEN
+				step_todo_id := OLD.todo_id;
+				changed_step_id := OLD.id;
+			ELSE
+				step_todo_id := NEW.todo_id;
+				changed_step_id := NEW.id;
+			END IF;
+
+			-- 随待办事项级联删除的步骤找不到所属待办事项，客户端按待办事项的墓碑一起删除
+			SELECT user_id INTO owner_id FROM todos WHERE id = step_todo_id;
+			IF owner_id IS NOT NULL THEN
+				PERFORM record_sync_change(owner_id, 'step', changed_step_id, TG_OP = 'DELETE');
+			END IF;
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		CREATE OR REPLACE FUNCTION sync_tag_change() RETURNS trigger AS $$
+		BEGIN
+			IF TG_OP = 'DELETE' THEN
+				IF OLD.user_id IS NOT NULL THEN
+					PERFORM record_sync_change(OLD.user_id, 'tag', OLD.id, TRUE);
+				END IF;
+			ELSIF NEW.user_id IS NOT NULL THEN
+				PERFORM record_sync_change(NEW.user_id, 'tag', NEW.id, FALSE);
+			END IF;
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		DROP TRIGGER IF EXISTS trg_todos_sync ON todos;
+		CREATE TRIGGER trg_todos_sync
+			AFTER INSERT OR UPDATE OR DELETE ON todos
+			FOR EACH ROW EXECUTE FUNCTION sync_todo_change();
+
+		DROP TRIGGER IF EXISTS trg_steps_sync ON steps;
+		CREATE TRIGGER trg_steps_sync
+			AFTER INSERT OR UPDATE OR DELETE ON steps
+			FOR EACH ROW EXECUTE FUNCTION sync_step_change();
+
+		DROP TRIGGER IF EXISTS trg_tags_sync ON tags;
+		CREATE TRIGGER trg_tags_sync
+			AFTER INSERT OR UPDATE OR DELETE ON tags
+			FOR EACH ROW EXECUTE FUNCTION sync_tag_change();
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create sync triggers: %w", err)
+	}
+
+	// 公开的 UUID 标识：整数ID可以被枚举，也无法在离线时生成
+	_, err = db.Exec(`
+		-- UUIDv7（RFC 9562）：前 48 位是毫秒时间戳，其余是随机数，按生成时间有序
+		CREATE OR REPLACE FUNCTION uuid_generate_v7() RETURNS uuid AS $$
+		DECLARE
+			bytes BYTEA;
+		BEGIN
+			bytes := substring(int8send(floor(extract(epoch FROM clock_timestamp()) * 1000)::bigint) FROM 3)
+				|| substring(uuid_send(gen_random_uuid()) FROM 7);
+			-- 版本号 7；变体位沿用 gen_random_uuid 生成的 10
+			bytes := set_byte(bytes, 6, (get_byte(bytes, 6) & 15) | 112);
+			RETURN encode(bytes, 'hex')::uuid;
+		END;
+		$$ LANGUAGE plpgsql VOLATILE;
+
+		-- 添加列时按默认值为已有的行逐行生成 UUID。表重写不触发行级触发器，
+		-- 已有待办事项的版本号不变，客户端缓存的 ETag 和整数ID继续有效
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS uuid UUID NOT NULL DEFAULT uuid_generate_v7();
+		ALTER TABLE todos ADD COLUMN IF NOT EXISTS uuid UUID NOT NULL DEFAULT uuid_generate_v7();
+		ALTER TABLE steps ADD COLUMN IF NOT EXISTS uuid UUID NOT NULL DEFAULT uuid_generate_v7();
+
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_users_uuid ON users(uuid);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_todos_uuid ON todos(uuid);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_steps_uuid ON steps(uuid);
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to add public uuids: %w", err)
+	}
+
+	// Webhook 触发器：待办事项的写入在同一个事务中加入投递队列，事务回滚时不会投递
+	_, err = db.Exec(`
+		-- 待办事项在 webhook 负载中的表示，字段名与 API 一致，时间按 UTC 输出
+		CREATE OR REPLACE FUNCTION webhook_todo_json(t todos) RETURNS jsonb AS $$
+			SELECT jsonb_build_object(
+				'id', t.id,
+				'uuid', t.uuid,
+				'task', t.task,
+				'description', COALESCE(t.description, ''),
+				'done', COALESCE(t.done, FALSE),
+				'priority', t.priority,
+				'category', t.category,
+				'status', t.status,
+				'dueDate', to_char(t.due_date, 'YYYY-MM-DD"T"HH24:MI:SS"Z"'),
+				'tags', COALESCE(t.tags, '[]'::jsonb),
+				'userId', t.user_id,
+				'version', t.version,
+				'createdAt', to_char(t.created_at, 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"'),
+				'updatedAt', to_char(t.updated_at, 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"'),
+				'completedAt', to_char(t.completed_at, 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"')
+			);
+		$$ LANGUAGE sql STABLE;
+
+		-- 为订阅了该事件的 webhook（用户自己的和管理员的全局订阅）各加入一条投递
+		CREATE OR REPLACE FUNCTION enqueue_webhook_event(owner_id INTEGER, kind TEXT, todo JSONB) RETURNS void AS $$
+		DECLARE
+			payload JSONB;
+		BEGIN
+			IF NOT EXISTS (
+				SELECT 1 FROM webhooks WHERE enabled AND (user_id = owner_id OR user_id IS NULL)
+			) THEN
+				RETURN;
+			END IF;
+
+			payload := jsonb_build_object(
+				'id', uuid_generate_v7(),
+				'type', kind,
+				'createdAt', to_char(NOW() AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"'),
+				'userId', owner_id,
+				'todo', todo
+			);
+			INSERT INTO webhook_deliveries (webhook_id, event_type, payload)
+			SELECT id, kind, payload FROM webhooks
+			WHERE enabled AND (user_id = owner_id OR user_id IS NULL)
+			  AND (cardinality(events) = 0 OR kind = ANY(events));
+		END;
+		$$ LANGUAGE plpgsql;
+
+		CREATE OR REPLACE FUNCTION enqueue_todo_webhooks() RETURNS trigger AS $$
+		BEGIN
+			IF TG_OP = 'DELETE' THEN
+				IF OLD.user_id IS NOT NULL THEN
+					PERFORM enqueue_webhook_event(OLD.user_id, 'todo.deleted', webhook_todo_json(OLD));
+				END IF;
+			ELSIF NEW.user_id IS NOT NULL THEN
+				IF TG_OP = 'INSERT' THEN
+					PERFORM enqueue_webhook_event(NEW.user_id, 'todo.created', webhook_todo_json(NEW));
+				-- 只有 search_vector 变化时版本号不变，不发送事件
+				ELSIF NEW.version <> OLD.version THEN
+					PERFORM enqueue_webhook_event(NEW.user_id, 'todo.updated', webhook_todo_json(NEW));
+					IF NEW.done AND NOT COALESCE(OLD.done, FALSE) THEN
+						PERFORM enqueue_webhook_event(NEW.user_id, 'todo.completed', webhook_todo_json(NEW));
+					END IF;
+				END IF;
+			END IF;
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		DROP TRIGGER IF EXISTS trg_todos_webhooks ON todos;
+		CREATE TRIGGER trg_todos_webhooks
+			AFTER INSERT OR UPDATE OR DELETE ON todos
+			FOR EACH ROW EXECUTE FUNCTION enqueue_todo_webhooks();
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook triggers: %w", err)
+	}
+
 	return nil
 }
 
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/TodoList/models"
+)
+
+// AppPasswordHandler 处理应用专用密码（CalDAV 等不支持 JWT 的客户端使用）相关的HTTP请求
+type AppPasswordHandler struct {
+	Model *models.AppPasswordModel
+}
+
+// NewAppPasswordHandler 创建一个新的AppPasswordHandler实例
+func NewAppPasswordHandler(model *models.AppPasswordModel) *AppPasswordHandler {
+	return &AppPasswordHandler{Model: model}
+}
+
+// CreateAppPasswordRequest 创建应用专用密码请求
+type CreateAppPasswordRequest struct {
+	Name string `json:"name"` // 用于区分设备，例如 "iPhone"
+}
+
+// GetAppPasswords 获取当前用户的应用专用密码（不包含密码本身）
+func (h *AppPasswordHandler) GetAppPasswords(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	passwords, err := h.Model.List(userID)
+	if err != nil {
+		log.Printf("获取应用专用密码失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(passwords)
+}
+
+// CreateAppPassword 创建应用专用密码，响应中的密码只返回这一次
+func (h *AppPasswordHandler) CreateAppPassword(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req CreateAppPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	password, err := h.Model.Create(userID, req.Name)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidAppPasswordName) {
+			writeJSONError(w, http.StatusBadRequest, "Name is required and must be at most 50 characters", "name")
+			return
+		}
+		log.Printf("创建应用专用密码失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(password)
+}
+
+// DeleteAppPassword 撤销应用专用密码
+func (h *AppPasswordHandler) DeleteAppPassword(w http.ResponseWriter, r *http.Request, id int) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.Model.Delete(userID, id); err != nil {
+		if errors.Is(err, models.ErrAppPasswordNotFound) {
+			http.Error(w, "App password not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("删除应用专用密码失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
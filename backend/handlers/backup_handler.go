@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/TodoList/models"
+)
+
+// maxBackupBodySize 恢复时备份文件的最大大小
+const maxBackupBodySize = 50 << 20
+
+// BackupHandler 处理账户备份和恢复请求
+type BackupHandler struct {
+	Model *models.BackupModel
+}
+
+// NewBackupHandler 创建一个新的BackupHandler实例
+func NewBackupHandler(model *models.BackupModel) *BackupHandler {
+	return &BackupHandler{Model: model}
+}
+
+// ExportAccount 导出当前用户的账户备份
+func (h *BackupHandler) ExportAccount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	h.Export(w, r, userID)
+}
+
+// RestoreAccount 把备份恢复到当前用户的账户
+func (h *BackupHandler) RestoreAccount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	h.Restore(w, r, userID)
+}
+
+// Export 以 JSON 文件的形式导出指定用户的账户备份（管理员可以导出任意用户）
+func (h *BackupHandler) Export(w http.ResponseWriter, r *http.Request, userID int) {
+	backup, err := h.Model.Export(userID)
+	if err != nil {
+		if errors.Is(err, models.ErrUserNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("导出账户备份失败: %v", err)
+		http.Error(w, "Failed to export backup", http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("todolist-backup-%s-%s.json", backup.Profile.UUID, backup.ExportedAt.Format("20060102"))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	json.NewEncoder(w).Encode(backup)
+}
+
+// Restore 把请求体中的备份恢复到指定用户的账户。mode=merge（默认）保留已有数据并跳过重复项，
+// mode=replace 先清空账户中的待办事项和设置。
+func (h *BackupHandler) Restore(w http.ResponseWriter, r *http.Request, userID int) {
+	var backup models.Backup
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBackupBodySize))
+	if err := decoder.Decode(&backup); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, "Backup is too large", "")
+			return
+		}
+		writeJSONError(w, http.StatusBadRequest, "Invalid backup file", "")
+		return
+	}
+
+	start := time.Now()
+	report, err := h.Model.Restore(userID, &backup, getQueryParam(r, "mode", models.RestoreModeMerge))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidRestoreMode):
+			writeJSONError(w, http.StatusBadRequest, "mode must be merge or replace", "mode")
+		case errors.Is(err, models.ErrInvalidBackup), errors.Is(err, models.ErrUnsupportedBackupVersion):
+			writeJSONError(w, http.StatusBadRequest, err.Error(), "")
+		case errors.Is(err, models.ErrUserNotFound):
+			writeJSONError(w, http.StatusNotFound, "User not found", "")
+		default:
+			log.Printf("恢复账户备份失败: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to restore backup", "")
+		}
+		return
+	}
+	log.Printf("用户 %d 恢复备份（%s）：%d 个待办事项，耗时 %v", userID, report.Mode, report.Todos.Created, time.Since(start))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,914 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/TodoList/models"
+)
+
+// CalDAV 的路径：/caldav/{username}/ 是用户主体和日历主目录，/caldav/{username}/todos/ 是待办事项集合
+const (
+	caldavPrefix       = "/caldav/"
+	caldavCalendar     = "todos"
+	maxCalDAVBodySize  = 1 << 20
+	caldavAllowMethods = "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT"
+)
+
+// XML 命名空间
+const (
+	nsDAV    = "DAV:"
+	nsCalDAV = "urn:ietf:params:xml:ns:caldav"
+	nsCS     = "http://calendarserver.org/ns/"
+)
+
+// CalDAVStore CalDAV 处理器使用的存储，由 models.CalDAVModel 实现
+type CalDAVStore interface {
+	Authenticate(username, password string) (int, error)
+	Objects(userID int) ([]models.CalDAVObject, error)
+	Object(userID int, name string) (*models.CalDAVObject, error)
+	ObjectByUID(userID int, uid string) (*models.CalDAVObject, error)
+	Create(userID int, obj *models.CalDAVObject) error
+	Update(userID int, obj *models.CalDAVObject, versions []int) error
+	Delete(userID, todoID int, versions []int) error
+	CTag(userID int) (string, error)
+	Categories(userID int) ([]string, error)
+}
+
+// CalDAVHandler 把每个用户的待办事项作为一个只包含 VTODO 的 CalDAV 日历集合提供给
+// Apple 提醒事项、Thunderbird、DAVx5 等客户端双向同步。客户端使用用户名和应用专用密码认证。
+type CalDAVHandler struct {
+	Store CalDAVStore
+}
+
+// NewCalDAVHandler 创建一个新的CalDAVHandler实例
+func NewCalDAVHandler(store CalDAVStore) *CalDAVHandler {
+	return &CalDAVHandler{Store: store}
+}
+
+// 资源类型
+const (
+	davRoot = iota
+	davPrincipal
+	davCalendar
+	davObject
+)
+
+// davResource 请求路径对应的资源
+type davResource struct {
+	kind   int
+	user   string
+	name   string // 对象的资源名
+	ctag   string
+	object *models.CalDAVObject
+}
+
+// parseCalDAVPath 解析 /caldav/ 下的路径，返回资源类型、用户名和对象名
+func parseCalDAVPath(p string) (davResource, bool) {
+	if !strings.HasPrefix(p, caldavPrefix) {
+		return davResource{}, false
+	}
+	rest := strings.TrimPrefix(p, caldavPrefix)
+	trimmed := strings.Trim(rest, "/")
+	if trimmed == "" {
+		return davResource{kind: davRoot}, true
+	}
+
+	segments := strings.Split(trimmed, "/")
+	switch {
+	case len(segments) == 1:
+		return davResource{kind: davPrincipal, user: segments[0]}, true
+	case len(segments) == 2 && segments[1] == caldavCalendar:
+		return davResource{kind: davCalendar, user: segments[0]}, true
+	case len(segments) == 3 && segments[1] == caldavCalendar && !strings.HasSuffix(rest, "/"):
+		return davResource{kind: davObject, user: segments[0], name: segments[2]}, true
+	}
+	return davResource{}, false
+}
+
+func principalHref(user string) string {
+	return caldavPrefix + url.PathEscape(user) + "/"
+}
+
+func calendarHref(user string) string {
+	return principalHref(user) + caldavCalendar + "/"
+}
+
+func objectHref(user, name string) string {
+	return calendarHref(user) + url.PathEscape(name)
+}
+
+// href 资源的路径
+func (res davResource) href() string {
+	switch res.kind {
+	case davPrincipal:
+		return principalHref(res.user)
+	case davCalendar:
+		return calendarHref(res.user)
+	case davObject:
+		return objectHref(res.user, res.name)
+	}
+	return caldavPrefix
+}
+
+// WellKnown 处理 /.well-known/caldav（RFC 6764），重定向到服务根路径
+func (h *CalDAVHandler) WellKnown(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, caldavPrefix, http.StatusMovedPermanently)
+}
+
+// ServeCalDAV 处理 /caldav/ 下的所有请求
+func (h *CalDAVHandler) ServeCalDAV(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("DAV", "1, 3, calendar-access")
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Allow", caldavAllowMethods)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	userID, username, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	res, ok := parseCalDAVPath(r.URL.Path)
+	if !ok {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if res.kind == davRoot {
+		res.user = username
+	} else if res.user != username {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxCalDAVBodySize)
+	switch r.Method {
+	case "PROPFIND":
+		h.propfind(w, r, userID, res)
+	case "REPORT":
+		h.report(w, r, userID, res)
+	case http.MethodGet, http.MethodHead:
+		h.get(w, r, userID, res)
+	case http.MethodPut:
+		h.put(w, r, userID, res)
+	case http.MethodDelete:
+		h.delete(w, r, userID, res)
+	default:
+		w.Header().Set("Allow", caldavAllowMethods)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// authenticate 使用 HTTP Basic 认证校验用户名和应用专用密码，失败时写入 401
+func (h *CalDAVHandler) authenticate(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	if username, password, ok := r.BasicAuth(); ok {
+		userID, err := h.Store.Authenticate(username, password)
+		if err == nil {
+			return userID, username, true
+		}
+		if !errors.Is(err, models.ErrInvalidCredentials) {
+			log.Printf("CalDAV认证失败: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return 0, "", false
+		}
+	}
+	w.Header().Set("WWW-Authenticate", `Basic realm="TodoList CalDAV", charset="UTF-8"`)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	return 0, "", false
+}
+
+// caldavServerError 记录错误并返回 500
+func caldavServerError(w http.ResponseWriter, action string, err error) {
+	log.Printf("CalDAV%s失败: %v", action, err)
+	http.Error(w, "Internal server error", http.StatusInternalServerError)
+}
+
+// davPropRequest PROPFIND 和 REPORT 请求中要求的属性；allprop 为 true 时返回所有已知属性
+type davPropRequest struct {
+	names   []xml.Name
+	allprop bool
+}
+
+// davAnyElement 只关心名称的 XML 元素
+type davAnyElement struct {
+	XMLName xml.Name
+}
+
+// davPropfindBody PROPFIND 请求体
+type davPropfindBody struct {
+	XMLName xml.Name `xml:"DAV: propfind"`
+	Prop    *struct {
+		Names []davAnyElement `xml:",any"`
+	} `xml:"DAV: prop"`
+}
+
+// readPropfind 解析 PROPFIND 请求体，空请求体、allprop 和 propname 都按 allprop 处理
+func readPropfind(r *http.Request) (davPropRequest, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return davPropRequest{}, err
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return davPropRequest{allprop: true}, nil
+	}
+
+	var pf davPropfindBody
+	if err := xml.Unmarshal(body, &pf); err != nil {
+		return davPropRequest{}, err
+	}
+	if pf.Prop == nil {
+		return davPropRequest{allprop: true}, nil
+	}
+	req := davPropRequest{}
+	for _, el := range pf.Prop.Names {
+		req.names = append(req.names, el.XMLName)
+	}
+	return req, nil
+}
+
+// propfind 返回资源的属性；Depth 为 1（infinity 按 1 处理）时同时返回直接子资源
+func (h *CalDAVHandler) propfind(w http.ResponseWriter, r *http.Request, userID int, res davResource) {
+	req, err := readPropfind(r)
+	if err != nil {
+		http.Error(w, "Invalid PROPFIND body", http.StatusBadRequest)
+		return
+	}
+	depth := r.Header.Get("Depth")
+
+	resources := []davResource{}
+	switch res.kind {
+	case davRoot:
+		resources = append(resources, res)
+		if depth != "0" {
+			resources = append(resources, davResource{kind: davPrincipal, user: res.user})
+		}
+	case davPrincipal:
+		resources = append(resources, res)
+		if depth != "0" {
+			ctag, err := h.Store.CTag(userID)
+			if err != nil {
+				caldavServerError(w, "获取CTag", err)
+				return
+			}
+			resources = append(resources, davResource{kind: davCalendar, user: res.user, ctag: ctag})
+		}
+	case davCalendar:
+		if res.ctag, err = h.Store.CTag(userID); err != nil {
+			caldavServerError(w, "获取CTag", err)
+			return
+		}
+		resources = append(resources, res)
+		if depth != "0" {
+			objects, err := h.Store.Objects(userID)
+			if err != nil {
+				caldavServerError(w, "查询对象", err)
+				return
+			}
+			for i := range objects {
+				resources = append(resources, davResource{kind: davObject, user: res.user, name: objects[i].Name, object: &objects[i]})
+			}
+		}
+	case davObject:
+		obj, err := h.Store.Object(userID, res.name)
+		if err != nil {
+			if errors.Is(err, models.ErrTodoNotFound) {
+				http.Error(w, "Not found", http.StatusNotFound)
+				return
+			}
+			caldavServerError(w, "查询对象", err)
+			return
+		}
+		res.object = obj
+		resources = append(resources, res)
+	}
+
+	ms := &multistatus{}
+	for _, resource := range resources {
+		ms.add(resource, req)
+	}
+	ms.write(w)
+}
+
+// davReportBody calendar-multiget 和 calendar-query 的请求体
+type davReportBody struct {
+	XMLName xml.Name
+	Prop    *struct {
+		Names []davAnyElement `xml:",any"`
+	} `xml:"DAV: prop"`
+	Hrefs  []string        `xml:"DAV: href"`
+	Filter *calCompFilters `xml:"urn:ietf:params:xml:ns:caldav filter"`
+}
+
+// calCompFilters CALDAV:filter 或 comp-filter 中的子 comp-filter
+type calCompFilters struct {
+	CompFilters []calCompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+}
+
+// calCompFilter CALDAV:comp-filter
+type calCompFilter struct {
+	Name         string          `xml:"name,attr"`
+	IsNotDefined *struct{}       `xml:"urn:ietf:params:xml:ns:caldav is-not-defined"`
+	TimeRange    *calTimeRange   `xml:"urn:ietf:params:xml:ns:caldav time-range"`
+	PropFilters  []calPropFilter `xml:"urn:ietf:params:xml:ns:caldav prop-filter"`
+	calCompFilters
+}
+
+// calPropFilter CALDAV:prop-filter，支持 is-not-defined、time-range 和 text-match
+type calPropFilter struct {
+	Name         string        `xml:"name,attr"`
+	IsNotDefined *struct{}     `xml:"urn:ietf:params:xml:ns:caldav is-not-defined"`
+	TimeRange    *calTimeRange `xml:"urn:ietf:params:xml:ns:caldav time-range"`
+	TextMatch    *struct {
+		Value  string `xml:",chardata"`
+		Negate string `xml:"negate-condition,attr"`
+	} `xml:"urn:ietf:params:xml:ns:caldav text-match"`
+}
+
+// calTimeRange CALDAV:time-range，start 和 end 都是 UTC 时间，缺少时不限制
+type calTimeRange struct {
+	Start string `xml:"start,attr"`
+	End   string `xml:"end,attr"`
+}
+
+// report 处理日历集合上的 calendar-multiget 和 calendar-query
+func (h *CalDAVHandler) report(w http.ResponseWriter, r *http.Request, userID int, res davResource) {
+	var body davReportBody
+	if err := xml.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid REPORT body", http.StatusBadRequest)
+		return
+	}
+	if res.kind != davCalendar || body.XMLName.Space != nsCalDAV {
+		writeDAVError(w, http.StatusForbidden, xml.Name{Space: nsDAV, Local: "supported-report"})
+		return
+	}
+
+	req := davPropRequest{allprop: body.Prop == nil}
+	if body.Prop != nil {
+		for _, el := range body.Prop.Names {
+			req.names = append(req.names, el.XMLName)
+		}
+	}
+
+	objects, err := h.Store.Objects(userID)
+	if err != nil {
+		caldavServerError(w, "查询对象", err)
+		return
+	}
+
+	ms := &multistatus{}
+	switch body.XMLName.Local {
+	case "calendar-multiget":
+		byName := make(map[string]*models.CalDAVObject, len(objects))
+		for i := range objects {
+			byName[objects[i].Name] = &objects[i]
+		}
+		prefix := calendarHref(res.user)
+		for _, href := range body.Hrefs {
+			href = strings.TrimSpace(href)
+			name, ok := hrefObjectName(href, prefix)
+			obj := byName[name]
+			if !ok || obj == nil {
+				ms.missing(href, http.StatusNotFound)
+				continue
+			}
+			ms.add(davResource{kind: davObject, user: res.user, name: obj.Name, object: obj}, req)
+		}
+	case "calendar-query":
+		filter := body.Filter
+		for i := range objects {
+			match, err := matchCalendarQuery(objects[i], filter)
+			if err != nil {
+				writeDAVError(w, http.StatusForbidden, xml.Name{Space: nsCalDAV, Local: "valid-filter"})
+				return
+			}
+			if match {
+				ms.add(davResource{kind: davObject, user: res.user, name: objects[i].Name, object: &objects[i]}, req)
+			}
+		}
+	default:
+		writeDAVError(w, http.StatusForbidden, xml.Name{Space: nsDAV, Local: "supported-report"})
+		return
+	}
+	ms.write(w)
+}
+
+// hrefObjectName 从 multiget 的 href（路径或完整 URL）中取出集合 prefix 下的对象名
+func hrefObjectName(href, prefix string) (string, bool) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", false
+	}
+	name := strings.TrimPrefix(u.Path, prefix)
+	if name == u.Path || name == "" || strings.Contains(name, "/") {
+		return "", false
+	}
+	return name, true
+}
+
+// matchCalendarQuery 判断对象是否满足 calendar-query 的过滤条件。过滤针对对象输出的
+// iCalendar 内容进行，因此与客户端 GET 到的数据保持一致
+func matchCalendarQuery(obj models.CalDAVObject, filter *calCompFilters) (bool, error) {
+	if filter == nil || len(filter.CompFilters) == 0 {
+		return true, nil
+	}
+	var b strings.Builder
+	if err := writeCalDAVObject(&b, obj); err != nil {
+		return false, err
+	}
+	cal, err := parseICS(b.String())
+	if err != nil {
+		return false, err
+	}
+
+	for _, cf := range filter.CompFilters {
+		if !strings.EqualFold(cf.Name, "VCALENDAR") {
+			return false, fmt.Errorf("top-level comp-filter must be VCALENDAR")
+		}
+		ok, err := matchCompFilter(cal, cf)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// matchCompFilter 判断组件是否满足 comp-filter
+func matchCompFilter(c *icsComponent, cf calCompFilter) (bool, error) {
+	if cf.IsNotDefined != nil {
+		return false, nil
+	}
+	if cf.TimeRange != nil {
+		ok, err := todoInTimeRange(c, cf.TimeRange)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	for _, pf := range cf.PropFilters {
+		ok, err := matchPropFilter(c, pf)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	for _, child := range cf.CompFilters {
+		sub := c.component(strings.ToUpper(child.Name))
+		if sub == nil {
+			if child.IsNotDefined != nil {
+				continue
+			}
+			return false, nil
+		}
+		ok, err := matchCompFilter(sub, child)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// matchPropFilter 判断组件是否满足 prop-filter；text-match 按不区分大小写的子串匹配
+func matchPropFilter(c *icsComponent, pf calPropFilter) (bool, error) {
+	prop := c.prop(strings.ToUpper(pf.Name))
+	if pf.IsNotDefined != nil {
+		return prop == nil, nil
+	}
+	if prop == nil {
+		return false, nil
+	}
+	if pf.TimeRange != nil {
+		start, end, err := parseTimeRange(pf.TimeRange)
+		if err != nil {
+			return false, err
+		}
+		t, err := parseICSTime(prop)
+		if err != nil {
+			return false, nil
+		}
+		if t.Before(start) || !t.Before(end) {
+			return false, nil
+		}
+	}
+	if pf.TextMatch != nil {
+		found := strings.Contains(strings.ToLower(unescapeICSText(prop.Value)), strings.ToLower(strings.TrimSpace(pf.TextMatch.Value)))
+		if strings.EqualFold(pf.TextMatch.Negate, "yes") {
+			found = !found
+		}
+		return found, nil
+	}
+	return true, nil
+}
+
+// parseTimeRange 解析 time-range 的 start 和 end，缺少时使用极小和极大值
+func parseTimeRange(tr *calTimeRange) (time.Time, time.Time, error) {
+	start := time.Time{}
+	end := time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+	var err error
+	if tr.Start != "" {
+		if start, err = time.Parse("20060102T150405Z", tr.Start); err != nil {
+			return start, end, err
+		}
+	}
+	if tr.End != "" {
+		if end, err = time.Parse("20060102T150405Z", tr.End); err != nil {
+			return start, end, err
+		}
+	}
+	return start, end, nil
+}
+
+// todoInTimeRange 按 RFC 4791 第 9.9 节判断 VTODO 是否与时间范围重叠（本服务不输出 DTSTART 和 DURATION）
+func todoInTimeRange(c *icsComponent, tr *calTimeRange) (bool, error) {
+	start, end, err := parseTimeRange(tr)
+	if err != nil {
+		return false, err
+	}
+	propTime := func(name string) (time.Time, bool) {
+		p := c.prop(name)
+		if p == nil {
+			return time.Time{}, false
+		}
+		t, err := parseICSTime(p)
+		return t, err == nil
+	}
+
+	if due, ok := propTime("DUE"); ok {
+		return !start.After(due) && !end.Before(due), nil
+	}
+	created, hasCreated := propTime("CREATED")
+	if completed, ok := propTime("COMPLETED"); ok {
+		if !hasCreated {
+			return !start.After(completed) && !end.Before(completed), nil
+		}
+		return (!start.After(created) || !start.After(completed)) &&
+			(!end.Before(created) || !end.Before(completed)), nil
+	}
+	if hasCreated {
+		return end.After(created), nil
+	}
+	return true, nil
+}
+
+// get 返回对象的 iCalendar 内容，支持 If-None-Match
+func (h *CalDAVHandler) get(w http.ResponseWriter, r *http.Request, userID int, res davResource) {
+	if res.kind != davObject {
+		w.Header().Set("Allow", "OPTIONS, PROPFIND, REPORT")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	obj, err := h.Store.Object(userID, res.name)
+	if err != nil {
+		if errors.Is(err, models.ErrTodoNotFound) {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		caldavServerError(w, "查询对象", err)
+		return
+	}
+
+	if notModified(w, r, todoETag(obj.Todo)) {
+		return
+	}
+	var b bytes.Buffer
+	if err := writeCalDAVObject(&b, *obj); err != nil {
+		caldavServerError(w, "输出对象", err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Last-Modified", obj.Todo.UpdatedAt.UTC().Format(http.TimeFormat))
+	if r.Method == http.MethodHead {
+		return
+	}
+	w.Write(b.Bytes())
+}
+
+// put 创建或更新对象。If-None-Match: * 要求对象不存在，If-Match 要求 ETag 匹配，
+// 不满足时返回 412。服务端会规范化内容（例如把步骤之外的字段映射到待办事项），
+// 因此不返回 ETag，客户端需要重新获取对象
+func (h *CalDAVHandler) put(w http.ResponseWriter, r *http.Request, userID int, res davResource) {
+	if res.kind != davObject {
+		w.Header().Set("Allow", "OPTIONS, PROPFIND, REPORT")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	cal, err := parseICS(string(body))
+	if err != nil || cal.Name != "VCALENDAR" {
+		writeDAVError(w, http.StatusForbidden, xml.Name{Space: nsCalDAV, Local: "valid-calendar-data"})
+		return
+	}
+	vtodo, ok := calendarTodo(cal)
+	if !ok {
+		writeDAVError(w, http.StatusForbidden, xml.Name{Space: nsCalDAV, Local: "supported-calendar-component"})
+		return
+	}
+	uidProp := vtodo.prop("UID")
+	if uidProp == nil || strings.TrimSpace(uidProp.Value) == "" {
+		writeDAVError(w, http.StatusForbidden, xml.Name{Space: nsCalDAV, Local: "valid-calendar-object-resource"})
+		return
+	}
+	uid := strings.TrimSpace(unescapeICSText(uidProp.Value))
+
+	categories, err := h.Store.Categories(userID)
+	if err != nil {
+		caldavServerError(w, "查询分类", err)
+		return
+	}
+
+	existing, err := h.Store.Object(userID, res.name)
+	if err != nil && !errors.Is(err, models.ErrTodoNotFound) {
+		caldavServerError(w, "查询对象", err)
+		return
+	}
+
+	if existing == nil {
+		if r.Header.Get("If-Match") != "" {
+			http.Error(w, "Precondition failed", http.StatusPreconditionFailed)
+			return
+		}
+		if _, err := h.Store.ObjectByUID(userID, uid); err == nil {
+			writeDAVError(w, http.StatusForbidden, xml.Name{Space: nsCalDAV, Local: "no-uid-conflict"})
+			return
+		} else if !errors.Is(err, models.ErrTodoNotFound) {
+			caldavServerError(w, "查询对象", err)
+			return
+		}
+
+		obj := &models.CalDAVObject{Name: res.name, UID: uid}
+		if err := applyVTODO(&obj.Todo, vtodo, categories); err != nil {
+			writeDAVError(w, http.StatusForbidden, xml.Name{Space: nsCalDAV, Local: "valid-calendar-data"})
+			return
+		}
+		if err := h.Store.Create(userID, obj); err != nil {
+			writeCalDAVWriteError(w, err)
+			return
+		}
+		w.Header().Set("Location", objectHref(res.user, res.name))
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+
+	if r.Header.Get("If-None-Match") == "*" {
+		http.Error(w, "Precondition failed", http.StatusPreconditionFailed)
+		return
+	}
+	if uid != existing.UID {
+		writeDAVError(w, http.StatusForbidden, xml.Name{Space: nsCalDAV, Local: "no-uid-conflict"})
+		return
+	}
+	if err := applyVTODO(&existing.Todo, vtodo, categories); err != nil {
+		writeDAVError(w, http.StatusForbidden, xml.Name{Space: nsCalDAV, Local: "valid-calendar-data"})
+		return
+	}
+	// 步骤和自定义字段不在 iCalendar 中表示，传 nil 保留原有的值
+	existing.Todo.Steps, existing.Todo.CustomFields = nil, nil
+	if err := h.Store.Update(userID, existing, ifMatchVersions(r, existing.Todo.ID)); err != nil {
+		writeCalDAVWriteError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeCalDAVWriteError 把写入待办事项时的错误转换为响应
+func writeCalDAVWriteError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrVersionConflict):
+		http.Error(w, "Precondition failed", http.StatusPreconditionFailed)
+	case errors.Is(err, models.ErrInvalidTag):
+		http.Error(w, "Invalid tag name", http.StatusBadRequest)
+	case errors.Is(err, models.ErrUnknownCategory):
+		http.Error(w, "Unknown category", http.StatusBadRequest)
+	case errors.Is(err, models.ErrWIPLimitReached):
+		http.Error(w, "WIP limit reached", http.StatusConflict)
+	default:
+		caldavServerError(w, "写入对象", err)
+	}
+}
+
+// delete 删除对象，支持 If-Match
+func (h *CalDAVHandler) delete(w http.ResponseWriter, r *http.Request, userID int, res davResource) {
+	if res.kind != davObject {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	obj, err := h.Store.Object(userID, res.name)
+	if err != nil {
+		if errors.Is(err, models.ErrTodoNotFound) {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		caldavServerError(w, "查询对象", err)
+		return
+	}
+
+	err = h.Store.Delete(userID, obj.Todo.ID, ifMatchVersions(r, obj.Todo.ID))
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, models.ErrVersionConflict):
+		http.Error(w, "Precondition failed", http.StatusPreconditionFailed)
+	case errors.Is(err, models.ErrTodoNotFound):
+		http.Error(w, "Not found", http.StatusNotFound)
+	default:
+		caldavServerError(w, "删除对象", err)
+	}
+}
+
+// writeDAVError 输出带前置条件元素的 DAV:error
+func writeDAVError(w http.ResponseWriter, status int, condition xml.Name) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?>`+"\n"+`<d:error %s>%s</d:error>`, davNamespaces, davEmptyElement(condition))
+}
+
+// davNamespaces multistatus 中使用的命名空间前缀
+const davNamespaces = `xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav" xmlns:cs="http://calendarserver.org/ns/"`
+
+// davPrefixes 已知命名空间的前缀
+var davPrefixes = map[string]string{nsDAV: "d", nsCalDAV: "c", nsCS: "cs"}
+
+// davElement 输出带内容的元素；未知命名空间时在元素上声明
+func davElement(name xml.Name, content string) string {
+	if prefix, ok := davPrefixes[name.Space]; ok {
+		return fmt.Sprintf("<%s:%s>%s</%s:%s>", prefix, name.Local, content, prefix, name.Local)
+	}
+	var ns bytes.Buffer
+	xml.EscapeText(&ns, []byte(name.Space))
+	return fmt.Sprintf(`<x:%s xmlns:x="%s">%s</x:%s>`, name.Local, ns.String(), content, name.Local)
+}
+
+// davEmptyElement 输出空元素
+func davEmptyElement(name xml.Name) string {
+	if prefix, ok := davPrefixes[name.Space]; ok {
+		return fmt.Sprintf("<%s:%s/>", prefix, name.Local)
+	}
+	var ns bytes.Buffer
+	xml.EscapeText(&ns, []byte(name.Space))
+	return fmt.Sprintf(`<x:%s xmlns:x="%s"/>`, name.Local, ns.String())
+}
+
+// xmlText 转义文本内容
+func xmlText(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// davHref 输出 <d:href>
+func davHref(href string) string {
+	return "<d:href>" + xmlText(href) + "</d:href>"
+}
+
+// allProps allprop 时返回的属性（不包含体积较大的 calendar-data）
+var allProps = []xml.Name{
+	{Space: nsDAV, Local: "resourcetype"},
+	{Space: nsDAV, Local: "displayname"},
+	{Space: nsDAV, Local: "current-user-principal"},
+	{Space: nsDAV, Local: "principal-URL"},
+	{Space: nsCalDAV, Local: "calendar-home-set"},
+	{Space: nsCalDAV, Local: "supported-calendar-component-set"},
+	{Space: nsCS, Local: "getctag"},
+	{Space: nsDAV, Local: "getetag"},
+	{Space: nsDAV, Local: "getcontenttype"},
+	{Space: nsDAV, Local: "getlastmodified"},
+	{Space: nsDAV, Local: "owner"},
+	{Space: nsDAV, Local: "current-user-privilege-set"},
+	{Space: nsDAV, Local: "supported-report-set"},
+}
+
+// prop 返回资源的属性值（已渲染的 XML 内容），资源没有该属性时返回 false
+func (res davResource) prop(name xml.Name) (string, bool) {
+	principal := davHref(principalHref(res.user))
+	switch name.Space + " " + name.Local {
+	case nsDAV + " resourcetype":
+		switch res.kind {
+		case davPrincipal:
+			return "<d:collection/><d:principal/>", true
+		case davCalendar:
+			return "<d:collection/><c:calendar/>", true
+		case davObject:
+			return "", true
+		}
+		return "<d:collection/>", true
+	case nsDAV + " displayname":
+		switch res.kind {
+		case davPrincipal:
+			return xmlText(res.user), true
+		case davCalendar:
+			return "TodoList", true
+		case davObject:
+			return xmlText(res.object.Todo.Task), true
+		}
+	case nsDAV + " current-user-principal":
+		return principal, true
+	case nsDAV + " principal-URL":
+		if res.kind == davPrincipal {
+			return principal, true
+		}
+	case nsCalDAV + " calendar-home-set":
+		if res.kind == davPrincipal {
+			return principal, true
+		}
+	case nsCalDAV + " supported-calendar-component-set":
+		if res.kind == davCalendar {
+			return `<c:comp name="VTODO"/>`, true
+		}
+	case nsCS + " getctag":
+		if res.kind == davCalendar {
+			return xmlText(res.ctag), true
+		}
+	case nsDAV + " getetag":
+		if res.kind == davObject {
+			return xmlText(todoETag(res.object.Todo)), true
+		}
+	case nsDAV + " getcontenttype":
+		if res.kind == davObject {
+			return "text/calendar; charset=utf-8; component=VTODO", true
+		}
+	case nsDAV + " getlastmodified":
+		if res.kind == davObject {
+			return res.object.Todo.UpdatedAt.UTC().Format(http.TimeFormat), true
+		}
+	case nsDAV + " owner":
+		if res.kind != davRoot {
+			return principal, true
+		}
+	case nsDAV + " current-user-privilege-set":
+		if res.kind != davRoot {
+			var b strings.Builder
+			for _, p := range []string{"read", "write", "write-content", "bind", "unbind"} {
+				b.WriteString("<d:privilege><d:" + p + "/></d:privilege>")
+			}
+			return b.String(), true
+		}
+	case nsDAV + " supported-report-set":
+		if res.kind == davCalendar {
+			return "<d:supported-report><d:report><c:calendar-multiget/></d:report></d:supported-report>" +
+				"<d:supported-report><d:report><c:calendar-query/></d:report></d:supported-report>", true
+		}
+	case nsCalDAV + " calendar-data":
+		if res.kind == davObject {
+			var b strings.Builder
+			if err := writeCalDAVObject(&b, *res.object); err != nil {
+				return "", false
+			}
+			return xmlText(b.String()), true
+		}
+	}
+	return "", false
+}
+
+// multistatus 207 响应
+type multistatus struct {
+	b strings.Builder
+}
+
+// add 添加一个资源的属性：找到的属性放在 200 的 propstat 中，其余放在 404 的 propstat 中
+func (ms *multistatus) add(res davResource, req davPropRequest) {
+	names := req.names
+	if req.allprop {
+		names = allProps
+	}
+
+	var found, missing strings.Builder
+	for _, name := range names {
+		if value, ok := res.prop(name); ok {
+			found.WriteString(davElement(name, value))
+		} else if !req.allprop {
+			missing.WriteString(davEmptyElement(name))
+		}
+	}
+
+	ms.b.WriteString("<d:response>")
+	ms.b.WriteString(davHref(res.href()))
+	if found.Len() > 0 {
+		ms.b.WriteString("<d:propstat><d:prop>" + found.String() + "</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>")
+	}
+	if missing.Len() > 0 {
+		ms.b.WriteString("<d:propstat><d:prop>" + missing.String() + "</d:prop><d:status>HTTP/1.1 404 Not Found</d:status></d:propstat>")
+	}
+	ms.b.WriteString("</d:response>")
+}
+
+// missing 添加一个只有状态的 response（例如 multiget 中不存在的对象）
+func (ms *multistatus) missing(href string, status int) {
+	fmt.Fprintf(&ms.b, "<d:response>%s<d:status>HTTP/1.1 %d %s</d:status></d:response>",
+		davHref(href), status, http.StatusText(status))
+}
+
+func (ms *multistatus) write(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?>`+"\n"+`<d:multistatus %s>%s</d:multistatus>`, davNamespaces, ms.b.String())
+}
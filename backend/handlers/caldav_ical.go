@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TodoList/models"
+)
+
+// icsProperty 一个内容行：大写的属性名、参数和原始值（未反转义）
+type icsProperty struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// icsComponent 一个组件（BEGIN:X ... END:X）及其属性和子组件
+type icsComponent struct {
+	Name       string
+	Props      []icsProperty
+	Components []*icsComponent
+}
+
+// prop 返回第一个名为 name 的属性，不存在时返回 nil
+func (c *icsComponent) prop(name string) *icsProperty {
+	for i := range c.Props {
+		if c.Props[i].Name == name {
+			return &c.Props[i]
+		}
+	}
+	return nil
+}
+
+// component 返回第一个名为 name 的子组件，不存在时返回 nil
+func (c *icsComponent) component(name string) *icsComponent {
+	for _, child := range c.Components {
+		if child.Name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+// parseICS 解析 iCalendar 文本，返回最外层的组件（通常是 VCALENDAR）。
+// 接受 CRLF 和 LF 换行，续行以空格或制表符开头。
+func parseICS(data string) (*icsComponent, error) {
+	data = strings.TrimPrefix(data, utf8BOM)
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	data = strings.ReplaceAll(data, "\n ", "")
+	data = strings.ReplaceAll(data, "\n\t", "")
+
+	var root *icsComponent
+	var stack []*icsComponent
+	for n, raw := range strings.Split(data, "\n") {
+		raw = strings.TrimRight(raw, "\r")
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+		prop, err := parseICSLine(raw)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+
+		switch prop.Name {
+		case "BEGIN":
+			if root != nil && len(stack) == 0 {
+				return nil, fmt.Errorf("line %d: content after END:%s", n+1, root.Name)
+			}
+			c := &icsComponent{Name: strings.ToUpper(prop.Value)}
+			if len(stack) == 0 {
+				root = c
+			} else {
+				parent := stack[len(stack)-1]
+				parent.Components = append(parent.Components, c)
+			}
+			stack = append(stack, c)
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(prop.Value) {
+				return nil, fmt.Errorf("line %d: unexpected END:%s", n+1, prop.Value)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("line %d: property outside of a component", n+1)
+			}
+			c := stack[len(stack)-1]
+			c.Props = append(c.Props, prop)
+		}
+	}
+	if root == nil {
+		return nil, fmt.Errorf("no component found")
+	}
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("missing END:%s", stack[len(stack)-1].Name)
+	}
+	return root, nil
+}
+
+// parseICSLine 解析一个已展开的内容行 name;param=value:value。参数值可以用双引号括起来，
+// 其中的分号和冒号不作为分隔符
+func parseICSLine(line string) (icsProperty, error) {
+	prop := icsProperty{Params: map[string]string{}}
+
+	end := strings.IndexAny(line, ";:")
+	if end <= 0 {
+		return prop, fmt.Errorf("invalid content line")
+	}
+	prop.Name = strings.ToUpper(line[:end])
+	rest := line[end:]
+
+	for strings.HasPrefix(rest, ";") {
+		rest = rest[1:]
+		eq := strings.IndexByte(rest, '=')
+		if eq <= 0 {
+			return prop, fmt.Errorf("invalid parameter in %s", prop.Name)
+		}
+		key := strings.ToUpper(rest[:eq])
+		rest = rest[eq+1:]
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			closing := strings.IndexByte(rest[1:], '"')
+			if closing < 0 {
+				return prop, fmt.Errorf("unterminated parameter value in %s", prop.Name)
+			}
+			value, rest = rest[1:closing+1], rest[closing+2:]
+		} else {
+			stop := strings.IndexAny(rest, ";:")
+			if stop < 0 {
+				return prop, fmt.Errorf("missing value in %s", prop.Name)
+			}
+			value, rest = rest[:stop], rest[stop:]
+		}
+		prop.Params[key] = value
+	}
+
+	if !strings.HasPrefix(rest, ":") {
+		return prop, fmt.Errorf("missing value in %s", prop.Name)
+	}
+	prop.Value = rest[1:]
+	return prop, nil
+}
+
+// unescapeICSText 还原 TEXT 类型的转义
+func unescapeICSText(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// splitICSList 按未转义的逗号拆分多值 TEXT（如 CATEGORIES），返回反转义后的非空值
+func splitICSList(s string) []string {
+	var values []string
+	start := 0
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) && s[i] == '\\' {
+			i++
+			continue
+		}
+		if i == len(s) || s[i] == ',' {
+			if v := strings.TrimSpace(unescapeICSText(s[start:i])); v != "" {
+				values = append(values, v)
+			}
+			start = i + 1
+		}
+	}
+	return values
+}
+
+// parseICSTime 解析 DATE 或 DATE-TIME 值。UTC 时间以 Z 结尾；带 TZID 时按该时区解析，
+// 未知时区和浮动时间按 UTC 处理；DATE 解析为 UTC 的午夜，与只设置日期的截止时间一致
+func parseICSTime(prop *icsProperty) (time.Time, error) {
+	value := strings.TrimSpace(prop.Value)
+	if strings.EqualFold(prop.Params["VALUE"], "DATE") || len(value) == len("20060102") {
+		return time.Parse("20060102", value)
+	}
+	if strings.HasSuffix(value, "Z") {
+		return time.Parse("20060102T150405Z", value)
+	}
+	loc := time.UTC
+	if tzid := prop.Params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(strings.TrimPrefix(tzid, "/")); err == nil {
+			loc = l
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	if err != nil {
+		return t, err
+	}
+	return t.UTC(), nil
+}
+
+// priorityFromICS 把 PRIORITY 映射回优先级：1-4 为高，5 为中，6-9 为低，0 表示未定义
+func priorityFromICS(value string) string {
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	switch {
+	case err != nil || n <= 0 || n > 9:
+		return ""
+	case n < 5:
+		return "high"
+	case n == 5:
+		return "medium"
+	}
+	return "low"
+}
+
+// calendarTodo 从 VCALENDAR 中取出唯一的 VTODO。包含其他类型的对象（如 VEVENT）时返回 false
+func calendarTodo(cal *icsComponent) (*icsComponent, bool) {
+	var vtodo *icsComponent
+	for _, c := range cal.Components {
+		switch c.Name {
+		case "VTODO":
+			if vtodo != nil {
+				return nil, false
+			}
+			vtodo = c
+		case "VTIMEZONE":
+		default:
+			return nil, false
+		}
+	}
+	return vtodo, vtodo != nil
+}
+
+// applyVTODO 把 VTODO 的内容写入待办事项。CATEGORIES 中第一个与用户分类同名的值作为分类，
+// 其余作为标签；没有匹配的分类或未设置优先级时保留原来的值。步骤不在 iCalendar 中表示，保持不变。
+func applyVTODO(todo *models.Todo, vtodo *icsComponent, categories []string) error {
+	todo.Task = "Untitled"
+	if p := vtodo.prop("SUMMARY"); p != nil {
+		if task := strings.TrimSpace(unescapeICSText(p.Value)); task != "" {
+			todo.Task = task
+		}
+	}
+
+	todo.Description = ""
+	if p := vtodo.prop("DESCRIPTION"); p != nil {
+		todo.Description = unescapeICSText(p.Value)
+	}
+
+	todo.DueDate = nil
+	if p := vtodo.prop("DUE"); p != nil {
+		due, err := parseICSTime(p)
+		if err != nil {
+			return fmt.Errorf("invalid DUE: %w", err)
+		}
+		todo.DueDate = &due
+	}
+
+	if p := vtodo.prop("PRIORITY"); p != nil {
+		if priority := priorityFromICS(p.Value); priority != "" {
+			todo.Priority = priority
+		}
+	}
+
+	todo.Done = vtodo.prop("COMPLETED") != nil
+	if p := vtodo.prop("STATUS"); p != nil {
+		todo.Done = strings.EqualFold(strings.TrimSpace(p.Value), "COMPLETED")
+	}
+	// 状态由完成标记推导
+	todo.Status = ""
+
+	todo.Reminder = vtodo.component("VALARM") != nil
+
+	var values []string
+	for _, p := range vtodo.Props {
+		if p.Name == "CATEGORIES" {
+			values = append(values, splitICSList(p.Value)...)
+		}
+	}
+	tags := []string{}
+	categoryFound := false
+	for _, value := range values {
+		if !categoryFound {
+			if name, ok := matchCategory(categories, value); ok {
+				todo.Category, categoryFound = name, true
+				continue
+			}
+		}
+		tags = append(tags, value)
+	}
+	todo.Tags = tags
+	return nil
+}
+
+// matchCategory 不区分大小写地查找同名分类，返回分类的原名
+func matchCategory(categories []string, value string) (string, bool) {
+	for _, name := range categories {
+		if strings.EqualFold(name, value) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// writeCalDAVObject 输出 CalDAV 对象：只包含一个 VTODO 的 VCALENDAR，UID 使用客户端提供的值
+func writeCalDAVObject(w io.Writer, obj models.CalDAVObject) error {
+	ics := &icsWriter{w: w}
+	ics.line("BEGIN", "VCALENDAR")
+	ics.line("VERSION", "2.0")
+	ics.line("PRODID", "-//TodoList//CalDAV//EN")
+	ics.todo(obj.Todo, escapeICSText(obj.UID), icsOptions{todos: true, alarmMinutes: defaultAlarmMinutes})
+	ics.line("END", "VCALENDAR")
+	return ics.err
+}
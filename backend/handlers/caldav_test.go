@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TodoList/models"
+)
+
+// memoryCalDAVStore 内存中的 CalDAVStore，版本号和 CTag 的行为与数据库实现一致
+type memoryCalDAVStore struct {
+	users   map[string]int // 用户名 -> 用户ID
+	secret  string
+	objects map[int]*models.CalDAVObject
+	nextID  int
+	seq     map[int]int
+}
+
+func newMemoryCalDAVStore() *memoryCalDAVStore {
+	return &memoryCalDAVStore{
+		users:   map[string]int{"alice": 1, "bob": 2},
+		secret:  "abcd-efgh",
+		objects: map[int]*models.CalDAVObject{},
+		seq:     map[int]int{},
+	}
+}
+
+func (s *memoryCalDAVStore) Authenticate(username, password string) (int, error) {
+	if id, ok := s.users[username]; ok && password == s.secret {
+		return id, nil
+	}
+	return 0, models.ErrInvalidCredentials
+}
+
+func (s *memoryCalDAVStore) Objects(userID int) ([]models.CalDAVObject, error) {
+	objects := []models.CalDAVObject{}
+	for id := 1; id <= s.nextID; id++ {
+		if obj, ok := s.objects[id]; ok && obj.Todo.UserID == userID {
+			objects = append(objects, *obj)
+		}
+	}
+	return objects, nil
+}
+
+func (s *memoryCalDAVStore) find(userID int, match func(*models.CalDAVObject) bool) (*models.CalDAVObject, error) {
+	for _, obj := range s.objects {
+		if obj.Todo.UserID == userID && match(obj) {
+			copied := *obj
+			return &copied, nil
+		}
+	}
+	return nil, models.ErrTodoNotFound
+}
+
+func (s *memoryCalDAVStore) Object(userID int, name string) (*models.CalDAVObject, error) {
+	return s.find(userID, func(obj *models.CalDAVObject) bool { return obj.Name == name })
+}
+
+func (s *memoryCalDAVStore) ObjectByUID(userID int, uid string) (*models.CalDAVObject, error) {
+	return s.find(userID, func(obj *models.CalDAVObject) bool { return obj.UID == uid })
+}
+
+func (s *memoryCalDAVStore) Create(userID int, obj *models.CalDAVObject) error {
+	s.nextID++
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	obj.Todo.ID, obj.Todo.UserID, obj.Todo.Version = s.nextID, userID, 1
+	obj.Todo.CreatedAt, obj.Todo.UpdatedAt = now, now
+	if obj.Todo.Category == "" {
+		obj.Todo.Category = "personal"
+	}
+	s.save(obj)
+	return nil
+}
+
+// save 保存对象；completed_at 与数据库触发器一样由 done 维护
+func (s *memoryCalDAVStore) save(obj *models.CalDAVObject) {
+	if !obj.Todo.Done {
+		obj.Todo.CompletedAt = nil
+	} else if obj.Todo.CompletedAt == nil {
+		completed := obj.Todo.UpdatedAt
+		obj.Todo.CompletedAt = &completed
+	}
+	copied := *obj
+	s.objects[obj.Todo.ID] = &copied
+	s.seq[obj.Todo.UserID]++
+}
+
+func (s *memoryCalDAVStore) Update(userID int, obj *models.CalDAVObject, versions []int) error {
+	current, ok := s.objects[obj.Todo.ID]
+	if !ok || current.Todo.UserID != userID {
+		return models.ErrTodoNotFound
+	}
+	if versions != nil && !containsInt(versions, current.Todo.Version) {
+		return models.ErrVersionConflict
+	}
+	obj.Todo.Version = current.Todo.Version + 1
+	s.save(obj)
+	return nil
+}
+
+func (s *memoryCalDAVStore) Delete(userID, todoID int, versions []int) error {
+	current, ok := s.objects[todoID]
+	if !ok || current.Todo.UserID != userID {
+		return models.ErrTodoNotFound
+	}
+	if versions != nil && !containsInt(versions, current.Todo.Version) {
+		return models.ErrVersionConflict
+	}
+	delete(s.objects, todoID)
+	s.seq[userID]++
+	return nil
+}
+
+func (s *memoryCalDAVStore) CTag(userID int) (string, error) {
+	return strings.Repeat("x", s.seq[userID]), nil
+}
+
+func (s *memoryCalDAVStore) Categories(userID int) ([]string, error) {
+	return []string{"personal", "work"}, nil
+}
+
+// caldavClient 按客户端的方式依次发送请求的测试辅助
+type caldavClient struct {
+	t        *testing.T
+	server   *httptest.Server
+	user     string
+	password string
+}
+
+func (c *caldavClient) do(method, path, body string, headers ...string) (*http.Response, string) {
+	c.t.Helper()
+	req, err := http.NewRequest(method, c.server.URL+path, strings.NewReader(body))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	req.SetBasicAuth(c.user, c.password)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := c.server.Client().Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp, string(data)
+}
+
+// expect 检查状态码和响应中包含的片段
+func (c *caldavClient) expect(resp *http.Response, body string, status int, contains ...string) {
+	c.t.Helper()
+	if resp.StatusCode != status {
+		c.t.Fatalf("%s %s: status = %d, want %d\n%s", resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, status, body)
+	}
+	for _, want := range contains {
+		if !strings.Contains(body, want) {
+			c.t.Errorf("%s %s: response missing %q\n%s", resp.Request.Method, resp.Request.URL.Path, want, body)
+		}
+	}
+}
+
+// between 取出 start 和 end 之间的第一段文本
+func between(s, start, end string) string {
+	_, rest, ok := strings.Cut(s, start)
+	if !ok {
+		return ""
+	}
+	value, _, _ := strings.Cut(rest, end)
+	return value
+}
+
+const (
+	propfindCTag = `<?xml version="1.0"?><d:propfind xmlns:d="DAV:" xmlns:cs="http://calendarserver.org/ns/">
+		<d:prop><cs:getctag/><d:resourcetype/></d:prop></d:propfind>`
+	propfindETags = `<d:propfind xmlns:d="DAV:"><d:prop><d:getetag/></d:prop></d:propfind>`
+)
+
+func vtodoBody(uid, summary, extra string) string {
+	return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//Test//EN\r\nBEGIN:VTODO\r\nUID:" + uid +
+		"\r\nSUMMARY:" + summary + "\r\n" + extra + "END:VTODO\r\nEND:VCALENDAR\r\n"
+}
+
+func TestCalDAVClientSession(t *testing.T) {
+	store := newMemoryCalDAVStore()
+	server := httptest.NewServer(http.HandlerFunc(NewCalDAVHandler(store).ServeCalDAV))
+	defer server.Close()
+	c := &caldavClient{t: t, server: server, user: "alice", password: store.secret}
+
+	// 发现：根路径 -> 用户主体 -> 日历主目录 -> 集合
+	resp, body := c.do("PROPFIND", "/caldav/", `<d:propfind xmlns:d="DAV:"><d:prop><d:current-user-principal/></d:prop></d:propfind>`, "Depth", "0")
+	c.expect(resp, body, http.StatusMultiStatus, "<d:current-user-principal><d:href>/caldav/alice/</d:href>")
+	resp, body = c.do("PROPFIND", "/caldav/alice/", `<d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:prop><c:calendar-home-set/><d:foo/></d:prop></d:propfind>`, "Depth", "0")
+	c.expect(resp, body, http.StatusMultiStatus, "<c:calendar-home-set><d:href>/caldav/alice/</d:href>", "<d:foo/>", "404 Not Found")
+	resp, body = c.do("PROPFIND", "/caldav/alice/", propfindCTag, "Depth", "1")
+	c.expect(resp, body, http.StatusMultiStatus, "<d:href>/caldav/alice/todos/</d:href>", "<c:calendar/>")
+	ctag := between(body, "<cs:getctag>", "</cs:getctag>")
+
+	// 创建
+	resp, body = c.do("PUT", "/caldav/alice/todos/new-1.ics",
+		vtodoBody("client-uid-1", "Buy milk", "DUE;VALUE=DATE:20240510\r\nPRIORITY:1\r\nCATEGORIES:Work,groceries\r\n"),
+		"If-None-Match", "*", "Content-Type", "text/calendar")
+	c.expect(resp, body, http.StatusCreated)
+	created := store.objects[1].Todo
+	if created.Task != "Buy milk" || created.Priority != "high" || created.Category != "work" ||
+		len(created.Tags) != 1 || created.Tags[0] != "groceries" || created.DueDate == nil {
+		t.Errorf("created todo = %+v", created)
+	}
+	resp, body = c.do("PUT", "/caldav/alice/todos/new-1.ics", vtodoBody("client-uid-1", "Again", ""), "If-None-Match", "*")
+	c.expect(resp, body, http.StatusPreconditionFailed)
+	resp, body = c.do("PUT", "/caldav/alice/todos/other.ics", vtodoBody("client-uid-1", "Same UID", ""))
+	c.expect(resp, body, http.StatusForbidden, "<c:no-uid-conflict/>")
+
+	// CTag 变化后客户端列出集合并批量获取
+	resp, body = c.do("PROPFIND", "/caldav/alice/todos/", propfindCTag, "Depth", "0")
+	c.expect(resp, body, http.StatusMultiStatus)
+	if newCTag := between(body, "<cs:getctag>", "</cs:getctag>"); newCTag == ctag {
+		t.Errorf("ctag did not change: %q", newCTag)
+	}
+	resp, body = c.do("PROPFIND", "/caldav/alice/todos/", propfindETags, "Depth", "1")
+	c.expect(resp, body, http.StatusMultiStatus, "<d:href>/caldav/alice/todos/new-1.ics</d:href>", `<d:getetag>&#34;1-1&#34;</d:getetag>`)
+	resp, body = c.do("REPORT", "/caldav/alice/todos/", `<c:calendar-multiget xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+		<d:prop><d:getetag/><c:calendar-data/></d:prop>
+		<d:href>/caldav/alice/todos/new-1.ics</d:href><d:href>/caldav/alice/todos/gone.ics</d:href>
+	</c:calendar-multiget>`, "Depth", "1")
+	c.expect(resp, body, http.StatusMultiStatus, "UID:client-uid-1", "SUMMARY:Buy milk", "DUE;VALUE=DATE:20240510",
+		"<d:href>/caldav/alice/todos/gone.ics</d:href><d:status>HTTP/1.1 404 Not Found</d:status>")
+
+	// GET 并按 ETag 修改；过期的 ETag 返回 412
+	resp, body = c.do("GET", "/caldav/alice/todos/new-1.ics", "")
+	c.expect(resp, body, http.StatusOK, "BEGIN:VTODO", "STATUS:NEEDS-ACTION")
+	etag := resp.Header.Get("ETag")
+	resp, body = c.do("PUT", "/caldav/alice/todos/new-1.ics",
+		vtodoBody("client-uid-1", "Buy milk", "STATUS:COMPLETED\r\nCOMPLETED:20240502T100000Z\r\n"), "If-Match", etag)
+	c.expect(resp, body, http.StatusNoContent)
+	if todo := store.objects[1].Todo; !todo.Done || todo.Category != "work" || todo.DueDate != nil {
+		t.Errorf("updated todo = %+v", todo)
+	}
+	resp, body = c.do("PUT", "/caldav/alice/todos/new-1.ics", vtodoBody("client-uid-1", "Stale", ""), "If-Match", etag)
+	c.expect(resp, body, http.StatusPreconditionFailed)
+
+	// calendar-query：只查询未完成的待办事项
+	c.do("PUT", "/caldav/alice/todos/new-2.ics", vtodoBody("client-uid-2", "Call mom", "DUE:20240503T090000Z\r\n"))
+	query := `<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">
+		<d:prop><d:getetag/></d:prop>
+		<c:filter><c:comp-filter name="VCALENDAR"><c:comp-filter name="VTODO">%s</c:comp-filter></c:comp-filter></c:filter>
+	</c:calendar-query>`
+	resp, body = c.do("REPORT", "/caldav/alice/todos/", strings.Replace(query, "%s",
+		`<c:prop-filter name="COMPLETED"><c:is-not-defined/></c:prop-filter>`, 1), "Depth", "1")
+	c.expect(resp, body, http.StatusMultiStatus, "new-2.ics")
+	if strings.Contains(body, "new-1.ics") {
+		t.Errorf("completed todo matched is-not-defined:\n%s", body)
+	}
+	resp, body = c.do("REPORT", "/caldav/alice/todos/", strings.Replace(query, "%s",
+		`<c:time-range start="20240503T000000Z" end="20240504T000000Z"/>`, 1), "Depth", "1")
+	c.expect(resp, body, http.StatusMultiStatus, "new-2.ics")
+
+	// 删除：过期的 ETag 返回 412，之后对象不存在
+	resp, body = c.do("DELETE", "/caldav/alice/todos/new-1.ics", "", "If-Match", etag)
+	c.expect(resp, body, http.StatusPreconditionFailed)
+	resp, body = c.do("DELETE", "/caldav/alice/todos/new-1.ics", "")
+	c.expect(resp, body, http.StatusNoContent)
+	resp, body = c.do("GET", "/caldav/alice/todos/new-1.ics", "")
+	c.expect(resp, body, http.StatusNotFound)
+
+	// 不支持的组件
+	resp, body = c.do("PUT", "/caldav/alice/todos/event.ics",
+		"BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:e\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n")
+	c.expect(resp, body, http.StatusForbidden, "<c:supported-calendar-component/>")
+}
+
+func TestCalDAVAuthentication(t *testing.T) {
+	store := newMemoryCalDAVStore()
+	server := httptest.NewServer(http.HandlerFunc(NewCalDAVHandler(store).ServeCalDAV))
+	defer server.Close()
+
+	c := &caldavClient{t: t, server: server, user: "alice", password: "wrong"}
+	resp, body := c.do("PROPFIND", "/caldav/alice/todos/", propfindCTag)
+	c.expect(resp, body, http.StatusUnauthorized)
+	if !strings.HasPrefix(resp.Header.Get("WWW-Authenticate"), "Basic ") {
+		t.Errorf("WWW-Authenticate = %q", resp.Header.Get("WWW-Authenticate"))
+	}
+
+	// 不能访问其他用户的集合
+	c.password = store.secret
+	resp, body = c.do("PROPFIND", "/caldav/bob/todos/", propfindCTag)
+	c.expect(resp, body, http.StatusForbidden)
+
+	// OPTIONS 不需要认证
+	c.password = ""
+	resp, body = c.do("OPTIONS", "/caldav/alice/todos/", "")
+	c.expect(resp, body, http.StatusOK)
+	if !strings.Contains(resp.Header.Get("DAV"), "calendar-access") {
+		t.Errorf("DAV = %q", resp.Header.Get("DAV"))
+	}
+}
+
+func TestParseICS(t *testing.T) {
+	cal, err := parseICS("BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nUID:1\r\nSUMMARY:Long \r\n summary\\, folded\r\n" +
+		"DUE;TZID=\"Asia/Shanghai\":20240501T080000\r\nCATEGORIES:a\\,b,c\r\nEND:VTODO\r\nEND:VCALENDAR\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vtodo, ok := calendarTodo(cal)
+	if !ok {
+		t.Fatal("no VTODO")
+	}
+	if got := unescapeICSText(vtodo.prop("SUMMARY").Value); got != "Long summary, folded" {
+		t.Errorf("SUMMARY = %q", got)
+	}
+	want := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	if loc, err := time.LoadLocation("Asia/Shanghai"); err == nil {
+		want = time.Date(2024, 5, 1, 8, 0, 0, 0, loc)
+	}
+	if due, err := parseICSTime(vtodo.prop("DUE")); err != nil || !due.Equal(want) {
+		t.Errorf("DUE = %v, %v", due, err)
+	}
+	if got := splitICSList(vtodo.prop("CATEGORIES").Value); len(got) != 2 || got[0] != "a,b" || got[1] != "c" {
+		t.Errorf("CATEGORIES = %q", got)
+	}
+
+	for _, bad := range []string{"", "SUMMARY:x", "BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nEND:VCALENDAR", "BEGIN:VCALENDAR\r\n"} {
+		if _, err := parseICS(bad); err == nil {
+			t.Errorf("parseICS(%q) succeeded", bad)
+		}
+	}
+}
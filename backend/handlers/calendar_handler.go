@@ -0,0 +1,389 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TodoList/models"
+)
+
+// 日历订阅的组件类型
+const (
+	icsComponentEvent = "vevent" // 截止时间作为日程，Google 日历和 Outlook 只支持这一种
+	icsComponentTodo  = "vtodo"  // 作为任务，Apple 提醒事项、Thunderbird 等支持
+)
+
+// icsLineLimit RFC 5545 中每行的最大字节数（不含 CRLF），超出时折行
+const icsLineLimit = 75
+
+// defaultAlarmMinutes 开启提醒的待办事项在截止前多少分钟提醒
+const defaultAlarmMinutes = 15
+
+// defaultEventMinutes 没有预估时间的日程的时长
+const defaultEventMinutes = 30
+
+// CalendarHandler 处理 iCalendar 订阅和订阅令牌的管理
+type CalendarHandler struct {
+	Feeds *models.CalendarFeedModel
+	Todos *EnhancedTodoHandler
+}
+
+// NewCalendarHandler 创建一个新的CalendarHandler实例
+func NewCalendarHandler(feeds *models.CalendarFeedModel, todos *EnhancedTodoHandler) *CalendarHandler {
+	return &CalendarHandler{Feeds: feeds, Todos: todos}
+}
+
+// calendarFeedResponse 订阅令牌和完整的订阅链接
+type calendarFeedResponse struct {
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+// feedURL 根据请求的主机生成订阅链接；经过反向代理时使用 X-Forwarded-Proto 判断协议
+func feedURL(r *http.Request, token string) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/api/calendar/%s.ics", scheme, r.Host, token)
+}
+
+// GetFeed 返回当前用户的订阅链接，第一次访问时生成令牌
+func (h *CalendarHandler) GetFeed(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	token, err := h.Feeds.GetToken(userID)
+	if err != nil {
+		log.Printf("获取日历订阅令牌失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(calendarFeedResponse{Token: token, URL: feedURL(r, token)})
+}
+
+// RotateFeed 轮换当前用户的订阅令牌，泄露的旧链接立即失效
+func (h *CalendarHandler) RotateFeed(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	token, err := h.Feeds.RotateToken(userID)
+	if err != nil {
+		log.Printf("轮换日历订阅令牌失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(calendarFeedResponse{Token: token, URL: feedURL(r, token)})
+}
+
+// icsOptions 订阅输出的选项
+type icsOptions struct {
+	events       bool // 输出 VEVENT
+	todos        bool // 输出 VTODO
+	steps        bool // 在描述中附上步骤清单
+	alarmMinutes int
+}
+
+// parseICSOptions 解析 components=vevent,vtodo（默认 vevent）和 alarm=<分钟>
+func parseICSOptions(r *http.Request) (icsOptions, error) {
+	opts := icsOptions{steps: true, alarmMinutes: defaultAlarmMinutes}
+	for _, c := range strings.Split(getQueryParam(r, "components", icsComponentEvent), ",") {
+		switch strings.ToLower(strings.TrimSpace(c)) {
+		case icsComponentEvent:
+			opts.events = true
+		case icsComponentTodo:
+			opts.todos = true
+		default:
+			return opts, fmt.Errorf("components must be vevent, vtodo or both")
+		}
+	}
+	if v := r.URL.Query().Get("alarm"); v != "" {
+		minutes, err := strconv.Atoi(v)
+		if err != nil || minutes < 0 || minutes > 7*24*60 {
+			return opts, fmt.Errorf("alarm must be between 0 and 10080 minutes")
+		}
+		opts.alarmMinutes = minutes
+	}
+	return opts, nil
+}
+
+// Feed 输出订阅令牌对应用户的有截止日期的待办事项（text/calendar）。不需要登录，
+// 令牌就是凭据；支持与 GetTodosWithFilter 相同的过滤参数（不分页）。
+func (h *CalendarHandler) Feed(w http.ResponseWriter, r *http.Request, token string) {
+	userID, err := h.Feeds.UserByToken(token)
+	if err != nil {
+		if errors.Is(err, models.ErrCalendarFeedNotFound) {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("获取日历订阅失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	opts, err := parseICSOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filters, ok := h.Todos.requestFilters(w, r, userID)
+	if !ok {
+		return
+	}
+	fq := buildFilterQuery(userID, filters)
+	query := fmt.Sprintf("SELECT %s, %s FROM todos %s AND due_date IS NOT NULL %s",
+		models.TodoColumns, csvStepsQuery, fq.where, fq.keyset.OrderBy())
+
+	rows, err := h.Todos.Model.DB.Query(query, fq.args...)
+	if err != nil {
+		log.Printf("日历订阅查询失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="todos.ics"`)
+	w.Header().Set("Cache-Control", "private, max-age=300")
+
+	ics := &icsWriter{w: w}
+	ics.begin()
+	for rows.Next() {
+		var stepsJSON []byte
+		todo, err := models.ScanTodo(extraColumnScanner{rows: rows, extra: []interface{}{&stepsJSON}})
+		if err != nil {
+			// 响应已经开始，只能中断输出
+			log.Printf("日历订阅扫描失败: %v", err)
+			return
+		}
+		if err := json.Unmarshal(stepsJSON, &todo.Steps); err != nil {
+			log.Printf("解析步骤失败: %v", err)
+		}
+		if opts.events {
+			ics.event(todo, opts)
+		}
+		if opts.todos {
+			ics.todo(todo, todo.UUID+"@todolist", opts)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("日历订阅查询失败: %v", err)
+		return
+	}
+	ics.end()
+}
+
+// icsWriter 按 RFC 5545 输出内容行（CRLF 换行、超过 75 字节折行），写入出错后忽略后续输出
+type icsWriter struct {
+	w   io.Writer
+	err error
+}
+
+// line 输出一行 name:value，value 需要已经转义
+func (iw *icsWriter) line(name, value string) {
+	if iw.err != nil {
+		return
+	}
+	_, iw.err = io.WriteString(iw.w, foldICSLine(name+":"+value))
+}
+
+// foldICSLine 把超过 75 字节的行折为多行，续行以一个空格开头；不会拆开 UTF-8 字符
+func foldICSLine(line string) string {
+	var b strings.Builder
+	limit := icsLineLimit
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		limit = icsLineLimit - 1 // 续行开头的空格占一个字节
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// escapeICSText 转义 TEXT 类型的值
+func escapeICSText(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", "")
+	return r.Replace(s)
+}
+
+// formatICSTime 输出 UTC 时间
+func formatICSTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// icsDate 截止时间为午夜（只设置了日期）时按全天处理，返回属性参数和值
+func icsDate(t time.Time) (string, string) {
+	if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 {
+		return ";VALUE=DATE", t.Format("20060102")
+	}
+	return "", formatICSTime(t)
+}
+
+// icsPriority 把优先级映射为 RFC 5545 的 PRIORITY（1 最高，5 中等，9 最低）
+func icsPriority(priority string) string {
+	switch priority {
+	case "high":
+		return "1"
+	case "low":
+		return "9"
+	}
+	return "5"
+}
+
+// icsCategories 分类和标签作为 CATEGORIES
+func icsCategories(todo models.Todo) string {
+	var values []string
+	if todo.Category != "" {
+		values = append(values, escapeICSText(todo.Category))
+	}
+	for _, tag := range todo.Tags {
+		values = append(values, escapeICSText(tag))
+	}
+	return strings.Join(values, ",")
+}
+
+// icsDescription 描述，steps 为 true 时在后面附上步骤清单
+func icsDescription(todo models.Todo, steps bool) string {
+	lines := []string{}
+	if todo.Description != "" {
+		lines = append(lines, todo.Description)
+		if steps && len(todo.Steps) > 0 {
+			lines = append(lines, "")
+		}
+	}
+	for _, step := range todo.Steps {
+		if !steps {
+			break
+		}
+		mark := "[ ] "
+		if step.Completed {
+			mark = "[x] "
+		}
+		lines = append(lines, mark+step.Content)
+	}
+	return escapeICSText(strings.Join(lines, "\n"))
+}
+
+func (iw *icsWriter) begin() {
+	iw.line("BEGIN", "VCALENDAR")
+	iw.line("VERSION", "2.0")
+	iw.line("PRODID", "-//TodoList//Todo Feed//EN")
+	iw.line("CALSCALE", "GREGORIAN")
+	iw.line("METHOD", "PUBLISH")
+	iw.line("X-WR-CALNAME", "TodoList")
+	iw.line("REFRESH-INTERVAL;VALUE=DURATION", "PT1H")
+	iw.line("X-PUBLISHED-TTL", "PT1H")
+}
+
+func (iw *icsWriter) end() {
+	iw.line("END", "VCALENDAR")
+}
+
+// common 输出 VEVENT 和 VTODO 共有的属性
+func (iw *icsWriter) common(todo models.Todo, uid, summary string, opts icsOptions) {
+	iw.line("UID", uid)
+	iw.line("DTSTAMP", formatICSTime(todo.UpdatedAt))
+	iw.line("CREATED", formatICSTime(todo.CreatedAt))
+	iw.line("LAST-MODIFIED", formatICSTime(todo.UpdatedAt))
+	iw.line("SUMMARY", escapeICSText(summary))
+	if description := icsDescription(todo, opts.steps); description != "" {
+		iw.line("DESCRIPTION", description)
+	}
+	iw.line("PRIORITY", icsPriority(todo.Priority))
+	if categories := icsCategories(todo); categories != "" {
+		iw.line("CATEGORIES", categories)
+	}
+}
+
+// alarm 开启提醒且未完成时输出 VALARM；related 为 END 时相对于 VTODO 的 DUE
+func (iw *icsWriter) alarm(todo models.Todo, opts icsOptions, related string) {
+	if !todo.Reminder || todo.Done {
+		return
+	}
+	iw.line("BEGIN", "VALARM")
+	iw.line("ACTION", "DISPLAY")
+	iw.line("DESCRIPTION", escapeICSText(todo.Task))
+	iw.line("TRIGGER"+related, fmt.Sprintf("-PT%dM", opts.alarmMinutes))
+	iw.line("END", "VALARM")
+}
+
+// event 把截止时间输出为日程：有具体时间时持续预估时间（默认30分钟），只有日期时为全天日程
+func (iw *icsWriter) event(todo models.Todo, opts icsOptions) {
+	summary := todo.Task
+	if todo.Done {
+		summary = "✓ " + summary
+	}
+
+	iw.line("BEGIN", "VEVENT")
+	iw.common(todo, todo.UUID+"-due@todolist", summary, opts)
+	param, value := icsDate(*todo.DueDate)
+	iw.line("DTSTART"+param, value)
+	if param != "" {
+		iw.line("DURATION", "P1D")
+	} else {
+		minutes := defaultEventMinutes
+		if todo.EstimatedTime != nil && *todo.EstimatedTime > 0 {
+			minutes = *todo.EstimatedTime
+		}
+		iw.line("DURATION", fmt.Sprintf("PT%dM", minutes))
+	}
+	iw.line("STATUS", "CONFIRMED")
+	iw.line("TRANSP", "TRANSPARENT")
+	iw.alarm(todo, opts, "")
+	iw.line("END", "VEVENT")
+}
+
+// todo 输出为任务，完成状态和按步骤计算的完成百分比一并输出
+func (iw *icsWriter) todo(todo models.Todo, uid string, opts icsOptions) {
+	iw.line("BEGIN", "VTODO")
+	iw.common(todo, uid, todo.Task, opts)
+	if todo.DueDate != nil {
+		param, value := icsDate(*todo.DueDate)
+		iw.line("DUE"+param, value)
+	}
+
+	completedSteps := 0
+	for _, step := range todo.Steps {
+		if step.Completed {
+			completedSteps++
+		}
+	}
+	switch {
+	case todo.Done:
+		iw.line("STATUS", "COMPLETED")
+		iw.line("PERCENT-COMPLETE", "100")
+		if todo.CompletedAt != nil {
+			iw.line("COMPLETED", formatICSTime(*todo.CompletedAt))
+		}
+	case completedSteps > 0:
+		iw.line("STATUS", "IN-PROCESS")
+		iw.line("PERCENT-COMPLETE", strconv.Itoa(completedSteps*100/len(todo.Steps)))
+	default:
+		iw.line("STATUS", "NEEDS-ACTION")
+	}
+	iw.alarm(todo, opts, ";RELATED=END")
+	iw.line("END", "VTODO")
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TodoList/models"
+)
+
+func TestFoldICSLine(t *testing.T) {
+	line := "DESCRIPTION:" + strings.Repeat("待办", 30)
+	folded := foldICSLine(line)
+	for _, l := range strings.Split(strings.TrimSuffix(folded, "\r\n"), "\r\n") {
+		if len(l) > icsLineLimit {
+			t.Errorf("line too long (%d bytes): %q", len(l), l)
+		}
+	}
+	if unfolded := strings.ReplaceAll(strings.TrimSuffix(folded, "\r\n"), "\r\n ", ""); unfolded != line {
+		t.Errorf("unfolded = %q", unfolded)
+	}
+}
+
+func TestEscapeICSText(t *testing.T) {
+	if got := escapeICSText("a,b;c\\d\r\ne"); got != `a\,b\;c\\d\ne` {
+		t.Errorf("escapeICSText = %q", got)
+	}
+}
+
+func TestICSWriter(t *testing.T) {
+	due := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	completed := due.Add(-time.Hour)
+	estimated := 45
+	todo := models.Todo{
+		UUID:          "0190a6e2-3c4b-7d8e-9f01-23456789abcd",
+		Task:          "Write report",
+		Priority:      "high",
+		Category:      "work",
+		Tags:          []string{"q2"},
+		DueDate:       &due,
+		Reminder:      true,
+		EstimatedTime: &estimated,
+		Steps:         []models.Step{{Content: "outline", Completed: true}, {Content: "draft"}},
+	}
+
+	var b strings.Builder
+	ics := &icsWriter{w: &b}
+	opts := icsOptions{events: true, todos: true, steps: true, alarmMinutes: 10}
+	ics.event(todo, opts)
+	ics.todo(todo, todo.UUID+"@todolist", opts)
+	out := b.String()
+
+	for _, want := range []string{
+		"UID:0190a6e2-3c4b-7d8e-9f01-23456789abcd-due@todolist\r\n",
+		"DTSTART:20240501T093000Z\r\n",
+		"DURATION:PT45M\r\n",
+		"TRIGGER:-PT10M\r\n",
+		"UID:0190a6e2-3c4b-7d8e-9f01-23456789abcd@todolist\r\n",
+		"DUE:20240501T093000Z\r\n",
+		"PRIORITY:1\r\n",
+		"CATEGORIES:work,q2\r\n",
+		"DESCRIPTION:[x] outline\\n[ ] draft\r\n",
+		"STATUS:IN-PROCESS\r\n",
+		"PERCENT-COMPLETE:50\r\n",
+		"TRIGGER;RELATED=END:-PT10M\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+
+	// 已完成：不再提醒；只有日期的截止时间按全天处理
+	dateOnly := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	todo.Done, todo.CompletedAt, todo.DueDate = true, &completed, &dateOnly
+	b.Reset()
+	ics.todo(todo, todo.UUID+"@todolist", opts)
+	out = b.String()
+	for _, want := range []string{"DUE;VALUE=DATE:20240501\r\n", "STATUS:COMPLETED\r\n", "COMPLETED:20240501T083000Z\r\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "VALARM") {
+		t.Errorf("completed todo has an alarm:\n%s", out)
+	}
+}
+
+func TestParseICSOptions(t *testing.T) {
+	opts, err := parseICSOptions(httptest.NewRequest("GET", "/api/calendar/x.ics", nil))
+	if err != nil || !opts.events || opts.todos || opts.alarmMinutes != defaultAlarmMinutes {
+		t.Errorf("defaults = %+v, %v", opts, err)
+	}
+	opts, err = parseICSOptions(httptest.NewRequest("GET", "/api/calendar/x.ics?components=vtodo,VEVENT&alarm=60", nil))
+	if err != nil || !opts.events || !opts.todos || opts.alarmMinutes != 60 {
+		t.Errorf("parsed = %+v, %v", opts, err)
+	}
+	for _, query := range []string{"components=vjournal", "alarm=-5", "alarm=soon"} {
+		if _, err := parseICSOptions(httptest.NewRequest("GET", "/api/calendar/x.ics?"+query, nil)); err == nil {
+			t.Errorf("%s accepted", query)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/TodoList/models"
+)
+
+// CategoryHandler 处理分类相关的HTTP请求
+type CategoryHandler struct {
+	Model *models.CategoryModel
+}
+
+// NewCategoryHandler 创建一个新的CategoryHandler实例
+func NewCategoryHandler(model *models.CategoryModel) *CategoryHandler {
+	return &CategoryHandler{Model: model}
+}
+
+// GetCategories 获取当前用户的分类
+func (h *CategoryHandler) GetCategories(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	categories, err := h.Model.GetCategories(userID)
+	if err != nil {
+		log.Printf("获取分类失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(categories)
+}
+
+// CreateCategory 创建分类
+func (h *CategoryHandler) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var category models.Category
+	if err := json.NewDecoder(r.Body).Decode(&category); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	category.UserID = userID
+	if err := h.Model.CreateCategory(&category); err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidCategory):
+			http.Error(w, "Invalid category", http.StatusBadRequest)
+		case errors.Is(err, models.ErrDuplicateCategory):
+			http.Error(w, "Category already exists", http.StatusConflict)
+		default:
+			log.Printf("创建分类失败: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(category)
+}
+
+// UpdateCategory 更新分类，改名时同步改写相关待办事项
+func (h *CategoryHandler) UpdateCategory(w http.ResponseWriter, r *http.Request, categoryID int) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var category models.Category
+	if err := json.NewDecoder(r.Body).Decode(&category); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	category.ID = categoryID
+	category.UserID = userID
+	if err := h.Model.UpdateCategory(&category); err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidCategory):
+			http.Error(w, "Invalid category", http.StatusBadRequest)
+		case errors.Is(err, models.ErrUnknownCategory):
+			http.Error(w, "Category not found", http.StatusNotFound)
+		case errors.Is(err, models.ErrDuplicateCategory):
+			http.Error(w, "Category already exists", http.StatusConflict)
+		default:
+			log.Printf("更新分类失败: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(category)
+}
+
+// DeleteCategory 删除分类，其中的待办事项改为 ?reassignTo= 指定的分类
+func (h *CategoryHandler) DeleteCategory(w http.ResponseWriter, r *http.Request, categoryID int) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	reassigned, err := h.Model.DeleteCategory(userID, categoryID, r.URL.Query().Get("reassignTo"))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrUnknownCategory):
+			http.Error(w, "Category not found", http.StatusNotFound)
+		case errors.Is(err, models.ErrLastCategory):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			log.Printf("删除分类失败: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":         true,
+		"reassignedTodos": reassigned,
+	})
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/TodoList/models"
+)
+
+func TestCategoryHandlerInvalidCategory(t *testing.T) {
+	// 分类无效时在访问数据库之前返回
+	h := NewCategoryHandler(models.NewCategoryModel(nil))
+	update := func(w http.ResponseWriter, r *http.Request) { h.UpdateCategory(w, r, 1) }
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		body    string
+	}{
+		{"create empty name", h.CreateCategory, `{"name":" "}`},
+		{"create long name", h.CreateCategory, `{"name":"` + strings.Repeat("x", 21) + `"}`},
+		{"create bad color", h.CreateCategory, `{"name":"work","color":"red"}`},
+		{"create bad priority", h.CreateCategory, `{"name":"work","defaultPriority":"urgent"}`},
+		{"create invalid json", h.CreateCategory, `[]`},
+		{"update bad color", update, `{"name":"work","color":"#12"}`},
+		{"update empty name", update, `{"name":""}`},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/api/categories", strings.NewReader(tt.body))
+		r = r.WithContext(context.WithValue(r.Context(), "userID", 1))
+		w := httptest.NewRecorder()
+		tt.handler(w, r)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", tt.name, w.Code)
+		}
+	}
+}
+
+func TestWriteBatchErrorUnknownCategory(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeBatchError(w, models.ErrUnknownCategory)
+
+	var body map[string]string
+	json.NewDecoder(w.Body).Decode(&body)
+	if w.Code != http.StatusBadRequest || body["field"] != "category" {
+		t.Errorf("response = %d %v", w.Code, body)
+	}
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/TodoList/models"
+)
+
+// CustomFieldHandler 处理自定义字段定义相关的HTTP请求
+type CustomFieldHandler struct {
+	Model *models.CustomFieldModel
+}
+
+// NewCustomFieldHandler 创建一个新的CustomFieldHandler实例
+func NewCustomFieldHandler(model *models.CustomFieldModel) *CustomFieldHandler {
+	return &CustomFieldHandler{Model: model}
+}
+
+// GetDefinitions 获取当前用户的自定义字段定义
+func (h *CustomFieldHandler) GetDefinitions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	defs, err := h.Model.GetDefinitions(userID)
+	if err != nil {
+		log.Printf("获取自定义字段失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(defs)
+}
+
+// CreateDefinition 创建自定义字段定义
+func (h *CustomFieldHandler) CreateDefinition(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var def models.CustomFieldDefinition
+	if err := json.NewDecoder(r.Body).Decode(&def); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !models.KeyPattern.MatchString(def.Key) {
+		http.Error(w, "Invalid field key", http.StatusBadRequest)
+		return
+	}
+	if !models.IsValidFieldType(def.Type) {
+		http.Error(w, "Invalid field type", http.StatusBadRequest)
+		return
+	}
+	if msg := validateFieldDefinition(&def); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	def.UserID = userID
+	if err := h.Model.CreateDefinition(&def); err != nil {
+		if errors.Is(err, models.ErrDuplicateCustomField) {
+			http.Error(w, "Custom field already exists", http.StatusConflict)
+			return
+		}
+		log.Printf("创建自定义字段失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(def)
+}
+
+// UpdateDefinition 更新自定义字段定义（key 和类型不可修改）
+func (h *CustomFieldHandler) UpdateDefinition(w http.ResponseWriter, r *http.Request, fieldID int) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var def models.CustomFieldDefinition
+	if err := json.NewDecoder(r.Body).Decode(&def); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	def.ID = fieldID
+	def.UserID = userID
+
+	// 选项校验依赖字段类型，以数据库中的类型为准
+	defs, err := h.Model.GetDefinitions(userID)
+	if err != nil {
+		log.Printf("获取自定义字段失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	for _, existing := range defs {
+		if existing.ID == fieldID {
+			def.Type = existing.Type
+		}
+	}
+	if def.Type == "" {
+		http.Error(w, "Custom field not found", http.StatusNotFound)
+		return
+	}
+	if msg := validateFieldDefinition(&def); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Model.UpdateDefinition(&def); err != nil {
+		if errors.Is(err, models.ErrUnknownCustomField) {
+			http.Error(w, "Custom field not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("更新自定义字段失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(def)
+}
+
+// DeleteDefinition 删除自定义字段定义及其在待办事项中的值
+func (h *CustomFieldHandler) DeleteDefinition(w http.ResponseWriter, r *http.Request, fieldID int) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.Model.DeleteDefinition(userID, fieldID); err != nil {
+		if errors.Is(err, models.ErrUnknownCustomField) {
+			http.Error(w, "Custom field not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("删除自定义字段失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// validateFieldDefinition 校验自定义字段定义的可编辑字段，返回错误信息
+func validateFieldDefinition(def *models.CustomFieldDefinition) string {
+	if def.Name == "" || len([]rune(def.Name)) > 50 {
+		return "Field name must be 1-50 characters"
+	}
+
+	switch def.Type {
+	case models.FieldTypeSelect, models.FieldTypeMultiSelect:
+		if len(def.Options) == 0 {
+			return "Select fields require at least one option"
+		}
+		seen := make(map[string]bool, len(def.Options))
+		for _, option := range def.Options {
+			if option == "" || seen[option] {
+				return "Options must be unique and non-empty"
+			}
+			seen[option] = true
+		}
+	default:
+		def.Options = nil
+	}
+
+	return ""
+}
@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -14,37 +17,77 @@ import (
 
 // EnhancedTodoHandler 增强的待办事项处理器
 type EnhancedTodoHandler struct {
-	Model *models.TodoModel
+	Model        *models.TodoModel
+	Workflow     *models.WorkflowModel
+	CustomFields *models.CustomFieldModel
+	Tags         *models.TagModel
+	Categories   *models.CategoryModel
+	SavedFilters *models.SavedFilterModel
+	Undo         *models.UndoModel
 }
 
 // NewEnhancedTodoHandler 创建新的增强处理器
-func NewEnhancedTodoHandler(model *models.TodoModel) *EnhancedTodoHandler {
-	return &EnhancedTodoHandler{Model: model}
+func NewEnhancedTodoHandler(model *models.TodoModel, undo *models.UndoModel) *EnhancedTodoHandler {
+	return &EnhancedTodoHandler{
+		Model:        model,
+		Undo:         undo,
+		Workflow:     models.NewWorkflowModel(model.DB),
+		CustomFields: models.NewCustomFieldModel(model.DB),
+		Tags:         models.NewTagModel(model.DB),
+		Categories:   models.NewCategoryModel(model.DB),
+		SavedFilters: models.NewSavedFilterModel(model.DB),
+	}
 }
 
 // BatchUpdateRequest 批量更新请求
 type BatchUpdateRequest struct {
-	TodoIDs []int                  `json:"todoIds"`
-	Updates map[string]interface{} `json:"updates"`
+	TodoIDs  []int                  `json:"todoIds"`
+	Updates  models.TodoBatchUpdate `json:"updates"`
+	Versions map[int]int            `json:"versions,omitempty"` // 可选：待办事项ID -> 期望的版本号
+	Mode     string                 `json:"mode,omitempty"`     // atomic（默认）或 best-effort
 }
 
 // BatchDeleteRequest 批量删除请求
 type BatchDeleteRequest struct {
-	TodoIDs []int `json:"todoIds"`
+	TodoIDs  []int       `json:"todoIds"`
+	Versions map[int]int `json:"versions,omitempty"`
+	Mode     string      `json:"mode,omitempty"`
 }
 
 // FilterParams 过滤参数
 type FilterParams struct {
 	Status      string     `json:"status"`      // all, completed, pending
+	State       string     `json:"state"`       // 工作流状态key，空表示全部
 	Priority    string     `json:"priority"`    // all, high, medium, low
 	Category    string     `json:"category"`    // all, work, personal, etc.
 	Search      string     `json:"search"`      // 搜索关键词
-	SortBy      string     `json:"sortBy"`      // createdAt, updatedAt, priority, alphabetical
+	Tags        []string   `json:"tags"`        // 标签过滤
+	TagMode     string     `json:"tagMode"`     // any, all, none
+	SortBy      string     `json:"sortBy"`      // createdAt, updatedAt, dueDate, priority, alphabetical, relevance
 	SortOrder   string     `json:"sortOrder"`   // asc, desc
 	Page        int        `json:"page"`        // 页码
 	PageSize    int        `json:"pageSize"`    // 每页大小
 	DueDateFrom *time.Time `json:"dueDateFrom"` // 截止日期范围开始
 	DueDateTo   *time.Time `json:"dueDateTo"`   // 截止日期范围结束
+	Due         string     `json:"due"`         // 相对截止日期：today, next7days, overdue, none
+	Query       string     `json:"q,omitempty"` // 查询语言，见 query_language.go
+
+	CustomFields  []CustomFieldFilter `json:"customFields,omitempty"` // cf.<key>[.<op>]=value
+	SortFieldType string              `json:"-"`                      // sortBy=cf.<key> 时字段的类型
+
+	queryCondition string        // 编译后的查询语言条件，由 resolveQuery 填充
+	queryArgs      []interface{} // queryCondition 的参数，占位符从 $2 开始
+	withSteps      bool          // include=steps 时加载步骤
+}
+
+// CustomFieldFilter 自定义字段过滤条件
+type CustomFieldFilter struct {
+	Key   string `json:"key"`
+	Op    string `json:"op"` // eq, ne, gt, gte, lt, lte, contains, exists
+	Value string `json:"value"`
+
+	fieldType  string      // 字段类型，由 resolveCustomFields 填充
+	typedValue interface{} // 按字段类型解析后的值
 }
 
 // GetTodosWithFilter 获取带过滤的待办事项
@@ -56,20 +99,58 @@ func (h *EnhancedTodoHandler) GetTodosWithFilter(w http.ResponseWriter, r *http.
 		return
 	}
 
-	// 解析查询参数
-	filters := parseFilterParams(r)
+	filters, ok := h.requestFilters(w, r, userID)
+	if !ok {
+		return
+	}
+	// page/pageSize 模式原来总是返回步骤，只有游标分页默认不加载步骤
+	filters.withSteps = includeSteps(r, !wantsCursorPage(r))
 
 	// 构建查询
-	query, args := buildFilterQuery(userID, filters)
+	fq := buildFilterQuery(userID, filters)
 
-	// 执行查询
-	todos, total, err := h.executeFilterQuery(query, args, filters)
+	// 游标分页：带 cursor 或 limit 参数（且没有 page）时使用
+	if wantsCursorPage(r) {
+		page := parsePageRequest(r)
+		todos, info, err := h.executeCursorQuery(fq, filters, page)
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidCursor) {
+				http.Error(w, "Invalid cursor", http.StatusBadRequest)
+				return
+			}
+			log.Printf("查询失败: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if notModified(w, r, pageETag(todos, info)) {
+			return
+		}
+		writeCursorPage(w, r, todos, info, map[string]interface{}{"filters": filters})
+		return
+	}
+
+	// 兼容模式：page/pageSize
+	todos, total, err := h.executeFilterQuery(fq, filters)
 	if err != nil {
 		log.Printf("查询失败: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
+	if notModified(w, r, listETag(todos, strconv.Itoa(total))) {
+		return
+	}
+
+	hasMore := (filters.Page * filters.PageSize) < total
+	links := map[string]string{"first": pageLink(r, map[string]string{"page": "1"})}
+	if filters.Page > 1 {
+		links["prev"] = pageLink(r, map[string]string{"page": strconv.Itoa(filters.Page - 1)})
+	}
+	if hasMore {
+		links["next"] = pageLink(r, map[string]string{"page": strconv.Itoa(filters.Page + 1)})
+	}
+	setLinkHeader(w, links)
+
 	// 构建响应
 	response := map[string]interface{}{
 		"todos": todos,
@@ -77,7 +158,7 @@ func (h *EnhancedTodoHandler) GetTodosWithFilter(w http.ResponseWriter, r *http.
 			"total":    total,
 			"page":     filters.Page,
 			"pageSize": filters.PageSize,
-			"hasMore":  (filters.Page * filters.PageSize) < total,
+			"hasMore":  hasMore,
 		},
 		"filters": filters,
 	}
@@ -86,7 +167,38 @@ func (h *EnhancedTodoHandler) GetTodosWithFilter(w http.ResponseWriter, r *http.
 	json.NewEncoder(w).Encode(response)
 }
 
-// BatchUpdate 批量更新待办事项
+// requestFilters 解析并校验请求中的过滤参数，指定 savedFilter 时以保存的条件为基础。
+// 失败时已经输出了错误响应，返回 false。
+func (h *EnhancedTodoHandler) requestFilters(w http.ResponseWriter, r *http.Request, userID int) (FilterParams, bool) {
+	base := defaultFilterParams()
+	if ref := r.URL.Query().Get("savedFilter"); ref != "" {
+		saved, err := h.resolveSavedFilter(userID, ref)
+		if err != nil {
+			if errors.Is(err, models.ErrSavedFilterNotFound) {
+				http.Error(w, "Saved filter not found", http.StatusNotFound)
+				return base, false
+			}
+			log.Printf("获取保存的过滤器失败: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return base, false
+		}
+		base = saved
+	}
+
+	filters := applyFilterQuery(r, base)
+	if err := validateFilterParams(&filters); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return filters, false
+	}
+	if err := h.resolveFilters(userID, &filters); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return filters, false
+	}
+	return filters, true
+}
+
+// BatchUpdate 批量更新待办事项。默认原子模式：所有项在一个事务中，任意一项失败则全部回滚；
+// mode=best-effort 时每一项独立生效。响应中包含每一项的结果。
 func (h *EnhancedTodoHandler) BatchUpdate(w http.ResponseWriter, r *http.Request) {
 	// 从上下文中获取用户ID
 	userID, ok := r.Context().Value("userID").(int)
@@ -96,47 +208,48 @@ func (h *EnhancedTodoHandler) BatchUpdate(w http.ResponseWriter, r *http.Request
 	}
 
 	var req BatchUpdateRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error(), "")
 		return
 	}
-
-	if len(req.TodoIDs) == 0 {
-		http.Error(w, "No todo IDs provided", http.StatusBadRequest)
-		return
+	if req.Mode == "" {
+		req.Mode = models.BatchAtomic
 	}
 
-	// 验证所有待办事项都属于当前用户
-	if !h.validateTodoOwnership(req.TodoIDs, userID) {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+	before, err := snapshotForUndo(h.Undo, userID, req.TodoIDs...)
+	if err != nil {
+		log.Printf("读取撤销快照失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	// 执行批量更新
-	err := h.executeBatchUpdate(req.TodoIDs, req.Updates)
+	result, err := h.Model.BatchUpdateTodos(userID, req.TodoIDs, &req.Updates, req.Versions, req.Mode)
 	if err != nil {
-		log.Printf("批量更新失败: %v", err)
-		http.Error(w, "Batch update failed", http.StatusInternalServerError)
+		writeBatchError(w, err)
 		return
 	}
 
-	// 返回更新后的待办事项
-	updatedTodos, err := h.getTodosByIDs(req.TodoIDs)
+	// 返回成功更新的待办事项
+	var updatedIDs []int
+	for _, item := range result.Results {
+		if item.Status == models.BatchItemUpdated {
+			updatedIDs = append(updatedIDs, item.ID)
+		}
+	}
+	updatedTodos, err := h.getTodosByIDs(userID, updatedIDs)
 	if err != nil {
 		log.Printf("获取更新后的待办事项失败: %v", err)
 		http.Error(w, "Failed to fetch updated todos", http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"message": fmt.Sprintf("Successfully updated %d todos", len(req.TodoIDs)),
-		"todos":   updatedTodos,
-	})
+	undoToken := recordUndo(h.Undo, userID, models.UndoActionBatchUpdate, before, updatedIDs...)
+	writeBatchResult(w, result, fmt.Sprintf("Successfully updated %d todos", result.Succeeded), "todos", updatedTodos, undoToken)
 }
 
-// BatchDelete 批量删除待办事项
+// BatchDelete 批量删除待办事项，模式与 BatchUpdate 相同
 func (h *EnhancedTodoHandler) BatchDelete(w http.ResponseWriter, r *http.Request) {
 	// 从上下文中获取用户ID
 	userID, ok := r.Context().Value("userID").(int)
@@ -146,36 +259,91 @@ func (h *EnhancedTodoHandler) BatchDelete(w http.ResponseWriter, r *http.Request
 	}
 
 	var req BatchDeleteRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error(), "")
 		return
 	}
-
-	if len(req.TodoIDs) == 0 {
-		http.Error(w, "No todo IDs provided", http.StatusBadRequest)
-		return
+	if req.Mode == "" {
+		req.Mode = models.BatchAtomic
 	}
 
-	// 验证所有待办事项都属于当前用户
-	if !h.validateTodoOwnership(req.TodoIDs, userID) {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+	before, err := snapshotForUndo(h.Undo, userID, req.TodoIDs...)
+	if err != nil {
+		log.Printf("读取撤销快照失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	// 执行批量删除
-	err := h.executeBatchDelete(req.TodoIDs)
+	result, err := h.Model.BatchDeleteTodos(userID, req.TodoIDs, req.Versions, req.Mode)
 	if err != nil {
-		log.Printf("批量删除失败: %v", err)
-		http.Error(w, "Batch delete failed", http.StatusInternalServerError)
+		writeBatchError(w, err)
 		return
 	}
 
+	deletedIDs := []int{}
+	for _, item := range result.Results {
+		if item.Status == models.BatchItemDeleted {
+			deletedIDs = append(deletedIDs, item.ID)
+		}
+	}
+
+	undoToken := recordUndo(h.Undo, userID, models.UndoActionBatchDelete, before, deletedIDs...)
+	writeBatchResult(w, result, fmt.Sprintf("Successfully deleted %d todos", result.Succeeded), "deletedIds", deletedIDs, undoToken)
+}
+
+// writeBatchError 输出批量请求本身无效时的错误
+func writeBatchError(w http.ResponseWriter, err error) {
+	var fieldErr *models.TodoFieldError
+	switch {
+	case errors.As(err, &fieldErr):
+		writeJSONError(w, http.StatusBadRequest, fieldErr.Message, fieldErr.Field)
+	case errors.Is(err, models.ErrUnknownStatus):
+		writeJSONError(w, http.StatusBadRequest, "Unknown status", "status")
+	case errors.Is(err, models.ErrUnknownCategory):
+		writeJSONError(w, http.StatusBadRequest, "Unknown category", "category")
+	case errors.Is(err, models.ErrInvalidTag):
+		writeJSONError(w, http.StatusBadRequest, "Invalid tag name", "tags")
+	default:
+		log.Printf("批量操作失败: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Batch operation failed", "")
+	}
+}
+
+// writeBatchResult 输出批量操作的结果。原子模式失败时：存在版本冲突返回 412，否则返回 409；
+// 尽力模式总是返回 200，由每一项的状态说明结果。有生效的项时附带撤销令牌。
+func writeBatchResult(w http.ResponseWriter, result *models.BatchResult, message, key string, data interface{}, undoToken string) {
+	status := http.StatusOK
+	if result.Mode == models.BatchAtomic && result.Failed > 0 {
+		status = http.StatusConflict
+		message = "Batch rolled back: some todos could not be processed"
+		for _, item := range result.Results {
+			if item.Status == models.BatchItemConflict {
+				status = http.StatusPreconditionFailed
+				break
+			}
+		}
+	} else if result.Failed > 0 {
+		message = fmt.Sprintf("%s, %d failed", message, result.Failed)
+	}
+
+	body := map[string]interface{}{
+		"success":   result.Failed == 0,
+		"message":   message,
+		"mode":      result.Mode,
+		"succeeded": result.Succeeded,
+		"failed":    result.Failed,
+		"results":   result.Results,
+		key:         data,
+	}
+	if undoToken != "" {
+		body["undoToken"] = undoToken
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success":    true,
-		"message":    fmt.Sprintf("Successfully deleted %d todos", len(req.TodoIDs)),
-		"deletedIds": req.TodoIDs,
-	})
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
 }
 
 // GetTodoStats 获取待办事项统计信息
@@ -198,17 +366,46 @@ func (h *EnhancedTodoHandler) GetTodoStats(w http.ResponseWriter, r *http.Reques
 	json.NewEncoder(w).Encode(stats)
 }
 
+// defaultFilterParams 返回默认的过滤参数
+func defaultFilterParams() FilterParams {
+	return FilterParams{
+		Status:    "all",
+		Priority:  "all",
+		Category:  "all",
+		TagMode:   "any",
+		SortBy:    "createdAt",
+		SortOrder: "desc",
+		Page:      1,
+		PageSize:  20,
+	}
+}
+
 // parseFilterParams 解析过滤参数
 func parseFilterParams(r *http.Request) FilterParams {
-	params := FilterParams{
-		Status:    getQueryParam(r, "status", "all"),
-		Priority:  getQueryParam(r, "priority", "all"),
-		Category:  getQueryParam(r, "category", "all"),
-		Search:    getQueryParam(r, "search", ""),
-		SortBy:    getQueryParam(r, "sortBy", "createdAt"),
-		SortOrder: getQueryParam(r, "sortOrder", "desc"),
-		Page:      getQueryParamInt(r, "page", 1),
-		PageSize:  getQueryParamInt(r, "pageSize", 20),
+	return applyFilterQuery(r, defaultFilterParams())
+}
+
+// applyFilterQuery 用查询字符串中出现的参数覆盖 base 中的过滤条件
+func applyFilterQuery(r *http.Request, base FilterParams) FilterParams {
+	params := base
+	params.Status = getQueryParam(r, "status", base.Status)
+	params.State = getQueryParam(r, "state", base.State)
+	params.Priority = getQueryParam(r, "priority", base.Priority)
+	params.Category = getQueryParam(r, "category", base.Category)
+	params.Search = getQueryParam(r, "search", base.Search)
+	params.TagMode = getQueryParam(r, "tagMode", base.TagMode)
+	params.SortBy = getQueryParam(r, "sortBy", base.SortBy)
+	params.SortOrder = getQueryParam(r, "sortOrder", base.SortOrder)
+	params.Page = getQueryParamInt(r, "page", base.Page)
+	params.PageSize = getQueryParamInt(r, "pageSize", base.PageSize)
+	params.Due = getQueryParam(r, "due", base.Due)
+
+	// 保存的过滤器中的查询与请求中的查询同时生效
+	if q := strings.TrimSpace(r.URL.Query().Get("q")); q != "" {
+		if strings.TrimSpace(base.Query) != "" {
+			q = "(" + base.Query + ") (" + q + ")"
+		}
+		params.Query = q
 	}
 
 	// 解析日期参数
@@ -224,9 +421,218 @@ func parseFilterParams(r *http.Request) FilterParams {
 		}
 	}
 
+	// 解析标签过滤：tags=a,b
+	if tags := r.URL.Query().Get("tags"); tags != "" {
+		params.Tags, _ = models.NormalizeTags(strings.Split(tags, ","))
+	}
+
+	// 解析自定义字段过滤：cf.<key>=value 或 cf.<key>.<op>=value
+	for name, values := range r.URL.Query() {
+		if !strings.HasPrefix(name, "cf.") || len(values) == 0 {
+			continue
+		}
+		key, op := strings.TrimPrefix(name, "cf."), "eq"
+		if idx := strings.Index(key, "."); idx != -1 {
+			key, op = key[:idx], key[idx+1:]
+		}
+		params.CustomFields = append(params.CustomFields, CustomFieldFilter{Key: key, Op: op, Value: values[0]})
+	}
+	sort.SliceStable(params.CustomFields, func(i, j int) bool {
+		return params.CustomFields[i].Key < params.CustomFields[j].Key
+	})
+
 	return params
 }
 
+// validateFilterParams 校验相对截止日期，并修正分页参数
+func validateFilterParams(filters *FilterParams) error {
+	switch filters.Due {
+	case "", "today", "next7days", "overdue", "none":
+	default:
+		return fmt.Errorf("invalid due filter: %s", filters.Due)
+	}
+
+	if filters.Page < 1 {
+		filters.Page = 1
+	}
+	if filters.PageSize < 1 {
+		filters.PageSize = 20
+	}
+	if filters.PageSize > models.MaxPageLimit {
+		filters.PageSize = models.MaxPageLimit
+	}
+	return nil
+}
+
+// decodeFilterCriteria 把保存的过滤条件解析为过滤参数，未保存的字段使用默认值
+func decodeFilterCriteria(criteria json.RawMessage) (FilterParams, error) {
+	params := defaultFilterParams()
+	if len(criteria) > 0 {
+		if err := json.Unmarshal(criteria, &params); err != nil {
+			return params, fmt.Errorf("invalid filter criteria")
+		}
+	}
+	params.Page, params.PageSize = 1, 20
+	return params, nil
+}
+
+// resolveFilters 校验需要用户数据的过滤条件：自定义字段和查询语言
+func (h *EnhancedTodoHandler) resolveFilters(userID int, filters *FilterParams) error {
+	if err := h.resolveCustomFields(userID, filters); err != nil {
+		return err
+	}
+	return h.resolveQuery(userID, filters)
+}
+
+// resolveQuery 解析并编译查询语言，结果保存在 filters 中供 buildFilterQuery 使用
+func (h *EnhancedTodoHandler) resolveQuery(userID int, filters *FilterParams) error {
+	node, err := parseQuery(filters.Query)
+	if err != nil || node == nil {
+		return err
+	}
+
+	var types map[string]string
+	if len(customFieldKeys(node)) > 0 {
+		defs, err := h.CustomFields.GetDefinitions(userID)
+		if err != nil {
+			return fmt.Errorf("failed to load custom fields")
+		}
+		types = make(map[string]string, len(defs))
+		for _, def := range defs {
+			types[def.Key] = def.Type
+		}
+	}
+
+	// buildFilterQuery 中 $1 是用户ID，查询语言的参数紧随其后
+	filters.queryCondition, filters.queryArgs, err = compileQuery(node, 2, types)
+	return err
+}
+
+// resolveCustomFields 根据用户的字段定义校验自定义字段过滤和排序条件
+func (h *EnhancedTodoHandler) resolveCustomFields(userID int, filters *FilterParams) error {
+	sortKey := strings.TrimPrefix(filters.SortBy, "cf.")
+	if len(filters.CustomFields) == 0 && sortKey == filters.SortBy {
+		return nil
+	}
+
+	defs, err := h.CustomFields.GetDefinitions(userID)
+	if err != nil {
+		return fmt.Errorf("failed to load custom fields")
+	}
+	types := make(map[string]string, len(defs))
+	for _, def := range defs {
+		types[def.Key] = def.Type
+	}
+
+	if sortKey != filters.SortBy {
+		fieldType, ok := types[sortKey]
+		if !ok {
+			return fmt.Errorf("unknown custom field: %s", sortKey)
+		}
+		filters.SortFieldType = fieldType
+	}
+
+	for i := range filters.CustomFields {
+		f := &filters.CustomFields[i]
+		fieldType, ok := types[f.Key]
+		if !ok {
+			return fmt.Errorf("unknown custom field: %s", f.Key)
+		}
+		f.fieldType = fieldType
+
+		if err := parseCustomFieldFilter(f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseCustomFieldFilter 检查操作符是否适用于字段类型，并解析过滤值
+func parseCustomFieldFilter(f *CustomFieldFilter) error {
+	invalid := fmt.Errorf("invalid filter for custom field %s", f.Key)
+
+	switch f.Op {
+	case "exists":
+		b, err := strconv.ParseBool(f.Value)
+		if err != nil {
+			return invalid
+		}
+		f.typedValue = b
+		return nil
+	case "eq", "ne":
+	case "gt", "gte", "lt", "lte":
+		if f.fieldType != models.FieldTypeNumber && f.fieldType != models.FieldTypeDate {
+			return invalid
+		}
+	case "contains":
+		if f.fieldType != models.FieldTypeText && f.fieldType != models.FieldTypeURL {
+			return invalid
+		}
+		f.typedValue = "%" + f.Value + "%"
+		return nil
+	default:
+		return invalid
+	}
+
+	switch f.fieldType {
+	case models.FieldTypeNumber:
+		n, err := strconv.ParseFloat(f.Value, 64)
+		if err != nil {
+			return invalid
+		}
+		f.typedValue = n
+	case models.FieldTypeCheckbox:
+		b, err := strconv.ParseBool(f.Value)
+		if err != nil {
+			return invalid
+		}
+		f.typedValue = b
+	case models.FieldTypeDate:
+		if _, err := time.Parse("2006-01-02", f.Value); err != nil {
+			return invalid
+		}
+		f.typedValue = f.Value
+	case models.FieldTypeMultiSelect:
+		// 多选字段的 eq 表示“包含该选项”
+		f.typedValue = []string{f.Value}
+	default:
+		f.typedValue = f.Value
+	}
+
+	return nil
+}
+
+// customFieldCondition 构建单个自定义字段过滤条件，返回条件和参数
+func customFieldCondition(f CustomFieldFilter, argIndex int) (string, []interface{}) {
+	switch f.Op {
+	case "exists":
+		cond := fmt.Sprintf("custom_fields ? $%d::text", argIndex)
+		if exists, _ := f.typedValue.(bool); !exists {
+			cond = "NOT (" + cond + ")"
+		}
+		return cond, []interface{}{f.Key}
+	case "contains":
+		return fmt.Sprintf("custom_fields->>$%d::text ILIKE $%d", argIndex, argIndex+1), []interface{}{f.Key, f.typedValue}
+	case "gt", "gte", "lt", "lte":
+		ops := map[string]string{"gt": ">", "gte": ">=", "lt": "<", "lte": "<="}
+		cast := "numeric"
+		if f.fieldType == models.FieldTypeDate {
+			cast = "date"
+		}
+		cond := fmt.Sprintf("(custom_fields->>$%d::text)::%s %s $%d::%s", argIndex, cast, ops[f.Op], argIndex+1, cast)
+		return cond, []interface{}{f.Key, f.typedValue}
+	}
+
+	// eq / ne 使用 @> 包含查询，可以利用 idx_todos_custom_fields GIN 索引
+	doc, _ := json.Marshal(map[string]interface{}{f.Key: f.typedValue})
+	cond := fmt.Sprintf("custom_fields @> $%d::jsonb", argIndex)
+	if f.Op == "ne" {
+		cond = "NOT (" + cond + ")"
+	}
+	return cond, []interface{}{string(doc)}
+}
+
 // getQueryParam 获取查询参数
 func getQueryParam(r *http.Request, key, defaultValue string) string {
 	if value := r.URL.Query().Get(key); value != "" {
@@ -245,8 +651,17 @@ func getQueryParamInt(r *http.Request, key string, defaultValue int) int {
 	return defaultValue
 }
 
+// filterQuery 过滤查询的组成部分：WHERE 子句、参数和排序。args 中前 whereArgs 个参数属于
+// WHERE 子句，之后是只在排序中使用的参数（按自定义字段排序时的字段 key）
+type filterQuery struct {
+	where     string
+	args      []interface{}
+	whereArgs int
+	keyset    models.Keyset
+}
+
 // buildFilterQuery 构建过滤查询
-func buildFilterQuery(userID int, filters FilterParams) (string, []interface{}) {
+func buildFilterQuery(userID int, filters FilterParams) filterQuery {
 	var conditions []string
 	var args []interface{}
 	argIndex := 1
@@ -256,6 +671,13 @@ func buildFilterQuery(userID int, filters FilterParams) (string, []interface{})
 	args = append(args, userID)
 	argIndex++
 
+	// 查询语言条件，由 resolveQuery 按 $2 起始编译
+	if filters.queryCondition != "" {
+		conditions = append(conditions, filters.queryCondition)
+		args = append(args, filters.queryArgs...)
+		argIndex += len(filters.queryArgs)
+	}
+
 	// 状态过滤
 	if filters.Status != "all" {
 		if filters.Status == "completed" {
@@ -268,6 +690,13 @@ func buildFilterQuery(userID int, filters FilterParams) (string, []interface{})
 		argIndex++
 	}
 
+	// 工作流状态过滤
+	if filters.State != "" {
+		conditions = append(conditions, fmt.Sprintf("status = $%d", argIndex))
+		args = append(args, filters.State)
+		argIndex++
+	}
+
 	// 优先级过滤
 	if filters.Priority != "all" {
 		conditions = append(conditions, fmt.Sprintf("priority = $%d", argIndex))
@@ -282,11 +711,32 @@ func buildFilterQuery(userID int, filters FilterParams) (string, []interface{})
 		argIndex++
 	}
 
-	// 搜索过滤
+	// 搜索过滤：使用 search_vector 全文索引，没有可搜索的词时退回 ILIKE
+	searchArg := 0
 	if filters.Search != "" {
-		searchCondition := fmt.Sprintf("(task ILIKE $%d OR description ILIKE $%d)", argIndex, argIndex)
-		conditions = append(conditions, searchCondition)
-		args = append(args, "%"+filters.Search+"%")
+		if tsquery := models.BuildTSQuery(filters.Search); tsquery != "" {
+			conditions = append(conditions, fmt.Sprintf("search_vector @@ to_tsquery('simple', $%d)", argIndex))
+			args = append(args, tsquery)
+			searchArg = argIndex
+		} else {
+			conditions = append(conditions, fmt.Sprintf("(task ILIKE $%d OR description ILIKE $%d)", argIndex, argIndex))
+			args = append(args, "%"+filters.Search+"%")
+		}
+		argIndex++
+	}
+
+	// 标签过滤，?| 和 @> 都可以利用 idx_todos_tags GIN 索引
+	if len(filters.Tags) > 0 {
+		tagsJSON, _ := json.Marshal(filters.Tags)
+		switch filters.TagMode {
+		case "all":
+			conditions = append(conditions, fmt.Sprintf("tags @> $%d::jsonb", argIndex))
+		case "none":
+			conditions = append(conditions, fmt.Sprintf("NOT (tags ?| ARRAY(SELECT jsonb_array_elements_text($%d::jsonb)))", argIndex))
+		default:
+			conditions = append(conditions, fmt.Sprintf("tags ?| ARRAY(SELECT jsonb_array_elements_text($%d::jsonb))", argIndex))
+		}
+		args = append(args, string(tagsJSON))
 		argIndex++
 	}
 
@@ -303,260 +753,231 @@ func buildFilterQuery(userID int, filters FilterParams) (string, []interface{})
 		argIndex++
 	}
 
-	// 构建WHERE子句
-	whereClause := "WHERE " + strings.Join(conditions, " AND ")
-
-	// 构建ORDER BY子句
-	orderBy := "ORDER BY "
-	switch filters.SortBy {
-	case "priority":
-		orderBy += "CASE WHEN priority = 'high' THEN 1 WHEN priority = 'medium' THEN 2 WHEN priority = 'low' THEN 3 ELSE 4 END"
-	case "alphabetical":
-		orderBy += "task"
-	case "updatedAt":
-		orderBy += "updated_at"
-	default:
-		orderBy += "created_at"
+	// 相对截止日期过滤，按数据库的当前日期计算
+	switch filters.Due {
+	case "today":
+		conditions = append(conditions, "due_date >= CURRENT_DATE AND due_date < CURRENT_DATE + 1")
+	case "next7days":
+		conditions = append(conditions, "due_date >= CURRENT_DATE AND due_date < CURRENT_DATE + 8")
+	case "overdue":
+		conditions = append(conditions, "due_date < NOW() AND done = false")
+	case "none":
+		conditions = append(conditions, "due_date IS NULL")
 	}
 
-	if filters.SortOrder == "asc" {
-		orderBy += " ASC"
-	} else {
-		orderBy += " DESC"
+	// 自定义字段过滤
+	for _, f := range filters.CustomFields {
+		cond, condArgs := customFieldCondition(f, argIndex)
+		conditions = append(conditions, cond)
+		args = append(args, condArgs...)
+		argIndex += len(condArgs)
 	}
 
-	// 构建LIMIT和OFFSET
-	offset := (filters.Page - 1) * filters.PageSize
-	limitClause := fmt.Sprintf("LIMIT %d OFFSET %d", filters.PageSize, offset)
-
-	// 完整查询
-	query := fmt.Sprintf(`
-		SELECT id, task, description, done, priority, category, due_date,
-		       reminder, estimated_time, tags, created_at, updated_at, completed_at
-		FROM todos
-		%s
-		%s
-		%s
-	`, whereClause, orderBy, limitClause)
+	whereArgs := len(args)
 
-	return query, args
-}
-
-// executeFilterQuery 执行过滤查询
-func (h *EnhancedTodoHandler) executeFilterQuery(query string, args []interface{}, filters FilterParams) ([]models.Todo, int, error) {
-	// 首先获取总数
-	countQuery := strings.Replace(query,
-		"SELECT id, task, description, done, priority, category, due_date, reminder, estimated_time, tags, created_at, updated_at, completed_at",
-		"SELECT COUNT(*)", 1)
-	// 移除LIMIT和OFFSET
-	if idx := strings.Index(countQuery, "LIMIT"); idx != -1 {
-		countQuery = countQuery[:idx]
+	// 按自定义字段排序时字段 key 作为参数传入排序表达式
+	sortArg := 0
+	if k := strings.TrimPrefix(filters.SortBy, "cf."); k != filters.SortBy && filters.SortFieldType != "" {
+		args = append(args, k)
+		sortArg = argIndex
 	}
 
-	var total int
-	err := h.Model.DB.QueryRow(countQuery, args...).Scan(&total)
-	if err != nil {
-		return nil, 0, fmt.Errorf("count query failed: %w", err)
+	return filterQuery{
+		where:     "WHERE " + strings.Join(conditions, " AND "),
+		args:      args,
+		whereArgs: whereArgs,
+		keyset:    filterKeyset(filters, searchArg, sortArg),
 	}
+}
 
-	// 执行主查询
-	rows, err := h.Model.DB.Query(query, args...)
-	if err != nil {
-		return nil, 0, fmt.Errorf("main query failed: %w", err)
+// filterKeyset 根据排序参数构建排序键，最后按 id 排序保证翻页稳定。searchArg、sortArg 是
+// 全文搜索词和自定义字段 key 的参数序号，为 0 表示没有
+func filterKeyset(filters FilterParams, searchArg, sortArg int) models.Keyset {
+	desc := filters.SortOrder != "asc"
+	keyset := models.Keyset{Name: filters.SortBy + ":asc"}
+	if desc {
+		keyset.Name = filters.SortBy + ":desc"
 	}
-	defer rows.Close()
 
-	var todos []models.Todo
-	for rows.Next() {
-		var todo models.Todo
-		var tagsJSON string
-
-		err := rows.Scan(
-			&todo.ID,
-			&todo.Task,
-			&todo.Description,
-			&todo.Done,
-			&todo.Priority,
-			&todo.Category,
-			&todo.DueDate,
-			&todo.Reminder,
-			&todo.EstimatedTime,
-			&tagsJSON,
-			&todo.CreatedAt,
-			&todo.UpdatedAt,
-			&todo.CompletedAt,
-		)
-		if err != nil {
-			log.Printf("scan todo failed: %v", err)
-			continue
+	var key models.SortKey
+	switch filters.SortBy {
+	case "priority":
+		key = models.SortKey{Expr: models.PriorityRankExpr, Cast: "integer"}
+	case "alphabetical":
+		key = models.SortKey{Expr: "task", Cast: "text"}
+	case "updatedAt":
+		key = models.SortKey{Expr: "updated_at", Cast: "timestamp"}
+	case "dueDate":
+		// 没有截止日期的排在最后
+		key = models.SortKey{Expr: fmt.Sprintf("COALESCE(due_date, '%s'::timestamp)", dueDateSentinel(desc)), Cast: "timestamp"}
+	case "relevance":
+		if searchArg > 0 {
+			// 浮点数相关度无法精确比较，使用偏移量游标
+			key = models.SortKey{Expr: fmt.Sprintf("ts_rank(search_vector, to_tsquery('simple', $%d))", searchArg), Cast: "real"}
+			keyset.OffsetOnly = true
+		} else {
+			key = models.SortKey{Expr: "created_at", Cast: "timestamp"}
 		}
-
-		// 解析标签
-		if tagsJSON != "" {
-			if err := json.Unmarshal([]byte(tagsJSON), &todo.Tags); err != nil {
-				log.Printf("parse tags failed: %v", err)
-				todo.Tags = []string{}
+	default:
+		if sortArg > 0 {
+			expr := fmt.Sprintf("(custom_fields->>$%d::text)", sortArg)
+			switch filters.SortFieldType {
+			case models.FieldTypeNumber:
+				expr += "::numeric"
+			case models.FieldTypeDate:
+				expr += "::date"
+			case models.FieldTypeCheckbox:
+				expr += "::boolean"
 			}
+			// 自定义字段可能为空，使用偏移量游标
+			key = models.SortKey{Expr: expr, NullsLast: true}
+			keyset.OffsetOnly = true
+		} else {
+			key = models.SortKey{Expr: "created_at", Cast: "timestamp"}
 		}
-
-		// 获取步骤
-		todo.Steps, _ = h.Model.GetStepsByTodoID(todo.ID)
-		todos = append(todos, todo)
 	}
 
-	return todos, total, nil
+	key.Desc = desc
+	keyset.Keys = []models.SortKey{key, {Expr: "id", Desc: desc, Cast: "integer"}}
+	return keyset
 }
 
-// validateTodoOwnership 验证待办事项所有权
-func (h *EnhancedTodoHandler) validateTodoOwnership(todoIDs []int, userID int) bool {
-	if len(todoIDs) == 0 {
-		return false
+// dueDateSentinel 没有截止日期时用于排序的哨兵值
+func dueDateSentinel(desc bool) string {
+	if desc {
+		return "-infinity"
 	}
+	return "infinity"
+}
 
-	// 构建查询，检查所有待办事项是否都属于当前用户
-	placeholders := make([]string, len(todoIDs))
-	args := make([]interface{}, len(todoIDs)+1)
-	args[0] = userID
-
-	for i, id := range todoIDs {
-		placeholders[i] = fmt.Sprintf("$%d", i+2)
-		args[i+1] = id
+// filterCursorValues 返回待办事项在 filterKeyset 排序下的键值，用于生成游标
+func filterCursorValues(filters FilterParams, todo models.Todo) []interface{} {
+	var value interface{}
+	switch filters.SortBy {
+	case "priority":
+		value = models.PriorityRank(todo.Priority)
+	case "alphabetical":
+		value = todo.Task
+	case "updatedAt":
+		value = todo.UpdatedAt
+	case "dueDate":
+		if todo.DueDate != nil {
+			value = *todo.DueDate
+		} else {
+			value = dueDateSentinel(filters.SortOrder != "asc")
+		}
+	default:
+		value = todo.CreatedAt
 	}
+	return []interface{}{value, todo.ID}
+}
 
-	query := fmt.Sprintf(`
-		SELECT COUNT(*)
-		FROM todos
-		WHERE user_id = $1 AND id IN (%s)
-	`, strings.Join(placeholders, ","))
-
-	var count int
-	err := h.Model.DB.QueryRow(query, args...).Scan(&count)
+// countFilteredTodos 统计过滤查询匹配的待办事项总数
+func (h *EnhancedTodoHandler) countFilteredTodos(fq filterQuery) (int, error) {
+	var total int
+	err := h.Model.DB.QueryRow("SELECT COUNT(*) FROM todos "+fq.where, fq.args[:fq.whereArgs]...).Scan(&total)
 	if err != nil {
-		log.Printf("验证待办事项所有权失败: %v", err)
-		return false
+		return 0, fmt.Errorf("count query failed: %w", err)
 	}
-
-	// 如果查询到的数量等于传入的ID数量，说明所有待办事项都属于当前用户
-	return count == len(todoIDs)
+	return total, nil
 }
 
-// executeBatchUpdate 执行批量更新
-func (h *EnhancedTodoHandler) executeBatchUpdate(todoIDs []int, updates map[string]interface{}) error {
-	if len(todoIDs) == 0 || len(updates) == 0 {
-		return fmt.Errorf("no todos or updates provided")
+// executeFilterQuery 按 page/pageSize 执行过滤查询（兼容模式）
+func (h *EnhancedTodoHandler) executeFilterQuery(fq filterQuery, filters FilterParams) ([]models.Todo, int, error) {
+	// 首先获取总数
+	total, err := h.countFilteredTodos(fq)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	// 构建更新语句
-	var setParts []string
-	var args []interface{}
-	argIndex := 1
-
-	// 处理更新字段
-	for key, value := range updates {
-		switch key {
-		case "done", "priority", "category", "reminder":
-			setParts = append(setParts, fmt.Sprintf("%s = $%d", key, argIndex))
-			args = append(args, value)
-			argIndex++
-		case "description", "task":
-			setParts = append(setParts, fmt.Sprintf("%s = $%d", key, argIndex))
-			args = append(args, value)
-			argIndex++
-		case "dueDate":
-			setParts = append(setParts, fmt.Sprintf("due_date = $%d", argIndex))
-			args = append(args, value)
-			argIndex++
-		case "estimatedTime":
-			setParts = append(setParts, fmt.Sprintf("estimated_time = $%d", argIndex))
-			args = append(args, value)
-			argIndex++
-		}
-	}
+	offset := (filters.Page - 1) * filters.PageSize
+	query := fmt.Sprintf("SELECT %s FROM todos %s %s LIMIT %d OFFSET %d",
+		models.TodoColumns, fq.where, fq.keyset.OrderBy(), filters.PageSize, offset)
 
-	if len(setParts) == 0 {
-		return fmt.Errorf("no valid update fields provided")
+	todos, err := h.queryTodos(query, fq.args, filters.withSteps)
+	if err != nil {
+		return nil, 0, err
 	}
+	return todos, total, nil
+}
 
-	// 添加updated_at字段
-	setParts = append(setParts, "updated_at = NOW()")
-
-	// 如果更新done为true，设置completed_at
-	if done, ok := updates["done"].(bool); ok && done {
-		setParts = append(setParts, "completed_at = NOW()")
+// executeCursorQuery 按游标执行过滤查询，总数可选
+func (h *EnhancedTodoHandler) executeCursorQuery(fq filterQuery, filters FilterParams, page models.PageRequest) ([]models.Todo, models.PageInfo, error) {
+	query, args, offset, err := models.BuildPageQuery("SELECT "+models.TodoColumns+" FROM todos", fq.where, fq.args, fq.keyset, page)
+	if err != nil {
+		return nil, models.PageInfo{}, err
 	}
 
-	// 构建WHERE子句
-	placeholders := make([]string, len(todoIDs))
-	for i, id := range todoIDs {
-		placeholders[i] = fmt.Sprintf("$%d", argIndex)
-		args = append(args, id)
-		argIndex++
+	todos, err := h.queryTodos(query, args, filters.withSteps)
+	if err != nil {
+		return nil, models.PageInfo{}, err
 	}
 
-	query := fmt.Sprintf(`
-		UPDATE todos
-		SET %s
-		WHERE id IN (%s)
-	`, strings.Join(setParts, ", "), strings.Join(placeholders, ","))
+	n, info := models.FinishPage(fq.keyset, page, len(todos), offset, func(i int) []interface{} {
+		return filterCursorValues(filters, todos[i])
+	})
+	todos = todos[:n]
 
-	_, err := h.Model.DB.Exec(query, args...)
-	if err != nil {
-		return fmt.Errorf("batch update failed: %w", err)
+	if page.WithTotal {
+		total, err := h.countFilteredTodos(fq)
+		if err != nil {
+			return nil, models.PageInfo{}, err
+		}
+		info.Total = &total
 	}
 
-	return nil
+	return todos, info, nil
 }
 
-// executeBatchDelete 执行批量删除
-func (h *EnhancedTodoHandler) executeBatchDelete(todoIDs []int) error {
-	if len(todoIDs) == 0 {
-		return fmt.Errorf("no todo IDs provided")
+// queryTodos 执行查询，withSteps 为 true 时用一次查询批量加载步骤
+func (h *EnhancedTodoHandler) queryTodos(query string, args []interface{}, withSteps bool) ([]models.Todo, error) {
+	rows, err := h.Model.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("main query failed: %w", err)
 	}
+	defer rows.Close()
 
-	// 构建删除语句
-	placeholders := make([]string, len(todoIDs))
-	args := make([]interface{}, len(todoIDs))
-
-	for i, id := range todoIDs {
-		placeholders[i] = fmt.Sprintf("$%d", i+1)
-		args[i] = id
+	todos := []models.Todo{}
+	for rows.Next() {
+		todo, err := models.ScanTodo(rows)
+		if err != nil {
+			log.Printf("scan todo failed: %v", err)
+			continue
+		}
+		todos = append(todos, todo)
 	}
 
-	query := fmt.Sprintf(`
-		DELETE FROM todos
-		WHERE id IN (%s)
-	`, strings.Join(placeholders, ","))
-
-	_, err := h.Model.DB.Exec(query, args...)
-	if err != nil {
-		return fmt.Errorf("batch delete failed: %w", err)
+	if withSteps {
+		if err := h.Model.AttachSteps(todos); err != nil {
+			return nil, err
+		}
 	}
 
-	return nil
+	return todos, nil
 }
 
-// getTodosByIDs 根据ID列表获取待办事项
-func (h *EnhancedTodoHandler) getTodosByIDs(todoIDs []int) ([]models.Todo, error) {
+// getTodosByIDs 根据ID列表获取用户的待办事项
+func (h *EnhancedTodoHandler) getTodosByIDs(userID int, todoIDs []int) ([]models.Todo, error) {
 	if len(todoIDs) == 0 {
 		return []models.Todo{}, nil
 	}
 
 	// 构建查询
 	placeholders := make([]string, len(todoIDs))
-	args := make([]interface{}, len(todoIDs))
+	args := make([]interface{}, len(todoIDs)+1)
+	args[0] = userID
 
 	for i, id := range todoIDs {
-		placeholders[i] = fmt.Sprintf("$%d", i+1)
-		args[i] = id
+		placeholders[i] = fmt.Sprintf("$%d", i+2)
+		args[i+1] = id
 	}
 
 	query := fmt.Sprintf(`
-		SELECT id, task, description, done, priority, category, due_date,
-		       reminder, estimated_time, tags, created_at, updated_at, completed_at
+		SELECT %s
 		FROM todos
-		WHERE id IN (%s)
+		WHERE user_id = $1 AND id IN (%s)
 		ORDER BY created_at DESC
-	`, strings.Join(placeholders, ","))
+	`, models.TodoColumns, strings.Join(placeholders, ","))
 
 	rows, err := h.Model.DB.Query(query, args...)
 	if err != nil {
@@ -566,42 +987,19 @@ func (h *EnhancedTodoHandler) getTodosByIDs(todoIDs []int) ([]models.Todo, error
 
 	var todos []models.Todo
 	for rows.Next() {
-		var todo models.Todo
-		var tagsJSON string
-
-		err := rows.Scan(
-			&todo.ID,
-			&todo.Task,
-			&todo.Description,
-			&todo.Done,
-			&todo.Priority,
-			&todo.Category,
-			&todo.DueDate,
-			&todo.Reminder,
-			&todo.EstimatedTime,
-			&tagsJSON,
-			&todo.CreatedAt,
-			&todo.UpdatedAt,
-			&todo.CompletedAt,
-		)
+		todo, err := models.ScanTodo(rows)
 		if err != nil {
 			log.Printf("scan todo failed: %v", err)
 			continue
 		}
-
-		// 解析标签
-		if tagsJSON != "" {
-			if err := json.Unmarshal([]byte(tagsJSON), &todo.Tags); err != nil {
-				log.Printf("parse tags failed: %v", err)
-				todo.Tags = []string{}
-			}
-		}
-
-		// 获取步骤
-		todo.Steps, _ = h.Model.GetStepsByTodoID(todo.ID)
 		todos = append(todos, todo)
 	}
 
+	// 一次查询加载所有步骤
+	if err := h.Model.AttachSteps(todos); err != nil {
+		return nil, err
+	}
+
 	return todos, nil
 }
 
@@ -651,13 +1049,32 @@ func (h *EnhancedTodoHandler) calculateTodoStats(userID int) (map[string]interfa
 		return nil, fmt.Errorf("failed to get today stats: %w", err)
 	}
 
-	// 分类统计
+	// 分类统计：按用户管理的分类汇总（包含没有任务的分类），
+	// 以及尚未登记到分类目录中的历史分类
 	categoryStatsQuery := `
-		SELECT category, COUNT(*) as count
-		FROM todos
-		WHERE user_id = $1
-		GROUP BY category
-		ORDER BY count DESC
+		SELECT name, icon, color, managed, total, completed
+		FROM (
+			SELECT c.name, c.icon, c.color, c.position, TRUE AS managed,
+			       COUNT(t.id) AS total,
+			       COUNT(CASE WHEN t.done = true THEN 1 END) AS completed
+			FROM categories c
+			LEFT JOIN todos t ON t.user_id = c.user_id AND t.category = c.name
+			WHERE c.user_id = $1
+			GROUP BY c.id, c.name, c.icon, c.color, c.position
+
+			UNION ALL
+
+			SELECT t.category, NULL, NULL, 2147483647, FALSE,
+			       COUNT(*),
+			       COUNT(CASE WHEN t.done = true THEN 1 END)
+			FROM todos t
+			WHERE t.user_id = $1
+			AND NOT EXISTS (
+				SELECT 1 FROM categories c WHERE c.user_id = t.user_id AND c.name = t.category
+			)
+			GROUP BY t.category
+		) breakdown
+		ORDER BY position, name
 	`
 
 	rows, err := h.Model.DB.Query(categoryStatsQuery, userID)
@@ -667,14 +1084,25 @@ func (h *EnhancedTodoHandler) calculateTodoStats(userID int) (map[string]interfa
 	defer rows.Close()
 
 	categoryStats := make(map[string]int)
+	categoryBreakdown := make([]map[string]interface{}, 0)
 	for rows.Next() {
 		var category string
-		var count int
-		if err := rows.Scan(&category, &count); err != nil {
+		var icon, color sql.NullString
+		var managed bool
+		var count, categoryCompleted int
+		if err := rows.Scan(&category, &icon, &color, &managed, &count, &categoryCompleted); err != nil {
 			log.Printf("scan category stats failed: %v", err)
 			continue
 		}
 		categoryStats[category] = count
+		categoryBreakdown = append(categoryBreakdown, map[string]interface{}{
+			"name":      category,
+			"icon":      icon.String,
+			"color":     color.String,
+			"managed":   managed,
+			"total":     count,
+			"completed": categoryCompleted,
+		})
 	}
 
 	// 最近7天完成任务统计
@@ -755,6 +1183,7 @@ func (h *EnhancedTodoHandler) calculateTodoStats(userID int) (map[string]interfa
 		"completed": todayCompleted,
 	}
 	stats["categories"] = categoryStats
+	stats["categoryBreakdown"] = categoryBreakdown
 	stats["weekly"] = weeklyStats
 	stats["upcoming"] = upcomingCount
 	stats["overdue"] = overdueCount
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/TodoList/models"
+)
+
+func TestFilterQueryCustomFieldSort(t *testing.T) {
+	filters := FilterParams{Status: "pending", Priority: "all", Category: "all",
+		SortBy: "cf.a'||pg_sleep(9)||'", SortOrder: "asc", SortFieldType: models.FieldTypeNumber}
+	fq := buildFilterQuery(1, filters)
+
+	// 字段 key 作为参数传入排序表达式，不拼接到 SQL 中
+	orderBy := fq.keyset.OrderBy()
+	if strings.Contains(orderBy, "pg_sleep") || !strings.Contains(orderBy, "(custom_fields->>$3::text)::numeric") {
+		t.Errorf("order by = %s", orderBy)
+	}
+	if fq.whereArgs != 2 || len(fq.args) != 3 || fq.args[2] != "a'||pg_sleep(9)||'" {
+		t.Errorf("args = %v, whereArgs = %d", fq.args, fq.whereArgs)
+	}
+
+	// 没有按自定义字段排序时所有参数都属于 WHERE 子句
+	filters.SortBy, filters.SortFieldType = "createdAt", ""
+	if fq := buildFilterQuery(1, filters); fq.whereArgs != len(fq.args) {
+		t.Errorf("args = %v, whereArgs = %d", fq.args, fq.whereArgs)
+	}
+}
+
+func TestIncludeStepsDefault(t *testing.T) {
+	// 与 GetTodosWithFilter 相同：page/pageSize 模式默认返回步骤，游标分页默认不返回
+	tests := map[string]bool{
+		"/api/v2/todos":                             true,
+		"/api/v2/todos?page=2&pageSize=10":          true,
+		"/api/v2/todos?limit=20":                    false,
+		"/api/v2/todos?cursor=abc":                  false,
+		"/api/v2/todos?limit=20&include=steps":      true,
+		"/api/v2/todos?page=1&include=customFields": false,
+	}
+	for target, want := range tests {
+		r := httptest.NewRequest("GET", target, nil)
+		if got := includeSteps(r, !wantsCursorPage(r)); got != want {
+			t.Errorf("%s: withSteps = %v, want %v", target, got, want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/TodoList/models"
+)
+
+// todoETag 返回单个待办事项的强ETag，形如 "12-3"（ID-版本号）
+func todoETag(todo models.Todo) string {
+	return fmt.Sprintf(`"%d-%d"`, todo.ID, todo.Version)
+}
+
+// listETag 返回待办事项列表的弱ETag，由每一项的ID和版本号以及 extra（总数、游标等）计算，
+// 任意一项被修改、增删或顺序变化都会改变
+func listETag(todos []models.Todo, extra ...string) string {
+	hash := sha1.New()
+	for _, todo := range todos {
+		fmt.Fprintf(hash, "%d-%d,", todo.ID, todo.Version)
+	}
+	for _, value := range extra {
+		fmt.Fprintf(hash, "|%s", value)
+	}
+	return `W/"` + hex.EncodeToString(hash.Sum(nil))[:20] + `"`
+}
+
+// pageETag 返回游标分页列表的弱ETag，包含下一页游标和总数
+func pageETag(todos []models.Todo, info models.PageInfo) string {
+	total := ""
+	if info.Total != nil {
+		total = strconv.Itoa(*info.Total)
+	}
+	return listETag(todos, info.NextCursor, total)
+}
+
+// splitETags 拆分 If-Match / If-None-Match 中逗号分隔的ETag列表
+func splitETags(header string) []string {
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// notModified 设置 ETag 头；If-None-Match 匹配（弱比较）时写入 304 并返回 true
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, tag := range splitETags(header) {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchVersions 解析 If-Match 头，返回其中属于 todoID 的版本号。
+// 未提供或为 * 时返回 nil（不检查）；弱ETag按 RFC 9110 的强比较规则永远不匹配，
+// 没有任何可用的ETag时返回空切片，写入必然失败并返回 412。
+func ifMatchVersions(r *http.Request, todoID int) []int {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return nil
+	}
+
+	versions := []int{}
+	for _, tag := range splitETags(header) {
+		if tag == "*" {
+			return nil
+		}
+		if !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) || len(tag) < 2 {
+			continue
+		}
+		id, version, ok := strings.Cut(strings.Trim(tag, `"`), "-")
+		if !ok || id != strconv.Itoa(todoID) {
+			continue
+		}
+		if n, err := strconv.Atoi(version); err == nil {
+			versions = append(versions, n)
+		}
+	}
+	return versions
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/TodoList/models"
+)
+
+func TestIfMatchVersions(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []int
+	}{
+		{"", nil},
+		{"*", nil},
+		{`"12-3"`, []int{3}},
+		{`"12-3", "12-4"`, []int{3, 4}},
+		{`"7-3"`, []int{}},
+		{`W/"12-3"`, []int{}},
+		{`"12-x", 12-5`, []int{}},
+		{`"7-1", *`, nil},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPut, "/api/todos/12", nil)
+		if tt.header != "" {
+			r.Header.Set("If-Match", tt.header)
+		}
+		if got := ifMatchVersions(r, 12); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("If-Match %q = %#v, want %#v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	todo := models.Todo{ID: 12, Version: 3}
+	etag := todoETag(todo)
+	if etag != `"12-3"` {
+		t.Fatalf("todoETag = %s", etag)
+	}
+
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{`"12-2"`, false},
+		{`"12-2", "12-3"`, true},
+		{`W/"12-3"`, true},
+		{"*", true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/todos/12", nil)
+		if tt.header != "" {
+			r.Header.Set("If-None-Match", tt.header)
+		}
+		w := httptest.NewRecorder()
+		if got := notModified(w, r, etag); got != tt.want {
+			t.Errorf("If-None-Match %q = %v, want %v", tt.header, got, tt.want)
+		}
+		if w.Header().Get("ETag") != etag {
+			t.Errorf("ETag header = %q, want %q", w.Header().Get("ETag"), etag)
+		}
+		if tt.want && w.Code != http.StatusNotModified {
+			t.Errorf("If-None-Match %q: status = %d, want 304", tt.header, w.Code)
+		}
+	}
+}
+
+func TestListETag(t *testing.T) {
+	a := []models.Todo{{ID: 1, Version: 1}, {ID: 2, Version: 5}}
+	b := []models.Todo{{ID: 1, Version: 1}, {ID: 2, Version: 6}}
+	c := []models.Todo{{ID: 2, Version: 5}, {ID: 1, Version: 1}}
+
+	if listETag(a) != listETag(a) {
+		t.Error("listETag is not stable")
+	}
+	if listETag(a) == listETag(b) {
+		t.Error("listETag ignores versions")
+	}
+	if listETag(a) == listETag(c) {
+		t.Error("listETag ignores order")
+	}
+	if listETag(a, "10") == listETag(a, "11") {
+		t.Error("listETag ignores extra values")
+	}
+}
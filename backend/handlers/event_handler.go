@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/TodoList/models"
+)
+
+// eventHeartbeatInterval 事件连接的心跳间隔，避免代理因空闲断开连接
+const eventHeartbeatInterval = 25 * time.Second
+
+// websocketWriteTimeout WebSocket 单次写入的超时时间
+const websocketWriteTimeout = 10 * time.Second
+
+// EventHandler 处理实时事件推送（SSE 和 WebSocket）
+type EventHandler struct {
+	Bus *models.EventBus
+}
+
+// NewEventHandler 创建一个新的EventHandler实例
+func NewEventHandler(bus *models.EventBus) *EventHandler {
+	return &EventHandler{Bus: bus}
+}
+
+// lastEventID 读取客户端最后收到的事件ID：SSE 重连时浏览器发送 Last-Event-ID 请求头，
+// WebSocket 和手动重连使用 lastEventId 查询参数
+func lastEventID(r *http.Request) int64 {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("lastEventId")
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 0 {
+		return 0
+	}
+	return id
+}
+
+// subscribe 订阅用户的事件并读取断线期间错过的事件。先订阅再读取事件日志，
+// 之间发生的事件可能重复出现在两边，由调用方按事件ID去重。reset 为 true 表示错过的事件已被清理。
+func (h *EventHandler) subscribe(userID int, lastID int64) (<-chan models.Event, func(), []models.Event, bool, error) {
+	events, unsubscribe := h.Bus.Subscribe(userID)
+	if lastID == 0 {
+		return events, unsubscribe, nil, false, nil
+	}
+
+	backlog, complete, err := h.Bus.EventsSince(userID, lastID)
+	if err != nil {
+		unsubscribe()
+		return nil, nil, nil, false, err
+	}
+	return events, unsubscribe, backlog, !complete, nil
+}
+
+// writeSSEEvent 以 text/event-stream 格式输出一个事件
+func writeSSEEvent(w io.Writer, event models.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
+
+// Stream 以 Server-Sent Events 推送当前用户的待办事项和步骤变更事件。
+// 重连时根据 Last-Event-ID 从事件日志补发；错过的事件已被清理时先发送 reset 事件，客户端应重新加载全部数据。
+func (h *EventHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	lastID := lastEventID(r)
+	events, unsubscribe, backlog, reset, err := h.subscribe(userID, lastID)
+	if err != nil {
+		log.Printf("读取事件日志失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if reset {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, event := range backlog {
+		if err := writeSSEEvent(w, event); err != nil {
+			return
+		}
+		lastID = event.ID
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				// 处理过慢被断开，客户端会带着 Last-Event-ID 重连
+				return
+			}
+			if event.ID <= lastID {
+				continue
+			}
+			if err := writeSSEEvent(w, event); err != nil {
+				return
+			}
+			lastID = event.ID
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// WebSocket 通过 WebSocket 推送与 Stream 相同的事件，每条文本消息是一个事件的JSON；
+// 错过的事件已被清理时先发送 {"type":"reset"}。重连时通过 lastEventId 查询参数补发。
+func (h *EventHandler) WebSocket(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// 浏览器的 WebSocket 不受 CORS 限制，需要自行检查来源
+	if origin := r.Header.Get("Origin"); origin != "" && !isAllowedOrigin(origin) {
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	lastID := lastEventID(r)
+	events, unsubscribe, backlog, reset, err := h.subscribe(userID, lastID)
+	if err != nil {
+		log.Printf("读取事件日志失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer unsubscribe()
+
+	conn, reader, err := upgradeWebSocket(w, r)
+	if err != nil {
+		log.Printf("WebSocket 握手失败: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// 读写在不同的 goroutine 中进行，写入需要串行化
+	var writeMu sync.Mutex
+	write := func(opcode byte, payload []byte) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		conn.SetWriteDeadline(time.Now().Add(websocketWriteTimeout))
+		return writeWebSocketFrame(conn, opcode, payload)
+	}
+	writeEvent := func(event models.Event) error {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		return write(wsOpText, data)
+	}
+
+	// 读取客户端的控制帧：回应 ping，收到 close 或连接出错时结束
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			opcode, payload, err := readWebSocketFrame(reader)
+			if err != nil {
+				return
+			}
+			switch opcode {
+			case wsOpPing:
+				if write(wsOpPong, payload) != nil {
+					return
+				}
+			case wsOpClose:
+				write(wsOpClose, nil)
+				return
+			}
+		}
+	}()
+
+	if reset {
+		if write(wsOpText, []byte(`{"type":"reset"}`)) != nil {
+			return
+		}
+	}
+	for _, event := range backlog {
+		if writeEvent(event) != nil {
+			return
+		}
+		lastID = event.ID
+	}
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case event, ok := <-events:
+			if !ok {
+				write(wsOpClose, nil)
+				return
+			}
+			if event.ID <= lastID {
+				continue
+			}
+			if writeEvent(event) != nil {
+				return
+			}
+			lastID = event.ID
+		case <-heartbeat.C:
+			if write(wsOpPing, nil) != nil {
+				return
+			}
+		}
+	}
+}
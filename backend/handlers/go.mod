@@ -9,4 +9,7 @@ require (
 	github.com/golang-jwt/jwt/v4 v4.5.2
 )
 
-require golang.org/x/crypto v0.40.0 // indirect
+require (
+	github.com/lib/pq v1.10.9 // indirect
+	golang.org/x/crypto v0.40.0 // indirect
+)
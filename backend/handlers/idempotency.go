@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/TodoList/models"
+)
+
+// 幂等请求相关的请求头和限制
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	maxIdempotentRequestBytes = 10 << 20
+)
+
+// IdempotencyHandler 为带 Idempotency-Key 请求头的写请求提供重放
+type IdempotencyHandler struct {
+	Model *models.IdempotencyModel
+}
+
+// NewIdempotencyHandler 创建一个新的IdempotencyHandler实例
+func NewIdempotencyHandler(model *models.IdempotencyModel) *IdempotencyHandler {
+	return &IdempotencyHandler{Model: model}
+}
+
+// idempotencyRecorder 把响应写给客户端的同时记录状态码和响应体
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *idempotencyRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *idempotencyRecorder) Write(data []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(data)
+	return rec.ResponseWriter.Write(data)
+}
+
+// idempotencyRequestHash 计算请求的摘要（方法、路径和查询参数、请求体），用于识别同一个键被用于不同的请求
+func idempotencyRequestHash(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	io.WriteString(hash, r.Method+" "+r.URL.RequestURI()+"\n")
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// storedResponseHeaders 返回需要随响应保存的响应头；CORS 头由 EnableCORS 在重放时重新设置
+func storedResponseHeaders(header http.Header) http.Header {
+	stored := http.Header{}
+	for name, values := range header {
+		if strings.HasPrefix(name, "Access-Control-") || name == "Content-Length" || name == "Date" {
+			continue
+		}
+		stored[name] = append([]string(nil), values...)
+	}
+	return stored
+}
+
+// Middleware 为非 GET 请求支持 Idempotency-Key 请求头（需放在 AuthMiddleware 之内）。
+// 同一用户在24小时内用同一个键重试时重放第一次的响应；键被用于不同的请求时返回 422，
+// 第一次请求仍在处理中时返回 409。服务器错误（5xx）不保存，可以用同一个键重试。
+func (h *IdempotencyHandler) Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next(w, r)
+			return
+		}
+
+		userID, ok := r.Context().Value("userID").(int)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			writeJSONError(w, http.StatusBadRequest, "Idempotency-Key is too long", "")
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentRequestBytes))
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				writeJSONError(w, http.StatusRequestEntityTooLarge, "Request body too large", "")
+				return
+			}
+			writeJSONError(w, http.StatusBadRequest, "Failed to read request body", "")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		requestHash := idempotencyRequestHash(r, body)
+
+		record, err := h.Model.Reserve(userID, key, requestHash)
+		if err != nil {
+			log.Printf("预留幂等键失败: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "Internal server error", "")
+			return
+		}
+
+		if record != nil {
+			switch {
+			case record.RequestHash != requestHash:
+				writeJSONError(w, http.StatusUnprocessableEntity, "Idempotency-Key has already been used for a different request", "")
+			case record.StatusCode == 0:
+				writeJSONError(w, http.StatusConflict, "A request with this Idempotency-Key is still being processed", "")
+			default:
+				for name, values := range record.Header {
+					w.Header()[name] = values
+				}
+				w.Header().Set(idempotentReplayedHeader, "true")
+				w.WriteHeader(record.StatusCode)
+				w.Write(record.Body)
+			}
+			return
+		}
+
+		// 处理器没有正常完成（例如 panic）时释放键，允许客户端重试
+		completed := false
+		defer func() {
+			if !completed {
+				if err := h.Model.Release(userID, key); err != nil {
+					log.Printf("释放幂等键失败: %v", err)
+				}
+			}
+		}()
+
+		rec := &idempotencyRecorder{ResponseWriter: w}
+		next(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		if rec.status >= http.StatusInternalServerError {
+			return
+		}
+
+		if err := h.Model.Complete(userID, key, rec.status, storedResponseHeaders(w.Header()), rec.body.Bytes()); err != nil {
+			log.Printf("保存幂等响应失败: %v", err)
+			return
+		}
+		completed = true
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIdempotencyRequestHash(t *testing.T) {
+	post := httptest.NewRequest(http.MethodPost, "/api/todos", nil)
+	hash := idempotencyRequestHash(post, []byte(`{"task":"a"}`))
+
+	if got := idempotencyRequestHash(post, []byte(`{"task":"a"}`)); got != hash {
+		t.Errorf("same request hashed differently: %s != %s", got, hash)
+	}
+	if got := idempotencyRequestHash(post, []byte(`{"task":"b"}`)); got == hash {
+		t.Error("different bodies produced the same hash")
+	}
+	put := httptest.NewRequest(http.MethodPut, "/api/todos", nil)
+	if got := idempotencyRequestHash(put, []byte(`{"task":"a"}`)); got == hash {
+		t.Error("different methods produced the same hash")
+	}
+	query := httptest.NewRequest(http.MethodPost, "/api/todos?x=1", nil)
+	if got := idempotencyRequestHash(query, []byte(`{"task":"a"}`)); got == hash {
+		t.Error("different query strings produced the same hash")
+	}
+}
+
+func TestIdempotencyRecorder(t *testing.T) {
+	w := httptest.NewRecorder()
+	rec := &idempotencyRecorder{ResponseWriter: w}
+	rec.Header().Set("Content-Type", "application/json")
+	rec.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000")
+	rec.WriteHeader(http.StatusCreated)
+	rec.Write([]byte(`{"id":1}`))
+
+	if rec.status != http.StatusCreated || rec.body.String() != `{"id":1}` {
+		t.Errorf("recorded %d %q", rec.status, rec.body.String())
+	}
+	if w.Code != http.StatusCreated || w.Body.String() != `{"id":1}` {
+		t.Errorf("client received %d %q", w.Code, w.Body.String())
+	}
+
+	stored := storedResponseHeaders(w.Header())
+	if stored.Get("Content-Type") != "application/json" || stored.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("stored headers = %v", stored)
+	}
+}
+
+// failingReader 读取时总是返回错误的请求体
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, errors.New("connection reset") }
+
+func TestIdempotencyMiddlewareBodyErrors(t *testing.T) {
+	// 读取请求体失败时还没有访问数据库，不需要 Model
+	h := &IdempotencyHandler{}
+	next := func(w http.ResponseWriter, r *http.Request) { t.Error("next handler called") }
+
+	tests := []struct {
+		name string
+		body io.Reader
+		want int
+	}{
+		{"too large", strings.NewReader(strings.Repeat("x", maxIdempotentRequestBytes+1)), http.StatusRequestEntityTooLarge},
+		{"read error", failingReader{}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/api/todos", tt.body)
+		r.Header.Set(idempotencyKeyHeader, "key")
+		r = r.WithContext(context.WithValue(r.Context(), "userID", 1))
+		w := httptest.NewRecorder()
+		h.Middleware(next)(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
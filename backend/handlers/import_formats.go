@@ -0,0 +1,612 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TodoList/models"
+)
+
+// maxImportCategoryLength 项目/列表名称作为分类时的最大长度，与 todos.category VARCHAR(20) 一致
+const maxImportCategoryLength = 20
+
+// importFile 从其他工具的导出文件中解析出的待办事项，以及解析时发现的问题
+type importFile struct {
+	items    []models.ImportItem
+	warnings []string
+}
+
+// warn 记录一条警告，相同的警告只记录一次
+func (f *importFile) warn(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	for _, w := range f.warnings {
+		if w == message {
+			return
+		}
+	}
+	f.warnings = append(f.warnings, message)
+}
+
+// importClientID 用来源和来源中的ID生成 client_id（最长64字符）。再次导入同一份数据时
+// 已经存在的 client_id 会被跳过
+func importClientID(source, id string) string {
+	clientID := source + ":" + id
+	if len(clientID) > 64 {
+		sum := sha256.Sum256([]byte(id))
+		clientID = source + ":" + hex.EncodeToString(sum[:])[:40]
+	}
+	return clientID
+}
+
+// contentClientID 来源中没有ID时（todo.txt、Todoist CSV）用内容的摘要生成 client_id
+func contentClientID(source string, parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return source + ":" + hex.EncodeToString(sum[:])[:40]
+}
+
+// importCategory 项目/列表名称作为分类，过长时截断
+func importCategory(name string) string {
+	name = strings.TrimSpace(name)
+	if runes := []rune(name); len(runes) > maxImportCategoryLength {
+		name = strings.TrimSpace(string(runes[:maxImportCategoryLength]))
+	}
+	return name
+}
+
+// importID 兼容字符串和数字两种形式的ID（Todoist 旧版 API 使用数字）
+type importID string
+
+func (id *importID) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*id = ""
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*id = importID(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("invalid id %s", data)
+	}
+	*id = importID(n.String())
+	return nil
+}
+
+// todoistDue Todoist 的截止日期：date 是日期或不带时区的时间，datetime（REST API）是 UTC 时间
+type todoistDue struct {
+	Date        string `json:"date"`
+	Datetime    string `json:"datetime"`
+	Timezone    string `json:"timezone"`
+	IsRecurring bool   `json:"is_recurring"`
+}
+
+// todoistTask Todoist 同步 API（items）和 REST API（tasks）的任务
+type todoistTask struct {
+	ID          importID    `json:"id"`
+	Content     string      `json:"content"`
+	Description string      `json:"description"`
+	ProjectID   importID    `json:"project_id"`
+	ParentID    importID    `json:"parent_id"`
+	Priority    int         `json:"priority"` // 4 为 p1（最高），1 为 p4（无优先级）
+	Labels      []importID  `json:"labels"`
+	Due         *todoistDue `json:"due"`
+	Checked     bool        `json:"checked"`
+	IsCompleted bool        `json:"is_completed"`
+	IsDeleted   bool        `json:"is_deleted"`
+}
+
+// todoistExport Todoist 的 JSON 导出（同步 API 的完整同步结果）
+type todoistExport struct {
+	Projects []struct {
+		ID             importID `json:"id"`
+		Name           string   `json:"name"`
+		InboxProject   bool     `json:"inbox_project"`
+		IsInboxProject bool     `json:"is_inbox_project"`
+	} `json:"projects"`
+	Labels []struct {
+		ID   importID `json:"id"`
+		Name string   `json:"name"`
+	} `json:"labels"`
+	Items []todoistTask `json:"items"`
+	Tasks []todoistTask `json:"tasks"`
+}
+
+// todoistPriority API 中的 4（p1）为高，3（p2）为中，2（p3）为低，1（p4）使用分类的默认优先级
+func todoistPriority(priority int) string {
+	switch priority {
+	case 4:
+		return "high"
+	case 3:
+		return "medium"
+	case 2:
+		return "low"
+	}
+	return ""
+}
+
+// parseTodoistDue 解析 Todoist 的截止日期；不带时区的时间按 timezone 解析，没有时按 UTC
+func parseTodoistDue(due *todoistDue) (*time.Time, error) {
+	value := due.Datetime
+	if value == "" {
+		value = due.Date
+	}
+	if len(value) == len("2006-01-02") {
+		t, err := time.Parse("2006-01-02", value)
+		return &t, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(time.RFC3339, value)
+		return &t, err
+	}
+	loc := time.UTC
+	if due.Timezone != "" {
+		if l, err := time.LoadLocation(due.Timezone); err == nil {
+			loc = l
+		}
+	}
+	t, err := time.ParseInLocation("2006-01-02T15:04:05", value, loc)
+	if err != nil {
+		return nil, err
+	}
+	t = t.UTC()
+	return &t, nil
+}
+
+// parseTodoistJSON 解析 Todoist 的 JSON 导出：同步 API 结果（projects、items、labels）或
+// REST API 的任务数组。项目作为分类（收件箱使用默认分类），标签作为标签，
+// 子任务（任意层级）合并为顶层任务的步骤
+func parseTodoistJSON(data []byte) (*importFile, error) {
+	var export todoistExport
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &export.Tasks); err != nil {
+			return nil, fmt.Errorf("invalid Todoist JSON: %v", err)
+		}
+	} else if err := json.Unmarshal(trimmed, &export); err != nil {
+		return nil, fmt.Errorf("invalid Todoist JSON: %v", err)
+	}
+	tasks := append(export.Items, export.Tasks...)
+
+	projects := map[importID]string{}
+	for _, p := range export.Projects {
+		if !p.InboxProject && !p.IsInboxProject {
+			projects[p.ID] = importCategory(p.Name)
+		}
+	}
+	labels := map[importID]string{}
+	for _, l := range export.Labels {
+		labels[l.ID] = l.Name
+	}
+
+	file := &importFile{}
+	byID := map[importID]*todoistTask{}
+	for i := range tasks {
+		if !tasks[i].IsDeleted {
+			byID[tasks[i].ID] = &tasks[i]
+		}
+	}
+	// root 沿着 parent_id 找到顶层任务；父任务不在导出中时自己作为顶层任务
+	root := func(t *todoistTask) *todoistTask {
+		for depth := 0; depth < len(tasks) && t.ParentID != ""; depth++ {
+			parent, ok := byID[t.ParentID]
+			if !ok {
+				break
+			}
+			t = parent
+		}
+		return t
+	}
+
+	index := map[importID]int{}
+	for i := range tasks {
+		t := &tasks[i]
+		if t.IsDeleted || root(t) != t {
+			continue
+		}
+		todo := models.Todo{
+			Task:        strings.TrimSpace(t.Content),
+			Description: t.Description,
+			Done:        t.Checked || t.IsCompleted,
+			Priority:    todoistPriority(t.Priority),
+			Category:    projects[t.ProjectID],
+			Tags:        []string{},
+			ClientID:    importClientID(models.ImportSourceTodoist, string(t.ID)),
+		}
+		for _, label := range t.Labels {
+			if name, ok := labels[label]; ok {
+				todo.Tags = append(todo.Tags, name)
+			} else {
+				todo.Tags = append(todo.Tags, string(label))
+			}
+		}
+		if t.Due != nil {
+			due, err := parseTodoistDue(t.Due)
+			if err != nil {
+				file.warn("task %s: could not parse due date %q", t.ID, t.Due.Date)
+			} else {
+				todo.DueDate = due
+			}
+			if t.Due.IsRecurring {
+				file.warn("recurring due dates were imported as their next occurrence")
+			}
+		}
+		index[t.ID] = len(file.items)
+		file.items = append(file.items, models.ImportItem{Ref: "task " + string(t.ID), Todo: todo})
+	}
+
+	for i := range tasks {
+		t := &tasks[i]
+		if t.IsDeleted {
+			continue
+		}
+		if r := root(t); r != t {
+			n, ok := index[r.ID]
+			if !ok {
+				// parent_id 形成环，无法确定顶层任务
+				file.warn("task %s: invalid parent, skipped", t.ID)
+				continue
+			}
+			item := &file.items[n]
+			item.Todo.Steps = append(item.Todo.Steps, models.Step{
+				Content:   strings.TrimSpace(t.Content),
+				Completed: t.Checked || t.IsCompleted,
+			})
+			if t.Due != nil || len(t.Labels) > 0 {
+				file.warn("due dates and labels of subtasks were not imported")
+			}
+		}
+	}
+	return file, nil
+}
+
+// todoistCSVLabel 任务内容中的 @标签
+var todoistCSVLabel = regexp.MustCompile(`(^|\s)@(\S+)`)
+
+// todoistCSVPriority CSV 中的 1（p1）为高，2 为中，3 为低，4 使用分类的默认优先级
+func todoistCSVPriority(value string) string {
+	switch strings.TrimSpace(value) {
+	case "1":
+		return "high"
+	case "2":
+		return "medium"
+	case "3":
+		return "low"
+	}
+	return ""
+}
+
+// parseTodoistCSVDate 解析 CSV 中的日期。Todoist 导出的可能是自然语言（如 "every day"），无法解析时返回 false
+func parseTodoistCSVDate(value string) (*time.Time, bool) {
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02T15:04:05", "Jan 2 2006", "2 Jan 2006", "01/02/2006"} {
+		if t, err := time.Parse(layout, strings.TrimSpace(value)); err == nil {
+			return &t, true
+		}
+	}
+	return nil, false
+}
+
+// parseTodoistCSV 解析 Todoist 的项目 CSV 导出（TYPE、CONTENT、DESCRIPTION、PRIORITY、INDENT、DATE 列）。
+// CSV 中没有项目名称，由 project 指定（为空时使用默认分类）。INDENT 大于 1 的任务作为上一个顶层任务的步骤，
+// note 行附加到上一个任务的描述中
+func parseTodoistCSV(data []byte, project string) (*importFile, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte(utf8BOM))))
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid Todoist CSV: missing header row")
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToUpper(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"TYPE", "CONTENT"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("invalid Todoist CSV: missing %s column", required)
+		}
+	}
+
+	category := importCategory(project)
+	file := &importFile{}
+	var last *models.ImportItem
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("invalid Todoist CSV: %v", err)
+		}
+		value := func(column string) string {
+			if i, ok := columns[column]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		content := value("CONTENT")
+		switch strings.ToLower(value("TYPE")) {
+		case "task":
+		case "note":
+			if last != nil && content != "" {
+				if last.Todo.Description != "" {
+					last.Todo.Description += "\n\n"
+				}
+				last.Todo.Description += content
+			}
+			continue
+		default:
+			continue
+		}
+
+		tags := []string{}
+		for _, m := range todoistCSVLabel.FindAllStringSubmatch(content, -1) {
+			tags = append(tags, m[2])
+		}
+		task := strings.Join(strings.Fields(todoistCSVLabel.ReplaceAllString(content, "$1")), " ")
+
+		if indent, _ := strconv.Atoi(value("INDENT")); indent > 1 && last != nil {
+			last.Todo.Steps = append(last.Todo.Steps, models.Step{Content: task})
+			continue
+		}
+
+		todo := models.Todo{
+			Task:        task,
+			Description: value("DESCRIPTION"),
+			Priority:    todoistCSVPriority(value("PRIORITY")),
+			Category:    category,
+			Tags:        tags,
+			ClientID:    contentClientID(models.ImportSourceTodoist, project, content, value("DATE")),
+		}
+		if date := value("DATE"); date != "" {
+			if due, ok := parseTodoistCSVDate(date); ok {
+				todo.DueDate = due
+			} else {
+				file.warn("line %d: could not parse due date %q", line, date)
+			}
+		}
+		file.items = append(file.items, models.ImportItem{Ref: fmt.Sprintf("line %d", line), Todo: todo})
+		last = &file.items[len(file.items)-1]
+	}
+	return file, nil
+}
+
+// msTodoTask Microsoft Graph 中的 todoTask
+type msTodoTask struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	Body  *struct {
+		Content     string `json:"content"`
+		ContentType string `json:"contentType"`
+	} `json:"body"`
+	Importance  string `json:"importance"` // low, normal, high
+	Status      string `json:"status"`     // notStarted, inProgress, completed, waitingOnOthers, deferred
+	DueDateTime *struct {
+		DateTime string `json:"dateTime"`
+		TimeZone string `json:"timeZone"`
+	} `json:"dueDateTime"`
+	IsReminderOn   bool     `json:"isReminderOn"`
+	Categories     []string `json:"categories"`
+	ChecklistItems []struct {
+		DisplayName string `json:"displayName"`
+		IsChecked   bool   `json:"isChecked"`
+	} `json:"checklistItems"`
+}
+
+// msTodoList Microsoft Graph 中的 todoTaskList，tasks 是该列表的任务
+type msTodoList struct {
+	ID                string       `json:"id"`
+	DisplayName       string       `json:"displayName"`
+	WellknownListName string       `json:"wellknownListName"` // 默认的“任务”列表为 defaultList
+	Tasks             []msTodoTask `json:"tasks"`
+}
+
+// msTodoImportance low 为低，high 为高，normal 使用分类的默认优先级
+func msTodoImportance(importance string) string {
+	switch strings.ToLower(importance) {
+	case "high":
+		return "high"
+	case "low":
+		return "low"
+	}
+	return ""
+}
+
+var (
+	htmlBreak      = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</div>|</li>`)
+	htmlTag        = regexp.MustCompile(`<[^>]*>`)
+	htmlBlankLines = regexp.MustCompile(`\n{3,}`)
+)
+
+// htmlToText 把 HTML 格式的任务备注转换为纯文本
+func htmlToText(s string) string {
+	s = htmlBreak.ReplaceAllString(s, "\n")
+	s = html.UnescapeString(htmlTag.ReplaceAllString(s, ""))
+	lines := strings.Split(s, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	return strings.TrimSpace(htmlBlankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+// parseMicrosoftTodo 解析 Microsoft To Do 的 Graph 风格 JSON 导出：{"lists": [...]}、
+// Graph 分页结果 {"value": [...]} 或列表数组，每个列表的 tasks 中是任务。
+// 列表作为分类（默认列表使用默认分类），categories 作为标签，checklistItems 作为步骤
+func parseMicrosoftTodo(data []byte) (*importFile, error) {
+	var lists []msTodoList
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &lists); err != nil {
+			return nil, fmt.Errorf("invalid Microsoft To Do JSON: %v", err)
+		}
+	} else {
+		var export struct {
+			Lists []msTodoList `json:"lists"`
+			Value []msTodoList `json:"value"`
+		}
+		if err := json.Unmarshal(trimmed, &export); err != nil {
+			return nil, fmt.Errorf("invalid Microsoft To Do JSON: %v", err)
+		}
+		lists = append(export.Lists, export.Value...)
+	}
+
+	file := &importFile{}
+	for _, list := range lists {
+		category := ""
+		if list.WellknownListName != "defaultList" {
+			category = importCategory(list.DisplayName)
+		}
+		for _, t := range list.Tasks {
+			todo := models.Todo{
+				Task:     strings.TrimSpace(t.Title),
+				Done:     strings.EqualFold(t.Status, "completed"),
+				Priority: msTodoImportance(t.Importance),
+				Category: category,
+				Reminder: t.IsReminderOn,
+				Tags:     append([]string{}, t.Categories...),
+				ClientID: importClientID(models.ImportSourceMicrosoftTodo, t.ID),
+			}
+			if t.Body != nil {
+				todo.Description = strings.TrimSpace(t.Body.Content)
+				if strings.EqualFold(t.Body.ContentType, "html") {
+					todo.Description = htmlToText(todo.Description)
+				}
+			}
+			// To Do 的截止时间只有日期（所在时区的午夜），只取日期部分
+			if t.DueDateTime != nil && len(t.DueDateTime.DateTime) >= len("2006-01-02") {
+				if due, err := time.Parse("2006-01-02", t.DueDateTime.DateTime[:10]); err == nil {
+					todo.DueDate = &due
+				} else {
+					file.warn("task %q: could not parse due date %q", t.Title, t.DueDateTime.DateTime)
+				}
+			}
+			for _, item := range t.ChecklistItems {
+				todo.Steps = append(todo.Steps, models.Step{Content: strings.TrimSpace(item.DisplayName), Completed: item.IsChecked})
+			}
+			if s := strings.ToLower(t.Status); s == "waitingonothers" || s == "deferred" {
+				file.warn("statuses waitingOnOthers and deferred were imported as not done")
+			}
+			file.items = append(file.items, models.ImportItem{Ref: fmt.Sprintf("%s / %s", list.DisplayName, t.Title), Todo: todo})
+		}
+	}
+	return file, nil
+}
+
+// todoTxtDate todo.txt 中的日期
+var todoTxtDate = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+// todoTxtPriority (A) 为高，(B) 为中，(C) 及以后为低
+func todoTxtPriority(letter byte) string {
+	switch {
+	case letter == 'A':
+		return "high"
+	case letter == 'B':
+		return "medium"
+	case letter >= 'C' && letter <= 'Z':
+		return "low"
+	}
+	return ""
+}
+
+// parseTodoTxtLine 解析 todo.txt 的一行：完成标记 "x "、优先级 "(A) "、完成和创建日期、
+// +项目（第一个作为分类，其余作为标签）、@上下文（作为标签）以及 due:YYYY-MM-DD 和 pri:A 扩展
+func parseTodoTxtLine(line string) (models.Todo, error) {
+	todo := models.Todo{Tags: []string{}}
+	fields := strings.Fields(line)
+
+	if len(fields) > 0 && fields[0] == "x" {
+		todo.Done = true
+		fields = fields[1:]
+		// 完成日期和创建日期
+		for i := 0; i < 2 && len(fields) > 0 && todoTxtDate.MatchString(fields[0]); i++ {
+			fields = fields[1:]
+		}
+	} else if len(fields) > 0 && len(fields[0]) == 3 && fields[0][0] == '(' && fields[0][2] == ')' {
+		todo.Priority = todoTxtPriority(fields[0][1])
+		fields = fields[1:]
+		if len(fields) > 0 && todoTxtDate.MatchString(fields[0]) {
+			fields = fields[1:]
+		}
+	} else if len(fields) > 0 && todoTxtDate.MatchString(fields[0]) {
+		fields = fields[1:]
+	}
+
+	var words, projects []string
+	for _, field := range fields {
+		switch {
+		case len(field) > 1 && field[0] == '+':
+			projects = append(projects, field[1:])
+		case len(field) > 1 && field[0] == '@':
+			todo.Tags = append(todo.Tags, field[1:])
+		case strings.HasPrefix(field, "due:"):
+			due, err := time.Parse("2006-01-02", strings.TrimPrefix(field, "due:"))
+			if err != nil {
+				return todo, fmt.Errorf("invalid due date %q", field)
+			}
+			todo.DueDate = &due
+		case strings.HasPrefix(field, "pri:") && len(field) == 5:
+			todo.Priority = todoTxtPriority(field[4])
+		default:
+			words = append(words, field)
+		}
+	}
+	if len(projects) > 0 {
+		todo.Category = importCategory(projects[0])
+		todo.Tags = append(todo.Tags, projects[1:]...)
+	}
+	todo.Task = strings.Join(words, " ")
+	if todo.Task == "" {
+		return todo, fmt.Errorf("task is empty")
+	}
+	return todo, nil
+}
+
+// parseTodoTxt 解析 todo.txt 文件，每行一个任务，空行忽略
+func parseTodoTxt(data []byte) (*importFile, error) {
+	file := &importFile{}
+	scanner := bufio.NewScanner(bytes.NewReader(bytes.TrimPrefix(data, []byte(utf8BOM))))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		todo, err := parseTodoTxtLine(line)
+		if err != nil {
+			file.warn("line %d: %v, skipped", n, err)
+			continue
+		}
+		todo.ClientID = contentClientID(models.ImportSourceTodoTxt, line)
+		file.items = append(file.items, models.ImportItem{Ref: fmt.Sprintf("line %d", n), Todo: todo})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("invalid todo.txt: %v", err)
+	}
+	return file, nil
+}
+
+// importCategories 导入项中使用的非空分类（去重并排序）
+func importCategories(items []models.ImportItem) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, item := range items {
+		if c := item.Todo.Category; c != "" && !seen[c] {
+			seen[c] = true
+			names = append(names, c)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TodoList/models"
+)
+
+func TestParseTodoistJSON(t *testing.T) {
+	file, err := parseTodoistJSON([]byte(`{
+		"projects": [{"id": "1", "name": "Inbox", "inbox_project": true}, {"id": "2", "name": "Home renovation project"}],
+		"labels": [{"id": 7, "name": "errand"}],
+		"items": [
+			{"id": "11", "content": "Paint walls", "project_id": "2", "priority": 4, "labels": ["weekend"],
+			 "due": {"date": "2024-05-01T09:00:00", "timezone": null, "is_recurring": true}},
+			{"id": "12", "content": "Buy paint", "project_id": "2", "parent_id": "11", "checked": true},
+			{"id": "13", "content": "Pick colors", "project_id": "2", "parent_id": "12"},
+			{"id": "14", "content": "Call bank", "project_id": "1", "priority": 1, "labels": [7], "due": {"date": "2024-05-02"}},
+			{"id": "15", "content": "Old", "is_deleted": true}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(file.items) != 2 {
+		t.Fatalf("items = %+v", file.items)
+	}
+
+	paint := file.items[0].Todo
+	if paint.Task != "Paint walls" || paint.Priority != "high" || paint.Category != "Home renovation proj" ||
+		len(paint.Tags) != 1 || paint.Tags[0] != "weekend" || paint.ClientID != "todoist:11" {
+		t.Errorf("paint = %+v", paint)
+	}
+	if paint.DueDate == nil || !paint.DueDate.Equal(time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("paint due = %v", paint.DueDate)
+	}
+	if len(paint.Steps) != 2 || !paint.Steps[0].Completed || paint.Steps[1].Content != "Pick colors" {
+		t.Errorf("paint steps = %+v", paint.Steps)
+	}
+
+	bank := file.items[1].Todo
+	if bank.Category != "" || bank.Priority != "" || len(bank.Tags) != 1 || bank.Tags[0] != "errand" {
+		t.Errorf("bank = %+v", bank)
+	}
+	if len(file.warnings) != 1 || !strings.Contains(file.warnings[0], "recurring") {
+		t.Errorf("warnings = %q", file.warnings)
+	}
+
+	if _, err := parseTodoistJSON([]byte(`{"items": 1}`)); err == nil {
+		t.Error("invalid JSON accepted")
+	}
+}
+
+func TestParseTodoistCSV(t *testing.T) {
+	data := "TYPE,CONTENT,DESCRIPTION,PRIORITY,INDENT,AUTHOR,RESPONSIBLE,DATE,DATE_LANG,TIMEZONE\n" +
+		"section,Planning,,,,,,,,\n" +
+		"task,Write plan @work @q2,draft first,1,1,,,2024-05-03,en,UTC\n" +
+		"task,Outline,,4,2,,,,en,UTC\n" +
+		"note,Remember the budget,,,,,,,,\n" +
+		"task,Review,,4,1,,,every friday,en,UTC\n"
+	file, err := parseTodoistCSV([]byte(data), "Work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(file.items) != 2 {
+		t.Fatalf("items = %+v", file.items)
+	}
+
+	plan := file.items[0].Todo
+	if plan.Task != "Write plan" || plan.Priority != "high" || plan.Category != "Work" ||
+		strings.Join(plan.Tags, ",") != "work,q2" || plan.Description != "draft first\n\nRemember the budget" {
+		t.Errorf("plan = %+v", plan)
+	}
+	if len(plan.Steps) != 1 || plan.Steps[0].Content != "Outline" || plan.DueDate == nil {
+		t.Errorf("plan steps/due = %+v %v", plan.Steps, plan.DueDate)
+	}
+	if review := file.items[1].Todo; review.DueDate != nil || review.Priority != "" || file.items[1].Ref != "line 6" {
+		t.Errorf("review = %+v", file.items[1])
+	}
+	if len(file.warnings) != 1 || !strings.Contains(file.warnings[0], "every friday") {
+		t.Errorf("warnings = %q", file.warnings)
+	}
+
+	if _, err := parseTodoistCSV([]byte("NAME\nx\n"), ""); err == nil {
+		t.Error("CSV without TYPE column accepted")
+	}
+}
+
+func TestParseMicrosoftTodo(t *testing.T) {
+	file, err := parseMicrosoftTodo([]byte(`{"value": [
+		{"id": "l1", "displayName": "Tasks", "wellknownListName": "defaultList", "tasks": [
+			{"id": "t1", "title": "Renew passport", "importance": "high", "status": "completed",
+			 "body": {"content": "<p>Bring <b>photos</b></p><p>&amp; form</p>", "contentType": "html"},
+			 "dueDateTime": {"dateTime": "2024-05-10T00:00:00.0000000", "timeZone": "Pacific Standard Time"},
+			 "isReminderOn": true, "categories": ["Red category"]}
+		]},
+		{"id": "l2", "displayName": "Groceries", "tasks": [
+			{"id": "t2", "title": "Weekly shop", "importance": "normal", "status": "notStarted",
+			 "checklistItems": [{"displayName": "Milk", "isChecked": true}, {"displayName": "Eggs"}]}
+		]}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(file.items) != 2 {
+		t.Fatalf("items = %+v", file.items)
+	}
+
+	passport := file.items[0].Todo
+	if !passport.Done || passport.Priority != "high" || passport.Category != "" || !passport.Reminder ||
+		passport.Description != "Bring photos\n& form" || len(passport.Tags) != 1 {
+		t.Errorf("passport = %+v", passport)
+	}
+	if passport.DueDate == nil || !passport.DueDate.Equal(time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("passport due = %v", passport.DueDate)
+	}
+
+	shop := file.items[1].Todo
+	if shop.Category != "Groceries" || shop.Priority != "" || len(shop.Steps) != 2 || !shop.Steps[0].Completed {
+		t.Errorf("shop = %+v", shop)
+	}
+}
+
+func TestParseTodoTxt(t *testing.T) {
+	file, err := parseTodoTxt([]byte("(A) 2024-04-30 Call mom +Family +Phone @home due:2024-05-01\n" +
+		"\n" +
+		"x 2024-05-02 2024-04-30 Pay rent +Home pri:B\n" +
+		"(C) +Empty\n" +
+		"Fix bike due:tomorrow\n" +
+		"plain task with key:value\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(file.items) != 3 {
+		t.Fatalf("items = %+v", file.items)
+	}
+
+	call := file.items[0].Todo
+	if call.Task != "Call mom" || call.Priority != "high" || call.Category != "Family" ||
+		strings.Join(call.Tags, ",") != "home,Phone" || call.DueDate == nil || call.Done {
+		t.Errorf("call = %+v", call)
+	}
+	if rent := file.items[1].Todo; !rent.Done || rent.Priority != "medium" || rent.Task != "Pay rent" || file.items[1].Ref != "line 3" {
+		t.Errorf("rent = %+v", file.items[1])
+	}
+	if plain := file.items[2].Todo; plain.Task != "plain task with key:value" || plain.Category != "" {
+		t.Errorf("plain = %+v", plain)
+	}
+	if len(file.warnings) != 2 {
+		t.Errorf("warnings = %q", file.warnings)
+	}
+
+	// 相同的行生成相同的 client_id，重复导入时跳过
+	again, _ := parseTodoTxt([]byte("(A) 2024-04-30 Call mom +Family +Phone @home due:2024-05-01\n"))
+	if again.items[0].Todo.ClientID != call.ClientID || !strings.HasPrefix(call.ClientID, models.ImportSourceTodoTxt+":") {
+		t.Errorf("client ids = %q, %q", again.items[0].Todo.ClientID, call.ClientID)
+	}
+}
+
+func TestImportClientID(t *testing.T) {
+	if got := importClientID(models.ImportSourceTodoist, "123"); got != "todoist:123" {
+		t.Errorf("short id = %q", got)
+	}
+	long := importClientID(models.ImportSourceMicrosoftTodo, strings.Repeat("AQMkADAwATM0MDAAMS", 10))
+	if len(long) > 64 || !strings.HasPrefix(long, "microsoft-todo:") {
+		t.Errorf("long id = %q", long)
+	}
+}
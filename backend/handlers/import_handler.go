@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/TodoList/models"
+)
+
+// importProgressInterval 导入时每处理多少项保存一次进度
+const importProgressInterval = 25
+
+// ImportHandler 处理从 Todoist、Microsoft To Do 和 todo.txt 导入待办事项。
+// 上传的文件在请求中解析，写入在后台执行，客户端轮询任务获取进度和导入报告
+type ImportHandler struct {
+	Jobs  *models.ImportJobModel
+	Todos *models.TodoModel
+	Undo  *models.UndoModel
+}
+
+// NewImportHandler 创建一个新的ImportHandler实例
+func NewImportHandler(jobs *models.ImportJobModel, todos *models.TodoModel, undo *models.UndoModel) *ImportHandler {
+	return &ImportHandler{Jobs: jobs, Todos: todos, Undo: undo}
+}
+
+// parseImportFile 按来源解析上传的文件。Todoist 根据内容区分 JSON 和 CSV 导出
+func parseImportFile(source string, data []byte, r *http.Request) (*importFile, error) {
+	switch source {
+	case models.ImportSourceTodoist:
+		if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+			return parseTodoistJSON(data)
+		}
+		return parseTodoistCSV(data, r.URL.Query().Get("project"))
+	case models.ImportSourceMicrosoftTodo:
+		return parseMicrosoftTodo(data)
+	case models.ImportSourceTodoTxt:
+		return parseTodoTxt(data)
+	}
+	return nil, fmt.Errorf("source must be todoist, microsoft-todo or todotxt")
+}
+
+// StartImport 上传其他工具的导出文件并开始导入（POST /api/v2/imports?source=todoist|microsoft-todo|todotxt）。
+// Todoist 的 CSV 导出中没有项目名称，可以通过 project 参数指定。文件无法解析时直接返回 400；
+// 否则返回 202 和导入任务，Location 指向任务的地址。
+// 再次导入同一份文件时，已经导入过的任务会被跳过。
+func (h *ImportHandler) StartImport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportBodySize))
+	if err != nil {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "File too large", "")
+		return
+	}
+	source := r.URL.Query().Get("source")
+	file, err := parseImportFile(source, data, r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error(), "")
+		return
+	}
+	if len(file.items) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "No tasks found in file", "")
+		return
+	}
+	if len(file.items) > maxImportRows {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("File has more than %d tasks", maxImportRows), "")
+		return
+	}
+
+	job := &models.ImportJob{UserID: userID, Source: source, Total: len(file.items)}
+	if err := h.Jobs.Create(job); err != nil {
+		log.Printf("创建导入任务失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	// 后台任务会修改 job，响应使用副本
+	response := *job
+	go h.run(job, file)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/api/v2/imports/%d", job.ID))
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(response)
+}
+
+// run 在后台逐项写入，定期保存进度，结束时保存导入报告并记录可以撤销整个导入的令牌
+func (h *ImportHandler) run(job *models.ImportJob, file *importFile) {
+	report := &models.ImportReport{
+		CreatedIDs:        []int{},
+		CategoriesCreated: []string{},
+		Warnings:          append([]string{}, file.warnings...),
+		Items:             []models.ImportItemResult{},
+	}
+	job.Report = report
+	if err := h.Jobs.Start(job); err != nil {
+		log.Printf("开始导入任务失败: %v", err)
+	}
+
+	mapping, created, err := h.Jobs.EnsureCategories(job.UserID, importCategories(file.items))
+	if err != nil {
+		h.finish(job, err)
+		return
+	}
+	report.CategoriesCreated = created
+
+	for i := range file.items {
+		item := &file.items[i]
+		todo := &item.Todo
+		todo.UserID = job.UserID
+		if todo.Category != "" {
+			todo.Category = mapping[todo.Category]
+		}
+
+		result := models.ImportItemResult{Ref: item.Ref, Task: todo.Task}
+		exists, err := h.Jobs.ClientIDExists(job.UserID, todo.ClientID)
+		switch {
+		case err != nil:
+			log.Printf("导入待办事项失败: %v", err)
+			result.Status, result.Message = models.ImportItemFailed, "failed to import task"
+		case exists:
+			result.Status, result.Message = models.ImportItemSkipped, "already imported"
+		case todo.Task == "":
+			result.Status, result.Message = models.ImportItemFailed, "task is empty"
+		default:
+			if err := h.Todos.AddTodo(todo); err != nil {
+				result.Status, result.Message = models.ImportItemFailed, importAddError(err)
+				break
+			}
+			result.Status = models.ImportItemCreated
+			report.CreatedIDs = append(report.CreatedIDs, todo.ID)
+		}
+
+		switch result.Status {
+		case models.ImportItemCreated:
+			job.Created++
+		case models.ImportItemSkipped:
+			job.Skipped++
+			report.Items = append(report.Items, result)
+		default:
+			job.Failed++
+			report.Items = append(report.Items, result)
+		}
+		job.Processed++
+		if job.Processed%importProgressInterval == 0 {
+			if err := h.Jobs.Progress(job); err != nil {
+				log.Printf("保存导入进度失败: %v", err)
+			}
+		}
+	}
+
+	if len(report.CreatedIDs) > 0 {
+		job.UndoToken = recordUndo(h.Undo, job.UserID, models.UndoActionImport, nil, report.CreatedIDs...)
+	}
+	h.finish(job, nil)
+}
+
+// finish 保存任务的结果
+func (h *ImportHandler) finish(job *models.ImportJob, jobErr error) {
+	if jobErr != nil {
+		log.Printf("导入任务 %d 失败: %v", job.ID, jobErr)
+		jobErr = errors.New("import failed")
+	}
+	if err := h.Jobs.Finish(job, jobErr); err != nil {
+		log.Printf("保存导入任务结果失败: %v", err)
+	}
+}
+
+// importAddError 把写入时的错误转换为报告中的说明
+func importAddError(err error) string {
+	switch {
+	case errors.Is(err, models.ErrInvalidTag):
+		return "invalid tag name"
+	case errors.Is(err, models.ErrUnknownCategory):
+		return "unknown category"
+	case errors.Is(err, models.ErrDuplicateUUID):
+		return "uuid already in use"
+	}
+	log.Printf("导入待办事项失败: %v", err)
+	return "failed to import task"
+}
+
+// GetImports 获取当前用户最近的导入任务（不包含报告）
+func (h *ImportHandler) GetImports(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	jobs, err := h.Jobs.List(userID)
+	if err != nil {
+		log.Printf("获取导入任务失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobs)
+}
+
+// GetImport 获取导入任务的进度；任务结束后包含导入报告
+func (h *ImportHandler) GetImport(w http.ResponseWriter, r *http.Request, id int) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	job, err := h.Jobs.Get(userID, id)
+	if err != nil {
+		if errors.Is(err, models.ErrImportJobNotFound) {
+			http.Error(w, "Import job not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("获取导入任务失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if job.Status == models.ImportStatusPending || job.Status == models.ImportStatusRunning {
+		w.Header().Set("Retry-After", "1")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
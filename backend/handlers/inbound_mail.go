@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/TodoList/models"
+)
+
+// 邮件转换为待办事项时的限制
+const (
+	maxInboundMailSize      = 10 << 20
+	maxInboundAttachments   = 20
+	maxInboundMIMEDepth     = 5
+	maxAttachmentNameRunes  = 255
+	maxAttachmentTypeLength = 255 // todo_attachments.content_type VARCHAR(255)
+)
+
+// errEmptyInboundMail 邮件没有主题也没有正文，无法生成任务
+var errEmptyInboundMail = errors.New("message has no subject or text body")
+
+// inboundMail 解析后的邮件
+type inboundMail struct {
+	Todo        models.Todo
+	Attachments []models.Attachment
+}
+
+// parseInboundMail 把邮件转换为待办事项：主题作为任务（其中的 !high #tag due:friday 语法
+// 设置优先级、标签和截止日期），正文作为描述（优先使用 text/plain，只有 HTML 时转换为纯文本），
+// 其余部分作为附件。相对日期按邮件 Date 头的时区计算，没有 Date 头时使用 now
+func parseInboundMail(raw []byte, now time.Time) (*inboundMail, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid message: %v", err)
+	}
+	if date, err := msg.Header.Date(); err == nil {
+		now = date
+	}
+
+	parsed := &inboundMail{}
+	var text, htmlText string
+	err = walkMailPart(textproto.MIMEHeader(msg.Header), msg.Body, 0, func(mediaType string, header textproto.MIMEHeader, body []byte) {
+		name := mailPartFilename(header)
+		switch {
+		case name == "" && mediaType == "text/plain" && text == "":
+			text = decodeMailCharset(body, header)
+		case name == "" && mediaType == "text/html" && htmlText == "":
+			htmlText = decodeMailCharset(body, header)
+		case strings.HasPrefix(mediaType, "text/") && name == "":
+			// 其他没有文件名的正文部分（例如 text/enriched 替代格式）不保存
+		default:
+			if len(parsed.Attachments) >= maxInboundAttachments {
+				return
+			}
+			if name == "" {
+				name = "attachment" + mailExtension(mediaType)
+			}
+			if len(mediaType) > maxAttachmentTypeLength {
+				mediaType = "application/octet-stream"
+			}
+			parsed.Attachments = append(parsed.Attachments, models.Attachment{
+				Filename:    name,
+				ContentType: mediaType,
+				Data:        body,
+			})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if text == "" && htmlText != "" {
+		text = htmlToText(mailHTMLHidden.ReplaceAllString(htmlText, ""))
+	}
+	parsed.Todo.Description = mailBodyText(text)
+
+	subject := stripForwardPrefix(decodeMailHeader(msg.Header.Get("Subject")))
+	syntax := parseInlineTaskSyntax(subject, now)
+	if syntax.Task == "" {
+		// 没有主题时使用正文的第一行
+		for _, line := range strings.Split(parsed.Todo.Description, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				syntax.Task = line
+				break
+			}
+		}
+	}
+	if syntax.Task == "" {
+		return nil, errEmptyInboundMail
+	}
+	parsed.Todo.Task = syntax.Task
+	parsed.Todo.Priority = syntax.Priority
+	parsed.Todo.Tags = syntax.Tags
+	parsed.Todo.DueDate = syntax.DueDate
+
+	// 用 Message-ID 生成 client_id，发件服务器重试投递同一封邮件时不会重复创建；
+	// 没有 Message-ID 时使用整封邮件的哈希，重试投递的内容相同
+	if id := strings.TrimSpace(msg.Header.Get("Message-Id")); id != "" {
+		parsed.Todo.ClientID = contentClientID("email", id)
+	} else {
+		parsed.Todo.ClientID = contentClientID("email", string(raw))
+	}
+	return parsed, nil
+}
+
+// walkMailPart 递归遍历 MIME 结构，对每个非 multipart 部分调用 visit（内容已按
+// Content-Transfer-Encoding 解码）
+func walkMailPart(header textproto.MIMEHeader, body io.Reader, depth int, visit func(string, textproto.MIMEHeader, []byte)) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if depth >= maxInboundMIMEDepth {
+			return errors.New("invalid message: MIME parts nested too deeply")
+		}
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			// NextRawPart 不会自动解码 quoted-printable，所有编码统一在下面处理
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("invalid message: %v", err)
+			}
+			if err := walkMailPart(part.Header, part, depth+1, visit); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch strings.ToLower(strings.TrimSpace(header.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("invalid message: %v", err)
+	}
+	visit(mediaType, header, data)
+	return nil
+}
+
+// mailPartFilename 返回附件的文件名（Content-Disposition 的 filename 或 Content-Type 的 name），
+// 去掉路径并限制长度；内联的正文部分返回空字符串
+func mailPartFilename(header textproto.MIMEHeader) string {
+	disposition, params, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	name := params["filename"]
+	if name == "" {
+		_, typeParams, _ := mime.ParseMediaType(header.Get("Content-Type"))
+		name = typeParams["name"]
+	}
+	name = decodeMailHeader(name)
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" {
+		name = ""
+	}
+	if name == "" && disposition == "attachment" {
+		return "attachment"
+	}
+	if utf8.RuneCountInString(name) > maxAttachmentNameRunes {
+		name = string([]rune(name)[:maxAttachmentNameRunes])
+	}
+	return name
+}
+
+// mailExtension 没有文件名的附件按类型生成扩展名
+func mailExtension(mediaType string) string {
+	if mediaType == "message/rfc822" {
+		return ".eml"
+	}
+	if exts, err := mime.ExtensionsByType(mediaType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+// decodeMailHeader 解码 RFC 2047 编码的头部（=?UTF-8?B?...?=），无法解码时原样返回
+func decodeMailHeader(s string) string {
+	decoded, err := new(mime.WordDecoder).DecodeHeader(s)
+	if err != nil {
+		return strings.TrimSpace(s)
+	}
+	return strings.TrimSpace(decoded)
+}
+
+// decodeMailCharset 把正文转换为 UTF-8。只识别 ISO-8859-1，其他字符集按 UTF-8 处理并替换无效字节
+func decodeMailCharset(body []byte, header textproto.MIMEHeader) string {
+	_, params, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	switch strings.ToLower(params["charset"]) {
+	case "iso-8859-1", "latin1":
+		runes := make([]rune, len(body))
+		for i, b := range body {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	}
+	return strings.ToValidUTF8(string(body), "�")
+}
+
+// mailHTMLHidden HTML 邮件中不显示的部分，转换为纯文本前去掉
+var mailHTMLHidden = regexp.MustCompile(`(?is)<head\b.*?</head>|<style\b.*?</style>|<script\b.*?</script>`)
+
+// mailSignature 签名分隔符 "-- "，之后的内容不放入描述
+var mailSignature = regexp.MustCompile(`(?m)^-- ?$`)
+
+// mailBodyText 规范化正文：统一换行、去掉签名和首尾空白
+func mailBodyText(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if loc := mailSignature.FindStringIndex(text); loc != nil {
+		text = text[:loc[0]]
+	}
+	return strings.TrimSpace(text)
+}
+
+// forwardPrefix 转发邮件的主题前缀
+var forwardPrefix = regexp.MustCompile(`(?i)^((fwd?|fw)\s*:\s*)+`)
+
+// stripForwardPrefix 去掉主题开头的 "Fwd:"、"FW:"，转发的邮件以原主题作为任务
+func stripForwardPrefix(subject string) string {
+	return strings.TrimSpace(forwardPrefix.ReplaceAllString(subject, ""))
+}
+
+// inlineTaskSyntax 从任务文本中解析出的属性
+type inlineTaskSyntax struct {
+	Task     string
+	Priority string
+	Tags     []string
+	DueDate  *time.Time
+}
+
+// inlinePriorities 优先级语法
+var inlinePriorities = map[string]string{"!high": "high", "!medium": "medium", "!low": "low"}
+
+// parseInlineTaskSyntax 解析任务文本中的快捷语法，识别出的部分从任务中去掉：
+//
+//	!high、!medium、!low     优先级
+//	#billing                 标签，以字母开头，这样 "Invoice #123" 不会变成标签
+//	due:friday               截止日期：today、tomorrow、星期几（包括今天在内的下一个）或 YYYY-MM-DD
+//
+// 截止日期按 now 所在时区的日期计算，保存为该日期的 UTC 零点，与导入的日期一致。
+// 无法识别的写法原样留在任务中
+func parseInlineTaskSyntax(text string, now time.Time) inlineTaskSyntax {
+	var result inlineTaskSyntax
+	var words []string
+	for _, word := range strings.Fields(text) {
+		lower := strings.ToLower(word)
+		if priority, ok := inlinePriorities[lower]; ok {
+			result.Priority = priority
+			continue
+		}
+		if tag := strings.TrimPrefix(word, "#"); tag != word && isInlineTag(tag) {
+			if !containsTag(result.Tags, tag) {
+				result.Tags = append(result.Tags, tag)
+			}
+			continue
+		}
+		if value := strings.TrimPrefix(lower, "due:"); value != lower {
+			if due, ok := parseInlineDueDate(value, now); ok {
+				result.DueDate = &due
+				continue
+			}
+		}
+		words = append(words, word)
+	}
+	result.Task = strings.Join(words, " ")
+	return result
+}
+
+// isInlineTag 判断 # 后面的文本是否是标签：以字母开头，不超过 30 个字符
+func isInlineTag(tag string) bool {
+	first, _ := utf8.DecodeRuneInString(tag)
+	return unicode.IsLetter(first) && utf8.RuneCountInString(tag) <= 30
+}
+
+// containsTag 判断标签是否已存在（不区分大小写）
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseInlineDueDate 解析 due: 后面的日期
+func parseInlineDueDate(value string, now time.Time) (time.Time, bool) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	switch value {
+	case "today":
+		return today, true
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), true
+	}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		name := strings.ToLower(day.String())
+		if value == name || value == name[:3] {
+			return today.AddDate(0, 0, (int(day)-int(today.Weekday())+7)%7), true
+		}
+	}
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		return date, true
+	}
+	return time.Time{}, false
+}
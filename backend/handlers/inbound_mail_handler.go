@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/TodoList/models"
+)
+
+// InboundMailHandler 处理收件地址的管理，以及下载邮件带来的附件
+type InboundMailHandler struct {
+	Addresses   *models.InboundMailModel
+	Attachments *models.AttachmentModel
+	Domain      string // 收件域名，为空时使用请求的主机名
+}
+
+// NewInboundMailHandler 创建一个新的InboundMailHandler实例
+func NewInboundMailHandler(addresses *models.InboundMailModel, attachments *models.AttachmentModel, domain string) *InboundMailHandler {
+	return &InboundMailHandler{Addresses: addresses, Attachments: attachments, Domain: domain}
+}
+
+// inboundAddressResponse 收件地址的令牌和完整地址
+type inboundAddressResponse struct {
+	Token   string `json:"token"`
+	Address string `json:"address"`
+}
+
+// address 生成完整的收件地址
+func (h *InboundMailHandler) address(r *http.Request, token string) string {
+	domain := h.Domain
+	if domain == "" {
+		domain = r.Host
+		if host, _, err := net.SplitHostPort(r.Host); err == nil {
+			domain = host
+		}
+	}
+	return token + "@" + domain
+}
+
+// GetAddress 返回当前用户的收件地址，第一次访问时生成令牌
+func (h *InboundMailHandler) GetAddress(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	token, err := h.Addresses.GetToken(userID)
+	if err != nil {
+		log.Printf("获取收件地址失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(inboundAddressResponse{Token: token, Address: h.address(r, token)})
+}
+
+// RotateAddress 轮换当前用户的收件地址，泄露的旧地址立即失效
+func (h *InboundMailHandler) RotateAddress(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	token, err := h.Addresses.RotateToken(userID)
+	if err != nil {
+		log.Printf("轮换收件地址失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(inboundAddressResponse{Token: token, Address: h.address(r, token)})
+}
+
+// GetAttachments 列出待办事项的附件
+func (h *InboundMailHandler) GetAttachments(w http.ResponseWriter, r *http.Request, todoID int) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	attachments, err := h.Attachments.List(userID, todoID)
+	if err != nil {
+		if errors.Is(err, models.ErrTodoNotFound) {
+			http.Error(w, "Todo not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("获取附件列表失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(attachments)
+}
+
+// DownloadAttachment 下载附件。附件来自外部邮件，总是作为下载返回，不在浏览器中直接打开
+func (h *InboundMailHandler) DownloadAttachment(w http.ResponseWriter, r *http.Request, todoID, id int) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	attachment, err := h.Attachments.Get(userID, todoID, id)
+	if err != nil {
+		if errors.Is(err, models.ErrAttachmentNotFound) {
+			http.Error(w, "Attachment not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("获取附件失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+	w.Header().Set("Content-Length", strconv.Itoa(len(attachment.Data)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(attachment.Data)
+}
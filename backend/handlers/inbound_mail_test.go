@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TodoList/models"
+)
+
+func TestParseInlineTaskSyntax(t *testing.T) {
+	// 2024-05-01 是星期三
+	now := time.Date(2024, 5, 1, 23, 30, 0, 0, time.FixedZone("CST", 8*3600))
+	day := func(d int) string { return time.Date(2024, 5, d, 0, 0, 0, 0, time.UTC).Format(time.RFC3339) }
+
+	tests := []struct {
+		text, task, priority, tags, due string
+	}{
+		{"Pay invoice !high #billing due:friday", "Pay invoice", "high", "billing", day(3)},
+		{"Invoice #123 due:Wed", "Invoice #123", "", "", day(1)},
+		{"#Home #home fix sink !LOW due:tomorrow", "fix sink", "low", "Home", day(2)},
+		{"Plan trip due:2024-06-10", "Plan trip", "", "", "2024-06-10T00:00:00Z"},
+		{"Call back due:someday !urgent", "Call back due:someday !urgent", "", "", ""},
+		{"due:tuesday", "", "", "", day(7)},
+	}
+	for _, tt := range tests {
+		got := parseInlineTaskSyntax(tt.text, now)
+		due := ""
+		if got.DueDate != nil {
+			due = got.DueDate.Format(time.RFC3339)
+		}
+		if got.Task != tt.task || got.Priority != tt.priority || strings.Join(got.Tags, ",") != tt.tags || due != tt.due {
+			t.Errorf("parseInlineTaskSyntax(%q) = %+v (due %s)", tt.text, got, due)
+		}
+	}
+}
+
+const testMultipartMail = "From: Alice <alice@example.com>\r\n" +
+	"To: token@todo.example.com\r\n" +
+	"Subject: =?UTF-8?B?RndkOiDlj5Hnpagg?= !high #billing\r\n" +
+	"Date: Wed, 01 May 2024 09:00:00 +0200\r\n" +
+	"Message-ID: <abc@example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=outer\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=inner\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"Please pay by Friday =E2=80=94 thanks=\r\n" +
+	"!\r\n" +
+	"-- \r\n" +
+	"Alice\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html\r\n" +
+	"\r\n" +
+	"<p>Please pay</p>\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: application/pdf; name=\"invoice.pdf\"\r\n" +
+	"Content-Disposition: attachment; filename=\"../invoice.pdf\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERi0x\r\n" +
+	"LjQ=\r\n" +
+	"--outer--\r\n"
+
+func TestParseInboundMail(t *testing.T) {
+	parsed, err := parseInboundMail([]byte(testMultipartMail), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	todo := parsed.Todo
+	if todo.Task != "发票" || todo.Priority != "high" || strings.Join(todo.Tags, ",") != "billing" {
+		t.Errorf("todo = %+v", todo)
+	}
+	if todo.Description != "Please pay by Friday — thanks!" {
+		t.Errorf("description = %q", todo.Description)
+	}
+	if !strings.HasPrefix(todo.ClientID, "email:") || len(todo.ClientID) > 64 {
+		t.Errorf("client id = %q", todo.ClientID)
+	}
+	if len(parsed.Attachments) != 1 {
+		t.Fatalf("attachments = %+v", parsed.Attachments)
+	}
+	if a := parsed.Attachments[0]; a.Filename != "invoice.pdf" || a.ContentType != "application/pdf" || string(a.Data) != "%PDF-1.4" {
+		t.Errorf("attachment = %+v", a)
+	}
+
+	// 只有 HTML 正文、没有主题时使用正文的第一行作为任务；没有 Message-ID 时按内容生成 client_id
+	htmlMail := []byte("Content-Type: text/html\r\n\r\n" +
+		"<html><head><style>p{}</style></head><body><p>Renew &amp; file</p><p>passport</p></body></html>")
+	parsed, err = parseInboundMail(htmlMail, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Todo.Task != "Renew & file" || parsed.Todo.Description != "Renew & file\npassport" || parsed.Todo.ClientID != contentClientID("email", string(htmlMail)) {
+		t.Errorf("html todo = %+v", parsed.Todo)
+	}
+
+	// 过长的附件类型不能写入数据库，改为 application/octet-stream
+	longType := "application/x-" + strings.Repeat("a", 300)
+	parsed, err = parseInboundMail([]byte("Subject: long type\r\nContent-Type: "+longType+"\r\n\r\ndata"), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed.Attachments) != 1 || parsed.Attachments[0].ContentType != "application/octet-stream" {
+		t.Errorf("attachments = %+v", parsed.Attachments)
+	}
+
+	if _, err := parseInboundMail([]byte("Subject: \r\n\r\n  \r\n"), time.Now()); !errors.Is(err, errEmptyInboundMail) {
+		t.Errorf("empty message error = %v", err)
+	}
+}
+
+// memoryInboundMailStore 内存中的 InboundMailStore
+type memoryInboundMailStore struct {
+	mu          sync.Mutex
+	tokens      map[string]int
+	todos       []models.Todo
+	attachments []models.Attachment
+	errors      map[int]error // 保存到这些用户时返回的错误
+}
+
+func (s *memoryInboundMailStore) UserByToken(token string) (int, error) {
+	if id, ok := s.tokens[token]; ok {
+		return id, nil
+	}
+	return 0, models.ErrInboundAddressNotFound
+}
+
+func (s *memoryInboundMailStore) CreateFromMail(userID int, todo *models.Todo, attachments []models.Attachment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.errors[userID]; err != nil {
+		return err
+	}
+	for _, existing := range s.todos {
+		if existing.UserID == userID && todo.ClientID != "" && existing.ClientID == todo.ClientID {
+			return models.ErrDuplicateInboundMail
+		}
+	}
+	todo.UserID = userID
+	todo.ID = len(s.todos) + 1
+	s.todos = append(s.todos, *todo)
+	for _, a := range attachments {
+		a.TodoID = todo.ID
+		s.attachments = append(s.attachments, a)
+	}
+	return nil
+}
+
+func TestSMTPServer(t *testing.T) {
+	store := &memoryInboundMailStore{tokens: map[string]int{"aaaa": 1, "bbbb": 2}}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewSMTPServer(store, "todo.example.com")
+	go server.Serve(listener)
+	defer listener.Close()
+	addr := listener.Addr().String()
+
+	send := func(to ...string) error {
+		return smtp.SendMail(addr, nil, "alice@example.com", to, []byte(testMultipartMail))
+	}
+
+	if err := send("aaaa@todo.example.com", "BBBB@TODO.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	// 发件服务器重试投递同一封邮件时不重复创建
+	if err := send("aaaa@todo.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.todos) != 2 || store.todos[0].UserID != 1 || store.todos[1].UserID != 2 || store.todos[0].Task != "发票" {
+		t.Fatalf("todos = %+v", store.todos)
+	}
+	if len(store.attachments) != 2 || store.attachments[1].TodoID != 2 {
+		t.Errorf("attachments = %+v", store.attachments)
+	}
+
+	if err := send("cccc@todo.example.com"); err == nil || !strings.Contains(err.Error(), "550") {
+		t.Errorf("unknown mailbox error = %v", err)
+	}
+	if err := send("aaaa@other.example.com"); err == nil || !strings.Contains(err.Error(), "Relay") {
+		t.Errorf("other domain error = %v", err)
+	}
+
+	client, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if ok, size := client.Extension("SIZE"); !ok || size != "10485760" {
+		t.Errorf("SIZE extension = %v %q", ok, size)
+	}
+	if err := client.Rcpt("aaaa@todo.example.com"); err == nil {
+		t.Error("RCPT before MAIL accepted")
+	}
+	if err := client.Quit(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSMTPDeliverErrors(t *testing.T) {
+	rejected := fmt.Errorf("%w: invalid tag", models.ErrInboundMailRejected)
+	tests := []struct {
+		name   string
+		errors map[int]error
+		code   int
+		todos  int
+	}{
+		{"all saved", nil, 250, 2},
+		{"all rejected", map[int]error{1: rejected, 2: rejected}, 554, 0},
+		// 已经保存给其他收件人时接受邮件，被拒绝的收件人不会因重试而成功
+		{"partly rejected", map[int]error{2: rejected}, 250, 1},
+		{"temporary failure", map[int]error{2: errors.New("connection refused")}, 451, 1},
+	}
+	for _, tt := range tests {
+		store := &memoryInboundMailStore{errors: tt.errors}
+		code, _ := NewSMTPServer(store, "").deliver([]byte(testMultipartMail), []int{1, 2})
+		if code != tt.code || len(store.todos) != tt.todos {
+			t.Errorf("%s: code = %d, todos = %d", tt.name, code, len(store.todos))
+		}
+	}
+}
+
+func TestSMTPLineTooLong(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go NewSMTPServer(&memoryInboundMailStore{}, "").serveConn(server)
+
+	text := textproto.NewConn(client)
+	if _, _, err := text.ReadResponse(220); err != nil {
+		t.Fatal(err)
+	}
+	if err := text.PrintfLine("NOOP %s", strings.Repeat("x", 10*smtpMaxLineLength)); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, err := text.ReadResponse(250); code != 500 {
+		t.Errorf("long line: %d %v", code, err)
+	}
+	// 过长的行被整行丢弃，之后的命令正常处理
+	text.PrintfLine("NOOP")
+	if _, _, err := text.ReadResponse(250); err != nil {
+		t.Errorf("NOOP after long line: %v", err)
+	}
+}
+
+func TestParseSMTPPath(t *testing.T) {
+	if addr, params, ok := parseSMTPPath("from:<a@b.c> SIZE=100 BODY=8BITMIME", "FROM:"); !ok || addr != "a@b.c" || len(params) != 2 {
+		t.Errorf("path = %q %v %v", addr, params, ok)
+	}
+	if addr, _, ok := parseSMTPPath("FROM:<>", "FROM:"); !ok || addr != "" {
+		t.Errorf("null path = %q %v", addr, ok)
+	}
+	if addr, _, ok := parseSMTPPath("TO:<@relay.example:x@y.z>", "TO:"); !ok || addr != "x@y.z" {
+		t.Errorf("source route = %q %v", addr, ok)
+	}
+	for _, arg := range []string{"TO:a@b.c", "FROM:<a@b.c>", "TO:<a@b.c"} {
+		if _, _, ok := parseSMTPPath(arg, "TO:"); ok {
+			t.Errorf("parseSMTPPath(%q) accepted", arg)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package handlers
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TodoList/models"
+)
+
+// SMTP 会话的限制
+const (
+	smtpCommandTimeout = 5 * time.Minute
+	smtpMaxRecipients  = 100
+	smtpMaxErrors      = 10
+	smtpMaxLineLength  = 1000 // RFC 5321 文本行的上限（包括 CRLF）
+)
+
+// InboundMailStore 邮件网关使用的存储，由 models.InboundMailModel 实现
+type InboundMailStore interface {
+	UserByToken(token string) (int, error)
+	CreateFromMail(userID int, todo *models.Todo, attachments []models.Attachment) error
+}
+
+// SMTPServer 内置的收件 SMTP 服务：接收发往 <token>@Domain 的邮件并转换为对应用户的待办事项。
+// 只做收件，不转发，也不需要认证，收件地址中的令牌就是凭据。可以直接暴露在 25 端口上作为
+// 该域名的 MX，也可以放在已有邮件服务器后面由其转发
+type SMTPServer struct {
+	Store    InboundMailStore
+	Domain   string // 收件域名，为空时接受任意域名
+	Hostname string // 问候语中的主机名
+}
+
+// NewSMTPServer 创建一个新的SMTPServer实例
+func NewSMTPServer(store InboundMailStore, domain string) *SMTPServer {
+	hostname := domain
+	if hostname == "" {
+		hostname = "localhost"
+	}
+	return &SMTPServer{Store: store, Domain: domain, Hostname: hostname}
+}
+
+// ListenAndServe 在 addr 上监听并处理 SMTP 连接
+func (s *SMTPServer) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve 处理 listener 上的连接，直到 listener 关闭
+func (s *SMTPServer) Serve(listener net.Listener) error {
+	defer listener.Close()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// smtpSession 一个连接上的会话状态
+type smtpSession struct {
+	server *SMTPServer
+	conn   net.Conn
+	text   *textproto.Conn
+	helo   bool
+	from   *string
+	users  []int
+	errors int
+}
+
+// serveConn 处理一个 SMTP 连接
+func (s *SMTPServer) serveConn(conn net.Conn) {
+	session := &smtpSession{server: s, conn: conn, text: textproto.NewConn(conn)}
+	defer session.text.Close()
+
+	session.reply(220, s.Hostname+" ESMTP TodoList")
+	for {
+		conn.SetDeadline(time.Now().Add(smtpCommandTimeout))
+		line, err := session.readLine()
+		switch {
+		case errors.Is(err, errSMTPLineTooLong):
+			session.fail(500, "5.5.2 Line too long")
+		case err != nil:
+			return
+		default:
+			verb, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+			if !session.handle(strings.ToUpper(verb), strings.TrimSpace(arg)) {
+				return
+			}
+		}
+		if session.errors >= smtpMaxErrors {
+			session.reply(421, "4.7.0 Too many errors, closing connection")
+			return
+		}
+	}
+}
+
+// errSMTPLineTooLong 命令行超过 smtpMaxLineLength
+var errSMTPLineTooLong = errors.New("line too long")
+
+// readLine 读取一行命令并去掉行尾的 CRLF。textproto.Reader.ReadLine 不限制行的长度，
+// 这里超过 smtpMaxLineLength 时丢弃该行的其余部分并返回 errSMTPLineTooLong，
+// 避免客户端发送一个无限长的行耗尽内存
+func (c *smtpSession) readLine() (string, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := c.text.R.ReadSlice('\n')
+		if !tooLong && len(line)+len(chunk) <= smtpMaxLineLength {
+			line = append(line, chunk...)
+		} else {
+			tooLong, line = true, nil
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		break
+	}
+	if tooLong {
+		return "", errSMTPLineTooLong
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// reply 写入一行响应
+func (c *smtpSession) reply(code int, msg string) {
+	c.text.PrintfLine("%d %s", code, msg)
+}
+
+// fail 写入错误响应并计数
+func (c *smtpSession) fail(code int, msg string) {
+	c.errors++
+	c.reply(code, msg)
+}
+
+// reset 清除当前邮件事务
+func (c *smtpSession) reset() {
+	c.from = nil
+	c.users = nil
+}
+
+// handle 处理一条命令，返回 false 时关闭连接
+func (c *smtpSession) handle(verb, arg string) bool {
+	switch verb {
+	case "HELO", "EHLO":
+		if arg == "" {
+			c.fail(501, "5.5.4 Syntax: "+verb+" hostname")
+			return true
+		}
+		c.reset()
+		c.helo = true
+		if verb == "HELO" {
+			c.reply(250, c.server.Hostname)
+			return true
+		}
+		c.text.PrintfLine("250-%s", c.server.Hostname)
+		c.text.PrintfLine("250-SIZE %d", maxInboundMailSize)
+		c.text.PrintfLine("250-8BITMIME")
+		c.reply(250, "ENHANCEDSTATUSCODES")
+	case "MAIL":
+		c.mail(arg)
+	case "RCPT":
+		c.rcpt(arg)
+	case "DATA":
+		c.data()
+	case "RSET":
+		c.reset()
+		c.reply(250, "2.0.0 Ok")
+	case "NOOP":
+		c.reply(250, "2.0.0 Ok")
+	case "VRFY":
+		c.reply(252, "2.5.0 Cannot verify user")
+	case "QUIT":
+		c.reply(221, "2.0.0 Bye")
+		return false
+	case "STARTTLS", "AUTH", "BDAT", "EXPN", "TURN", "ETRN":
+		c.fail(502, "5.5.1 Command not implemented")
+	default:
+		c.fail(500, "5.5.2 Command not recognized")
+	}
+	return true
+}
+
+// mail 处理 MAIL FROM:<address> [SIZE=n]
+func (c *smtpSession) mail(arg string) {
+	if !c.helo {
+		c.fail(503, "5.5.1 Send HELO/EHLO first")
+		return
+	}
+	if c.from != nil {
+		c.fail(503, "5.5.1 Sender already specified")
+		return
+	}
+	from, params, ok := parseSMTPPath(arg, "FROM:")
+	if !ok {
+		c.fail(501, "5.5.4 Syntax: MAIL FROM:<address>")
+		return
+	}
+	for _, param := range params {
+		key, value, _ := strings.Cut(param, "=")
+		if strings.EqualFold(key, "SIZE") {
+			if size, err := strconv.Atoi(value); err == nil && size > maxInboundMailSize {
+				c.fail(552, "5.3.4 Message too big")
+				return
+			}
+		}
+	}
+	c.from = &from
+	c.reply(250, "2.1.0 Ok")
+}
+
+// rcpt 处理 RCPT TO:<token@domain>，地址的本地部分是用户收件地址的令牌
+func (c *smtpSession) rcpt(arg string) {
+	if c.from == nil {
+		c.fail(503, "5.5.1 Send MAIL first")
+		return
+	}
+	if len(c.users) >= smtpMaxRecipients {
+		c.fail(452, "4.5.3 Too many recipients")
+		return
+	}
+	to, _, ok := parseSMTPPath(arg, "TO:")
+	if !ok || to == "" {
+		c.fail(501, "5.5.4 Syntax: RCPT TO:<address>")
+		return
+	}
+
+	local, domain, ok := strings.Cut(to, "@")
+	if !ok || (c.server.Domain != "" && !strings.EqualFold(domain, c.server.Domain)) {
+		c.fail(550, "5.7.1 Relay not permitted")
+		return
+	}
+	userID, err := c.server.Store.UserByToken(strings.ToLower(local))
+	if err != nil {
+		if errors.Is(err, models.ErrInboundAddressNotFound) {
+			c.fail(550, "5.1.1 No such mailbox")
+			return
+		}
+		log.Printf("查询收件地址失败: %v", err)
+		c.reply(451, "4.3.0 Temporary failure, try again later")
+		return
+	}
+
+	for _, id := range c.users {
+		if id == userID {
+			c.reply(250, "2.1.5 Ok")
+			return
+		}
+	}
+	c.users = append(c.users, userID)
+	c.reply(250, "2.1.5 Ok")
+}
+
+// data 接收邮件内容并为每个收件人创建待办事项
+func (c *smtpSession) data() {
+	if len(c.users) == 0 {
+		c.fail(503, "5.5.1 Send RCPT first")
+		return
+	}
+	c.reply(354, "End data with <CR><LF>.<CR><LF>")
+
+	c.conn.SetDeadline(time.Now().Add(smtpCommandTimeout))
+	reader := c.text.DotReader()
+	raw, err := io.ReadAll(io.LimitReader(reader, maxInboundMailSize+1))
+	if err != nil {
+		c.reset()
+		c.reply(451, "4.3.0 Error reading message")
+		return
+	}
+	if len(raw) > maxInboundMailSize {
+		io.Copy(io.Discard, reader)
+		c.reset()
+		c.fail(552, "5.3.4 Message too big")
+		return
+	}
+
+	users := c.users
+	c.reset()
+	code, msg := c.server.deliver(raw, users)
+	c.reply(code, msg)
+}
+
+// deliver 解析邮件并为每个收件人创建待办事项，返回 SMTP 响应。某个收件人遇到临时错误时返回 451
+// 让发件服务器重试，已经保存的收件人根据 client_id 跳过；所有收件人都因邮件内容无法保存时返回 554，
+// 避免发件服务器反复重试一封永远无法保存的邮件
+func (s *SMTPServer) deliver(raw []byte, users []int) (int, string) {
+	parsed, err := parseInboundMail(raw, time.Now())
+	if err != nil {
+		return 554, "5.6.0 " + err.Error()
+	}
+
+	saved, rejected, failed := 0, 0, 0
+	for _, userID := range users {
+		todo := parsed.Todo
+		todo.Tags = append([]string(nil), parsed.Todo.Tags...)
+		attachments := append([]models.Attachment(nil), parsed.Attachments...)
+		err := s.Store.CreateFromMail(userID, &todo, attachments)
+		switch {
+		case err == nil, errors.Is(err, models.ErrDuplicateInboundMail):
+			saved++
+		case errors.Is(err, models.ErrInboundMailRejected):
+			log.Printf("邮件无法转换为待办事项（用户 %d）: %v", userID, err)
+			rejected++
+		default:
+			log.Printf("邮件转换为待办事项失败（用户 %d）: %v", userID, err)
+			failed++
+		}
+	}
+	switch {
+	case failed > 0:
+		return 451, "4.3.0 Temporary failure, try again later"
+	case saved == 0 && rejected > 0:
+		return 554, "5.6.0 Message could not be saved"
+	}
+	return 250, "2.0.0 Ok: message accepted"
+}
+
+// parseSMTPPath 解析 MAIL/RCPT 的参数 "FROM:<address> PARAM=value ..."，返回地址和扩展参数。
+// 空路径 <> 返回空地址（退信）
+func parseSMTPPath(arg, prefix string) (string, []string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", nil, false
+	}
+	rest := strings.TrimSpace(arg[len(prefix):])
+	if !strings.HasPrefix(rest, "<") {
+		return "", nil, false
+	}
+	end := strings.Index(rest, ">")
+	if end < 0 {
+		return "", nil, false
+	}
+	address := rest[1:end]
+	// 去掉源路由 <@a,@b:user@host>
+	if strings.HasPrefix(address, "@") {
+		if i := strings.Index(address, ":"); i >= 0 {
+			address = address[i+1:]
+		}
+	}
+	return address, strings.Fields(rest[end+1:]), true
+}
@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// PatchError 补丁文档无法应用。Conflict 为 true 表示 test 操作失败（对应 409），
+// 否则表示补丁本身无效（对应 400/422）。
+type PatchError struct {
+	Op       int // JSON Patch 中操作的下标，从0开始；合并补丁为 -1
+	Message  string
+	Conflict bool
+}
+
+func (e *PatchError) Error() string {
+	if e.Op < 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("operation %d: %s", e.Op, e.Message)
+}
+
+// jsonPatchOperation RFC 6902 的一个操作
+type jsonPatchOperation struct {
+	Op    string           `json:"op"`
+	Path  *string          `json:"path"`
+	From  *string          `json:"from"`
+	Value *json.RawMessage `json:"value"`
+}
+
+// applyMergePatch 按 RFC 7396 把合并补丁应用到文档：对象逐键合并，null 删除键，其他值整体替换
+func applyMergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = applyMergePatch(targetObject[key], value)
+	}
+	return targetObject
+}
+
+// applyJSONPatch 按 RFC 6902 依次应用操作（add, remove, replace, move, copy, test），
+// 任意操作失败时返回错误，文档应视为未修改
+func applyJSONPatch(doc interface{}, patch []byte) (interface{}, error) {
+	var ops []jsonPatchOperation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, &PatchError{Op: -1, Message: "patch must be an array of operations"}
+	}
+
+	for i, op := range ops {
+		if op.Path == nil {
+			return nil, &PatchError{Op: i, Message: `missing "path"`}
+		}
+		path, err := parsePointer(*op.Path)
+		if err != nil {
+			return nil, &PatchError{Op: i, Message: err.Error()}
+		}
+
+		var value interface{}
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return nil, &PatchError{Op: i, Message: `missing "value"`}
+			}
+			if err := json.Unmarshal(*op.Value, &value); err != nil {
+				return nil, &PatchError{Op: i, Message: "invalid value"}
+			}
+		case "move", "copy":
+			if op.From == nil {
+				return nil, &PatchError{Op: i, Message: `missing "from"`}
+			}
+			from, err := parsePointer(*op.From)
+			if err != nil {
+				return nil, &PatchError{Op: i, Message: err.Error()}
+			}
+			if op.Op == "move" {
+				if isPointerPrefix(from, path) && len(from) < len(path) {
+					return nil, &PatchError{Op: i, Message: "cannot move a value into one of its children"}
+				}
+				if doc, value, err = removePointer(doc, from); err != nil {
+					return nil, &PatchError{Op: i, Message: err.Error()}
+				}
+			} else {
+				source, err := getPointer(doc, from)
+				if err != nil {
+					return nil, &PatchError{Op: i, Message: err.Error()}
+				}
+				value = deepCopyJSON(source)
+			}
+		case "remove":
+		default:
+			return nil, &PatchError{Op: i, Message: fmt.Sprintf("unknown operation %q", op.Op)}
+		}
+
+		switch op.Op {
+		case "add", "move", "copy":
+			doc, err = setPointer(doc, path, value, true)
+		case "replace":
+			doc, err = setPointer(doc, path, value, false)
+		case "remove":
+			doc, _, err = removePointer(doc, path)
+		case "test":
+			var current interface{}
+			if current, err = getPointer(doc, path); err == nil && !reflect.DeepEqual(current, value) {
+				return nil, &PatchError{Op: i, Message: fmt.Sprintf("test failed at %q", *op.Path), Conflict: true}
+			}
+		}
+		if err != nil {
+			return nil, &PatchError{Op: i, Message: err.Error()}
+		}
+	}
+
+	return doc, nil
+}
+
+// parsePointer 解析 RFC 6901 JSON Pointer，返回未转义的引用片段
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// isPointerPrefix 判断 prefix 是否为 path 的前缀
+func isPointerPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// arrayIndex 解析数组下标；allowEnd 时 "-" 和 len 表示追加到末尾
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if allowEnd && token == "-" {
+		return length, nil
+	}
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if index > length || (!allowEnd && index == length) {
+		return 0, fmt.Errorf("array index %d out of range", index)
+	}
+	return index, nil
+}
+
+// getPointer 返回指针引用的值
+func getPointer(doc interface{}, path []string) (interface{}, error) {
+	node := doc
+	for _, token := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			value, ok := n[token]
+			if !ok {
+				return nil, fmt.Errorf("path %q does not exist", token)
+			}
+			node = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			node = n[index]
+		default:
+			return nil, fmt.Errorf("path %q does not exist", token)
+		}
+	}
+	return node, nil
+}
+
+// setPointer 在指针位置写入值。insert 为 true 时是 add 语义（数组插入，对象新增或覆盖键），
+// 否则是 replace 语义（目标必须已存在）。返回修改后的根节点。
+func setPointer(node interface{}, path []string, value interface{}, insert bool) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	token, rest := path[0], path[1:]
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[token]
+		if len(rest) == 0 {
+			if !ok && !insert {
+				return nil, fmt.Errorf("path %q does not exist", token)
+			}
+			n[token] = value
+			return n, nil
+		}
+		if !ok {
+			return nil, fmt.Errorf("path %q does not exist", token)
+		}
+		updated, err := setPointer(child, rest, value, insert)
+		if err != nil {
+			return nil, err
+		}
+		n[token] = updated
+		return n, nil
+	case []interface{}:
+		if len(rest) == 0 && insert {
+			index, err := arrayIndex(token, len(n), true)
+			if err != nil {
+				return nil, err
+			}
+			n = append(n, nil)
+			copy(n[index+1:], n[index:])
+			n[index] = value
+			return n, nil
+		}
+		index, err := arrayIndex(token, len(n), false)
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) == 0 {
+			n[index] = value
+			return n, nil
+		}
+		updated, err := setPointer(n[index], rest, value, insert)
+		if err != nil {
+			return nil, err
+		}
+		n[index] = updated
+		return n, nil
+	}
+	return nil, fmt.Errorf("path %q does not exist", token)
+}
+
+// removePointer 删除指针位置的值，返回修改后的根节点和被删除的值
+func removePointer(node interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("cannot remove the whole document")
+	}
+	token, rest := path[0], path[1:]
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("path %q does not exist", token)
+		}
+		if len(rest) == 0 {
+			delete(n, token)
+			return n, child, nil
+		}
+		updated, removed, err := removePointer(child, rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		n[token] = updated
+		return n, removed, nil
+	case []interface{}:
+		index, err := arrayIndex(token, len(n), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(rest) == 0 {
+			removed := n[index]
+			return append(n[:index], n[index+1:]...), removed, nil
+		}
+		updated, removed, err := removePointer(n[index], rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		n[index] = updated
+		return n, removed, nil
+	}
+	return nil, nil, fmt.Errorf("path %q does not exist", token)
+}
+
+// deepCopyJSON 复制由 encoding/json 解码得到的值
+func deepCopyJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = deepCopyJSON(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = deepCopyJSON(item)
+		}
+		return copied
+	}
+	return value
+}
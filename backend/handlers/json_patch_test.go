@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/TodoList/models"
+)
+
+func decodeJSON(t *testing.T, s string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("invalid JSON %s: %v", s, err)
+	}
+	return v
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	// RFC 7396 附录A中的部分示例
+	tests := []struct{ target, patch, want string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		got := applyMergePatch(decodeJSON(t, tt.target), decodeJSON(t, tt.patch))
+		if want := decodeJSON(t, tt.want); !reflect.DeepEqual(got, want) {
+			t.Errorf("merge %s with %s = %v, want %v", tt.target, tt.patch, got, want)
+		}
+	}
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	tests := []struct{ doc, patch, want string }{
+		{`{"tags":["a"]}`, `[{"op":"add","path":"/tags/-","value":"b"}]`, `{"tags":["a","b"]}`},
+		{`{"tags":["a","c"]}`, `[{"op":"add","path":"/tags/1","value":"b"}]`, `{"tags":["a","b","c"]}`},
+		{`{"tags":["a","b"]}`, `[{"op":"remove","path":"/tags/0"}]`, `{"tags":["b"]}`},
+		{`{"task":"x"}`, `[{"op":"replace","path":"/task","value":"y"}]`, `{"task":"y"}`},
+		{
+			`{"steps":[{"id":1,"content":"a","completed":false}]}`,
+			`[{"op":"replace","path":"/steps/0/completed","value":true},{"op":"add","path":"/steps/-","value":{"content":"b"}}]`,
+			`{"steps":[{"id":1,"content":"a","completed":true},{"content":"b"}]}`,
+		},
+		{`{"a":{"b":1},"c":[]}`, `[{"op":"move","from":"/a/b","path":"/c/0"}]`, `{"a":{},"c":[1]}`},
+		{`{"a":[1],"b":null}`, `[{"op":"copy","from":"/a","path":"/b"},{"op":"add","path":"/b/-","value":2}]`, `{"a":[1],"b":[1,2]}`},
+		{`{"a/b":1,"m~n":2}`, `[{"op":"remove","path":"/a~1b"},{"op":"test","path":"/m~0n","value":2}]`, `{"m~n":2}`},
+	}
+
+	for _, tt := range tests {
+		got, err := applyJSONPatch(decodeJSON(t, tt.doc), []byte(tt.patch))
+		if err != nil {
+			t.Errorf("patch %s: %v", tt.patch, err)
+			continue
+		}
+		if want := decodeJSON(t, tt.want); !reflect.DeepEqual(got, want) {
+			t.Errorf("patch %s = %v, want %v", tt.patch, got, want)
+		}
+	}
+}
+
+func TestApplyJSONPatchErrors(t *testing.T) {
+	tests := []struct {
+		patch    string
+		op       int
+		conflict bool
+	}{
+		{`{"op":"add"}`, -1, false},
+		{`[{"op":"replace","path":"/missing","value":1}]`, 0, false},
+		{`[{"op":"add","path":"/tags/5","value":1}]`, 0, false},
+		{`[{"op":"remove","path":"/tags/01"}]`, 0, false},
+		{`[{"op":"add","path":"/x","value":1},{"op":"test","path":"/x","value":2}]`, 1, true},
+		{`[{"op":"move","from":"/tags","path":"/tags/0"}]`, 0, false},
+		{`[{"op":"add","path":"/x"}]`, 0, false},
+		{`[{"op":"frobnicate","path":"/x"}]`, 0, false},
+		{`[{"op":"remove","path":"tags"}]`, 0, false},
+	}
+
+	for _, tt := range tests {
+		_, err := applyJSONPatch(decodeJSON(t, `{"tags":["a"]}`), []byte(tt.patch))
+		var patchErr *PatchError
+		if !errors.As(err, &patchErr) {
+			t.Errorf("patch %s: error = %v, want *PatchError", tt.patch, err)
+			continue
+		}
+		if patchErr.Op != tt.op || patchErr.Conflict != tt.conflict {
+			t.Errorf("patch %s: error = %+v, want op %d conflict %v", tt.patch, patchErr, tt.op, tt.conflict)
+		}
+	}
+}
+
+func TestPatchTodoDocument(t *testing.T) {
+	todo := models.Todo{
+		ID:       7,
+		Task:     "write report",
+		Priority: "medium",
+		Category: "work",
+		Tags:     []string{"q3"},
+		Steps:    []models.Step{{ID: 1, TodoID: 7, Content: "outline"}},
+		UserID:   3,
+		Status:   "backlog",
+		Version:  4,
+	}
+
+	tests := []struct {
+		contentType string
+		patch       string
+		fields      []string
+		field       string // 期望的字段错误
+	}{
+		{mergePatchType, `{"priority":"high","description":"draft"}`, []string{"description", "priority"}, ""},
+		{mergePatchType, `{"tags":null}`, []string{"tags"}, ""},
+		{mergePatchType, `{"description":null,"dueDate":null}`, nil, ""},
+		{jsonPatchType, `[{"op":"add","path":"/tags/-","value":"urgent"}]`, []string{"tags"}, ""},
+		{jsonPatchType, `[{"op":"remove","path":"/steps/0"}]`, []string{"steps"}, ""},
+		{jsonPatchType, `[{"op":"test","path":"/version","value":4},{"op":"replace","path":"/done","value":true}]`, []string{"done"}, ""},
+		{mergePatchType, `{"version":9}`, nil, "version"},
+		{mergePatchType, `{"userId":1}`, nil, "userId"},
+		{mergePatchType, `{"owner":"me"}`, nil, "owner"},
+	}
+
+	for _, tt := range tests {
+		_, fields, err := patchTodoDocument(todo, tt.contentType, []byte(tt.patch))
+		if tt.field != "" {
+			var fieldErr *models.TodoFieldError
+			if !errors.As(err, &fieldErr) || fieldErr.Field != tt.field {
+				t.Errorf("patch %s: error = %v, want field error on %s", tt.patch, err, tt.field)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("patch %s: %v", tt.patch, err)
+			continue
+		}
+		if !reflect.DeepEqual(fields, tt.fields) {
+			t.Errorf("patch %s: changed fields = %v, want %v", tt.patch, fields, tt.fields)
+		}
+	}
+}
+
+func TestDecodeTodoDocumentFieldErrors(t *testing.T) {
+	tests := []struct{ doc, field string }{
+		{`{"task":1}`, "task"},
+		{`{"estimatedTime":"soon"}`, "estimatedTime"},
+		{`{"dueDate":"tomorrow"}`, "dueDate"},
+	}
+	for _, tt := range tests {
+		_, err := decodeTodoDocument(decodeJSON(t, tt.doc).(map[string]interface{}))
+		var fieldErr *models.TodoFieldError
+		if !errors.As(err, &fieldErr) || fieldErr.Field != tt.field {
+			t.Errorf("decode %s: error = %v, want field error on %s", tt.doc, err, tt.field)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/TodoList/models"
+)
+
+// ListEnvelope 游标分页列表的统一响应格式
+type ListEnvelope struct {
+	Data       interface{}     `json:"data"`
+	Pagination models.PageInfo `json:"pagination"`
+}
+
+// parsePageRequest 解析 cursor、limit、withTotal 参数
+func parsePageRequest(r *http.Request) models.PageRequest {
+	query := r.URL.Query()
+	withTotal, _ := strconv.ParseBool(query.Get("withTotal"))
+	return models.PageRequest{
+		Cursor:    query.Get("cursor"),
+		Limit:     getQueryParamInt(r, "limit", models.DefaultPageLimit),
+		WithTotal: withTotal,
+	}
+}
+
+// wantsCursorPage 请求中带有 cursor 或 limit 时使用游标分页；
+// 否则保持原有行为（v1 返回完整数组，v2 使用 page/pageSize）
+func wantsCursorPage(r *http.Request) bool {
+	query := r.URL.Query()
+	return query.Get("page") == "" && (query.Has("cursor") || query.Has("limit"))
+}
+
+// includeSteps 解析 include 参数（逗号分隔），未指定时使用 defaultValue
+func includeSteps(r *http.Request, defaultValue bool) bool {
+	if !r.URL.Query().Has("include") {
+		return defaultValue
+	}
+	for _, part := range strings.Split(r.URL.Query().Get("include"), ",") {
+		if strings.TrimSpace(part) == "steps" {
+			return true
+		}
+	}
+	return false
+}
+
+// pageLink 生成替换了部分查询参数后的相对链接
+func pageLink(r *http.Request, set map[string]string, del ...string) string {
+	query := r.URL.Query()
+	for _, key := range del {
+		query.Del(key)
+	}
+	for key, value := range set {
+		query.Set(key, value)
+	}
+	link := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	return link.String()
+}
+
+// setLinkHeader 按 RFC 8288 设置 first/next 链接
+func setLinkHeader(w http.ResponseWriter, links map[string]string) {
+	var parts []string
+	for _, rel := range []string{"first", "prev", "next"} {
+		if href, ok := links[rel]; ok {
+			parts = append(parts, "<"+href+">; rel=\""+rel+"\"")
+		}
+	}
+	if len(parts) > 0 {
+		w.Header().Set("Link", strings.Join(parts, ", "))
+	}
+}
+
+// writeCursorPage 输出游标分页的列表和 Link 头
+func writeCursorPage(w http.ResponseWriter, r *http.Request, data interface{}, info models.PageInfo, extra map[string]interface{}) {
+	links := map[string]string{"first": pageLink(r, nil, "cursor")}
+	if info.NextCursor != "" {
+		links["next"] = pageLink(r, map[string]string{"cursor": info.NextCursor})
+	}
+	setLinkHeader(w, links)
+
+	w.Header().Set("Content-Type", "application/json")
+	if extra == nil {
+		json.NewEncoder(w).Encode(ListEnvelope{Data: data, Pagination: info})
+		return
+	}
+
+	response := map[string]interface{}{"data": data, "pagination": info}
+	for key, value := range extra {
+		response[key] = value
+	}
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/TodoList/models"
+)
+
+// IDResolver 把路由中的 UUID 解析为整数ID，使所有路由同时接受整数ID和 UUID
+type IDResolver struct {
+	Todos *models.TodoModel
+	Users *models.UserModel
+}
+
+// NewIDResolver 创建一个新的IDResolver实例
+func NewIDResolver(todos *models.TodoModel, users *models.UserModel) *IDResolver {
+	return &IDResolver{Todos: todos, Users: users}
+}
+
+// resolve 按路径中前一段的资源名解析 UUID，返回 false 表示这一段不需要解析
+func (h *IDResolver) resolve(resource, ref string) (int, bool, error) {
+	switch resource {
+	case "todos":
+		id, err := h.Todos.ResolveTodoID(ref)
+		return id, true, err
+	case "steps":
+		id, err := h.Todos.ResolveStepID(ref)
+		return id, true, err
+	case "user-todos", "user-backups":
+		id, err := h.Users.ResolveUserID(ref)
+		return id, true, err
+	}
+	return 0, false, nil
+}
+
+// Middleware 把路径中紧跟在 todos、steps、user-todos、user-backups 之后的 UUID 替换为对应的整数ID，
+// 之后的路由和处理器只需要解析整数ID。UUID 不存在时返回 404。
+func (h *IDResolver) Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(r.URL.Path, "/")
+		changed := false
+		for i := 1; i < len(parts); i++ {
+			if _, err := models.ParseUUID(parts[i]); err != nil {
+				continue
+			}
+			id, ok, err := h.resolve(parts[i-1], parts[i])
+			if !ok {
+				continue
+			}
+			if err != nil {
+				if errors.Is(err, models.ErrTodoNotFound) || errors.Is(err, models.ErrStepNotFound) ||
+					errors.Is(err, models.ErrUserNotFound) {
+					http.Error(w, "Not found", http.StatusNotFound)
+					return
+				}
+				log.Printf("解析UUID失败: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			parts[i] = strconv.Itoa(id)
+			changed = true
+		}
+
+		if changed {
+			url := *r.URL
+			url.Path = strings.Join(parts, "/")
+			url.RawPath = ""
+			resolved := *r
+			resolved.URL = &url
+			r = &resolved
+		}
+		next(w, r)
+	}
+}
+
+// idRef 请求体中的ID，可以是整数或 UUID 字符串
+type idRef string
+
+// UnmarshalJSON 接受 JSON 数字或字符串
+func (ref *idRef) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*ref = idRef(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return errors.New("id must be an integer or a uuid")
+	}
+	*ref = idRef(n.String())
+	return nil
+}
+
+// pathID 读取路径中第 index 段的整数ID（UUID 已经由 IDResolver 解析）
+func pathID(r *http.Request, index int) (int, bool) {
+	parts := strings.Split(r.URL.Path, "/")
+	if index >= len(parts) {
+		return 0, false
+	}
+	id, err := strconv.Atoi(parts[index])
+	return id, err == nil
+}
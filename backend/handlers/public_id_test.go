@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIDRefUnmarshal(t *testing.T) {
+	cases := map[string]idRef{
+		`{"id": 42}`: "42",
+		`{"id": "0190a6e2-3c4b-7d8e-9f01-23456789abcd"}`: "0190a6e2-3c4b-7d8e-9f01-23456789abcd",
+	}
+	for body, want := range cases {
+		var data struct {
+			ID idRef `json:"id"`
+		}
+		if err := json.Unmarshal([]byte(body), &data); err != nil || data.ID != want {
+			t.Errorf("%s: id = %q, %v, want %q", body, data.ID, err, want)
+		}
+	}
+
+	var data struct {
+		ID idRef `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(`{"id": true}`), &data); err == nil {
+		t.Error("boolean id accepted")
+	}
+}
+
+func TestIDResolverPassesThroughIntegerIDs(t *testing.T) {
+	// 不需要解析时不会访问数据库
+	resolver := NewIDResolver(nil, nil)
+	for _, path := range []string{
+		"/api/todos/42/steps/7",
+		"/api/v2/tags/0190a6e2-3c4b-7d8e-9f01-23456789abcd",
+	} {
+		var got string
+		handler := resolver.Middleware(func(w http.ResponseWriter, r *http.Request) {
+			got = r.URL.Path
+		})
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+		if got != path {
+			t.Errorf("path %s rewritten to %s", path, got)
+		}
+	}
+}
@@ -0,0 +1,641 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/TodoList/models"
+)
+
+// 待办事项查询语言，例如：
+//
+//	priority:high,medium tag:billing due:<7d -status:done "exact phrase" (category:work OR assignee:me)
+//
+// 相邻的条件按 AND 组合，OR 的优先级低于 AND，可以用括号分组；
+// "-" 或 NOT 表示取反；field:a,b 表示字段匹配任意一个值。
+// 查询先被解析为 AST，再编译为参数化的 SQL 条件，所有值都通过参数传递。
+
+// QueryError 查询语言的解析错误，Pos 是从1开始的字符位置
+type QueryError struct {
+	Pos     int
+	Message string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("query error at position %d: %s", e.Pos, e.Message)
+}
+
+// queryTokenKind 词法单元类型
+type queryTokenKind int
+
+const (
+	tokWord queryTokenKind = iota
+	tokLParen
+	tokRParen
+	tokOr
+	tokAnd
+	tokNot
+	tokEOF
+)
+
+// queryToken 词法单元，pos 是从1开始的字符位置
+type queryToken struct {
+	kind queryTokenKind
+	text string
+	pos  int
+}
+
+// queryNode 查询语言的AST节点
+type queryNode interface{}
+
+type andNode struct{ children []queryNode }
+
+type orNode struct{ children []queryNode }
+
+type notNode struct{ child queryNode }
+
+// termNode 单个条件；field 为空表示全文搜索词
+type termNode struct {
+	field  string
+	op     string // =, >, >=, <, <=, ~
+	values []string
+	phrase bool // 带引号的短语
+	pos    int
+}
+
+// queryFields 查询语言支持的字段，cf.<key> 另外处理
+var queryFields = map[string]bool{
+	"status": true, "priority": true, "category": true, "tag": true, "title": true,
+	"due": true, "created": true, "updated": true, "completed": true,
+	"assignee": true, "has": true,
+}
+
+// queryDateColumns 日期字段对应的列
+var queryDateColumns = map[string]string{
+	"due":       "due_date",
+	"created":   "created_at",
+	"updated":   "updated_at",
+	"completed": "completed_at",
+}
+
+var (
+	queryFieldPattern    = regexp.MustCompile(`^(?:[a-z]+|cf\.[a-z][a-z0-9_]*)$`)
+	relativeDatePattern  = regexp.MustCompile(`^([+-]?\d{1,4})([hdwm])$`)
+	relativeIntervalUnit = map[string]string{"h": "hours", "d": "days", "w": "weeks", "m": "months"}
+)
+
+// lexQuery 把查询字符串切分为词法单元
+func lexQuery(input string) ([]queryToken, error) {
+	runes := []rune(input)
+	var tokens []queryToken
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: tokLParen, text: "(", pos: i + 1})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: tokRParen, text: ")", pos: i + 1})
+			i++
+		case r == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) && runes[i+1] != ')':
+			tokens = append(tokens, queryToken{kind: tokNot, text: "-", pos: i + 1})
+			i++
+		default:
+			start := i
+			inQuote, quoteStart := false, 0
+			for ; i < len(runes); i++ {
+				c := runes[i]
+				if inQuote {
+					if c == '\\' && i+1 < len(runes) {
+						i++
+					} else if c == '"' {
+						inQuote = false
+					}
+					continue
+				}
+				if c == '"' {
+					inQuote, quoteStart = true, i
+					continue
+				}
+				if unicode.IsSpace(c) || c == '(' || c == ')' {
+					break
+				}
+			}
+			if inQuote {
+				return nil, &QueryError{Pos: quoteStart + 1, Message: "unterminated quote"}
+			}
+
+			text := string(runes[start:i])
+			kind := tokWord
+			switch text {
+			case "OR":
+				kind = tokOr
+			case "AND":
+				kind = tokAnd
+			case "NOT":
+				kind = tokNot
+			}
+			tokens = append(tokens, queryToken{kind: kind, text: text, pos: start + 1})
+		}
+	}
+
+	tokens = append(tokens, queryToken{kind: tokEOF, pos: len(runes) + 1})
+	return tokens, nil
+}
+
+// queryParser 递归下降解析器
+type queryParser struct {
+	tokens []queryToken
+	index  int
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.index]
+}
+
+func (p *queryParser) next() queryToken {
+	tok := p.tokens[p.index]
+	if tok.kind != tokEOF {
+		p.index++
+	}
+	return tok
+}
+
+// parseQuery 解析查询字符串；空查询返回 nil
+func parseQuery(input string) (queryNode, error) {
+	tokens, err := lexQuery(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &queryParser{tokens: tokens}
+	if p.peek().kind == tokEOF {
+		return nil, nil
+	}
+
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, &QueryError{Pos: tok.pos, Message: fmt.Sprintf("unexpected %q", tok.text)}
+	}
+	return node, nil
+}
+
+// parseOr or := and (OR and)*
+func (p *queryParser) parseOr() (queryNode, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	children := []queryNode{first}
+	for p.peek().kind == tokOr {
+		p.next()
+		child, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+
+	if len(children) == 1 {
+		return first, nil
+	}
+	return &orNode{children: children}, nil
+}
+
+// parseAnd and := unary ([AND] unary)*
+func (p *queryParser) parseAnd() (queryNode, error) {
+	first, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	children := []queryNode{first}
+	for {
+		switch p.peek().kind {
+		case tokAnd:
+			p.next()
+		case tokWord, tokLParen, tokNot:
+		default:
+			if len(children) == 1 {
+				return first, nil
+			}
+			return &andNode{children: children}, nil
+		}
+
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+}
+
+// parseUnary unary := (- | NOT) unary | primary
+func (p *queryParser) parseUnary() (queryNode, error) {
+	if p.peek().kind == tokNot {
+		p.next()
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{child: child}, nil
+	}
+	return p.parsePrimary()
+}
+
+// parsePrimary primary := ( or ) | term
+func (p *queryParser) parsePrimary() (queryNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokLParen:
+		if p.peek().kind == tokRParen {
+			return nil, &QueryError{Pos: tok.pos, Message: "empty group"}
+		}
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokRParen {
+			return nil, &QueryError{Pos: tok.pos, Message: "missing closing parenthesis"}
+		}
+		p.next()
+		return node, nil
+	case tokWord:
+		return parseTerm(tok)
+	case tokEOF:
+		return nil, &QueryError{Pos: tok.pos, Message: "unexpected end of query"}
+	default:
+		return nil, &QueryError{Pos: tok.pos, Message: fmt.Sprintf("unexpected %q", tok.text)}
+	}
+}
+
+// parseTerm 解析 field:[op]value[,value...] 或搜索词
+func parseTerm(tok queryToken) (queryNode, error) {
+	raw := tok.text
+	colon := indexUnquoted(raw, ':')
+	if colon == -1 {
+		text := unquoteQueryValue(raw)
+		if text == "" {
+			return nil, &QueryError{Pos: tok.pos, Message: "empty search term"}
+		}
+		return &termNode{values: []string{text}, phrase: strings.HasPrefix(raw, `"`), pos: tok.pos}, nil
+	}
+
+	field := strings.ToLower(raw[:colon])
+	if !queryFieldPattern.MatchString(field) || (!queryFields[field] && !strings.HasPrefix(field, "cf.")) {
+		return nil, &QueryError{Pos: tok.pos, Message: fmt.Sprintf("unknown field %q", raw[:colon])}
+	}
+
+	rest := raw[colon+1:]
+	op := "="
+	for _, candidate := range []string{">=", "<=", ">", "<", "=", "~"} {
+		if strings.HasPrefix(rest, candidate) {
+			op, rest = candidate, rest[len(candidate):]
+			break
+		}
+	}
+
+	var values []string
+	for _, part := range splitUnquoted(rest, ',') {
+		value := unquoteQueryValue(part)
+		if value == "" {
+			return nil, &QueryError{Pos: tok.pos, Message: fmt.Sprintf("missing value for %s", field)}
+		}
+		values = append(values, value)
+	}
+	if op != "=" && len(values) > 1 {
+		return nil, &QueryError{Pos: tok.pos, Message: fmt.Sprintf("%s%s accepts a single value", field, op)}
+	}
+
+	return &termNode{field: field, op: op, values: values, pos: tok.pos}, nil
+}
+
+// indexUnquoted 返回引号外第一次出现 sep 的字节位置
+func indexUnquoted(s string, sep rune) int {
+	inQuote := false
+	for i, r := range s {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+		case r == sep && !inQuote:
+			return i
+		}
+	}
+	return -1
+}
+
+// splitUnquoted 按引号外的 sep 切分字符串
+func splitUnquoted(s string, sep rune) []string {
+	var parts []string
+	for {
+		idx := indexUnquoted(s, sep)
+		if idx == -1 {
+			return append(parts, s)
+		}
+		parts = append(parts, s[:idx])
+		s = s[idx+len(string(sep)):]
+	}
+}
+
+// unquoteQueryValue 去掉引号并处理引号内的 \ 转义
+func unquoteQueryValue(s string) string {
+	var b strings.Builder
+	inQuote := false
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+		case r == '\\' && inQuote && i+1 < len(runes):
+			i++
+			b.WriteRune(runes[i])
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// customFieldKeys 返回查询中引用的自定义字段key
+func customFieldKeys(node queryNode) []string {
+	var keys []string
+	switch n := node.(type) {
+	case *andNode:
+		for _, child := range n.children {
+			keys = append(keys, customFieldKeys(child)...)
+		}
+	case *orNode:
+		for _, child := range n.children {
+			keys = append(keys, customFieldKeys(child)...)
+		}
+	case *notNode:
+		keys = customFieldKeys(n.child)
+	case *termNode:
+		if strings.HasPrefix(n.field, "cf.") {
+			keys = append(keys, strings.TrimPrefix(n.field, "cf."))
+		}
+		if n.field == "has" {
+			for _, value := range n.values {
+				if strings.HasPrefix(value, "cf.") {
+					keys = append(keys, strings.TrimPrefix(value, "cf."))
+				}
+			}
+		}
+	}
+	return keys
+}
+
+// queryCompiler 把AST编译为参数化的SQL条件
+type queryCompiler struct {
+	args       []interface{}
+	argIndex   int
+	fieldTypes map[string]string // 自定义字段key到类型
+}
+
+// compileQuery 编译AST，参数占位符从 argIndex 开始编号
+func compileQuery(node queryNode, argIndex int, fieldTypes map[string]string) (string, []interface{}, error) {
+	c := &queryCompiler{argIndex: argIndex, fieldTypes: fieldTypes}
+	cond, err := c.compile(node)
+	if err != nil {
+		return "", nil, err
+	}
+	return cond, c.args, nil
+}
+
+// arg 添加一个参数，返回它的占位符
+func (c *queryCompiler) arg(value interface{}) string {
+	c.args = append(c.args, value)
+	placeholder := fmt.Sprintf("$%d", c.argIndex)
+	c.argIndex++
+	return placeholder
+}
+
+func (c *queryCompiler) compile(node queryNode) (string, error) {
+	switch n := node.(type) {
+	case *andNode:
+		return c.compileChildren(n.children, " AND ")
+	case *orNode:
+		return c.compileChildren(n.children, " OR ")
+	case *notNode:
+		child, err := c.compile(n.child)
+		if err != nil {
+			return "", err
+		}
+		// NULL 比较的结果按 false 处理，保证取反后的语义符合直觉
+		return "NOT COALESCE(" + child + ", FALSE)", nil
+	case *termNode:
+		return c.compileTerm(n)
+	}
+	return "", fmt.Errorf("unsupported query node %T", node)
+}
+
+func (c *queryCompiler) compileChildren(children []queryNode, sep string) (string, error) {
+	parts := make([]string, 0, len(children))
+	for _, child := range children {
+		part, err := c.compile(child)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, part)
+	}
+	return "(" + strings.Join(parts, sep) + ")", nil
+}
+
+// compileTerm 编译单个条件；多个值按 OR 组合
+func (c *queryCompiler) compileTerm(t *termNode) (string, error) {
+	if t.field == "" {
+		p := c.arg("%" + escapeLikePattern(t.values[0]) + "%")
+		return fmt.Sprintf("(task ILIKE %s OR COALESCE(description, '') ILIKE %s)", p, p), nil
+	}
+
+	fail := func(format string, args ...interface{}) (string, error) {
+		return "", &QueryError{Pos: t.pos, Message: fmt.Sprintf(format, args...)}
+	}
+
+	_, isDate := queryDateColumns[t.field]
+	isCustom := strings.HasPrefix(t.field, "cf.")
+	if t.op != "=" && !isDate && !isCustom && !(t.field == "title" && t.op == "~") {
+		return fail("%s does not support %q", t.field, t.op)
+	}
+
+	var conds []string
+	for _, value := range t.values {
+		var cond string
+		var err error
+
+		switch {
+		case isDate:
+			cond, err = c.dateCondition(t, queryDateColumns[t.field], value)
+		case isCustom:
+			cond, err = c.customFieldCondition(t, strings.TrimPrefix(t.field, "cf."), value)
+		default:
+			cond, err = c.fieldCondition(t, value)
+		}
+		if err != nil {
+			return "", err
+		}
+		conds = append(conds, cond)
+	}
+
+	if len(conds) == 1 {
+		return conds[0], nil
+	}
+	return "(" + strings.Join(conds, " OR ") + ")", nil
+}
+
+// fieldCondition 编译普通字段的单个值
+func (c *queryCompiler) fieldCondition(t *termNode, value string) (string, error) {
+	fail := func(format string, args ...interface{}) (string, error) {
+		return "", &QueryError{Pos: t.pos, Message: fmt.Sprintf(format, args...)}
+	}
+
+	switch t.field {
+	case "status":
+		switch value {
+		case "pending", "open":
+			return "done = false", nil
+		case "completed":
+			return "done = true", nil
+		}
+		if !models.KeyPattern.MatchString(value) {
+			return fail("invalid status %q", value)
+		}
+		return "status = " + c.arg(value), nil
+	case "priority":
+		if !models.IsValidPriority(value) {
+			return fail("invalid priority %q, expected low, medium or high", value)
+		}
+		return "priority = " + c.arg(value), nil
+	case "category":
+		return "category = " + c.arg(value), nil
+	case "tag":
+		return "tags ? " + c.arg(value) + "::text", nil
+	case "title":
+		return "task ILIKE " + c.arg("%"+escapeLikePattern(value)+"%"), nil
+	case "assignee":
+		// 待办事项只属于创建者本人，查询总是限定在当前用户范围内
+		if value != "me" {
+			return fail("assignee only supports \"me\"")
+		}
+		return "TRUE", nil
+	case "has":
+		switch value {
+		case "due":
+			return "due_date IS NOT NULL", nil
+		case "tags":
+			return "jsonb_array_length(COALESCE(tags, '[]'::jsonb)) > 0", nil
+		case "description":
+			return "COALESCE(description, '') <> ''", nil
+		case "steps":
+			return "EXISTS (SELECT 1 FROM steps WHERE steps.todo_id = todos.id)", nil
+		}
+		if key := strings.TrimPrefix(value, "cf."); key != value {
+			if _, ok := c.fieldTypes[key]; !ok {
+				return fail("unknown custom field %q", key)
+			}
+			return "custom_fields ? " + c.arg(key) + "::text", nil
+		}
+		return fail("has: expected due, tags, description, steps or cf.<key>")
+	}
+	return fail("unknown field %q", t.field)
+}
+
+// dateCondition 编译日期字段：today/tomorrow/yesterday、YYYY-MM-DD、
+// 相对时间（如 7d、-2w、3h、1m）、none/any，以及 due:overdue
+func (c *queryCompiler) dateCondition(t *termNode, column, value string) (string, error) {
+	fail := func(format string, args ...interface{}) (string, error) {
+		return "", &QueryError{Pos: t.pos, Message: fmt.Sprintf(format, args...)}
+	}
+	value = strings.ToLower(value)
+
+	switch value {
+	case "none", "any":
+		if t.op != "=" {
+			return fail("%s:%s does not support %q", t.field, value, t.op)
+		}
+		if value == "none" {
+			return column + " IS NULL", nil
+		}
+		return column + " IS NOT NULL", nil
+	case "overdue":
+		if t.field != "due" || t.op != "=" {
+			return fail("overdue is only valid as due:overdue")
+		}
+		return "(due_date < NOW() AND done = false)", nil
+	case "today":
+		return dayCondition(column, t.op, "CURRENT_DATE"), nil
+	case "tomorrow":
+		return dayCondition(column, t.op, "(CURRENT_DATE + 1)"), nil
+	case "yesterday":
+		return dayCondition(column, t.op, "(CURRENT_DATE - 1)"), nil
+	}
+
+	if m := relativeDatePattern.FindStringSubmatch(value); m != nil {
+		if t.op == "=" || t.op == "~" {
+			return fail("relative date %q needs <, <=, > or >=", value)
+		}
+		n, _ := strconv.Atoi(m[1])
+		interval := fmt.Sprintf("%d %s", n, relativeIntervalUnit[m[2]])
+		return fmt.Sprintf("%s %s NOW() + %s::interval", column, t.op, c.arg(interval)), nil
+	}
+
+	if _, err := time.Parse("2006-01-02", value); err == nil {
+		if t.op == "~" {
+			return fail("%s does not support %q", t.field, t.op)
+		}
+		return dayCondition(column, t.op, "("+c.arg(value)+"::date)"), nil
+	}
+
+	return fail("invalid date %q", value)
+}
+
+// dayCondition 按整天比较时间戳列
+func dayCondition(column, op, day string) string {
+	switch op {
+	case "<":
+		return fmt.Sprintf("%s < %s", column, day)
+	case "<=":
+		return fmt.Sprintf("%s < %s + 1", column, day)
+	case ">":
+		return fmt.Sprintf("%s >= %s + 1", column, day)
+	case ">=":
+		return fmt.Sprintf("%s >= %s", column, day)
+	}
+	return fmt.Sprintf("(%s >= %s AND %s < %s + 1)", column, day, column, day)
+}
+
+// customFieldCondition 编译 cf.<key> 条件，复用自定义字段过滤的校验和SQL
+func (c *queryCompiler) customFieldCondition(t *termNode, key, value string) (string, error) {
+	fieldType, ok := c.fieldTypes[key]
+	if !ok {
+		return "", &QueryError{Pos: t.pos, Message: fmt.Sprintf("unknown custom field %q", key)}
+	}
+
+	ops := map[string]string{"=": "eq", ">": "gt", ">=": "gte", "<": "lt", "<=": "lte", "~": "contains"}
+	f := CustomFieldFilter{Key: key, Op: ops[t.op], Value: value, fieldType: fieldType}
+	if err := parseCustomFieldFilter(&f); err != nil {
+		return "", &QueryError{Pos: t.pos, Message: err.Error()}
+	}
+
+	cond, args := customFieldCondition(f, c.argIndex)
+	c.args = append(c.args, args...)
+	c.argIndex += len(args)
+	return cond, nil
+}
+
+// escapeLikePattern 转义 LIKE 模式中的通配符
+func escapeLikePattern(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompileQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		cond  string
+		args  []interface{}
+	}{
+		{
+			query: "priority:high,medium tag:billing",
+			cond:  "((priority = $2 OR priority = $3) AND tags ? $4::text)",
+			args:  []interface{}{"high", "medium", "billing"},
+		},
+		{
+			query: `-status:done "exact phrase"`,
+			cond:  "(NOT COALESCE(status = $2, FALSE) AND (task ILIKE $3 OR COALESCE(description, '') ILIKE $3))",
+			args:  []interface{}{"done", "%exact phrase%"},
+		},
+		{
+			query: "due:<7d (category:work OR assignee:me)",
+			cond:  "(due_date < NOW() + $2::interval AND (category = $3 OR TRUE))",
+			args:  []interface{}{"7 days", "work"},
+		},
+		{
+			query: "status:pending OR due:overdue AND has:steps",
+			cond:  "(done = false OR ((due_date < NOW() AND done = false) AND EXISTS (SELECT 1 FROM steps WHERE steps.todo_id = todos.id)))",
+			args:  nil,
+		},
+		{
+			query: "created:>=2024-05-01 cf.points:>3",
+			cond:  "(created_at >= ($2::date) AND (custom_fields->>$3::text)::numeric > $4::numeric)",
+			args:  []interface{}{"2024-05-01", "points", float64(3)},
+		},
+		{
+			query: `category:"side project" 100%`,
+			cond:  "(category = $2 AND (task ILIKE $3 OR COALESCE(description, '') ILIKE $3))",
+			args:  []interface{}{"side project", `%100\%%`},
+		},
+	}
+
+	types := map[string]string{"points": "number"}
+	for _, tt := range tests {
+		node, err := parseQuery(tt.query)
+		if err != nil {
+			t.Fatalf("parseQuery(%q) error = %v", tt.query, err)
+		}
+		cond, args, err := compileQuery(node, 2, types)
+		if err != nil {
+			t.Fatalf("compileQuery(%q) error = %v", tt.query, err)
+		}
+		if cond != tt.cond {
+			t.Errorf("compileQuery(%q) cond =\n  %s\nwant\n  %s", tt.query, cond, tt.cond)
+		}
+		if !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("compileQuery(%q) args = %#v, want %#v", tt.query, args, tt.args)
+		}
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		pos   int
+	}{
+		{"(priority:high", 1},
+		{"priority:high)", 14},
+		{`tag:"billing`, 5},
+		{"owner:me", 1},
+		{"priority:urgent", 1},
+		{"due:soon", 1},
+		{"due:7d", 1},
+		{"priority:high OR", 17},
+		{"cf.missing:1", 1},
+		{"tag:a,", 1},
+		{"tag:a ()", 7},
+	}
+
+	for _, tt := range tests {
+		node, err := parseQuery(tt.query)
+		if err == nil {
+			_, _, err = compileQuery(node, 2, nil)
+		}
+		qerr, ok := err.(*QueryError)
+		if !ok {
+			t.Errorf("%q: error = %v, want *QueryError", tt.query, err)
+			continue
+		}
+		if qerr.Pos != tt.pos {
+			t.Errorf("%q: error position = %d, want %d (%v)", tt.query, qerr.Pos, tt.pos, qerr)
+		}
+	}
+
+	if node, err := parseQuery("   "); node != nil || err != nil {
+		t.Errorf("empty query = %v, %v, want nil, nil", node, err)
+	}
+}
@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/TodoList/models"
+)
+
+// SavedFilterHandler 处理保存的过滤器和智能列表相关的HTTP请求
+type SavedFilterHandler struct {
+	Model *models.SavedFilterModel
+	Todos *EnhancedTodoHandler
+}
+
+// NewSavedFilterHandler 创建一个新的SavedFilterHandler实例
+func NewSavedFilterHandler(model *models.SavedFilterModel, todos *EnhancedTodoHandler) *SavedFilterHandler {
+	return &SavedFilterHandler{Model: model, Todos: todos}
+}
+
+// SmartList 智能列表：内置的系统列表或置顶的保存过滤器
+type SmartList struct {
+	Key    string `json:"key"` // 系统列表的key，或保存过滤器的ID
+	ID     int    `json:"id,omitempty"`
+	Name   string `json:"name"`
+	Icon   string `json:"icon,omitempty"`
+	System bool   `json:"system"`
+	Count  int    `json:"count"`
+}
+
+// systemSmartList 内置的系统列表
+type systemSmartList struct {
+	Key  string
+	Name string
+	Icon string
+	Due  string
+}
+
+// systemSmartLists 内置的系统列表，只包含未完成的待办事项
+var systemSmartLists = []systemSmartList{
+	{Key: "today", Name: "Today", Icon: "📅", Due: "today"},
+	{Key: "next7days", Name: "Next 7 days", Icon: "🗓️", Due: "next7days"},
+	{Key: "overdue", Name: "Overdue", Icon: "⏰", Due: "overdue"},
+	{Key: "nodue", Name: "No due date", Icon: "📭", Due: "none"},
+}
+
+// systemListFilter 返回系统列表对应的过滤参数
+func systemListFilter(key string) (FilterParams, bool) {
+	for _, list := range systemSmartLists {
+		if list.Key == key {
+			params := defaultFilterParams()
+			params.Status = "pending"
+			params.Due = list.Due
+			if list.Due != "none" {
+				params.SortBy, params.SortOrder = "dueDate", "asc"
+			}
+			return params, true
+		}
+	}
+	return FilterParams{}, false
+}
+
+// resolveSavedFilter 根据 savedFilter 参数（保存过滤器的ID或系统列表的key）获取过滤参数
+func (h *EnhancedTodoHandler) resolveSavedFilter(userID int, ref string) (FilterParams, error) {
+	if params, ok := systemListFilter(ref); ok {
+		return params, nil
+	}
+
+	filterID, err := strconv.Atoi(ref)
+	if err != nil {
+		return FilterParams{}, models.ErrSavedFilterNotFound
+	}
+	saved, err := h.SavedFilters.GetFilter(userID, filterID)
+	if err != nil {
+		return FilterParams{}, err
+	}
+	return decodeFilterCriteria(saved.Criteria)
+}
+
+// countTodos 统计匹配过滤参数的待办事项数量
+func (h *EnhancedTodoHandler) countTodos(userID int, filters FilterParams) (int, error) {
+	if err := h.resolveFilters(userID, &filters); err != nil {
+		return 0, err
+	}
+	return h.countFilteredTodos(buildFilterQuery(userID, filters))
+}
+
+// validateCriteria 校验保存的过滤条件能否被解析和执行
+func (h *SavedFilterHandler) validateCriteria(userID int, criteria json.RawMessage) error {
+	params, err := decodeFilterCriteria(criteria)
+	if err != nil {
+		return err
+	}
+	// 使用时分页参数会被重置，但不保存超出上限的每页大小
+	var stored struct {
+		PageSize int `json:"pageSize"`
+	}
+	json.Unmarshal(criteria, &stored)
+	if stored.PageSize < 0 || stored.PageSize > models.MaxPageLimit {
+		return fmt.Errorf("pageSize must be between 1 and %d", models.MaxPageLimit)
+	}
+	if err := validateFilterParams(&params); err != nil {
+		return err
+	}
+	return h.Todos.resolveFilters(userID, &params)
+}
+
+// GetSavedFilters 获取当前用户保存的过滤器
+func (h *SavedFilterHandler) GetSavedFilters(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	filters, err := h.Model.GetFilters(userID)
+	if err != nil {
+		log.Printf("获取保存的过滤器失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(filters)
+}
+
+// CreateSavedFilter 保存过滤器
+func (h *SavedFilterHandler) CreateSavedFilter(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var filter models.SavedFilter
+	if err := json.NewDecoder(r.Body).Decode(&filter); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.validateCriteria(userID, filter.Criteria); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter.UserID = userID
+	if err := h.Model.CreateFilter(&filter); err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidSavedFilter):
+			http.Error(w, "Invalid saved filter", http.StatusBadRequest)
+		case errors.Is(err, models.ErrDuplicateSavedFilter):
+			http.Error(w, "Saved filter already exists", http.StatusConflict)
+		default:
+			log.Printf("保存过滤器失败: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(filter)
+}
+
+// UpdateSavedFilter 更新保存的过滤器
+func (h *SavedFilterHandler) UpdateSavedFilter(w http.ResponseWriter, r *http.Request, filterID int) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var filter models.SavedFilter
+	if err := json.NewDecoder(r.Body).Decode(&filter); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.validateCriteria(userID, filter.Criteria); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter.ID = filterID
+	filter.UserID = userID
+	if err := h.Model.UpdateFilter(&filter); err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidSavedFilter):
+			http.Error(w, "Invalid saved filter", http.StatusBadRequest)
+		case errors.Is(err, models.ErrSavedFilterNotFound):
+			http.Error(w, "Saved filter not found", http.StatusNotFound)
+		case errors.Is(err, models.ErrDuplicateSavedFilter):
+			http.Error(w, "Saved filter already exists", http.StatusConflict)
+		default:
+			log.Printf("更新保存的过滤器失败: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(filter)
+}
+
+// DeleteSavedFilter 删除保存的过滤器
+func (h *SavedFilterHandler) DeleteSavedFilter(w http.ResponseWriter, r *http.Request, filterID int) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.Model.DeleteFilter(userID, filterID); err != nil {
+		if errors.Is(err, models.ErrSavedFilterNotFound) {
+			http.Error(w, "Saved filter not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("删除保存的过滤器失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// GetSmartLists 获取系统列表和置顶的保存过滤器，以及各自的实时数量
+func (h *SavedFilterHandler) GetSmartLists(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	lists := []SmartList{}
+	for _, system := range systemSmartLists {
+		params, _ := systemListFilter(system.Key)
+		count, err := h.Todos.countTodos(userID, params)
+		if err != nil {
+			log.Printf("统计智能列表失败: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		lists = append(lists, SmartList{Key: system.Key, Name: system.Name, Icon: system.Icon, System: true, Count: count})
+	}
+
+	saved, err := h.Model.GetFilters(userID)
+	if err != nil {
+		log.Printf("获取保存的过滤器失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	for _, filter := range saved {
+		if !filter.Pinned {
+			continue
+		}
+		params, err := decodeFilterCriteria(filter.Criteria)
+		if err == nil {
+			err = validateFilterParams(&params)
+		}
+		var count int
+		if err == nil {
+			count, err = h.Todos.countTodos(userID, params)
+		}
+		if err != nil {
+			// 字段定义变化后旧的过滤条件可能失效，跳过计数而不是整体失败
+			log.Printf("统计保存的过滤器 %d 失败: %v", filter.ID, err)
+			count = -1
+		}
+		lists = append(lists, SmartList{
+			Key:   strconv.Itoa(filter.ID),
+			ID:    filter.ID,
+			Name:  filter.Name,
+			Icon:  filter.Icon,
+			Count: count,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lists)
+}
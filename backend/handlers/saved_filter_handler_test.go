@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/TodoList/models"
+)
+
+func TestDecodeFilterCriteria(t *testing.T) {
+	params, err := decodeFilterCriteria(json.RawMessage(`{"status":"pending","tags":["work"],"sortBy":"dueDate","page":5,"pageSize":500}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 保存的字段覆盖默认值，分页参数总是重置
+	if params.Status != "pending" || params.SortBy != "dueDate" || len(params.Tags) != 1 || params.Tags[0] != "work" {
+		t.Errorf("params = %+v", params)
+	}
+	if params.Priority != "all" || params.SortOrder != "desc" || params.Page != 1 || params.PageSize != 20 {
+		t.Errorf("defaults = %+v", params)
+	}
+
+	if params, err := decodeFilterCriteria(nil); err != nil || params.Status != "all" {
+		t.Errorf("empty criteria = %+v, %v", params, err)
+	}
+	for _, criteria := range []string{`[]`, `{"tags":"work"}`, `{"status":`} {
+		if _, err := decodeFilterCriteria(json.RawMessage(criteria)); err == nil {
+			t.Errorf("decodeFilterCriteria(%s) accepted", criteria)
+		}
+	}
+}
+
+func TestValidateFilterParams(t *testing.T) {
+	params := FilterParams{PageSize: 100000}
+	if err := validateFilterParams(&params); err != nil || params.Page != 1 || params.PageSize != models.MaxPageLimit {
+		t.Errorf("params = %+v, %v", params, err)
+	}
+	params = FilterParams{}
+	if err := validateFilterParams(&params); err != nil || params.PageSize != 20 {
+		t.Errorf("params = %+v, %v", params, err)
+	}
+	if err := validateFilterParams(&FilterParams{Due: "someday"}); err == nil {
+		t.Error("invalid due filter accepted")
+	}
+}
+
+func TestCreateSavedFilterInvalid(t *testing.T) {
+	// 这些请求在访问数据库之前就被拒绝
+	h := NewSavedFilterHandler(models.NewSavedFilterModel(nil), &EnhancedTodoHandler{})
+
+	for _, body := range []string{
+		`{"name":"Broken","criteria":[]}`,
+		`{"name":"Due","criteria":{"due":"someday"}}`,
+		`{"name":"Big","criteria":{"pageSize":100000}}`,
+		`{"name":"Query","criteria":{"q":"priority:"}}`,
+		`{"name":" ","criteria":{}}`,
+		`{"name":"` + strings.Repeat("x", 51) + `"}`,
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/api/filters", strings.NewReader(body))
+		r = r.WithContext(context.WithValue(r.Context(), "userID", 1))
+		w := httptest.NewRecorder()
+		h.CreateSavedFilter(w, r)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", body, w.Code)
+		}
+	}
+}
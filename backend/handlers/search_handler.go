@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/TodoList/models"
+)
+
+// SearchHandler 处理全文搜索相关的HTTP请求
+type SearchHandler struct {
+	Model *models.SearchModel
+}
+
+// NewSearchHandler 创建一个新的SearchHandler实例
+func NewSearchHandler(model *models.SearchModel) *SearchHandler {
+	return &SearchHandler{Model: model}
+}
+
+// Search 同时搜索待办事项和步骤：GET /api/v2/search?q=...&limit=20
+func (h *SearchHandler) Search(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		http.Error(w, "Missing search query", http.StatusBadRequest)
+		return
+	}
+
+	limit := getQueryParamInt(r, "limit", 20)
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	results, err := h.Model.Search(userID, query, limit)
+	if err != nil {
+		log.Printf("搜索失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"query":   query,
+		"results": results,
+	})
+}
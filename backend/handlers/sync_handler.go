@@ -0,0 +1,567 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/TodoList/models"
+)
+
+// 离线同步的限制
+const (
+	defaultSyncLimit = 500  // 增量同步默认每次返回的最大实体数
+	maxSyncLimit     = 1000 // 增量同步每次返回的实体数上限
+	maxSyncMutations = 500  // 一次推送的最大修改数
+	maxSyncBodySize  = 5 << 20
+)
+
+// 同步修改的处理结果
+const (
+	syncStatusApplied  = "applied"  // 修改已全部生效（或已经生效过）
+	syncStatusMerged   = "merged"   // 部分字段生效，其余字段以服务端为准
+	syncStatusConflict = "conflict" // 修改没有生效，以服务端为准
+	syncStatusRejected = "rejected" // 修改无效（校验失败），客户端应丢弃
+	syncStatusFailed   = "failed"   // 服务端错误，客户端可以稍后重试
+)
+
+// 冲突解决方式
+const (
+	syncResolutionDuplicate       = "duplicate"         // 相同 clientId 的实体已经存在，创建视为已生效
+	syncResolutionServerWins      = "server_wins"       // 字段在服务端也被修改过，保留服务端的值
+	syncResolutionDeletedOnServer = "deleted_on_server" // 实体已在服务端删除，删除优先于修改
+	syncResolutionAlreadyDeleted  = "already_deleted"   // 要删除的实体已经不存在
+	syncResolutionRetry           = "retry"             // 处理期间实体又被修改，客户端应拉取后重试
+)
+
+// stepSyncFields 步骤中可以通过同步修改的字段
+var stepSyncFields = map[string]bool{"content": true, "completed": true}
+
+// SyncHandler 处理离线客户端的增量同步
+type SyncHandler struct {
+	Model *models.SyncModel
+	Todos *models.TodoModel
+}
+
+// NewSyncHandler 创建一个新的SyncHandler实例
+func NewSyncHandler(model *models.SyncModel, todos *models.TodoModel) *SyncHandler {
+	return &SyncHandler{Model: model, Todos: todos}
+}
+
+// syncMutation 客户端离线期间的一次修改。
+// 待办事项通过 id 或 clientId 定位；步骤通过 id，或者所属待办事项（todoId/todoClientId）加 clientId 定位。
+// create 时 changes 是新实体的完整内容，clientId 必填；update 时 changes 只包含修改的字段，
+// base 是客户端修改前看到的这些字段的值，baseVersion 是客户端最后看到的待办事项版本号。
+type syncMutation struct {
+	Entity       string                 `json:"entity"` // todo 或 step
+	Op           string                 `json:"op"`     // create、update 或 delete
+	ID           int                    `json:"id"`
+	ClientID     string                 `json:"clientId"`
+	TodoID       int                    `json:"todoId"`
+	TodoClientID string                 `json:"todoClientId"`
+	BaseVersion  int                    `json:"baseVersion"`
+	Base         map[string]interface{} `json:"base"`
+	Changes      map[string]interface{} `json:"changes"`
+}
+
+// syncResult 一次修改的处理结果，按请求中的顺序返回。Todo/Step 是处理后服务端的当前状态。
+type syncResult struct {
+	Index          int          `json:"index"`
+	Entity         string       `json:"entity"`
+	Op             string       `json:"op"`
+	ClientID       string       `json:"clientId,omitempty"`
+	ID             int          `json:"id,omitempty"`
+	Status         string       `json:"status"`
+	Resolution     string       `json:"resolution,omitempty"`
+	RejectedFields []string     `json:"rejectedFields,omitempty"`
+	Error          string       `json:"error,omitempty"`
+	Field          string       `json:"field,omitempty"`
+	Todo           *models.Todo `json:"todo,omitempty"`
+	Step           *models.Step `json:"step,omitempty"`
+}
+
+// Changes 返回 since 令牌之后的变更和新的令牌。没有 since 时返回完整快照；
+// 响应中 hasMore 为 true 时客户端应立即用新令牌继续拉取。令牌无效时返回 410，客户端应重新完整同步。
+func (h *SyncHandler) Changes(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	since, err := models.DecodeSyncToken(r.URL.Query().Get("since"))
+	if err != nil {
+		writeJSONError(w, http.StatusGone, "Invalid sync token, full sync required", "since")
+		return
+	}
+	limit := getQueryParamInt(r, "limit", defaultSyncLimit)
+	if limit < 1 || limit > maxSyncLimit {
+		limit = defaultSyncLimit
+	}
+
+	changes, err := h.Model.Changes(userID, since, limit)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidSyncToken) {
+			writeJSONError(w, http.StatusGone, "Invalid sync token, full sync required", "since")
+			return
+		}
+		log.Printf("获取同步变更失败: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Internal server error", "")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(changes)
+}
+
+// Push 按顺序应用客户端离线期间的修改，每个修改单独生效并单独报告结果。冲突按以下规则确定地解决：
+//   - 创建以 clientId 去重，重复推送返回已存在的实体（duplicate）；
+//   - 删除总是生效，删除不存在的实体也视为成功（already_deleted）；
+//   - 修改已删除的实体不生效（deleted_on_server），删除优先；
+//   - 待办事项的 baseVersion 与当前版本一致时修改全部生效；否则逐字段三方合并：
+//     服务端的值仍等于 base 的字段采用客户端的值，服务端也修改过的字段保留服务端的值（server_wins）；
+//   - 步骤没有版本号，提供 base 时按同样的规则逐字段合并，否则客户端的值生效。
+func (h *SyncHandler) Push(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Mutations []syncMutation `json:"mutations"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSyncBodySize)).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body", "")
+		return
+	}
+	if len(req.Mutations) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "mutations is required", "mutations")
+		return
+	}
+	if len(req.Mutations) > maxSyncMutations {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "Too many mutations", "mutations")
+		return
+	}
+
+	results := make([]syncResult, len(req.Mutations))
+	for i, mutation := range req.Mutations {
+		result := &results[i]
+		result.Index = i
+		result.Entity = mutation.Entity
+		result.Op = mutation.Op
+		result.ClientID = mutation.ClientID
+
+		if mutation.Op != "create" && !mutation.hasTarget() {
+			result.reject("id or clientId is required", "id")
+			continue
+		}
+
+		switch mutation.Entity + "." + mutation.Op {
+		case "todo.create":
+			h.createTodo(userID, mutation, result)
+		case "todo.update":
+			h.updateTodo(userID, mutation, result)
+		case "todo.delete":
+			h.deleteTodo(userID, mutation, result)
+		case "step.create":
+			h.createStep(userID, mutation, result)
+		case "step.update":
+			h.updateStep(userID, mutation, result)
+		case "step.delete":
+			h.deleteStep(userID, mutation, result)
+		default:
+			result.reject("entity must be todo or step and op must be create, update or delete", "op")
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+}
+
+// reject 把修改标记为无效
+func (r *syncResult) reject(message, field string) {
+	r.Status = syncStatusRejected
+	r.Error = message
+	r.Field = field
+}
+
+// fail 把模型返回的错误转换为结果：校验错误标记为无效，其余错误标记为失败
+func (r *syncResult) fail(err error) {
+	var fieldErr *models.TodoFieldError
+	var patchErr *PatchError
+	switch {
+	case errors.As(err, &fieldErr):
+		r.reject(fieldErr.Message, fieldErr.Field)
+	case errors.As(err, &patchErr):
+		r.reject(patchErr.Error(), "changes")
+	case errors.Is(err, models.ErrUnknownStatus):
+		r.reject("Unknown status", "status")
+	case errors.Is(err, models.ErrUnknownCategory):
+		r.reject("Unknown category", "category")
+	case errors.Is(err, models.ErrInvalidTag):
+		r.reject("Invalid tag name", "tags")
+	case models.IsCustomFieldError(err):
+		r.reject(err.Error(), "customFields")
+	case errors.Is(err, models.ErrInvalidUUID):
+		r.reject("Invalid UUID", "uuid")
+	case errors.Is(err, models.ErrDuplicateUUID):
+		r.reject("UUID already in use", "uuid")
+	default:
+		log.Printf("应用同步修改失败: %v", err)
+		r.Status = syncStatusFailed
+		r.Error = "Internal server error"
+	}
+}
+
+// syncNotFound 判断错误是否表示实体不存在
+func syncNotFound(err error) bool {
+	return errors.Is(err, models.ErrTodoNotFound) || errors.Is(err, models.ErrStepNotFound)
+}
+
+// hasTarget 判断修改是否指定了要修改或删除的实体
+func (m syncMutation) hasTarget() bool {
+	if m.ID != 0 {
+		return true
+	}
+	if m.Entity == "step" && m.TodoID == 0 && m.TodoClientID == "" {
+		return false
+	}
+	return m.ClientID != ""
+}
+
+// findTodo 按 id 或 clientId 查找属于用户的待办事项（包含步骤）
+func (h *SyncHandler) findTodo(userID, id int, clientID string) (*models.Todo, error) {
+	if id == 0 {
+		return h.Model.TodoByClientID(userID, clientID)
+	}
+	todo, err := h.Todos.GetTodoByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if todo.UserID != userID {
+		return nil, models.ErrTodoNotFound
+	}
+	return todo, nil
+}
+
+// findStep 按 id，或者所属待办事项加 clientId 查找属于用户的步骤
+func (h *SyncHandler) findStep(userID int, m syncMutation) (*models.Step, error) {
+	if m.ID != 0 {
+		return h.Model.GetStep(userID, m.ID)
+	}
+	todo, err := h.findTodo(userID, m.TodoID, m.TodoClientID)
+	if err != nil {
+		if errors.Is(err, models.ErrTodoNotFound) {
+			return nil, models.ErrStepNotFound
+		}
+		return nil, err
+	}
+	return h.Model.StepByClientID(todo.ID, m.ClientID)
+}
+
+// createTodo 创建待办事项，相同 clientId 的待办事项已存在时返回它
+func (h *SyncHandler) createTodo(userID int, m syncMutation, result *syncResult) {
+	if m.ClientID == "" || len(m.ClientID) > 64 {
+		result.reject("clientId is required and must be at most 64 characters", "clientId")
+		return
+	}
+	if existing, err := h.Model.TodoByClientID(userID, m.ClientID); err == nil {
+		result.Status, result.Resolution = syncStatusApplied, syncResolutionDuplicate
+		result.ID, result.Todo = existing.ID, existing
+		return
+	} else if !errors.Is(err, models.ErrTodoNotFound) {
+		result.fail(err)
+		return
+	}
+
+	var todo models.Todo
+	data, _ := json.Marshal(m.Changes)
+	if err := json.Unmarshal(data, &todo); err != nil {
+		result.reject("Invalid todo", "changes")
+		return
+	}
+	todo.Task = strings.TrimSpace(todo.Task)
+	if todo.Task == "" {
+		result.reject("task is required", "task")
+		return
+	}
+	todo.UserID = userID
+	todo.ClientID = m.ClientID
+	for i := range todo.Steps {
+		todo.Steps[i].ID = 0
+	}
+
+	if err := h.Todos.AddTodo(&todo); err != nil {
+		// 并发推送同一个 clientId 时唯一索引会拒绝第二次插入
+		if existing, lookupErr := h.Model.TodoByClientID(userID, m.ClientID); lookupErr == nil {
+			result.Status, result.Resolution = syncStatusApplied, syncResolutionDuplicate
+			result.ID, result.Todo = existing.ID, existing
+			return
+		}
+		result.fail(err)
+		return
+	}
+
+	created, err := h.findTodo(userID, todo.ID, "")
+	if err != nil {
+		result.fail(err)
+		return
+	}
+	result.Status = syncStatusApplied
+	result.ID, result.Todo = created.ID, created
+}
+
+// updateTodo 修改待办事项，客户端看到的版本已过期时逐字段合并
+func (h *SyncHandler) updateTodo(userID int, m syncMutation, result *syncResult) {
+	current, err := h.findTodo(userID, m.ID, m.ClientID)
+	if err != nil {
+		if syncNotFound(err) {
+			result.Status, result.Resolution = syncStatusConflict, syncResolutionDeletedOnServer
+			result.ID = m.ID
+			return
+		}
+		result.fail(err)
+		return
+	}
+	result.ID = current.ID
+
+	server, err := todoDocument(*current)
+	if err != nil {
+		result.fail(err)
+		return
+	}
+	apply, rejected := mergeSyncFields(server, m.Base, m.Changes, m.BaseVersion != current.Version)
+	result.RejectedFields = rejected
+	result.Todo = current
+
+	if len(apply) == 0 {
+		if len(rejected) > 0 {
+			result.Status, result.Resolution = syncStatusConflict, syncResolutionServerWins
+		} else {
+			result.Status = syncStatusApplied
+		}
+		return
+	}
+
+	// 合并后的字段作为 JSON Merge Patch 应用，复用 PATCH 的字段校验
+	body, err := json.Marshal(apply)
+	if err != nil {
+		result.fail(err)
+		return
+	}
+	doc, fields, err := patchTodoDocument(*current, mergePatchType, body)
+	var todo models.Todo
+	if err == nil {
+		todo, err = decodeTodoDocument(doc)
+	}
+	if err == nil && len(fields) > 0 {
+		todo.ID = current.ID
+		err = h.Todos.PatchTodo(&todo, userID, fields, []int{current.Version})
+		result.Todo = &todo
+	}
+	if err != nil {
+		result.Todo = current
+		switch {
+		case errors.Is(err, models.ErrVersionConflict):
+			result.Status, result.Resolution = syncStatusConflict, syncResolutionRetry
+		case errors.Is(err, models.ErrTodoNotFound):
+			result.Status, result.Resolution = syncStatusConflict, syncResolutionDeletedOnServer
+			result.Todo = nil
+		default:
+			result.fail(err)
+		}
+		return
+	}
+
+	if len(rejected) > 0 {
+		result.Status, result.Resolution = syncStatusMerged, syncResolutionServerWins
+	} else {
+		result.Status = syncStatusApplied
+	}
+}
+
+// deleteTodo 删除待办事项，删除总是生效
+func (h *SyncHandler) deleteTodo(userID int, m syncMutation, result *syncResult) {
+	current, err := h.findTodo(userID, m.ID, m.ClientID)
+	if err != nil {
+		if syncNotFound(err) {
+			result.Status, result.Resolution = syncStatusApplied, syncResolutionAlreadyDeleted
+			result.ID = m.ID
+			return
+		}
+		result.fail(err)
+		return
+	}
+	result.ID = current.ID
+
+	if err := h.Todos.DeleteTodo(current.ID, userID); err != nil {
+		result.fail(err)
+		return
+	}
+	result.Status = syncStatusApplied
+}
+
+// createStep 在 todoId 或 todoClientId（可以是同一批次中先创建的待办事项）指定的待办事项下创建步骤
+func (h *SyncHandler) createStep(userID int, m syncMutation, result *syncResult) {
+	if m.ClientID == "" || len(m.ClientID) > 64 {
+		result.reject("clientId is required and must be at most 64 characters", "clientId")
+		return
+	}
+	todo, err := h.findTodo(userID, m.TodoID, m.TodoClientID)
+	if err != nil {
+		if syncNotFound(err) {
+			result.Status, result.Resolution = syncStatusConflict, syncResolutionDeletedOnServer
+			return
+		}
+		result.fail(err)
+		return
+	}
+
+	if existing, err := h.Model.StepByClientID(todo.ID, m.ClientID); err == nil {
+		result.Status, result.Resolution = syncStatusApplied, syncResolutionDuplicate
+		result.ID, result.Step = existing.ID, existing
+		return
+	} else if !errors.Is(err, models.ErrStepNotFound) {
+		result.fail(err)
+		return
+	}
+
+	content, _ := m.Changes["content"].(string)
+	completed, _ := m.Changes["completed"].(bool)
+	uuid, _ := m.Changes["uuid"].(string)
+	step := models.Step{TodoID: todo.ID, Content: strings.TrimSpace(content), Completed: completed, ClientID: m.ClientID, UUID: uuid}
+	if step.Content == "" {
+		result.reject("step content is required", "content")
+		return
+	}
+
+	if err := h.Todos.AddStep(&step); err != nil {
+		if existing, lookupErr := h.Model.StepByClientID(todo.ID, m.ClientID); lookupErr == nil {
+			result.Status, result.Resolution = syncStatusApplied, syncResolutionDuplicate
+			result.ID, result.Step = existing.ID, existing
+			return
+		}
+		result.fail(err)
+		return
+	}
+	result.Status = syncStatusApplied
+	result.ID, result.Step = step.ID, &step
+}
+
+// updateStep 修改步骤的内容或完成状态
+func (h *SyncHandler) updateStep(userID int, m syncMutation, result *syncResult) {
+	current, err := h.findStep(userID, m)
+	if err != nil {
+		if syncNotFound(err) {
+			result.Status, result.Resolution = syncStatusConflict, syncResolutionDeletedOnServer
+			result.ID = m.ID
+			return
+		}
+		result.fail(err)
+		return
+	}
+	result.ID = current.ID
+	result.Step = current
+
+	for field := range m.Changes {
+		if !stepSyncFields[field] {
+			result.reject("unknown field", field)
+			return
+		}
+	}
+	server := map[string]interface{}{"content": current.Content, "completed": current.Completed}
+	apply, rejected := mergeSyncFields(server, m.Base, m.Changes, m.Base != nil)
+	result.RejectedFields = rejected
+
+	if len(apply) == 0 {
+		if len(rejected) > 0 {
+			result.Status, result.Resolution = syncStatusConflict, syncResolutionServerWins
+		} else {
+			result.Status = syncStatusApplied
+		}
+		return
+	}
+
+	step := *current
+	if value, ok := apply["content"]; ok {
+		content, _ := value.(string)
+		if step.Content = strings.TrimSpace(content); step.Content == "" {
+			result.reject("step content is required", "content")
+			return
+		}
+	}
+	if value, ok := apply["completed"]; ok {
+		completed, isBool := value.(bool)
+		if !isBool {
+			result.reject("expected bool", "completed")
+			return
+		}
+		step.Completed = completed
+	}
+
+	if err := h.Model.UpdateStep(&step); err != nil {
+		if syncNotFound(err) {
+			result.Status, result.Resolution = syncStatusConflict, syncResolutionDeletedOnServer
+			result.Step = nil
+			return
+		}
+		result.fail(err)
+		return
+	}
+	result.Step = &step
+	if len(rejected) > 0 {
+		result.Status, result.Resolution = syncStatusMerged, syncResolutionServerWins
+	} else {
+		result.Status = syncStatusApplied
+	}
+}
+
+// deleteStep 删除步骤，删除总是生效
+func (h *SyncHandler) deleteStep(userID int, m syncMutation, result *syncResult) {
+	current, err := h.findStep(userID, m)
+	if err != nil {
+		if syncNotFound(err) {
+			result.Status, result.Resolution = syncStatusApplied, syncResolutionAlreadyDeleted
+			result.ID = m.ID
+			return
+		}
+		result.fail(err)
+		return
+	}
+	result.ID = current.ID
+
+	if err := h.Todos.DeleteStep(current.ID, current.TodoID); err != nil {
+		result.fail(err)
+		return
+	}
+	result.Status = syncStatusApplied
+}
+
+// mergeSyncFields 三方合并客户端的修改。serverChanged 为 false 表示客户端修改时看到的就是服务端的当前状态，
+// 所有修改都生效；否则只有服务端的值仍等于 base 的字段采用客户端的值，其余字段保留服务端的值并作为
+// 被拒绝的字段返回（排序后）。服务端的值已经等于客户端的值的字段既不生效也不算被拒绝。
+func mergeSyncFields(server, base, changes map[string]interface{}, serverChanged bool) (map[string]interface{}, []string) {
+	apply := make(map[string]interface{}, len(changes))
+	var rejected []string
+	for field, value := range changes {
+		current := server[field]
+		if reflect.DeepEqual(current, value) {
+			continue
+		}
+		if serverChanged {
+			baseValue, ok := base[field]
+			if !ok || !reflect.DeepEqual(current, baseValue) {
+				rejected = append(rejected, field)
+				continue
+			}
+		}
+		apply[field] = value
+	}
+	sort.Strings(rejected)
+	return apply, rejected
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeSyncFields(t *testing.T) {
+	server := map[string]interface{}{"task": "server", "priority": "high", "done": false, "tags": []interface{}{"a"}}
+	base := map[string]interface{}{"task": "old", "priority": "high", "done": false}
+	changes := map[string]interface{}{"task": "client", "priority": "low", "done": false, "tags": []interface{}{"b"}}
+
+	// 客户端看到的就是当前版本：全部生效，与服务端相同的值跳过
+	apply, rejected := mergeSyncFields(server, base, changes, false)
+	want := map[string]interface{}{"task": "client", "priority": "low", "tags": []interface{}{"b"}}
+	if !reflect.DeepEqual(apply, want) || len(rejected) != 0 {
+		t.Errorf("current version: apply = %v, rejected = %v", apply, rejected)
+	}
+
+	// 版本过期：服务端改过的 task 和没有 base 的 tags 保留服务端的值
+	apply, rejected = mergeSyncFields(server, base, changes, true)
+	if !reflect.DeepEqual(apply, map[string]interface{}{"priority": "low"}) {
+		t.Errorf("stale version: apply = %v", apply)
+	}
+	if !reflect.DeepEqual(rejected, []string{"tags", "task"}) {
+		t.Errorf("stale version: rejected = %v", rejected)
+	}
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/TodoList/models"
+)
+
+// TagHandler 处理标签目录相关的HTTP请求
+type TagHandler struct {
+	Model *models.TagModel
+}
+
+// NewTagHandler 创建一个新的TagHandler实例
+func NewTagHandler(model *models.TagModel) *TagHandler {
+	return &TagHandler{Model: model}
+}
+
+// RenameTagRequest 重命名标签请求
+type RenameTagRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// MergeTagsRequest 合并标签请求
+type MergeTagsRequest struct {
+	Sources []string `json:"sources"`
+	Target  string   `json:"target"`
+}
+
+// GetTags 获取当前用户的标签目录（包含使用次数）
+func (h *TagHandler) GetTags(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tags, err := h.Model.GetTags(userID)
+	if err != nil {
+		log.Printf("获取标签失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
+
+// CreateTag 在标签目录中创建标签
+func (h *TagHandler) CreateTag(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var tag models.Tag
+	if err := json.NewDecoder(r.Body).Decode(&tag); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tag.UserID = userID
+	if err := h.Model.CreateTag(&tag); err != nil {
+		if errors.Is(err, models.ErrInvalidTag) {
+			http.Error(w, "Invalid tag name", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, models.ErrDuplicateTag) {
+			http.Error(w, "Tag already exists", http.StatusConflict)
+			return
+		}
+		log.Printf("创建标签失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(tag)
+}
+
+// UpdateTag 更新标签的颜色和描述
+func (h *TagHandler) UpdateTag(w http.ResponseWriter, r *http.Request, tagID int) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var tag models.Tag
+	if err := json.NewDecoder(r.Body).Decode(&tag); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tag.ID = tagID
+	tag.UserID = userID
+	if err := h.Model.UpdateTag(&tag); err != nil {
+		if errors.Is(err, models.ErrTagNotFound) {
+			http.Error(w, "Tag not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("更新标签失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tag)
+}
+
+// DeleteTag 删除标签并从所有待办事项中移除
+func (h *TagHandler) DeleteTag(w http.ResponseWriter, r *http.Request, tagID int) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.Model.DeleteTag(userID, tagID); err != nil {
+		if errors.Is(err, models.ErrTagNotFound) {
+			http.Error(w, "Tag not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("删除标签失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// RenameTag 重命名标签，并改写所有使用该标签的待办事项
+func (h *TagHandler) RenameTag(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req RenameTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.From == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	affected, err := h.Model.RenameTag(userID, req.From, req.To)
+	h.writeMergeResult(w, affected, err)
+}
+
+// MergeTags 把多个标签合并为一个，并改写所有相关待办事项
+func (h *TagHandler) MergeTags(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req MergeTagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Sources) == 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	affected, err := h.Model.MergeTags(userID, req.Sources, req.Target)
+	h.writeMergeResult(w, affected, err)
+}
+
+// writeMergeResult 输出重命名/合并操作的结果
+func (h *TagHandler) writeMergeResult(w http.ResponseWriter, affected int, err error) {
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidTag):
+			http.Error(w, "Invalid tag name", http.StatusBadRequest)
+		case errors.Is(err, models.ErrTagNotFound):
+			http.Error(w, "Tag not found", http.StatusNotFound)
+		default:
+			log.Printf("合并标签失败: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":       true,
+		"affectedTodos": affected,
+	})
+}
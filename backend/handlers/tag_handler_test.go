@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/TodoList/models"
+)
+
+func TestTagHandlerInvalidNames(t *testing.T) {
+	// 这些请求在访问数据库之前就被拒绝
+	h := NewTagHandler(models.NewTagModel(nil))
+	long := strings.Repeat("x", 31)
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		body    string
+	}{
+		{"create empty", h.CreateTag, `{"name":"  "}`},
+		{"create too long", h.CreateTag, `{"name":"` + long + `"}`},
+		{"create invalid json", h.CreateTag, `{"name":`},
+		{"rename without from", h.RenameTag, `{"to":"b"}`},
+		{"rename to empty", h.RenameTag, `{"from":"a","to":" "}`},
+		{"rename too long", h.RenameTag, `{"from":"a","to":"` + long + `"}`},
+		{"merge without sources", h.MergeTags, `{"sources":[],"target":"b"}`},
+		{"merge to empty", h.MergeTags, `{"sources":["a"],"target":""}`},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/api/tags", strings.NewReader(tt.body))
+		r = r.WithContext(context.WithValue(r.Context(), "userID", 1))
+		w := httptest.NewRecorder()
+		tt.handler(w, r)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", tt.name, w.Code)
+		}
+	}
+}
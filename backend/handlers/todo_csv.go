@@ -0,0 +1,662 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TodoList/models"
+)
+
+// CSV 导入的限制
+const (
+	maxImportBodySize = 10 << 20
+	maxImportRows     = 5000
+	csvFlushInterval  = 100 // 导出时每写入多少行刷新一次
+)
+
+// utf8BOM 部分电子表格软件需要它来识别 UTF-8 编码的 CSV
+const utf8BOM = "\uFEFF"
+
+// csvColumns 导出的列，也是导入时默认识别的列名
+var csvColumns = []string{
+	"id", "uuid", "task", "description", "done", "priority", "category", "status", "dueDate",
+	"reminder", "estimatedTime", "tags", "steps", "customFields", "createdAt", "completedAt",
+}
+
+// csvImportFields 导入时可以映射的字段；id、createdAt、completedAt 由服务端生成
+var csvImportFields = []string{
+	"uuid", "task", "description", "done", "priority", "category", "status", "dueDate",
+	"reminder", "estimatedTime", "tags", "steps", "customFields",
+}
+
+// csvStepsQuery 导出时与待办事项一起查询步骤，避免逐行查询
+const csvStepsQuery = `COALESCE((
+	SELECT json_agg(json_build_object('id', s.id, 'content', s.content, 'completed', s.completed) ORDER BY s.id)
+	FROM steps s WHERE s.todo_id = todos.id
+), '[]')`
+
+// extraColumnScanner 在 TodoColumns 之后多扫描几列
+type extraColumnScanner struct {
+	rows  interface{ Scan(...interface{}) error }
+	extra []interface{}
+}
+
+func (s extraColumnScanner) Scan(dest ...interface{}) error {
+	return s.rows.Scan(append(dest, s.extra...)...)
+}
+
+// encodeList 用 sep 连接列表，元素中的 sep、反斜杠和换行用反斜杠转义，保证可以原样拆分
+func encodeList(items []string, sep rune) string {
+	escaped := make([]string, len(items))
+	for i, item := range items {
+		var b strings.Builder
+		for _, c := range item {
+			switch c {
+			case '\\', sep:
+				b.WriteRune('\\')
+				b.WriteRune(c)
+			case '\n':
+				b.WriteString(`\n`)
+			default:
+				b.WriteRune(c)
+			}
+		}
+		escaped[i] = b.String()
+	}
+	return strings.Join(escaped, string(sep))
+}
+
+// decodeList 拆分 encodeList 生成的字符串，空字符串表示空列表
+func decodeList(s string, sep rune) []string {
+	if s == "" {
+		return nil
+	}
+	var items []string
+	var b strings.Builder
+	escaped := false
+	for _, c := range s {
+		switch {
+		case escaped:
+			if c == 'n' {
+				b.WriteRune('\n')
+			} else {
+				b.WriteRune(c)
+			}
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == sep:
+			items = append(items, b.String())
+			b.Reset()
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return append(items, b.String())
+}
+
+// encodeCSVSteps 每行一个步骤，已完成的步骤以 "[x] " 开头，未完成的以 "[ ] " 开头
+func encodeCSVSteps(steps []models.Step) string {
+	items := make([]string, len(steps))
+	for i, step := range steps {
+		mark := "[ ] "
+		if step.Completed {
+			mark = "[x] "
+		}
+		items[i] = mark + step.Content
+	}
+	return encodeList(items, '\n')
+}
+
+// decodeCSVSteps 解析 encodeCSVSteps 的格式，没有复选框前缀的行视为未完成的步骤
+func decodeCSVSteps(s string) []models.Step {
+	var steps []models.Step
+	for _, item := range decodeList(strings.ReplaceAll(s, "\r\n", "\n"), '\n') {
+		var step models.Step
+		switch {
+		case strings.HasPrefix(item, "[x] "), strings.HasPrefix(item, "[X] "):
+			step.Completed = true
+			item = item[4:]
+		case strings.HasPrefix(item, "[ ] "):
+			item = item[4:]
+		}
+		if step.Content = strings.TrimSpace(item); step.Content != "" {
+			steps = append(steps, step)
+		}
+	}
+	return steps
+}
+
+// formatCSVTime 时间按 RFC 3339 输出，nil 输出为空
+func formatCSVTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// encodeTodoCSV 按 csvColumns 的顺序输出一行
+func encodeTodoCSV(todo models.Todo) []string {
+	estimated := ""
+	if todo.EstimatedTime != nil {
+		estimated = strconv.Itoa(*todo.EstimatedTime)
+	}
+	customFields := ""
+	if len(todo.CustomFields) > 0 {
+		data, _ := json.Marshal(todo.CustomFields)
+		customFields = string(data)
+	}
+	createdAt := todo.CreatedAt
+	return []string{
+		strconv.Itoa(todo.ID),
+		todo.UUID,
+		todo.Task,
+		todo.Description,
+		strconv.FormatBool(todo.Done),
+		todo.Priority,
+		todo.Category,
+		todo.Status,
+		formatCSVTime(todo.DueDate),
+		strconv.FormatBool(todo.Reminder),
+		estimated,
+		encodeList(todo.Tags, ';'),
+		encodeCSVSteps(todo.Steps),
+		customFields,
+		formatCSVTime(&createdAt),
+		formatCSVTime(todo.CompletedAt),
+	}
+}
+
+// csvFieldError 导入时某一列的值无效
+type csvFieldError struct {
+	Field   string `json:"field"`
+	Column  string `json:"column"`
+	Message string `json:"message"`
+}
+
+// csvImportContext 校验导入行需要的用户数据和列映射
+type csvImportContext struct {
+	columns    map[string]int    // 字段 -> 列下标
+	headers    map[string]string // 字段 -> 列名，用于错误信息
+	categories map[string]bool
+	states     map[string]bool
+}
+
+// parseCSVBool 解析布尔值，接受 true/false、yes/no、1/0、x 和空值
+func parseCSVBool(s string) (bool, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "true", "yes", "y", "1", "x", "✓":
+		return true, true
+	case "false", "no", "n", "0", "":
+		return false, true
+	}
+	return false, false
+}
+
+// csvDateLayouts 导入时接受的日期格式，没有时区的按 UTC 处理
+var csvDateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02", "2006/01/02"}
+
+// parseCSVDate 解析日期
+func parseCSVDate(s string) (time.Time, bool) {
+	for _, layout := range csvDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseCSVTodo 按列映射把一行解析为待办事项，返回所有无效的列
+func parseCSVTodo(record []string, ctx csvImportContext) (models.Todo, []csvFieldError) {
+	var todo models.Todo
+	var errs []csvFieldError
+	fail := func(field, message string) {
+		errs = append(errs, csvFieldError{Field: field, Column: ctx.headers[field], Message: message})
+	}
+	value := func(field string) string {
+		i, ok := ctx.columns[field]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	if todo.Task = value("task"); todo.Task == "" {
+		fail("task", "task is required")
+	}
+	todo.Description = value("description")
+
+	if v := value("uuid"); v != "" {
+		uuid, err := models.ParseUUID(v)
+		if err != nil {
+			fail("uuid", "invalid uuid")
+		}
+		todo.UUID = uuid
+	}
+	if done, ok := parseCSVBool(value("done")); ok {
+		todo.Done = done
+	} else {
+		fail("done", "expected true or false")
+	}
+	if reminder, ok := parseCSVBool(value("reminder")); ok {
+		todo.Reminder = reminder
+	} else {
+		fail("reminder", "expected true or false")
+	}
+
+	if v := strings.ToLower(value("priority")); v != "" {
+		if !models.IsValidPriority(v) {
+			fail("priority", "priority must be low, medium or high")
+		}
+		todo.Priority = v
+	}
+	if v := value("category"); v != "" {
+		if !ctx.categories[v] {
+			fail("category", "unknown category")
+		}
+		todo.Category = v
+	}
+	if v := value("status"); v != "" {
+		if !ctx.states[v] {
+			fail("status", "unknown status")
+		}
+		todo.Status = v
+	}
+
+	if v := value("dueDate"); v != "" {
+		if t, ok := parseCSVDate(v); ok {
+			todo.DueDate = &t
+		} else {
+			fail("dueDate", "expected a date such as 2006-01-02 or an RFC 3339 timestamp")
+		}
+	}
+	if v := value("estimatedTime"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			todo.EstimatedTime = &n
+		} else {
+			fail("estimatedTime", "estimated time must be a non-negative integer")
+		}
+	}
+
+	if v := value("tags"); v != "" {
+		tags, err := models.NormalizeTags(decodeList(v, ';'))
+		if err != nil {
+			fail("tags", "invalid tag name")
+		}
+		todo.Tags = tags
+	}
+	if i, ok := ctx.columns["steps"]; ok && i < len(record) {
+		todo.Steps = decodeCSVSteps(record[i])
+	}
+	if v := value("customFields"); v != "" {
+		if err := json.Unmarshal([]byte(v), &todo.CustomFields); err != nil {
+			fail("customFields", "expected a JSON object")
+		}
+		for key := range todo.CustomFields {
+			if !models.KeyPattern.MatchString(key) {
+				fail("customFields", "invalid custom field key")
+				break
+			}
+		}
+	}
+
+	return todo, errs
+}
+
+// csvImportMapping 根据表头和 map.<字段>=<列名> 查询参数确定每个字段所在的列。
+// 没有映射的字段按同名列（不区分大小写）识别，找不到时忽略。
+func csvImportMapping(header []string, query map[string][]string) (map[string]int, map[string]string, error) {
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		key := strings.ToLower(strings.TrimSpace(name))
+		if _, exists := index[key]; !exists {
+			index[key] = i
+		}
+	}
+
+	mapping := make(map[string]string)
+	for param, values := range query {
+		if !strings.HasPrefix(param, "map.") || len(values) == 0 {
+			continue
+		}
+		field := strings.TrimPrefix(param, "map.")
+		if !containsField(csvImportFields, field) {
+			return nil, nil, fmt.Errorf("unknown field in mapping: %s", field)
+		}
+		mapping[field] = values[0]
+	}
+
+	columns := make(map[string]int)
+	headers := make(map[string]string)
+	for _, field := range csvImportFields {
+		name, mapped := mapping[field]
+		if !mapped {
+			name = field
+		}
+		i, ok := index[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			if mapped {
+				return nil, nil, fmt.Errorf("column not found: %s", name)
+			}
+			continue
+		}
+		columns[field] = i
+		headers[field] = strings.TrimSpace(header[i])
+	}
+	if _, ok := columns["task"]; !ok {
+		return nil, nil, errors.New("a task column is required")
+	}
+	return columns, headers, nil
+}
+
+// containsField 判断字段是否在列表中
+func containsField(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// todoEncoder 导出时逐个输出待办事项
+type todoEncoder interface {
+	Encode(todo models.Todo) error
+	Flush() error
+}
+
+// csvTodoEncoder 按 csvColumns 输出 CSV，第一行是表头
+type csvTodoEncoder struct {
+	w *csv.Writer
+}
+
+func newCSVTodoEncoder(w io.Writer) todoEncoder {
+	e := &csvTodoEncoder{w: csv.NewWriter(w)}
+	e.w.Write(csvColumns)
+	return e
+}
+
+func (e *csvTodoEncoder) Encode(todo models.Todo) error {
+	return e.w.Write(encodeTodoCSV(todo))
+}
+
+func (e *csvTodoEncoder) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// exportFormats 支持的导出格式：响应类型、文件名和编码器
+var exportFormats = map[string]struct {
+	contentType string
+	filename    string
+	newEncoder  func(w io.Writer) todoEncoder
+}{
+	"csv":      {"text/csv; charset=utf-8", "todos.csv", newCSVTodoEncoder},
+	"todotxt":  {"text/plain; charset=utf-8", "todo.txt", newTodoTxtEncoder},
+	"markdown": {"text/markdown; charset=utf-8", "todos.md", newMarkdownEncoder},
+}
+
+// ExportTodos 导出与 GetTodosWithFilter 相同过滤条件下的全部待办事项（不分页），
+// 逐行查询并流式输出，不在内存中缓存结果。format 为 csv（默认）、todotxt 或 markdown，
+// Markdown 清单按分类分组；CSV 在 bom=true 时输出 UTF-8 BOM。
+func (h *EnhancedTodoHandler) ExportTodos(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	format := getQueryParam(r, "format", "csv")
+	exportFormat, ok := exportFormats[format]
+	if !ok {
+		http.Error(w, "Unsupported export format", http.StatusBadRequest)
+		return
+	}
+
+	filters, ok := h.requestFilters(w, r, userID)
+	if !ok {
+		return
+	}
+	fq := buildFilterQuery(userID, filters)
+	keyset := fq.keyset
+	if format == "markdown" {
+		// 分类相同的待办事项相邻输出，分类内保持请求的排序
+		keyset.Keys = append([]models.SortKey{{Expr: "category"}}, keyset.Keys...)
+	}
+	query := fmt.Sprintf("SELECT %s, %s FROM todos %s %s", models.TodoColumns, csvStepsQuery, fq.where, keyset.OrderBy())
+
+	rows, err := h.Model.DB.Query(query, fq.args...)
+	if err != nil {
+		log.Printf("导出查询失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	w.Header().Set("Content-Type", exportFormat.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, exportFormat.filename))
+	if b, _ := strconv.ParseBool(r.URL.Query().Get("bom")); b && format == "csv" {
+		io.WriteString(w, utf8BOM)
+	}
+
+	flusher, _ := w.(http.Flusher)
+	encoder := exportFormat.newEncoder(w)
+
+	count := 0
+	for rows.Next() {
+		var stepsJSON []byte
+		todo, err := models.ScanTodo(extraColumnScanner{rows: rows, extra: []interface{}{&stepsJSON}})
+		if err != nil {
+			// 响应已经开始，只能中断输出
+			log.Printf("导出扫描失败: %v", err)
+			return
+		}
+		if err := json.Unmarshal(stepsJSON, &todo.Steps); err != nil {
+			log.Printf("解析步骤失败: %v", err)
+		}
+
+		if err := encoder.Encode(todo); err != nil {
+			return
+		}
+		if count++; count%csvFlushInterval == 0 {
+			encoder.Flush()
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("导出查询失败: %v", err)
+	}
+	encoder.Flush()
+}
+
+// csvImportRow 一行的导入结果。Row 是 CSV 中的行号（表头为第 1 行）
+type csvImportRow struct {
+	Row    int             `json:"row"`
+	Status string          `json:"status"` // valid（仅预览）、imported、skipped、error
+	ID     int             `json:"id,omitempty"`
+	Errors []csvFieldError `json:"errors,omitempty"`
+	Todo   *models.Todo    `json:"todo,omitempty"`
+}
+
+// ImportTodos 从 CSV（Content-Type: text/csv）导入待办事项。第一行是表头，
+// 通过 map.<字段>=<列名> 查询参数指定列映射，默认识别导出时的列名。每一行单独校验，
+// 无效的行报告每一列的错误且不导入；uuid 已存在的行视为已经导入过而跳过。
+// dryRun=true 时只校验并返回预览，不写入数据库。
+// Content-Type 为 text/markdown 时导入 Markdown 任务清单，见 importMarkdown。
+func (h *EnhancedTodoHandler) ImportTodos(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+	if contentType == "text/markdown" {
+		h.importMarkdown(w, r, userID, dryRun)
+		return
+	}
+	if contentType != "text/csv" && contentType != "application/csv" {
+		writeJSONError(w, http.StatusUnsupportedMediaType, "Content-Type must be text/csv or text/markdown", "")
+		return
+	}
+
+	reader := csv.NewReader(http.MaxBytesReader(w, r.Body, maxImportBodySize))
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid CSV: missing header row", "")
+		return
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], utf8BOM)
+	}
+
+	ctx := csvImportContext{categories: map[string]bool{}, states: map[string]bool{}}
+	if ctx.columns, ctx.headers, err = csvImportMapping(header, r.URL.Query()); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error(), "mapping")
+		return
+	}
+
+	categories, err := h.Categories.GetCategories(userID)
+	if err != nil {
+		log.Printf("获取分类失败: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Internal server error", "")
+		return
+	}
+	for _, category := range categories {
+		ctx.categories[category.Name] = true
+	}
+	states, err := h.Workflow.GetStates(userID)
+	if err != nil {
+		log.Printf("获取工作流状态失败: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Internal server error", "")
+		return
+	}
+	for _, state := range states {
+		ctx.states[state.Key] = true
+	}
+
+	// 先读取并校验全部行，CSV 格式错误时整个请求无效
+	var records [][]string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				writeJSONError(w, http.StatusRequestEntityTooLarge, "CSV is too large", "")
+				return
+			}
+			writeJSONError(w, http.StatusBadRequest, "Invalid CSV: "+err.Error(), "")
+			return
+		}
+		if len(records) == maxImportRows {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("CSV has more than %d rows", maxImportRows), "")
+			return
+		}
+		records = append(records, record)
+	}
+
+	results := make([]csvImportRow, 0, len(records))
+	counts := map[string]int{}
+	var importedIDs []int
+	for i, record := range records {
+		result := csvImportRow{Row: i + 2}
+		todo, errs := parseCSVTodo(record, ctx)
+		exists := false
+		if len(errs) == 0 && todo.UUID != "" {
+			var err error
+			if exists, err = h.ownTodoUUID(userID, &todo); err != nil {
+				log.Printf("检查待办事项 UUID 失败: %v", err)
+				errs = []csvFieldError{{Field: "uuid", Column: ctx.headers["uuid"], Message: "failed to check uuid"}}
+			}
+		}
+
+		switch {
+		case len(errs) > 0:
+			result.Status, result.Errors = "error", errs
+		case exists:
+			result.Status = "skipped"
+			result.Errors = []csvFieldError{{Field: "uuid", Column: ctx.headers["uuid"], Message: "todo already exists"}}
+		case dryRun:
+			todo.UserID = userID
+			result.Status, result.Todo = "valid", &todo
+		default:
+			todo.UserID = userID
+			if err := h.Model.AddTodo(&todo); err != nil {
+				result.Status = "error"
+				result.Errors = []csvFieldError{csvAddError(err, ctx)}
+				break
+			}
+			result.Status, result.ID = "imported", todo.ID
+			importedIDs = append(importedIDs, todo.ID)
+		}
+		counts[result.Status]++
+		results = append(results, result)
+	}
+
+	response := map[string]interface{}{
+		"dryRun":   dryRun,
+		"total":    len(records),
+		"valid":    counts["valid"],
+		"imported": counts["imported"],
+		"skipped":  counts["skipped"],
+		"failed":   counts["error"],
+		"rows":     results,
+	}
+	if len(importedIDs) > 0 {
+		if token := recordUndo(h.Undo, userID, models.UndoActionImport, nil, importedIDs...); token != "" {
+			response["undoToken"] = token
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ownTodoUUID 判断 UUID 是否已被该用户的待办事项使用。UUID 属于其他账户时与备份恢复一样清除，
+// 导入时生成新的 UUID，不透露其他账户中是否存在该 UUID
+func (h *EnhancedTodoHandler) ownTodoUUID(userID int, todo *models.Todo) (bool, error) {
+	owner, err := h.Model.TodoUUIDOwner(todo.UUID)
+	if err != nil {
+		return false, err
+	}
+	if owner != 0 && owner != userID {
+		todo.UUID = ""
+	}
+	return owner == userID, nil
+}
+
+// csvAddError 把写入时的错误转换为列错误
+func csvAddError(err error, ctx csvImportContext) csvFieldError {
+	field, message := "", "failed to import row"
+	switch {
+	case errors.Is(err, models.ErrUnknownCategory):
+		field, message = "category", "unknown category"
+	case errors.Is(err, models.ErrUnknownStatus):
+		field, message = "status", "unknown status"
+	case errors.Is(err, models.ErrInvalidTag):
+		field, message = "tags", "invalid tag name"
+	case errors.Is(err, models.ErrDuplicateUUID):
+		field, message = "uuid", "uuid already in use"
+	case models.IsCustomFieldError(err):
+		field, message = "customFields", err.Error()
+	default:
+		log.Printf("导入待办事项失败: %v", err)
+	}
+	return csvFieldError{Field: field, Column: ctx.headers[field], Message: message}
+}
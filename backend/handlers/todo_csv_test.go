@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/TodoList/models"
+)
+
+func TestCSVListRoundTrip(t *testing.T) {
+	lists := [][]string{
+		nil,
+		{"work"},
+		{"a;b", `back\slash`, "line\nbreak", ""},
+	}
+	for _, list := range lists {
+		if got := decodeList(encodeList(list, ';'), ';'); !reflect.DeepEqual(got, list) {
+			t.Errorf("round trip %q = %q", list, got)
+		}
+	}
+}
+
+func TestCSVStepsRoundTrip(t *testing.T) {
+	steps := []models.Step{
+		{Content: "buy milk", Completed: true},
+		{Content: "[x] literal\nmultiline"},
+	}
+	encoded := encodeCSVSteps(steps)
+	if got := decodeCSVSteps(encoded); !reflect.DeepEqual(got, steps) {
+		t.Errorf("decodeCSVSteps(%q) = %+v", encoded, got)
+	}
+
+	// 手写的步骤：没有复选框前缀的行视为未完成，空行忽略
+	got := decodeCSVSteps("first\r\n\r\n[X] second")
+	want := []models.Step{{Content: "first"}, {Content: "second", Completed: true}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeCSVSteps = %+v, want %+v", got, want)
+	}
+}
+
+func TestCSVImportMapping(t *testing.T) {
+	header := []string{"Title", "Priority", "Notes"}
+	columns, headers, err := csvImportMapping(header, map[string][]string{
+		"map.task":        {"title"},
+		"map.description": {"Notes"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"task": 0, "priority": 1, "description": 2}
+	if !reflect.DeepEqual(columns, want) || headers["task"] != "Title" {
+		t.Errorf("columns = %v, headers = %v", columns, headers)
+	}
+
+	for _, query := range []map[string][]string{
+		{"map.owner": {"Title"}},  // 未知字段
+		{"map.task": {"Missing"}}, // 列不存在
+		{},                        // 没有 task 列
+	} {
+		if _, _, err := csvImportMapping([]string{"Name"}, query); err == nil {
+			t.Errorf("csvImportMapping(%v) succeeded", query)
+		}
+	}
+}
+
+func TestParseCSVTodo(t *testing.T) {
+	header := []string{"task", "done", "priority", "category", "status", "dueDate", "estimatedTime", "tags", "customFields"}
+	columns, headers, err := csvImportMapping(header, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := csvImportContext{
+		columns:    columns,
+		headers:    headers,
+		categories: map[string]bool{"work": true},
+		states:     map[string]bool{"todo": true},
+	}
+
+	todo, errs := parseCSVTodo([]string{"Write report", "yes", "HIGH", "work", "todo", "2024-05-01", "30", "a;b", `{"k":1}`}, ctx)
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %+v", errs)
+	}
+	if !todo.Done || todo.Priority != "high" || todo.DueDate == nil || *todo.EstimatedTime != 30 ||
+		!reflect.DeepEqual(todo.Tags, []string{"a", "b"}) || todo.CustomFields["k"] != float64(1) {
+		t.Errorf("parsed todo = %+v", todo)
+	}
+
+	_, errs = parseCSVTodo([]string{"", "maybe", "urgent", "home", "later", "tomorrow", "-1", "", "[1]"}, ctx)
+	var fields []string
+	for _, e := range errs {
+		fields = append(fields, e.Field)
+	}
+	want := []string{"task", "done", "priority", "category", "status", "dueDate", "estimatedTime", "customFields"}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("error fields = %v, want %v", fields, want)
+	}
+}
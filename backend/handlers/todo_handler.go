@@ -3,6 +3,7 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -16,11 +17,32 @@ import (
 // TodoHandler 处理待办事项相关的HTTP请求
 type TodoHandler struct {
 	Model *models.TodoModel
+	Undo  *models.UndoModel
 }
 
 // NewTodoHandler 创建一个新的TodoHandler实例
-func NewTodoHandler(model *models.TodoModel) *TodoHandler {
-	return &TodoHandler{Model: model}
+func NewTodoHandler(model *models.TodoModel, undo *models.UndoModel) *TodoHandler {
+	return &TodoHandler{Model: model, Undo: undo}
+}
+
+// allowedOrigins 允许跨域访问的前端地址（多个前端端口）
+var allowedOrigins = []string{
+	"http://localhost:3000",
+	"http://localhost:3001",
+	"http://localhost:3002",
+	"http://127.0.0.1:3000",
+	"http://127.0.0.1:3001",
+	"http://127.0.0.1:3002",
+}
+
+// isAllowedOrigin 检查请求来源是否在允许列表中
+func isAllowedOrigin(origin string) bool {
+	for _, allowedOrigin := range allowedOrigins {
+		if origin == allowedOrigin {
+			return true
+		}
+	}
+	return false
 }
 
 // EnableCORS 添加CORS头信息
@@ -30,22 +52,10 @@ func EnableCORS(next http.HandlerFunc) http.HandlerFunc {
 		origin := r.Header.Get("Origin")
 		log.Printf("CORS请求: %s %s, Origin: %s", r.Method, r.URL.Path, origin)
 
-		allowedOrigins := []string{
-			"http://localhost:3000",
-			"http://localhost:3001",
-			"http://localhost:3002",
-			"http://127.0.0.1:3000",
-			"http://127.0.0.1:3001",
-			"http://127.0.0.1:3002",
-		}
-
 		// 检查请求来源是否在允许列表中
-		for _, allowedOrigin := range allowedOrigins {
-			if origin == allowedOrigin {
-				w.Header().Set("Access-Control-Allow-Origin", origin)
-				log.Printf("允许来源: %s", origin)
-				break
-			}
+		if isAllowedOrigin(origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			log.Printf("允许来源: %s", origin)
 		}
 
 		// 如果没有Origin头或不在允许列表中，设置默认值
@@ -54,8 +64,9 @@ func EnableCORS(next http.HandlerFunc) http.HandlerFunc {
 			log.Printf("使用默认来源: http://localhost:3000")
 		}
 
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match, If-None-Match, Idempotency-Key, Last-Event-ID")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, Link, Idempotent-Replayed")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 
 		if r.Method == "OPTIONS" {
@@ -77,16 +88,75 @@ func (h *TodoHandler) GetAllTodos(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	todos, err := h.Model.GetAllTodos(userID)
+	h.writeUserTodos(w, r, userID)
+}
+
+// GetUserTodos 获取指定用户的待办事项（管理员使用）
+func (h *TodoHandler) GetUserTodos(w http.ResponseWriter, r *http.Request, userID int) {
+	h.writeUserTodos(w, r, userID)
+}
+
+// writeUserTodos 输出用户的待办事项：带 cursor/limit 时分页，否则返回完整数组。
+// 分页时默认不加载步骤（include=steps 加载），完整数组默认包含步骤以保持兼容。
+func (h *TodoHandler) writeUserTodos(w http.ResponseWriter, r *http.Request, userID int) {
+	if wantsCursorPage(r) {
+		todos, info, err := h.Model.ListTodos(userID, parsePageRequest(r), includeSteps(r, false))
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidCursor) {
+				http.Error(w, "Invalid cursor", http.StatusBadRequest)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if notModified(w, r, pageETag(todos, info)) {
+			return
+		}
+		writeCursorPage(w, r, todos, info, nil)
+		return
+	}
+
+	todos, err := h.Model.GetTodos(userID, includeSteps(r, true))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if notModified(w, r, listETag(todos)) {
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(todos)
 }
 
+// GetSteps 分页获取待办事项的步骤
+func (h *TodoHandler) GetSteps(w http.ResponseWriter, r *http.Request, todoID int) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	todo, err := h.Model.GetTodoByID(todoID)
+	if err != nil || todo.UserID != userID {
+		http.Error(w, "Todo not found", http.StatusNotFound)
+		return
+	}
+
+	steps, info, err := h.Model.ListSteps(todoID, parsePageRequest(r))
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidCursor) {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		log.Printf("获取步骤失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeCursorPage(w, r, steps, info, nil)
+}
+
 // AddTodo 添加新的待办事项
 // AddTodo 添加新的待办事项
 func (h *TodoHandler) AddTodo(w http.ResponseWriter, r *http.Request) {
@@ -133,6 +203,37 @@ func (h *TodoHandler) AddTodo(w http.ResponseWriter, r *http.Request) {
 
 	err = h.Model.AddTodo(&todo)
 	if err != nil {
+		if errors.Is(err, models.ErrUnknownStatus) {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, "{\"error\":\"未知的任务状态\"}", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, models.ErrInvalidTag) {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, "{\"error\":\"标签名称无效\"}", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, models.ErrUnknownCategory) {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, "{\"error\":\"未知的分类\"}", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, models.ErrInvalidUUID) {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, "{\"error\":\"UUID格式无效\"}", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, models.ErrDuplicateUUID) {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, "{\"error\":\"UUID已被使用\"}", http.StatusConflict)
+			return
+		}
+		if models.IsCustomFieldError(err) {
+			w.Header().Set("Content-Type", "application/json")
+			errorBody, _ := json.Marshal(map[string]string{"error": err.Error()})
+			http.Error(w, string(errorBody), http.StatusBadRequest)
+			return
+		}
 		log.Printf("添加任务失败: %v", err)
 		w.Header().Set("Content-Type", "application/json")
 		http.Error(w, fmt.Sprintf("{\"error\":\"%s\"}", err.Error()), http.StatusInternalServerError)
@@ -140,10 +241,12 @@ func (h *TodoHandler) AddTodo(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("任务添加成功，ID: %d", todo.ID)
+	undoToken := recordUndo(h.Undo, userID, models.UndoActionCreate, nil, todo.ID)
 
+	w.Header().Set("ETag", todoETag(todo))
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(todo)
+	json.NewEncoder(w).Encode(undoableTodo{Todo: todo, UndoToken: undoToken})
 }
 
 // UpdateTodo 更新待办事项
@@ -176,30 +279,72 @@ func (h *TodoHandler) UpdateTodo(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("解析后的更新任务: %+v, 步骤数量: %d", todo, len(todo.Steps))
 
+	// 请求体中没有ID时使用路径 /api/todos/{id} 中的ID
+	if todo.ID == 0 {
+		if id, ok := pathID(r, 3); ok {
+			todo.ID = id
+		}
+	}
+
 	// 设置用户ID
 	todo.UserID = userID
 
-	err = h.Model.UpdateTodo(&todo, userID)
+	before, err := snapshotForUndo(h.Undo, userID, todo.ID)
+	if err != nil {
+		log.Printf("读取撤销快照失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	err = h.Model.UpdateTodoIfMatch(&todo, userID, ifMatchVersions(r, todo.ID))
 	if err != nil {
 		if err.Error() == "unauthorized: todo does not belong to user" {
 			http.Error(w, "Unauthorized: You can only update your own todos", http.StatusForbidden)
 			return
 		}
+		if errors.Is(err, models.ErrVersionConflict) {
+			http.Error(w, "Precondition Failed: todo has been modified", http.StatusPreconditionFailed)
+			return
+		}
+		if errors.Is(err, models.ErrUnknownStatus) {
+			http.Error(w, "Unknown status", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, models.ErrInvalidTag) {
+			http.Error(w, "Invalid tag name", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, models.ErrUnknownCategory) {
+			http.Error(w, "Unknown category", http.StatusBadRequest)
+			return
+		}
+		if models.IsCustomFieldError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		log.Printf("更新任务失败: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	log.Printf("任务更新成功，ID: %d", todo.ID)
+	undoToken := recordUndo(h.Undo, userID, models.UndoActionUpdate, before, todo.ID)
 
+	w.Header().Set("ETag", todoETag(todo))
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(todo)
+	json.NewEncoder(w).Encode(undoableTodo{Todo: todo, UndoToken: undoToken})
 }
 
 // ToggleTodo 切换待办事项的完成状态
 func (h *TodoHandler) ToggleTodo(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	var data struct {
-		ID int `json:"id"`
+		ID idRef `json:"id"` // 整数ID或 UUID
 	}
 
 	err := json.NewDecoder(r.Body).Decode(&data)
@@ -208,13 +353,49 @@ func (h *TodoHandler) ToggleTodo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.Model.ToggleTodo(data.ID)
+	todoID, err := h.Model.ResolveTodoID(string(data.ID))
 	if err != nil {
+		if errors.Is(err, models.ErrTodoNotFound) {
+			http.Error(w, "Todo not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, models.ErrInvalidID) {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	// 与 GetTodoByID 一样显式检查所有权，不依赖撤销快照（未配置撤销存储时没有快照）
+	todo, err := h.Model.GetTodoByID(todoID)
+	if err != nil {
+		if errors.Is(err, models.ErrTodoNotFound) {
+			http.Error(w, "Todo not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if todo.UserID != userID {
+		http.Error(w, "Todo not found", http.StatusNotFound)
+		return
+	}
+
+	before, err := snapshotForUndo(h.Undo, userID, todoID)
+	if err != nil {
+		log.Printf("读取撤销快照失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	err = h.Model.ToggleTodo(todoID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeUndoToken(w, recordUndo(h.Undo, userID, models.UndoActionUpdate, before, todoID))
 }
 
 // DeleteTodo 删除待办事项
@@ -238,17 +419,28 @@ func (h *TodoHandler) DeleteTodo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.Model.DeleteTodo(id, userID)
+	before, err := snapshotForUndo(h.Undo, userID, id)
+	if err != nil {
+		log.Printf("读取撤销快照失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	err = h.Model.DeleteTodoIfMatch(id, userID, ifMatchVersions(r, id))
 	if err != nil {
 		if err.Error() == "unauthorized: todo does not belong to user" {
 			http.Error(w, "Unauthorized: You can only delete your own todos", http.StatusForbidden)
 			return
 		}
+		if errors.Is(err, models.ErrVersionConflict) {
+			http.Error(w, "Precondition Failed: todo has been modified", http.StatusPreconditionFailed)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	writeUndoToken(w, recordUndo(h.Undo, userID, models.UndoActionDelete, before, id))
 }
 
 // AddStep 添加步骤
@@ -274,8 +466,23 @@ func (h *TodoHandler) AddStep(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("解析后的步骤: %+v", step)
 
+	// 请求体中没有 todoId 时使用路径 /api/todos/{id}/steps 中的ID
+	if step.TodoID == 0 {
+		if id, ok := pathID(r, 3); ok {
+			step.TodoID = id
+		}
+	}
+
 	err = h.Model.AddStep(&step)
 	if err != nil {
+		if errors.Is(err, models.ErrInvalidUUID) {
+			http.Error(w, "Invalid UUID", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, models.ErrDuplicateUUID) {
+			http.Error(w, "UUID already in use", http.StatusConflict)
+			return
+		}
 		log.Printf("添加步骤失败: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -310,7 +517,7 @@ func (h *TodoHandler) UpdateStep(w http.ResponseWriter, r *http.Request) {
 // ToggleStep 切换步骤的完成状态
 func (h *TodoHandler) ToggleStep(w http.ResponseWriter, r *http.Request) {
 	var data struct {
-		ID int `json:"id"`
+		ID idRef `json:"id"` // 整数ID或 UUID
 	}
 
 	err := json.NewDecoder(r.Body).Decode(&data)
@@ -319,7 +526,21 @@ func (h *TodoHandler) ToggleStep(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.Model.ToggleStep(data.ID)
+	stepID, err := h.Model.ResolveStepID(string(data.ID))
+	if err != nil {
+		if errors.Is(err, models.ErrStepNotFound) {
+			http.Error(w, "Step not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, models.ErrInvalidID) {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = h.Model.ToggleStep(stepID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -330,6 +551,12 @@ func (h *TodoHandler) ToggleStep(w http.ResponseWriter, r *http.Request) {
 
 // DeleteStep 删除步骤
 func (h *TodoHandler) DeleteStep(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	parts := strings.Split(r.URL.Path, "/")
 	if len(parts) < 6 {
 		http.Error(w, "Invalid path", http.StatusBadRequest)
@@ -348,13 +575,24 @@ func (h *TodoHandler) DeleteStep(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before, err := snapshotForUndo(h.Undo, userID, todoID)
+	if err != nil {
+		log.Printf("读取撤销快照失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if before != nil && len(before) == 0 {
+		http.Error(w, "Todo not found", http.StatusNotFound)
+		return
+	}
+
 	err = h.Model.DeleteStep(stepID, todoID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	writeUndoToken(w, recordUndo(h.Undo, userID, models.UndoActionUpdate, before, todoID))
 }
 
 // HandleTodoRoutes 处理所有与待办事项相关的路由
@@ -388,6 +626,8 @@ func (h *TodoHandler) HandleTodoRoutes(w http.ResponseWriter, r *http.Request) {
 			h.GetTodoByID(w, r, todoID)
 		case http.MethodPut:
 			h.UpdateTodo(w, r)
+		case http.MethodPatch:
+			h.PatchTodo(w, r, todoID)
 		case http.MethodDelete:
 			h.DeleteTodo(w, r)
 		default:
@@ -425,12 +665,30 @@ func (h *TodoHandler) HandleTodoRoutes(w http.ResponseWriter, r *http.Request) {
 
 // GetTodoByID 根据ID获取单个待办事项
 func (h *TodoHandler) GetTodoByID(w http.ResponseWriter, r *http.Request, todoID int) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	todo, err := h.Model.GetTodoByID(todoID)
 	if err != nil {
+		if errors.Is(err, models.ErrTodoNotFound) {
+			http.Error(w, "Todo not found", http.StatusNotFound)
+			return
+		}
 		log.Printf("获取任务失败，ID: %d, 错误: %v", todoID, err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if todo.UserID != userID {
+		http.Error(w, "Todo not found", http.StatusNotFound)
+		return
+	}
+
+	if notModified(w, r, todoETag(*todo)) {
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(todo)
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+
+	"github.com/TodoList/models"
+)
+
+// 支持的补丁格式
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+// maxPatchBodySize 补丁请求体的最大字节数
+const maxPatchBodySize = 1 << 20
+
+// todoDocumentDefaults 可选字段在文档中缺省时的值，保证补丁路径（如 /tags/-）总是存在，
+// 也使合并补丁中的 null 与“清空”等价
+var todoDocumentDefaults = map[string]func() interface{}{
+	"description":   func() interface{} { return "" },
+	"dueDate":       func() interface{} { return nil },
+	"estimatedTime": func() interface{} { return nil },
+	"tags":          func() interface{} { return []interface{}{} },
+	"steps":         func() interface{} { return []interface{}{} },
+	"customFields":  func() interface{} { return map[string]interface{}{} },
+}
+
+// todoDocument 把待办事项转换为补丁操作的JSON文档
+func todoDocument(todo models.Todo) (map[string]interface{}, error) {
+	data, err := json.Marshal(todo)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	fillTodoDefaults(doc)
+	return doc, nil
+}
+
+// fillTodoDefaults 为缺省的可选字段补上默认值
+func fillTodoDefaults(doc map[string]interface{}) {
+	for field, value := range todoDocumentDefaults {
+		if current, ok := doc[field]; !ok || current == nil {
+			doc[field] = value()
+		}
+	}
+}
+
+// changedFields 返回打补丁前后值不同的顶层字段（排序后）
+func changedFields(before, after map[string]interface{}) []string {
+	var fields []string
+	for field, value := range after {
+		if old, ok := before[field]; !ok || !reflect.DeepEqual(old, value) {
+			fields = append(fields, field)
+		}
+	}
+	for field := range before {
+		if _, ok := after[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// patchTodoDocument 按 Content-Type 把补丁应用到待办事项，返回打补丁后的文档和被修改的字段
+func patchTodoDocument(todo models.Todo, contentType string, body []byte) (map[string]interface{}, []string, error) {
+	before, err := todoDocument(todo)
+	if err != nil {
+		return nil, nil, err
+	}
+	working, err := todoDocument(todo)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var patched interface{}
+	switch contentType {
+	case jsonPatchType:
+		if patched, err = applyJSONPatch(working, body); err != nil {
+			return nil, nil, err
+		}
+	default:
+		var patch interface{}
+		if err := json.Unmarshal(body, &patch); err != nil {
+			return nil, nil, &PatchError{Op: -1, Message: "invalid JSON merge patch"}
+		}
+		patched = applyMergePatch(working, patch)
+	}
+
+	after, ok := patched.(map[string]interface{})
+	if !ok {
+		return nil, nil, &PatchError{Op: -1, Message: "patched document must be an object"}
+	}
+	fillTodoDefaults(after)
+
+	fields := changedFields(before, after)
+	for _, field := range fields {
+		if !models.IsPatchableTodoField(field) {
+			if _, known := before[field]; known {
+				return nil, nil, &models.TodoFieldError{Field: field, Message: "field is read-only"}
+			}
+			return nil, nil, &models.TodoFieldError{Field: field, Message: "unknown field"}
+		}
+	}
+	return after, fields, nil
+}
+
+// decodeTodoDocument 把打补丁后的文档解码为待办事项，类型错误报告为字段错误
+func decodeTodoDocument(doc map[string]interface{}) (models.Todo, error) {
+	var todo models.Todo
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return todo, err
+	}
+	if err := json.Unmarshal(data, &todo); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return todo, &models.TodoFieldError{Field: typeErr.Field, Message: "expected " + typeErr.Type.String()}
+		}
+		// 只读的时间字段不会改变，其余解码错误只可能来自 dueDate 的时间格式
+		return todo, &models.TodoFieldError{Field: "dueDate", Message: "expected an RFC 3339 timestamp"}
+	}
+	return todo, nil
+}
+
+// writeJSONError 以 {"error": ..., "field": ...} 格式输出错误
+func writeJSONError(w http.ResponseWriter, status int, message, field string) {
+	body := map[string]string{"error": message}
+	if field != "" {
+		body["field"] = field
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// PatchTodo 部分更新待办事项，支持 RFC 7396 JSON Merge Patch（application/merge-patch+json，
+// 也接受 application/json）和 RFC 6902 JSON Patch（application/json-patch+json）。
+// 只有被补丁修改的字段会写入数据库；支持 If-Match 条件更新。
+func (h *TodoHandler) PatchTodo(w http.ResponseWriter, r *http.Request, todoID int) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch contentType {
+	case mergePatchType, jsonPatchType, "application/json":
+	default:
+		w.Header().Set("Accept-Patch", mergePatchType+", "+jsonPatchType)
+		writeJSONError(w, http.StatusUnsupportedMediaType, "Unsupported patch format", "")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPatchBodySize))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid request body", "")
+		return
+	}
+
+	current, err := h.Model.GetTodoByID(todoID)
+	if err != nil {
+		if errors.Is(err, models.ErrTodoNotFound) {
+			writeJSONError(w, http.StatusNotFound, "Todo not found", "")
+			return
+		}
+		log.Printf("获取任务失败，ID: %d, 错误: %v", todoID, err)
+		writeJSONError(w, http.StatusInternalServerError, "Internal server error", "")
+		return
+	}
+	if current.UserID != userID {
+		writeJSONError(w, http.StatusNotFound, "Todo not found", "")
+		return
+	}
+
+	// 先检查一次 If-Match，避免对已过期的版本计算补丁；写入时还会原子地再检查一次
+	versions := ifMatchVersions(r, todoID)
+	if versions != nil && !containsInt(versions, current.Version) {
+		writeJSONError(w, http.StatusPreconditionFailed, "Precondition Failed: todo has been modified", "")
+		return
+	}
+
+	doc, fields, err := patchTodoDocument(*current, contentType, body)
+	if err == nil && len(fields) == 0 {
+		// 补丁没有修改任何字段
+		w.Header().Set("ETag", todoETag(*current))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(current)
+		return
+	}
+
+	var todo models.Todo
+	if err == nil {
+		todo, err = decodeTodoDocument(doc)
+	}
+	if err == nil {
+		todo.ID = todoID
+		err = h.Model.PatchTodo(&todo, userID, fields, versions)
+	}
+	if err != nil {
+		writePatchError(w, err)
+		return
+	}
+
+	before := map[int]models.Todo{todoID: *current}
+	undoToken := recordUndo(h.Undo, userID, models.UndoActionUpdate, before, todoID)
+
+	w.Header().Set("ETag", todoETag(todo))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(undoableTodo{Todo: todo, UndoToken: undoToken})
+}
+
+// writePatchError 把补丁和校验错误映射为HTTP状态码
+func writePatchError(w http.ResponseWriter, err error) {
+	var patchErr *PatchError
+	var fieldErr *models.TodoFieldError
+	switch {
+	case errors.As(err, &patchErr):
+		status := http.StatusBadRequest
+		if patchErr.Conflict {
+			status = http.StatusConflict
+		}
+		writeJSONError(w, status, patchErr.Error(), "")
+	case errors.As(err, &fieldErr):
+		writeJSONError(w, http.StatusUnprocessableEntity, fieldErr.Message, fieldErr.Field)
+	case errors.Is(err, models.ErrVersionConflict):
+		writeJSONError(w, http.StatusPreconditionFailed, "Precondition Failed: todo has been modified", "")
+	case errors.Is(err, models.ErrTodoNotFound):
+		writeJSONError(w, http.StatusNotFound, "Todo not found", "")
+	case errors.Is(err, models.ErrUnknownStatus):
+		writeJSONError(w, http.StatusUnprocessableEntity, "Unknown status", "status")
+	case errors.Is(err, models.ErrUnknownCategory):
+		writeJSONError(w, http.StatusUnprocessableEntity, "Unknown category", "category")
+	case errors.Is(err, models.ErrInvalidTag):
+		writeJSONError(w, http.StatusUnprocessableEntity, "Invalid tag name", "tags")
+	case models.IsCustomFieldError(err):
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error(), "customFields")
+	case err.Error() == "unauthorized: todo does not belong to user":
+		writeJSONError(w, http.StatusNotFound, "Todo not found", "")
+	default:
+		log.Printf("部分更新任务失败: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Internal server error", "")
+	}
+}
+
+// containsInt 判断切片中是否包含 n
+func containsInt(values []int, n int) bool {
+	for _, value := range values {
+		if value == n {
+			return true
+		}
+	}
+	return false
+}
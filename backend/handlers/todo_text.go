@@ -0,0 +1,413 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/TodoList/models"
+)
+
+// todoTxtPriorityLetters 导出到 todo.txt 时优先级对应的字母，与导入时的 todoTxtPriority 对应
+var todoTxtPriorityLetters = map[string]string{"high": "A", "medium": "B", "low": "C"}
+
+// todoTxtWord 把分类、标签中的空白替换为下划线，使它们在 todo.txt 中是一个完整的 +项目 或 @上下文
+func todoTxtWord(s string) string {
+	return strings.Join(strings.Fields(s), "_")
+}
+
+// encodeTodoTxt 把待办事项编码为 todo.txt 的一行：未完成的任务以优先级和创建日期开头，
+// 已完成的任务以 "x"、完成日期和创建日期开头，优先级写为 pri: 扩展；
+// 分类输出为 +项目，标签输出为 @上下文，截止日期输出为 due:YYYY-MM-DD。描述和步骤不导出
+func encodeTodoTxt(todo models.Todo) string {
+	var fields []string
+	created := todo.CreatedAt.UTC().Format("2006-01-02")
+	letter := todoTxtPriorityLetters[todo.Priority]
+	if todo.Done {
+		fields = append(fields, "x")
+		// 没有完成日期时不能写创建日期，否则会被当作完成日期
+		if todo.CompletedAt != nil {
+			fields = append(fields, todo.CompletedAt.UTC().Format("2006-01-02"), created)
+		}
+	} else {
+		if letter != "" {
+			fields = append(fields, "("+letter+")")
+		}
+		fields = append(fields, created)
+	}
+
+	fields = append(fields, strings.Fields(todo.Task)...)
+	if todo.Category != "" {
+		fields = append(fields, "+"+todoTxtWord(todo.Category))
+	}
+	for _, tag := range todo.Tags {
+		fields = append(fields, "@"+todoTxtWord(tag))
+	}
+	if todo.DueDate != nil {
+		fields = append(fields, "due:"+todo.DueDate.UTC().Format("2006-01-02"))
+	}
+	if todo.Done && letter != "" {
+		fields = append(fields, "pri:"+letter)
+	}
+	return strings.Join(fields, " ")
+}
+
+// markdownText 把文本压成一行，Markdown 清单的每一项只占一行
+func markdownText(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// markdownCheckbox 复选框标记
+func markdownCheckbox(done bool) string {
+	if done {
+		return "[x]"
+	}
+	return "[ ]"
+}
+
+// encodeMarkdownTodo 把待办事项编码为 GitHub 风格的任务清单项，步骤为缩进的子项。
+// 行尾的 <!-- todo:UUID --> 注释在渲染后不可见，导入时用它找到对应的待办事项
+func encodeMarkdownTodo(todo models.Todo) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "- %s %s", markdownCheckbox(todo.Done), markdownText(todo.Task))
+	if todo.UUID != "" {
+		fmt.Fprintf(&b, " <!-- todo:%s -->", todo.UUID)
+	}
+	b.WriteByte('\n')
+	for _, step := range todo.Steps {
+		fmt.Fprintf(&b, "  - %s %s\n", markdownCheckbox(step.Completed), markdownText(step.Content))
+	}
+	return b.String()
+}
+
+// todoTxtEncoder 每个待办事项输出为 todo.txt 的一行
+type todoTxtEncoder struct {
+	w *bufio.Writer
+}
+
+func newTodoTxtEncoder(w io.Writer) todoEncoder {
+	return &todoTxtEncoder{w: bufio.NewWriter(w)}
+}
+
+func (e *todoTxtEncoder) Encode(todo models.Todo) error {
+	_, err := e.w.WriteString(encodeTodoTxt(todo) + "\n")
+	return err
+}
+
+func (e *todoTxtEncoder) Flush() error {
+	return e.w.Flush()
+}
+
+// markdownEncoder 按分类分组输出 Markdown 任务清单，每个分类一个二级标题。
+// 查询按分类排序，分类变化时输出新的标题
+type markdownEncoder struct {
+	w        *bufio.Writer
+	category string
+	started  bool
+}
+
+func newMarkdownEncoder(w io.Writer) todoEncoder {
+	return &markdownEncoder{w: bufio.NewWriter(w)}
+}
+
+func (e *markdownEncoder) Encode(todo models.Todo) error {
+	if !e.started || todo.Category != e.category {
+		if e.started {
+			e.w.WriteByte('\n')
+		}
+		fmt.Fprintf(e.w, "## %s\n\n", markdownText(todo.Category))
+		e.category, e.started = todo.Category, true
+	}
+	_, err := e.w.WriteString(encodeMarkdownTodo(todo))
+	return err
+}
+
+func (e *markdownEncoder) Flush() error {
+	return e.w.Flush()
+}
+
+var (
+	// markdownCheckboxLine 任务清单项：缩进、列表标记、复选框和文本
+	markdownCheckboxLine = regexp.MustCompile(`^([ \t]*)[-*+][ \t]+\[([ xX])\](?:[ \t]+(.*))?$`)
+	// markdownIDComment 行尾的待办事项ID注释
+	markdownIDComment = regexp.MustCompile(`[ \t]*<!--[ \t]*todo:([0-9a-fA-F]{8}(?:-[0-9a-fA-F]{4}){3}-[0-9a-fA-F]{12})[ \t]*-->[ \t]*$`)
+	// markdownHeading ATX 标题，忽略结尾的 # 序列
+	markdownHeading = regexp.MustCompile(`^#{1,6}[ \t]+(.*?)(?:[ \t]+#+)?[ \t]*$`)
+)
+
+// markdownItem 从 Markdown 清单中解析出的一个待办事项
+type markdownItem struct {
+	line    int    // 在文件中的行号
+	indent  int    // 缩进宽度，更深的子项是它的步骤
+	uuid    string // 行尾注释中的ID，没有时为空
+	task    string
+	done    bool
+	heading string // 所在的最近一个标题
+	steps   []models.Step
+}
+
+// markdownIndent 计算缩进宽度，制表符按 4 个空格计算
+func markdownIndent(s string) int {
+	width := 0
+	for _, c := range s {
+		if c == '\t' {
+			width += 4
+		} else {
+			width++
+		}
+	}
+	return width
+}
+
+// parseMarkdownChecklist 解析 Markdown 任务清单。比上一个待办事项缩进更深的清单项是它的步骤
+// （更深的层级也作为步骤展开），标题记录在之后的待办事项上，其他行忽略
+func parseMarkdownChecklist(data []byte) ([]markdownItem, error) {
+	var items []markdownItem
+	heading := ""
+	scanner := bufio.NewScanner(bytes.NewReader(bytes.TrimPrefix(data, []byte(utf8BOM))))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if m := markdownHeading.FindStringSubmatch(line); m != nil {
+			heading = m[1]
+			continue
+		}
+		m := markdownCheckboxLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		indent, done, text := markdownIndent(m[1]), m[2] != " ", m[3]
+
+		if last := len(items) - 1; last >= 0 && indent > items[last].indent {
+			items[last].steps = append(items[last].steps, models.Step{Content: markdownText(text), Completed: done})
+			continue
+		}
+		item := markdownItem{line: n, indent: indent, done: done, heading: heading}
+		if id := markdownIDComment.FindStringSubmatch(text); id != nil {
+			item.uuid = id[1]
+			text = text[:len(text)-len(id[0])]
+		}
+		item.task = markdownText(text)
+		items = append(items, item)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("invalid Markdown: %v", err)
+	}
+	return items, nil
+}
+
+// stepsEqual 判断两组步骤在导出为 Markdown 后的内容和完成状态是否相同
+func stepsEqual(a, b []models.Step) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if markdownText(a[i].Content) != markdownText(b[i].Content) || a[i].Completed != b[i].Completed {
+			return false
+		}
+	}
+	return true
+}
+
+// markdownImportPlan 一项的导入计划：existing 不为 nil 时更新它，否则创建 todo
+type markdownImportPlan struct {
+	result   csvImportRow
+	todo     models.Todo
+	existing *models.Todo
+}
+
+// importMarkdown 导入 Markdown 任务清单（ImportTodos 的 text/markdown 分支）。行尾有 <!-- todo:UUID -->
+// 注释的项更新对应的待办事项：任务文本、完成状态和步骤（步骤整体替换），所在标题与某个分类同名时
+// 同时移动到该分类；没有变化的项不写入。没有注释或 UUID 尚未使用的项创建新的待办事项。
+// 响应与 CSV 导入相同，row 为清单项所在的行号。
+func (h *EnhancedTodoHandler) importMarkdown(w http.ResponseWriter, r *http.Request, userID int, dryRun bool) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportBodySize))
+	if err != nil {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "Markdown is too large", "")
+		return
+	}
+	items, err := parseMarkdownChecklist(data)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error(), "")
+		return
+	}
+	if len(items) > maxImportRows {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Markdown has more than %d tasks", maxImportRows), "")
+		return
+	}
+
+	categories, err := h.Categories.GetCategories(userID)
+	if err != nil {
+		log.Printf("获取分类失败: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "Internal server error", "")
+		return
+	}
+	categoryNames := map[string]string{}
+	for _, category := range categories {
+		categoryNames[strings.ToLower(category.Name)] = category.Name
+	}
+
+	// 先解析每一项对应的待办事项，再在写入前读取撤销快照
+	plans := make([]markdownImportPlan, len(items))
+	seen := map[string]bool{}
+	var updateIDs []int
+	for i, item := range items {
+		plan := &plans[i]
+		plan.result.Row = item.line
+		category := categoryNames[strings.ToLower(item.heading)]
+		steps := item.steps
+		if steps == nil {
+			steps = []models.Step{}
+		}
+
+		if item.task == "" {
+			plan.result.Status = "error"
+			plan.result.Errors = []csvFieldError{{Field: "task", Message: "task is empty"}}
+			continue
+		}
+		if item.uuid != "" && seen[item.uuid] {
+			plan.result.Status = "error"
+			plan.result.Errors = []csvFieldError{{Field: "uuid", Message: "duplicate todo id"}}
+			continue
+		}
+
+		if item.uuid != "" {
+			seen[item.uuid] = true
+			existing, err := h.markdownExistingTodo(userID, item.uuid)
+			if err != nil {
+				plan.result.Status = "error"
+				plan.result.Errors = []csvFieldError{{Field: "uuid", Message: err.Error()}}
+				continue
+			}
+			if existing != nil {
+				plan.existing = existing
+				plan.result.ID = existing.ID
+				// 导出时任务和步骤的空白被合并为一个空格，按导出后的形式比较，相同时保留原来的文本
+				taskChanged := markdownText(existing.Task) != markdownText(item.task)
+				stepsChanged := !stepsEqual(existing.Steps, steps)
+				if !taskChanged && !stepsChanged && existing.Done == item.done &&
+					(category == "" || category == existing.Category) {
+					plan.result.Status = "unchanged"
+					continue
+				}
+				plan.todo = *existing
+				plan.todo.Done = item.done
+				if taskChanged {
+					plan.todo.Task = item.task
+				}
+				// 步骤没有变化时不传入步骤，避免重建步骤后ID和 UUID 改变
+				plan.todo.Steps = nil
+				if stepsChanged {
+					plan.todo.Steps = steps
+				}
+				// 由完成状态推导工作流状态，不修改自定义字段
+				plan.todo.Status, plan.todo.CustomFields = "", nil
+				if category != "" {
+					plan.todo.Category = category
+				}
+				updateIDs = append(updateIDs, existing.ID)
+				continue
+			}
+		}
+		plan.todo = models.Todo{UUID: item.uuid, Task: item.task, Done: item.done, Category: category, Tags: []string{}, Steps: steps}
+	}
+
+	var before map[int]models.Todo
+	if !dryRun {
+		if before, err = snapshotForUndo(h.Undo, userID, updateIDs...); err != nil {
+			log.Printf("读取撤销快照失败: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "Internal server error", "")
+			return
+		}
+	}
+
+	results := make([]csvImportRow, 0, len(plans))
+	counts := map[string]int{}
+	var changedIDs []int
+	for i := range plans {
+		plan := &plans[i]
+		result := &plan.result
+		switch {
+		case result.Status != "":
+		case dryRun:
+			plan.todo.UserID = userID
+			result.Status, result.Todo = "valid", &plan.todo
+		case plan.existing != nil:
+			if err := h.Model.UpdateTodoIfMatch(&plan.todo, userID, []int{plan.existing.Version}); err != nil {
+				result.Status = "error"
+				result.Errors = []csvFieldError{markdownWriteError(err)}
+				break
+			}
+			result.Status = "updated"
+			changedIDs = append(changedIDs, plan.todo.ID)
+		default:
+			plan.todo.UserID = userID
+			if err := h.Model.AddTodo(&plan.todo); err != nil {
+				result.Status = "error"
+				result.Errors = []csvFieldError{markdownWriteError(err)}
+				break
+			}
+			result.Status, result.ID = "imported", plan.todo.ID
+			changedIDs = append(changedIDs, plan.todo.ID)
+		}
+		counts[result.Status]++
+		results = append(results, *result)
+	}
+
+	response := map[string]interface{}{
+		"dryRun":    dryRun,
+		"total":     len(plans),
+		"valid":     counts["valid"],
+		"imported":  counts["imported"],
+		"updated":   counts["updated"],
+		"unchanged": counts["unchanged"],
+		"skipped":   counts["skipped"],
+		"failed":    counts["error"],
+		"rows":      results,
+	}
+	if len(changedIDs) > 0 {
+		if token := recordUndo(h.Undo, userID, models.UndoActionImport, before, changedIDs...); token != "" {
+			response["undoToken"] = token
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// markdownExistingTodo 查找注释中 UUID 对应的待办事项（包含步骤）。UUID 尚未使用时返回 nil，
+// 导入时用它创建新的待办事项；属于其他用户时返回错误
+func (h *EnhancedTodoHandler) markdownExistingTodo(userID int, uuid string) (*models.Todo, error) {
+	id, err := h.Model.ResolveTodoID(uuid)
+	if errors.Is(err, models.ErrTodoNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("解析待办事项ID失败: %v", err)
+		return nil, errors.New("failed to look up todo")
+	}
+	todo, err := h.Model.GetTodoByID(id)
+	if err != nil {
+		log.Printf("获取待办事项失败: %v", err)
+		return nil, errors.New("failed to look up todo")
+	}
+	if todo.UserID != userID {
+		return nil, errors.New("uuid already in use")
+	}
+	return todo, nil
+}
+
+// markdownWriteError 把写入时的错误转换为导入结果中的错误
+func markdownWriteError(err error) csvFieldError {
+	if errors.Is(err, models.ErrVersionConflict) {
+		return csvFieldError{Field: "uuid", Message: "todo was modified during import"}
+	}
+	return csvFieldError{Message: importAddError(err)}
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TodoList/models"
+)
+
+func TestEncodeTodoTxt(t *testing.T) {
+	created := time.Date(2024, 4, 30, 22, 0, 0, 0, time.UTC)
+	completed := time.Date(2024, 5, 2, 8, 0, 0, 0, time.UTC)
+	due := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	open := models.Todo{Task: "Call  mom\nabout trip", Priority: "high", Category: "Home renovation",
+		Tags: []string{"phone", "weekend plans"}, DueDate: &due, CreatedAt: created}
+	if got, want := encodeTodoTxt(open), "(A) 2024-04-30 Call mom about trip +Home_renovation @phone @weekend_plans due:2024-05-01"; got != want {
+		t.Errorf("open = %q, want %q", got, want)
+	}
+
+	done := models.Todo{Task: "Pay rent", Done: true, Priority: "medium", Category: "personal", CreatedAt: created, CompletedAt: &completed}
+	if got, want := encodeTodoTxt(done), "x 2024-05-02 2024-04-30 Pay rent +personal pri:B"; got != want {
+		t.Errorf("done = %q, want %q", got, want)
+	}
+
+	// 导出的行可以被 todo.txt 导入器读回
+	parsed, err := parseTodoTxtLine(encodeTodoTxt(done))
+	if err != nil || !parsed.Done || parsed.Priority != "medium" || parsed.Task != "Pay rent" || parsed.Category != "personal" {
+		t.Errorf("round trip = %+v, %v", parsed, err)
+	}
+}
+
+func TestMarkdownExportRoundTrip(t *testing.T) {
+	var b strings.Builder
+	encoder := newMarkdownEncoder(&b)
+	todos := []models.Todo{
+		{UUID: "0190f2a4-8c1e-7b3a-9f00-0123456789ab", Task: "Write plan", Category: "work",
+			Steps: []models.Step{{Content: "Outline", Completed: true}, {Content: "Draft"}}},
+		{UUID: "0190f2a4-8c1e-7b3a-9f00-0123456789ac", Task: "Ship", Done: true, Category: "work"},
+		{UUID: "0190f2a4-8c1e-7b3a-9f00-0123456789ad", Task: "Gym", Category: "health"},
+	}
+	for _, todo := range todos {
+		if err := encoder.Encode(todo); err != nil {
+			t.Fatal(err)
+		}
+	}
+	encoder.Flush()
+
+	want := "## work\n\n" +
+		"- [ ] Write plan <!-- todo:0190f2a4-8c1e-7b3a-9f00-0123456789ab -->\n" +
+		"  - [x] Outline\n" +
+		"  - [ ] Draft\n" +
+		"- [x] Ship <!-- todo:0190f2a4-8c1e-7b3a-9f00-0123456789ac -->\n" +
+		"\n## health\n\n" +
+		"- [ ] Gym <!-- todo:0190f2a4-8c1e-7b3a-9f00-0123456789ad -->\n"
+	if b.String() != want {
+		t.Fatalf("markdown =\n%s\nwant\n%s", b.String(), want)
+	}
+
+	items, err := parseMarkdownChecklist([]byte(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != len(todos) {
+		t.Fatalf("items = %+v", items)
+	}
+	for i, item := range items {
+		todo := todos[i]
+		if item.uuid != todo.UUID || item.task != todo.Task || item.done != todo.Done ||
+			item.heading != todo.Category || !stepsEqual(item.steps, todo.Steps) {
+			t.Errorf("item %d = %+v, want %+v", i, item, todo)
+		}
+	}
+}
+
+func TestParseMarkdownChecklist(t *testing.T) {
+	items, err := parseMarkdownChecklist([]byte("# My lists\n" +
+		"Some notes that are not tasks.\n" +
+		"* [X] Done thing\n" +
+		"\t- [ ] tab-indented step\n" +
+		"      + [x] deeper step\n" +
+		"- plain bullet, ignored\n" +
+		"- [ ]\n" +
+		"- [ ] Broken id <!-- todo:123 -->\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("items = %+v", items)
+	}
+	if first := items[0]; !first.done || first.task != "Done thing" || first.heading != "My lists" || first.line != 3 ||
+		len(first.steps) != 2 || first.steps[0].Completed || !first.steps[1].Completed {
+		t.Errorf("first = %+v", first)
+	}
+	if items[1].task != "" {
+		t.Errorf("empty item = %+v", items[1])
+	}
+	// 不是 UUID 的注释保留在任务文本中
+	if broken := items[2]; broken.uuid != "" || broken.task != "Broken id <!-- todo:123 -->" {
+		t.Errorf("broken = %+v", broken)
+	}
+}
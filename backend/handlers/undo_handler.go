@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/TodoList/models"
+)
+
+// UndoHandler 处理撤销相关的HTTP请求
+type UndoHandler struct {
+	Model *models.UndoModel
+}
+
+// NewUndoHandler 创建一个新的UndoHandler实例
+func NewUndoHandler(model *models.UndoModel) *UndoHandler {
+	return &UndoHandler{Model: model}
+}
+
+// undoableTodo 在待办事项的响应中附带撤销令牌
+type undoableTodo struct {
+	models.Todo
+	UndoToken string `json:"undoToken,omitempty"`
+}
+
+// snapshotForUndo 读取修改前的快照；没有配置撤销模型时返回 nil
+func snapshotForUndo(undo *models.UndoModel, userID int, ids ...int) (map[int]models.Todo, error) {
+	if undo == nil {
+		return nil, nil
+	}
+	return undo.Snapshot(userID, ids)
+}
+
+// recordUndo 在修改成功后保存撤销记录并返回令牌。修改已经生效，记录失败时只写日志、不返回令牌。
+func recordUndo(undo *models.UndoModel, userID int, action string, before map[int]models.Todo, ids ...int) string {
+	if undo == nil {
+		return ""
+	}
+	token, err := undo.Record(userID, action, before, ids)
+	if err != nil {
+		log.Printf("保存撤销记录失败: %v", err)
+		return ""
+	}
+	return token
+}
+
+// writeUndoToken 为没有响应体的修改输出 {"undoToken": ...}
+func writeUndoToken(w http.ResponseWriter, token string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"undoToken": token})
+}
+
+// Undo 执行撤销令牌对应的逆操作。受影响的待办事项之后又被编辑过时返回 409 和冲突列表，
+// 令牌过期或已经使用过时返回 410。
+func (h *UndoHandler) Undo(w http.ResponseWriter, r *http.Request, token string) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	result, err := h.Model.Undo(userID, token)
+	if err != nil {
+		var conflictErr *models.UndoConflictError
+		switch {
+		case errors.As(err, &conflictErr):
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":     "Todos have been modified since this change",
+				"conflicts": conflictErr.Conflicts,
+			})
+		case errors.Is(err, models.ErrUndoNotFound):
+			writeJSONError(w, http.StatusNotFound, "Undo token not found", "")
+		case errors.Is(err, models.ErrUndoExpired):
+			writeJSONError(w, http.StatusGone, "Undo window has expired", "")
+		case errors.Is(err, models.ErrUndoUsed):
+			writeJSONError(w, http.StatusGone, "Change has already been undone", "")
+		default:
+			log.Printf("撤销失败: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "Internal server error", "")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -256,6 +257,21 @@ func (h *UserHandler) GetAllUsers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 带 cursor/limit 时分页返回
+	if wantsCursorPage(r) {
+		users, info, err := h.Model.ListUsers(parsePageRequest(r))
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidCursor) {
+				http.Error(w, "Invalid cursor", http.StatusBadRequest)
+				return
+			}
+			http.Error(w, "Failed to get users", http.StatusInternalServerError)
+			return
+		}
+		writeCursorPage(w, r, users, info, nil)
+		return
+	}
+
 	// 获取所有用户
 	users, err := h.Model.GetAllUsers()
 	if err != nil {
@@ -347,16 +363,33 @@ func (h *UserHandler) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// StreamAuthMiddleware SSE 和 WebSocket 使用的认证中间件。浏览器的 EventSource 和 WebSocket
+// 不能设置 Authorization 请求头，因此也接受 access_token 查询参数中的令牌
+func (h *UserHandler) StreamAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	auth := h.AuthMiddleware(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			if token := r.URL.Query().Get("access_token"); token != "" {
+				r.Header.Set("Authorization", "Bearer "+token)
+			}
+		}
+		auth(w, r)
+	}
+}
+
 // AdminMiddleware 管理员中间件
 func (h *UserHandler) AdminMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// 验证令牌
-		_, isAdmin, err := h.validateToken(r)
+		userID, isAdmin, err := h.validateToken(r)
 		if err != nil || !isAdmin {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
+		// 将管理员的用户ID添加到请求上下文，幂等键按管理员区分
+		r = r.WithContext(context.WithValue(r.Context(), "userID", userID))
+
 		// 调用下一个处理器
 		next(w, r)
 	}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/TodoList/models"
+)
+
+// maxWebhookDeliveries 投递日志每次最多返回的条数
+const maxWebhookDeliveries = 100
+
+// WebhookHandler 处理 webhook 订阅和投递日志相关的HTTP请求。用户管理自己的订阅
+// （/api/v2/webhooks），管理员管理接收所有用户事件的全局订阅（/api/admin/webhooks）
+type WebhookHandler struct {
+	Model *models.WebhookModel
+}
+
+// NewWebhookHandler 创建一个新的WebhookHandler实例
+func NewWebhookHandler(model *models.WebhookModel) *WebhookHandler {
+	return &WebhookHandler{Model: model}
+}
+
+// CreateWebhookRequest 创建 webhook 请求
+type CreateWebhookRequest struct {
+	URL         string   `json:"url"`
+	Events      []string `json:"events"` // 为空表示所有事件
+	Description string   `json:"description"`
+}
+
+// ServeUser 处理 /api/v2/webhooks 下的请求，操作当前用户的订阅
+func (h *WebhookHandler) ServeUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	h.serve(w, r, userID, strings.TrimPrefix(r.URL.Path, "/api/v2/webhooks"))
+}
+
+// ServeAdmin 处理 /api/admin/webhooks 下的请求，操作管理员的全局订阅
+func (h *WebhookHandler) ServeAdmin(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r, 0, strings.TrimPrefix(r.URL.Path, "/api/admin/webhooks"))
+}
+
+// serve 按路径分发请求：
+//
+//	/                                  GET 列表，POST 创建
+//	/{id}                              GET、PATCH、DELETE
+//	/{id}/deliveries                   GET 投递日志（status、limit 参数）
+//	/{id}/deliveries/{deliveryID}      GET 投递详情，包含负载和响应内容
+//	/{id}/deliveries/{deliveryID}/redeliver  POST 重新投递
+func (h *WebhookHandler) serve(w http.ResponseWriter, r *http.Request, userID int, path string) {
+	var parts []string
+	if path = strings.Trim(path, "/"); path != "" {
+		parts = strings.Split(path, "/")
+	}
+
+	if len(parts) == 0 {
+		switch r.Method {
+		case http.MethodGet:
+			h.list(w, userID)
+		case http.MethodPost:
+			h.create(w, r, userID)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+	if len(parts) == 1 {
+		switch r.Method {
+		case http.MethodGet:
+			h.get(w, userID, id)
+		case http.MethodPatch:
+			h.update(w, r, userID, id)
+		case http.MethodDelete:
+			h.delete(w, userID, id)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	if parts[1] != "deliveries" || len(parts) > 4 || (len(parts) == 4 && parts[3] != "redeliver") {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if len(parts) == 2 {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.deliveries(w, r, userID, id)
+		return
+	}
+
+	deliveryID, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid delivery ID", http.StatusBadRequest)
+		return
+	}
+	switch {
+	case len(parts) == 3 && r.Method == http.MethodGet:
+		h.delivery(w, userID, id, deliveryID)
+	case len(parts) == 4 && r.Method == http.MethodPost:
+		h.redeliver(w, userID, id, deliveryID)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// writeWebhookError 输出 webhook 操作的错误
+func writeWebhookError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrWebhookNotFound):
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+	case errors.Is(err, models.ErrWebhookDeliveryNotFound):
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+	case errors.Is(err, models.ErrInvalidWebhookURL):
+		writeJSONError(w, http.StatusBadRequest, "URL must be an absolute http or https URL and must not point to a private address", "url")
+	case errors.Is(err, models.ErrInvalidWebhookEvent):
+		writeJSONError(w, http.StatusBadRequest, "Unknown event type, must be one of "+strings.Join(models.WebhookEvents, ", "), "events")
+	case errors.Is(err, models.ErrInvalidWebhookDescription):
+		writeJSONError(w, http.StatusBadRequest, "Description must be at most 100 characters", "description")
+	case errors.Is(err, models.ErrWebhookDisabled):
+		writeJSONError(w, http.StatusConflict, "Webhook is disabled, enable it before redelivering", "")
+	default:
+		log.Printf("webhook 操作失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// writeWebhookJSON 输出 JSON 响应
+func writeWebhookJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// list 列出订阅（不包含签名密钥）
+func (h *WebhookHandler) list(w http.ResponseWriter, userID int) {
+	hooks, err := h.Model.List(userID)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	writeWebhookJSON(w, http.StatusOK, hooks)
+}
+
+// create 创建订阅，响应中的签名密钥只返回这一次
+func (h *WebhookHandler) create(w http.ResponseWriter, r *http.Request, userID int) {
+	var req CreateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	hook := &models.Webhook{URL: req.URL, Events: req.Events, Description: req.Description}
+	if err := h.Model.Create(userID, hook); err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeWebhookJSON(w, http.StatusCreated, hook)
+}
+
+// get 获取订阅
+func (h *WebhookHandler) get(w http.ResponseWriter, userID, id int) {
+	hook, err := h.Model.Get(userID, id)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	writeWebhookJSON(w, http.StatusOK, hook)
+}
+
+// update 修改订阅：url、events、description、enabled（重新启用被自动停用的订阅），
+// rotateSecret=true 时生成新的签名密钥并在响应中返回
+func (h *WebhookHandler) update(w http.ResponseWriter, r *http.Request, userID, id int) {
+	var req models.WebhookUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	hook, err := h.Model.Update(userID, id, req)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	if req.RotateSecret {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+	writeWebhookJSON(w, http.StatusOK, hook)
+}
+
+// delete 删除订阅及其投递日志
+func (h *WebhookHandler) delete(w http.ResponseWriter, userID, id int) {
+	if err := h.Model.Delete(userID, id); err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deliveries 列出最近的投递（status=pending|delivered|failed 过滤，limit 最大 100）
+func (h *WebhookHandler) deliveries(w http.ResponseWriter, r *http.Request, userID, id int) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", models.WebhookDeliveryPending, models.WebhookDeliveryDelivered, models.WebhookDeliveryFailed:
+	default:
+		writeJSONError(w, http.StatusBadRequest, "status must be pending, delivered or failed", "status")
+		return
+	}
+	limit := getQueryParamInt(r, "limit", maxWebhookDeliveries)
+	if limit <= 0 || limit > maxWebhookDeliveries {
+		limit = maxWebhookDeliveries
+	}
+
+	deliveries, err := h.Model.Deliveries(userID, id, status, limit)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	writeWebhookJSON(w, http.StatusOK, deliveries)
+}
+
+// delivery 获取一次投递的详情
+func (h *WebhookHandler) delivery(w http.ResponseWriter, userID, id int, deliveryID int64) {
+	delivery, err := h.Model.Delivery(userID, id, deliveryID)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	writeWebhookJSON(w, http.StatusOK, delivery)
+}
+
+// redeliver 重新投递，返回 202 和新的投递
+func (h *WebhookHandler) redeliver(w http.ResponseWriter, userID, id int, deliveryID int64) {
+	delivery, err := h.Model.Redeliver(userID, id, deliveryID)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	writeWebhookJSON(w, http.StatusAccepted, delivery)
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TodoList/models"
+)
+
+func TestWebSocketAccept(t *testing.T) {
+	// RFC 6455 1.3 中的示例
+	if got := websocketAccept("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("websocketAccept = %s", got)
+	}
+}
+
+// maskedFrame 构造一个客户端发送的带掩码的帧
+func maskedFrame(opcode byte, payload []byte) []byte {
+	var server bytes.Buffer
+	writeWebSocketFrame(&server, opcode, payload)
+	frame := server.Bytes()
+
+	headerLen := len(frame) - len(payload)
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	out := append([]byte{}, frame[:headerLen]...)
+	out[1] |= 0x80
+	out = append(out, mask...)
+	for i, b := range payload {
+		out = append(out, b^mask[i%4])
+	}
+	return out
+}
+
+func TestWebSocketFrames(t *testing.T) {
+	for _, size := range []int{0, 5, 125, 126, 300, 70000} {
+		payload := bytes.Repeat([]byte("x"), size)
+		opcode, got, err := readWebSocketFrame(bytes.NewReader(maskedFrame(wsOpText, payload)))
+		if size > maxWebSocketFrameSize {
+			if err == nil {
+				t.Errorf("size %d: expected frame too large error", size)
+			}
+			continue
+		}
+		if err != nil || opcode != wsOpText || !bytes.Equal(got, payload) {
+			t.Errorf("size %d: opcode %d, %d bytes, err %v", size, opcode, len(got), err)
+		}
+	}
+
+	var unmasked bytes.Buffer
+	writeWebSocketFrame(&unmasked, wsOpPing, []byte("hi"))
+	if _, _, err := readWebSocketFrame(&unmasked); err == nil {
+		t.Error("unmasked client frame accepted")
+	}
+}
+
+func TestWriteSSEEvent(t *testing.T) {
+	version := 3
+	event := models.Event{ID: 42, UserID: 1, Type: "todo.updated", TodoID: 7, Version: &version, CreatedAt: time.Unix(0, 0).UTC()}
+
+	var buf bytes.Buffer
+	if err := writeSSEEvent(&buf, event); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	if !strings.HasPrefix(got, "id: 42\nevent: todo.updated\ndata: {") || !strings.HasSuffix(got, "}\n\n") {
+		t.Errorf("event = %q", got)
+	}
+	if !strings.Contains(got, `"todoId":7`) || !strings.Contains(got, `"version":3`) || strings.Contains(got, "stepId") {
+		t.Errorf("event data = %q", got)
+	}
+}
+
+func TestLastEventID(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/v2/events?lastEventId=9", nil)
+	if got := lastEventID(r); got != 9 {
+		t.Errorf("query lastEventId = %d", got)
+	}
+	r.Header.Set("Last-Event-ID", "12")
+	if got := lastEventID(r); got != 12 {
+		t.Errorf("Last-Event-ID = %d", got)
+	}
+	r.Header.Set("Last-Event-ID", "abc")
+	if got := lastEventID(r); got != 0 {
+		t.Errorf("invalid Last-Event-ID = %d", got)
+	}
+}
@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/TodoList/models"
+)
+
+// WorkflowHandler 处理工作流状态和看板相关的HTTP请求
+type WorkflowHandler struct {
+	Model *models.WorkflowModel
+	Undo  *models.UndoModel
+}
+
+// NewWorkflowHandler 创建一个新的WorkflowHandler实例
+func NewWorkflowHandler(model *models.WorkflowModel, undo *models.UndoModel) *WorkflowHandler {
+	return &WorkflowHandler{Model: model, Undo: undo}
+}
+
+// SetStatusRequest 移动待办事项到指定状态的请求
+type SetStatusRequest struct {
+	Status string `json:"status"`
+	Force  bool   `json:"force"` // 忽略WIP上限
+}
+
+// GetStates 获取当前用户的工作流状态
+func (h *WorkflowHandler) GetStates(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	states, err := h.Model.GetStates(userID)
+	if err != nil {
+		log.Printf("获取工作流状态失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(states)
+}
+
+// CreateState 创建工作流状态
+func (h *WorkflowHandler) CreateState(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var state models.WorkflowState
+	if err := json.NewDecoder(r.Body).Decode(&state); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !models.KeyPattern.MatchString(state.Key) {
+		http.Error(w, "Invalid state key", http.StatusBadRequest)
+		return
+	}
+	if msg := validateState(&state); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	state.UserID = userID
+	if err := h.Model.CreateState(&state); err != nil {
+		if errors.Is(err, models.ErrDuplicateState) {
+			http.Error(w, "State already exists", http.StatusConflict)
+			return
+		}
+		log.Printf("创建工作流状态失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(state)
+}
+
+// UpdateState 更新工作流状态
+func (h *WorkflowHandler) UpdateState(w http.ResponseWriter, r *http.Request, stateID int) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var state models.WorkflowState
+	if err := json.NewDecoder(r.Body).Decode(&state); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if msg := validateState(&state); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	state.ID = stateID
+	state.UserID = userID
+	if err := h.Model.UpdateState(&state); err != nil {
+		if errors.Is(err, models.ErrUnknownStatus) {
+			http.Error(w, "State not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("更新工作流状态失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
+
+// DeleteState 删除工作流状态，其中的待办事项移动到 ?moveTo= 指定的状态
+func (h *WorkflowHandler) DeleteState(w http.ResponseWriter, r *http.Request, stateID int) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	err := h.Model.DeleteState(userID, stateID, r.URL.Query().Get("moveTo"))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrUnknownStatus):
+			http.Error(w, "State not found", http.StatusNotFound)
+		case errors.Is(err, models.ErrLastState):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			log.Printf("删除工作流状态失败: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// GetBoard 获取按工作流状态分组的看板
+func (h *WorkflowHandler) GetBoard(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	columns, err := h.Model.GetBoard(userID)
+	if err != nil {
+		log.Printf("获取看板失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"columns": columns,
+	})
+}
+
+// SetTodoStatus 将待办事项移动到指定状态
+func (h *WorkflowHandler) SetTodoStatus(w http.ResponseWriter, r *http.Request, todoID int) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req SetStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	before, err := snapshotForUndo(h.Undo, userID, todoID)
+	if err != nil {
+		log.Printf("读取撤销快照失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	todo, err := h.Model.SetTodoStatus(todoID, userID, req.Status, req.Force)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrUnknownStatus):
+			http.Error(w, "Unknown status", http.StatusBadRequest)
+		case errors.Is(err, models.ErrWIPLimitReached):
+			http.Error(w, "WIP limit reached for this column", http.StatusConflict)
+		case errors.Is(err, models.ErrTodoNotFound):
+			http.Error(w, "Todo not found", http.StatusNotFound)
+		case err.Error() == "unauthorized: todo does not belong to user":
+			http.Error(w, "Unauthorized: You can only update your own todos", http.StatusForbidden)
+		default:
+			log.Printf("修改任务状态失败: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+	undoToken := recordUndo(h.Undo, userID, models.UndoActionUpdate, before, todoID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(undoableTodo{Todo: *todo, UndoToken: undoToken})
+}
+
+// GetTransitions 获取待办事项的状态流转记录和周期时间
+func (h *WorkflowHandler) GetTransitions(w http.ResponseWriter, r *http.Request, todoID int) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	transitions, err := h.Model.GetTransitions(todoID, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrTodoNotFound) {
+			http.Error(w, "Todo not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("获取状态流转失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	states, err := h.Model.GetStates(userID)
+	if err != nil {
+		log.Printf("获取工作流状态失败: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"transitions": transitions,
+		"cycleTime":   nil,
+	}
+	if d := models.CycleTime(transitions, states); d != nil {
+		response["cycleTime"] = int64(d.Seconds()) // 秒
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// validateState 校验工作流状态的可编辑字段，返回错误信息
+func validateState(state *models.WorkflowState) string {
+	if state.Name == "" || len([]rune(state.Name)) > 50 {
+		return "State name must be 1-50 characters"
+	}
+	if state.WIPLimit != nil && *state.WIPLimit < 1 {
+		return "WIP limit must be positive"
+	}
+	if state.Color != "" && !models.IsValidColor(state.Color) {
+		return "Color must be #RGB or #RRGGBB"
+	}
+	return ""
+}
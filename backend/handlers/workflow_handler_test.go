@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/TodoList/models"
+)
+
+func TestValidateState(t *testing.T) {
+	zero := 0
+	tests := []struct {
+		state models.WorkflowState
+		valid bool
+	}{
+		{models.WorkflowState{Name: "Doing"}, true},
+		{models.WorkflowState{Name: "Doing", Color: "#1890ff"}, true},
+		{models.WorkflowState{Name: "Doing", Color: "#fff"}, true},
+		{models.WorkflowState{Name: ""}, false},
+		{models.WorkflowState{Name: strings.Repeat("x", 51)}, false},
+		{models.WorkflowState{Name: "Doing", WIPLimit: &zero}, false},
+		{models.WorkflowState{Name: "Doing", Color: "blue"}, false},
+		// 超过 color VARCHAR(20) 的值在写入数据库之前被拒绝
+		{models.WorkflowState{Name: "Doing", Color: "#" + strings.Repeat("f", 30)}, false},
+	}
+	for _, tt := range tests {
+		state := tt.state
+		if msg := validateState(&state); (msg == "") != tt.valid {
+			t.Errorf("validateState(%+v) = %q", tt.state, msg)
+		}
+	}
+}
@@ -1,12 +1,13 @@
 package main
 
 import (
-	"encoding/json"
 	"log"
 	"net/http"
+	"net/netip"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/TodoList/config"
 	"github.com/TodoList/handlers"
@@ -44,6 +45,52 @@ func main() {
 	// 创建模型
 	todoModel := models.NewTodoModel(db)
 	userModel := models.NewUserModel(db)
+	workflowModel := models.NewWorkflowModel(db)
+	customFieldModel := models.NewCustomFieldModel(db)
+	tagModel := models.NewTagModel(db)
+	categoryModel := models.NewCategoryModel(db)
+	savedFilterModel := models.NewSavedFilterModel(db)
+	searchModel := models.NewSearchModel(db)
+	undoModel := models.NewUndoModel(db, undoWindow())
+	idempotencyModel := models.NewIdempotencyModel(db)
+	eventBus := models.NewEventBus(db)
+	syncModel := models.NewSyncModel(db)
+	backupModel := models.NewBackupModel(db)
+	calendarFeedModel := models.NewCalendarFeedModel(db)
+	appPasswordModel := models.NewAppPasswordModel(db)
+	caldavModel := models.NewCalDAVModel(db, todoModel, appPasswordModel)
+	importJobModel := models.NewImportJobModel(db)
+	webhookModel := models.NewWebhookModel(db)
+	inboundMailModel := models.NewInboundMailModel(db, todoModel)
+	attachmentModel := models.NewAttachmentModel(db)
+
+	// 监听数据库的变更通知，推送给本实例的 SSE / WebSocket 连接
+	go func() {
+		if err := eventBus.Listen(config.DefaultDBConfig().ConnectionString()); err != nil {
+			log.Printf("事件监听启动失败: %v\n", err)
+		}
+	}()
+
+	// 从数据库中的队列投递 webhook，并为过期的待办事项加入 todo.overdue 事件
+	go models.NewWebhookDispatcher(db, webhookAllowedNetworks()...).Run()
+
+	// 收件 SMTP 服务：INBOUND_SMTP_ADDR（例如 ":2525"）为空时不启动，发往 <令牌>@INBOUND_MAIL_DOMAIN 的邮件成为待办事项
+	inboundMailDomain := os.Getenv("INBOUND_MAIL_DOMAIN")
+	if addr := os.Getenv("INBOUND_SMTP_ADDR"); addr != "" {
+		go func() {
+			log.Printf("收件 SMTP 服务运行在 %s", addr)
+			if err := handlers.NewSMTPServer(inboundMailModel, inboundMailDomain).ListenAndServe(addr); err != nil {
+				log.Printf("收件 SMTP 服务启动失败: %v\n", err)
+			}
+		}()
+	}
+
+	// 服务重启前没有执行完的导入任务不会再继续，标记为失败
+	if n, err := importJobModel.FailInterrupted(); err != nil {
+		log.Printf("清理未完成的导入任务失败: %v\n", err)
+	} else if n > 0 {
+		log.Printf("%d 个未完成的导入任务已标记为失败", n)
+	}
 
 	// 初始化管理员用户
 	if err := userModel.InitAdminUser(); err != nil {
@@ -51,9 +98,27 @@ func main() {
 	}
 
 	// 创建处理器
-	todoHandler := handlers.NewTodoHandler(todoModel)
-	enhancedTodoHandler := handlers.NewEnhancedTodoHandler(todoModel)
+	todoHandler := handlers.NewTodoHandler(todoModel, undoModel)
+	enhancedTodoHandler := handlers.NewEnhancedTodoHandler(todoModel, undoModel)
 	userHandler := handlers.NewUserHandler(userModel, jwtSecret)
+	workflowHandler := handlers.NewWorkflowHandler(workflowModel, undoModel)
+	customFieldHandler := handlers.NewCustomFieldHandler(customFieldModel)
+	tagHandler := handlers.NewTagHandler(tagModel)
+	categoryHandler := handlers.NewCategoryHandler(categoryModel)
+	savedFilterHandler := handlers.NewSavedFilterHandler(savedFilterModel, enhancedTodoHandler)
+	searchHandler := handlers.NewSearchHandler(searchModel)
+	undoHandler := handlers.NewUndoHandler(undoModel)
+	idempotencyHandler := handlers.NewIdempotencyHandler(idempotencyModel)
+	eventHandler := handlers.NewEventHandler(eventBus)
+	syncHandler := handlers.NewSyncHandler(syncModel, todoModel)
+	backupHandler := handlers.NewBackupHandler(backupModel)
+	calendarHandler := handlers.NewCalendarHandler(calendarFeedModel, enhancedTodoHandler)
+	appPasswordHandler := handlers.NewAppPasswordHandler(appPasswordModel)
+	caldavHandler := handlers.NewCalDAVHandler(caldavModel)
+	importHandler := handlers.NewImportHandler(importJobModel, todoModel, undoModel)
+	webhookHandler := handlers.NewWebhookHandler(webhookModel)
+	inboundMailHandler := handlers.NewInboundMailHandler(inboundMailModel, attachmentModel, inboundMailDomain)
+	idResolver := handlers.NewIDResolver(todoModel, userModel)
 
 	// 用户认证路由
 	http.HandleFunc("/api/login", handlers.EnableCORS(userHandler.Login))
@@ -62,7 +127,7 @@ func main() {
 	http.HandleFunc("/api/users", handlers.EnableCORS(userHandler.AdminMiddleware(userHandler.GetAllUsers)))
 
 	// 主要的待办事项路由
-	http.HandleFunc("/api/todos", handlers.EnableCORS(userHandler.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/api/todos", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
 			todoHandler.GetAllTodos(w, r)
@@ -71,10 +136,10 @@ func main() {
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
-	})))
+	}))))
 
-	// 特定待办事项的路由（带ID）
-	http.HandleFunc("/api/todos/", handlers.EnableCORS(userHandler.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+	// 特定待办事项的路由（带ID，整数ID或 UUID）
+	http.HandleFunc("/api/todos/", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(idResolver.Middleware(func(w http.ResponseWriter, r *http.Request) {
 		path := r.URL.Path
 
 		// 提取路径中的ID
@@ -88,6 +153,13 @@ func main() {
 		if len(pathParts) >= 4 && pathParts[3] == "steps" {
 			// 处理步骤相关的请求 /api/todos/{id}/steps
 			switch r.Method {
+			case http.MethodGet:
+				todoID, err := strconv.Atoi(pathParts[2])
+				if err != nil {
+					http.Error(w, "Invalid todo ID", http.StatusBadRequest)
+					return
+				}
+				todoHandler.GetSteps(w, r, todoID)
 			case http.MethodPost:
 				todoHandler.AddStep(w, r)
 			case http.MethodPut:
@@ -110,34 +182,36 @@ func main() {
 				todoHandler.GetTodoByID(w, r, todoID)
 			case http.MethodPut:
 				todoHandler.UpdateTodo(w, r)
+			case http.MethodPatch:
+				todoHandler.PatchTodo(w, r, todoID)
 			case http.MethodDelete:
 				todoHandler.DeleteTodo(w, r)
 			default:
 				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			}
 		}
-	})))
+	})))))
 
 	// 切换任务状态
-	http.HandleFunc("/api/toggle", handlers.EnableCORS(userHandler.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/api/toggle", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodPost {
 			todoHandler.ToggleTodo(w, r)
 		} else {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
-	})))
+	}))))
 
 	// 切换步骤状态
-	http.HandleFunc("/api/toggle-step", handlers.EnableCORS(userHandler.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/api/toggle-step", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodPost {
 			todoHandler.ToggleStep(w, r)
 		} else {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
-	})))
+	}))))
 
 	// 管理员查看用户待办事项路由
-	http.HandleFunc("/api/admin/user-todos/", handlers.EnableCORS(userHandler.AdminMiddleware(func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/api/admin/user-todos/", handlers.EnableCORS(userHandler.AdminMiddleware(idResolver.Middleware(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
@@ -157,28 +231,45 @@ func main() {
 		}
 
 		// 获取指定用户的待办事项
-		todos, err := todoModel.GetAllTodos(userID)
+		todoHandler.GetUserTodos(w, r, userID)
+	}))))
+
+	// 管理员备份和恢复用户账户路由 /api/admin/user-backups/{userID}
+	http.HandleFunc("/api/admin/user-backups/", handlers.EnableCORS(userHandler.AdminMiddleware(idempotencyHandler.Middleware(idResolver.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(pathParts) < 4 {
+			http.Error(w, "Invalid path", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := strconv.Atoi(pathParts[3])
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(todos)
-	})))
+		switch r.Method {
+		case http.MethodGet:
+			backupHandler.Export(w, r, userID)
+		case http.MethodPost:
+			backupHandler.Restore(w, r, userID)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))))
 
 	// 增强API路由
-	http.HandleFunc("/api/v2/todos", handlers.EnableCORS(userHandler.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/api/v2/todos", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
 			enhancedTodoHandler.GetTodosWithFilter(w, r)
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
-	})))
+	}))))
 
 	// 批量操作路由
-	http.HandleFunc("/api/v2/todos/batch", handlers.EnableCORS(userHandler.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/api/v2/todos/batch", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodPut:
 			enhancedTodoHandler.BatchUpdate(w, r)
@@ -187,18 +278,496 @@ func main() {
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
-	})))
+	}))))
 
 	// 统计信息路由
-	http.HandleFunc("/api/v2/todos/stats", handlers.EnableCORS(userHandler.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/api/v2/todos/stats", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
 			enhancedTodoHandler.GetTodoStats(w, r)
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
+	}))))
+
+	// 导入导出路由
+	http.HandleFunc("/api/v2/todos/export", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			enhancedTodoHandler.ExportTodos(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))))
+
+	http.HandleFunc("/api/v2/todos/import", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			enhancedTodoHandler.ImportTodos(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))))
+
+	// 单个任务的增强路由 /api/v2/todos/{id}/status, /api/v2/todos/{id}/transitions,
+	// /api/v2/todos/{id}/attachments, /api/v2/todos/{id}/attachments/{attachmentID}
+	http.HandleFunc("/api/v2/todos/", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(idResolver.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(pathParts) != 5 && !(len(pathParts) == 6 && pathParts[4] == "attachments") {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+
+		todoID, err := strconv.Atoi(pathParts[3])
+		if err != nil {
+			http.Error(w, "Invalid todo ID", http.StatusBadRequest)
+			return
+		}
+
+		if len(pathParts) == 6 {
+			attachmentID, err := strconv.Atoi(pathParts[5])
+			if err != nil {
+				http.Error(w, "Invalid attachment ID", http.StatusBadRequest)
+				return
+			}
+			if r.Method == http.MethodGet {
+				inboundMailHandler.DownloadAttachment(w, r, todoID, attachmentID)
+			} else {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+
+		switch {
+		case pathParts[4] == "status" && r.Method == http.MethodPut:
+			workflowHandler.SetTodoStatus(w, r, todoID)
+		case pathParts[4] == "transitions" && r.Method == http.MethodGet:
+			workflowHandler.GetTransitions(w, r, todoID)
+		case pathParts[4] == "attachments" && r.Method == http.MethodGet:
+			inboundMailHandler.GetAttachments(w, r, todoID)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))))
+
+	// 工作流状态路由
+	http.HandleFunc("/api/v2/workflow/states", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			workflowHandler.GetStates(w, r)
+		case http.MethodPost:
+			workflowHandler.CreateState(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))))
+
+	http.HandleFunc("/api/v2/workflow/states/", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(pathParts) != 5 {
+			http.Error(w, "Invalid path", http.StatusBadRequest)
+			return
+		}
+
+		stateID, err := strconv.Atoi(pathParts[4])
+		if err != nil {
+			http.Error(w, "Invalid state ID", http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPut:
+			workflowHandler.UpdateState(w, r, stateID)
+		case http.MethodDelete:
+			workflowHandler.DeleteState(w, r, stateID)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))))
+
+	// 看板路由
+	http.HandleFunc("/api/v2/board", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			workflowHandler.GetBoard(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))))
+
+	// 自定义字段路由
+	http.HandleFunc("/api/v2/custom-fields", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			customFieldHandler.GetDefinitions(w, r)
+		case http.MethodPost:
+			customFieldHandler.CreateDefinition(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))))
+
+	http.HandleFunc("/api/v2/custom-fields/", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(pathParts) != 4 {
+			http.Error(w, "Invalid path", http.StatusBadRequest)
+			return
+		}
+
+		fieldID, err := strconv.Atoi(pathParts[3])
+		if err != nil {
+			http.Error(w, "Invalid custom field ID", http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPut:
+			customFieldHandler.UpdateDefinition(w, r, fieldID)
+		case http.MethodDelete:
+			customFieldHandler.DeleteDefinition(w, r, fieldID)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))))
+
+	// 标签目录路由
+	http.HandleFunc("/api/v2/tags", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			tagHandler.GetTags(w, r)
+		case http.MethodPost:
+			tagHandler.CreateTag(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))))
+
+	// 标签操作路由 /api/v2/tags/{id}, /api/v2/tags/rename, /api/v2/tags/merge
+	http.HandleFunc("/api/v2/tags/", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(pathParts) != 4 {
+			http.Error(w, "Invalid path", http.StatusBadRequest)
+			return
+		}
+
+		switch pathParts[3] {
+		case "rename":
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			tagHandler.RenameTag(w, r)
+			return
+		case "merge":
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			tagHandler.MergeTags(w, r)
+			return
+		}
+
+		tagID, err := strconv.Atoi(pathParts[3])
+		if err != nil {
+			http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPut:
+			tagHandler.UpdateTag(w, r, tagID)
+		case http.MethodDelete:
+			tagHandler.DeleteTag(w, r, tagID)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))))
+
+	// 分类路由
+	http.HandleFunc("/api/v2/categories", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			categoryHandler.GetCategories(w, r)
+		case http.MethodPost:
+			categoryHandler.CreateCategory(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))))
+
+	http.HandleFunc("/api/v2/categories/", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(pathParts) != 4 {
+			http.Error(w, "Invalid path", http.StatusBadRequest)
+			return
+		}
+
+		categoryID, err := strconv.Atoi(pathParts[3])
+		if err != nil {
+			http.Error(w, "Invalid category ID", http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPut:
+			categoryHandler.UpdateCategory(w, r, categoryID)
+		case http.MethodDelete:
+			categoryHandler.DeleteCategory(w, r, categoryID)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))))
+
+	// 保存的过滤器路由
+	http.HandleFunc("/api/v2/saved-filters", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			savedFilterHandler.GetSavedFilters(w, r)
+		case http.MethodPost:
+			savedFilterHandler.CreateSavedFilter(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))))
+
+	http.HandleFunc("/api/v2/saved-filters/", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(pathParts) != 4 {
+			http.Error(w, "Invalid path", http.StatusBadRequest)
+			return
+		}
+
+		filterID, err := strconv.Atoi(pathParts[3])
+		if err != nil {
+			http.Error(w, "Invalid saved filter ID", http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPut:
+			savedFilterHandler.UpdateSavedFilter(w, r, filterID)
+		case http.MethodDelete:
+			savedFilterHandler.DeleteSavedFilter(w, r, filterID)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))))
+
+	// 智能列表路由
+	http.HandleFunc("/api/v2/smart-lists", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			savedFilterHandler.GetSmartLists(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))))
+
+	// 全文搜索路由
+	http.HandleFunc("/api/v2/search", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			searchHandler.Search(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))))
+
+	// 撤销路由 /api/v2/undo/{token}
+	http.HandleFunc("/api/v2/undo/", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(pathParts) != 4 || pathParts[3] == "" {
+			http.Error(w, "Invalid path", http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPost:
+			undoHandler.Undo(w, r, pathParts[3])
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))))
+
+	// 实时事件路由（SSE），EventSource 不能设置请求头，也接受 access_token 查询参数
+	http.HandleFunc("/api/v2/events", handlers.EnableCORS(userHandler.StreamAuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			eventHandler.Stream(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
 	})))
 
+	// 实时事件路由（WebSocket）
+	http.HandleFunc("/api/v2/events/ws", handlers.EnableCORS(userHandler.StreamAuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		eventHandler.WebSocket(w, r)
+	})))
+
+	// 离线同步路由：GET 拉取变更，POST 推送离线修改
+	http.HandleFunc("/api/v2/sync", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			syncHandler.Changes(w, r)
+		case http.MethodPost:
+			syncHandler.Push(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))))
+
+	// 账户备份路由：GET 导出当前账户，POST 恢复备份（mode=merge|replace）
+	http.HandleFunc("/api/v2/backup", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			backupHandler.ExportAccount(w, r)
+		case http.MethodPost:
+			backupHandler.RestoreAccount(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))))
+
+	// 日历订阅管理路由：GET 获取订阅链接，POST /rotate 轮换令牌
+	http.HandleFunc("/api/v2/calendar-feed", handlers.EnableCORS(userHandler.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			calendarHandler.GetFeed(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	http.HandleFunc("/api/v2/calendar-feed/rotate", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			calendarHandler.RotateFeed(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))))
+
+	// 日历订阅 /api/calendar/{token}.ics：不需要登录，令牌就是凭据
+	http.HandleFunc("/api/calendar/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		name := strings.TrimPrefix(r.URL.Path, "/api/calendar/")
+		if !strings.HasSuffix(name, ".ics") || strings.Contains(name, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		calendarHandler.Feed(w, r, strings.TrimSuffix(name, ".ics"))
+	})
+
+	// 应用专用密码路由：GET 列表，POST 创建，DELETE /{id} 撤销
+	http.HandleFunc("/api/v2/app-passwords", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			appPasswordHandler.GetAppPasswords(w, r)
+		case http.MethodPost:
+			appPasswordHandler.CreateAppPassword(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))))
+
+	http.HandleFunc("/api/v2/app-passwords/", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/v2/app-passwords/"))
+		if err != nil {
+			http.Error(w, "Invalid app password ID", http.StatusBadRequest)
+			return
+		}
+		if r.Method == http.MethodDelete {
+			appPasswordHandler.DeleteAppPassword(w, r, id)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))))
+
+	// 从其他工具导入：POST 上传文件开始导入，GET 列出导入任务，GET /{id} 查询进度和报告
+	http.HandleFunc("/api/v2/imports", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			importHandler.GetImports(w, r)
+		case http.MethodPost:
+			importHandler.StartImport(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))))
+
+	http.HandleFunc("/api/v2/imports/", handlers.EnableCORS(userHandler.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/v2/imports/"))
+		if err != nil {
+			http.Error(w, "Invalid import job ID", http.StatusBadRequest)
+			return
+		}
+		if r.Method == http.MethodGet {
+			importHandler.GetImport(w, r, id)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	// Webhook 订阅：用户自己的订阅和管理员接收所有用户事件的全局订阅，路径见 WebhookHandler.serve
+	http.HandleFunc("/api/v2/webhooks", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(webhookHandler.ServeUser))))
+	http.HandleFunc("/api/v2/webhooks/", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(webhookHandler.ServeUser))))
+	http.HandleFunc("/api/admin/webhooks", handlers.EnableCORS(userHandler.AdminMiddleware(idempotencyHandler.Middleware(webhookHandler.ServeAdmin))))
+	http.HandleFunc("/api/admin/webhooks/", handlers.EnableCORS(userHandler.AdminMiddleware(idempotencyHandler.Middleware(webhookHandler.ServeAdmin))))
+
+	// 收件地址路由：GET 获取收件地址，POST /rotate 轮换令牌
+	http.HandleFunc("/api/v2/inbound-email", handlers.EnableCORS(userHandler.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			inboundMailHandler.GetAddress(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	http.HandleFunc("/api/v2/inbound-email/rotate", handlers.EnableCORS(userHandler.AuthMiddleware(idempotencyHandler.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			inboundMailHandler.RotateAddress(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))))
+
+	// CalDAV：使用应用专用密码的 Basic 认证，不经过 CORS 和 JWT 中间件
+	http.HandleFunc("/caldav/", caldavHandler.ServeCalDAV)
+	http.HandleFunc("/.well-known/caldav", caldavHandler.WellKnown)
+
 	log.Println("后端服务运行在 http://localhost:8080")
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }
+
+// undoWindow 从 UNDO_WINDOW 环境变量读取撤销窗口（例如 "10m"、"1h"），未设置或无效时使用默认值
+func undoWindow() time.Duration {
+	value := os.Getenv("UNDO_WINDOW")
+	if value == "" {
+		return models.DefaultUndoWindow
+	}
+	window, err := time.ParseDuration(value)
+	if err != nil || window <= 0 {
+		log.Printf("无效的 UNDO_WINDOW: %q，使用默认值 %s", value, models.DefaultUndoWindow)
+		return models.DefaultUndoWindow
+	}
+	return window
+}
+
+// webhookAllowedNetworks 从 WEBHOOK_ALLOWED_NETWORKS 环境变量读取管理员全局 webhook 可以访问的内网网段，
+// 以逗号分隔（例如 "10.0.0.0/8,192.168.1.20/32"），无效的网段会被忽略
+func webhookAllowedNetworks() []netip.Prefix {
+	var networks []netip.Prefix
+	for _, value := range strings.Split(os.Getenv("WEBHOOK_ALLOWED_NETWORKS"), ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			log.Printf("无效的 WEBHOOK_ALLOWED_NETWORKS 网段: %q", value)
+			continue
+		}
+		networks = append(networks, prefix.Masked())
+	}
+	return networks
+}
@@ -0,0 +1,26 @@
+-- 添加 CalDAV 支持
+-- 这个脚本添加应用专用密码（CalDAV 客户端使用 HTTP Basic 认证，只保存 SHA-256 摘要），
+-- 以及 CalDAV 客户端选择的资源名和 iCalendar UID 到待办事项的映射
+
+CREATE TABLE IF NOT EXISTS app_passwords (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    password_hash CHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_app_passwords_user_id ON app_passwords(user_id);
+
+CREATE TABLE IF NOT EXISTS caldav_objects (
+    todo_id INTEGER PRIMARY KEY REFERENCES todos(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    uid VARCHAR(255) NOT NULL,
+    UNIQUE (user_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_caldav_objects_uid ON caldav_objects(user_id, uid);
+
+COMMIT;
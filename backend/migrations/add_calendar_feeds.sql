@@ -0,0 +1,10 @@
+-- 添加日历订阅
+-- 这个脚本为每个用户保存一个私密的 iCalendar 订阅令牌，订阅链接泄露时可以轮换令牌使旧链接失效
+
+CREATE TABLE IF NOT EXISTS calendar_feeds (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    token VARCHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+COMMIT;
@@ -0,0 +1,37 @@
+-- 添加用户管理的分类
+-- 这个脚本把硬编码的分类字符串改为每个用户可管理的分类（图标、颜色、默认优先级）
+
+-- 用户管理的分类
+CREATE TABLE IF NOT EXISTS categories (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(20) NOT NULL,
+    icon VARCHAR(20),
+    color VARCHAR(20),
+    default_priority VARCHAR(10),
+    position INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, name)
+);
+
+-- 为还没有分类的用户创建默认分类（与 models.defaultCategories 保持一致）
+INSERT INTO categories (user_id, name, icon, color, default_priority, position)
+SELECT users.id, d.name, d.icon, d.color, 'medium', d.position
+FROM users
+CROSS JOIN (VALUES
+    ('work', '💼', '#1890ff', 0),
+    ('personal', '🏠', '#52c41a', 1),
+    ('study', '📚', '#722ed1', 2),
+    ('health', '❤️', '#f5222d', 3)
+) AS d(name, icon, color, position)
+WHERE NOT EXISTS (SELECT 1 FROM categories WHERE categories.user_id = users.id)
+ON CONFLICT (user_id, name) DO NOTHING;
+
+-- 登记已有待办事项中使用的其他分类
+INSERT INTO categories (user_id, name, position)
+SELECT DISTINCT user_id, category, 100
+FROM todos
+WHERE user_id IS NOT NULL AND category IS NOT NULL AND category <> ''
+ON CONFLICT (user_id, name) DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,23 @@
+-- 添加用户自定义字段
+-- 这个脚本为待办事项增加自定义字段定义和按字段存储的值（JSONB + GIN索引）
+
+-- 用户自定义字段
+CREATE TABLE IF NOT EXISTS custom_field_definitions (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    key VARCHAR(30) NOT NULL,
+    name VARCHAR(50) NOT NULL,
+    type VARCHAR(20) NOT NULL,
+    options JSONB DEFAULT '[]'::jsonb,
+    required BOOLEAN NOT NULL DEFAULT FALSE,
+    position INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, key)
+);
+
+ALTER TABLE todos
+ADD COLUMN IF NOT EXISTS custom_fields JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+CREATE INDEX IF NOT EXISTS idx_todos_custom_fields ON todos USING GIN(custom_fields);
+
+COMMIT;
@@ -0,0 +1,84 @@
+-- 添加全文搜索
+-- 这个脚本为 todos 维护 search_vector（任务、标签、描述、步骤）并建立 GIN 索引，
+-- 中日韩文字按一元/二元 n-gram 切分，不依赖 zhparser
+
+CREATE OR REPLACE FUNCTION cjk_ngrams(input TEXT) RETURNS TEXT AS $$
+DECLARE
+    run TEXT;
+    grams TEXT[] := '{}';
+    i INTEGER;
+BEGIN
+    FOR run IN
+        SELECT (regexp_matches(COALESCE(input, ''), '[\u3040-\u30ff\u3400-\u4dbf\u4e00-\u9fff\uac00-\ud7af]+', 'g'))[1]
+    LOOP
+        FOR i IN 1..char_length(run) LOOP
+            grams := grams || substr(run, i, 1);
+            IF i < char_length(run) THEN
+                grams := grams || substr(run, i, 2);
+            END IF;
+        END LOOP;
+    END LOOP;
+    RETURN array_to_string(grams, ' ');
+END;
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+CREATE OR REPLACE FUNCTION search_document(input TEXT) RETURNS tsvector AS $$
+    SELECT to_tsvector('simple', COALESCE(input, '') || ' ' || cjk_ngrams(input));
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE OR REPLACE FUNCTION todo_search_vector(p_id INTEGER, p_task TEXT, p_description TEXT, p_tags JSONB)
+RETURNS tsvector AS $$
+DECLARE
+    steps_text TEXT;
+    tags_text TEXT;
+BEGIN
+    SELECT string_agg(content, ' ') INTO steps_text FROM steps WHERE todo_id = p_id;
+    IF jsonb_typeof(p_tags) = 'array' THEN
+        SELECT string_agg(value, ' ') INTO tags_text FROM jsonb_array_elements_text(p_tags);
+    END IF;
+    RETURN setweight(search_document(p_task), 'A')
+        || setweight(search_document(tags_text), 'B')
+        || setweight(search_document(p_description), 'C')
+        || setweight(search_document(steps_text), 'D');
+END;
+$$ LANGUAGE plpgsql STABLE;
+
+CREATE OR REPLACE FUNCTION update_todo_search_vector() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector := todo_search_vector(NEW.id, NEW.task, NEW.description, NEW.tags);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- 步骤变化时把所属待办事项的 search_vector 置空，由 todos 上的触发器重新计算
+CREATE OR REPLACE FUNCTION refresh_todo_search_vector() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE todos SET search_vector = NULL WHERE id = NEW.todo_id;
+    ELSIF TG_OP = 'DELETE' THEN
+        UPDATE todos SET search_vector = NULL WHERE id = OLD.todo_id;
+    ELSE
+        UPDATE todos SET search_vector = NULL WHERE id IN (OLD.todo_id, NEW.todo_id);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS search_vector tsvector;
+CREATE INDEX IF NOT EXISTS idx_todos_search_vector ON todos USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_steps_search ON steps USING GIN (search_document(content));
+
+DROP TRIGGER IF EXISTS trg_todos_search_vector ON todos;
+CREATE TRIGGER trg_todos_search_vector
+    BEFORE INSERT OR UPDATE OF task, description, tags, search_vector ON todos
+    FOR EACH ROW EXECUTE FUNCTION update_todo_search_vector();
+
+DROP TRIGGER IF EXISTS trg_steps_search_vector ON steps;
+CREATE TRIGGER trg_steps_search_vector
+    AFTER INSERT OR UPDATE OF content, todo_id OR DELETE ON steps
+    FOR EACH ROW EXECUTE FUNCTION refresh_todo_search_vector();
+
+-- 为旧数据回填搜索向量
+UPDATE todos SET search_vector = NULL WHERE search_vector IS NULL;
+
+COMMIT;
@@ -0,0 +1,19 @@
+-- 添加幂等键
+-- 这个脚本保存带 Idempotency-Key 请求头的写请求的摘要和响应（按用户隔离，保留24小时），
+-- 客户端重试时重放保存的响应，而不是再执行一次
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    idempotency_key VARCHAR(255) NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    status_code INTEGER,
+    response_headers JSONB,
+    response_body BYTEA,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, idempotency_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires ON idempotency_keys(expires_at);
+
+COMMIT;
@@ -0,0 +1,25 @@
+-- 添加邮件收件地址和待办事项附件
+-- 这个脚本为每个用户提供一个带随机令牌的收件地址，内置的 SMTP 服务把发往该地址的邮件转换为待办事项，
+-- 邮件的附件保存在 todo_attachments 中
+
+-- 收件地址：发往 <token>@域名 的邮件会成为该用户的待办事项，令牌就是凭据
+CREATE TABLE IF NOT EXISTS inbound_mail_addresses (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    token VARCHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 待办事项的附件，目前来自邮件
+CREATE TABLE IF NOT EXISTS todo_attachments (
+    id SERIAL PRIMARY KEY,
+    todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    size INTEGER NOT NULL,
+    data BYTEA NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_todo_attachments_todo_id ON todo_attachments(todo_id);
+
+COMMIT;
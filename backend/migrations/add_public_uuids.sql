@@ -0,0 +1,28 @@
+-- 添加公开的 UUID 标识
+-- 这个脚本为用户、待办事项和步骤添加 UUIDv7 标识并为已有的行生成，
+-- 路由同时接受整数ID和 UUID，创建待办事项和步骤时可以由客户端提供 UUID
+
+-- UUIDv7（RFC 9562）：前 48 位是毫秒时间戳，其余是随机数，按生成时间有序
+CREATE OR REPLACE FUNCTION uuid_generate_v7() RETURNS uuid AS $$
+DECLARE
+    bytes BYTEA;
+BEGIN
+    bytes := substring(int8send(floor(extract(epoch FROM clock_timestamp()) * 1000)::bigint) FROM 3)
+        || substring(uuid_send(gen_random_uuid()) FROM 7);
+    -- 版本号 7；变体位沿用 gen_random_uuid 生成的 10
+    bytes := set_byte(bytes, 6, (get_byte(bytes, 6) & 15) | 112);
+    RETURN encode(bytes, 'hex')::uuid;
+END;
+$$ LANGUAGE plpgsql VOLATILE;
+
+-- 添加列时按默认值为已有的行逐行生成 UUID。表重写不触发行级触发器，
+-- 已有待办事项的版本号不变，客户端缓存的 ETag 和整数ID继续有效
+ALTER TABLE users ADD COLUMN IF NOT EXISTS uuid UUID NOT NULL DEFAULT uuid_generate_v7();
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS uuid UUID NOT NULL DEFAULT uuid_generate_v7();
+ALTER TABLE steps ADD COLUMN IF NOT EXISTS uuid UUID NOT NULL DEFAULT uuid_generate_v7();
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_uuid ON users(uuid);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_todos_uuid ON todos(uuid);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_steps_uuid ON steps(uuid);
+
+COMMIT;
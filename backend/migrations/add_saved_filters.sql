@@ -0,0 +1,17 @@
+-- 添加保存的过滤器（智能列表）
+-- 这个脚本让用户保存常用的过滤条件，并可以置顶为智能列表
+
+CREATE TABLE IF NOT EXISTS saved_filters (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    icon VARCHAR(20),
+    criteria JSONB NOT NULL DEFAULT '{}',
+    pinned BOOLEAN NOT NULL DEFAULT FALSE,
+    position INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, name)
+);
+
+COMMIT;
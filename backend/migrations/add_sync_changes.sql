@@ -0,0 +1,112 @@
+-- 添加增量同步
+-- 这个脚本为待办事项和步骤添加客户端生成的ID，并为待办事项、步骤和标签的每次写入分配
+-- 每个用户单调递增的同步序号（删除保留为墓碑），供 GET /api/v2/sync?since= 增量拉取
+
+-- 离线客户端生成的ID，同步时用于幂等地创建待办事项和步骤
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS client_id VARCHAR(64);
+ALTER TABLE steps ADD COLUMN IF NOT EXISTS client_id VARCHAR(64);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_todos_client_id ON todos(user_id, client_id) WHERE client_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_steps_client_id ON steps(todo_id, client_id) WHERE client_id IS NOT NULL;
+
+-- 同步序列：每个用户一个单调递增的变更序号
+CREATE TABLE IF NOT EXISTS sync_sequences (
+    user_id INTEGER PRIMARY KEY,
+    last_seq BIGINT NOT NULL DEFAULT 0
+);
+
+-- 同步变更：每个待办事项、步骤和标签最近一次变更的序号，删除时保留为墓碑
+CREATE TABLE IF NOT EXISTS sync_changes (
+    user_id INTEGER NOT NULL,
+    entity VARCHAR(10) NOT NULL,
+    entity_id INTEGER NOT NULL,
+    seq BIGINT NOT NULL,
+    deleted BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (user_id, entity, entity_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_sync_changes_seq ON sync_changes(user_id, seq);
+
+-- 同一用户的写入在 sync_sequences 的行锁上串行化，序号顺序与提交顺序一致
+CREATE OR REPLACE FUNCTION record_sync_change(
+    owner_id INTEGER, change_entity TEXT, change_entity_id INTEGER, is_deleted BOOLEAN
+) RETURNS void AS $$
+DECLARE
+    next_seq BIGINT;
+BEGIN
+    INSERT INTO sync_sequences (user_id, last_seq) VALUES (owner_id, 1)
+    ON CONFLICT (user_id) DO UPDATE SET last_seq = sync_sequences.last_seq + 1
+    RETURNING last_seq INTO next_seq;
+
+    INSERT INTO sync_changes (user_id, entity, entity_id, seq, deleted)
+    VALUES (owner_id, change_entity, change_entity_id, next_seq, is_deleted)
+    ON CONFLICT (user_id, entity, entity_id)
+    DO UPDATE SET seq = EXCLUDED.seq, deleted = EXCLUDED.deleted;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION sync_todo_change() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        IF OLD.user_id IS NOT NULL THEN
+            PERFORM record_sync_change(OLD.user_id, 'todo', OLD.id, TRUE);
+        END IF;
+    -- 只有 search_vector 变化时版本号不变，不需要同步
+    ELSIF NEW.user_id IS NOT NULL AND (TG_OP = 'INSERT' OR NEW.version <> OLD.version) THEN
+        PERFORM record_sync_change(NEW.user_id, 'todo', NEW.id, FALSE);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION sync_step_change() RETURNS trigger AS $$
+DECLARE
+    step_todo_id INTEGER;
+    changed_step_id INTEGER;
+    owner_id INTEGER;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        step_todo_id := OLD.todo_id;
+        changed_step_id := OLD.id;
+    ELSE
+        step_todo_id := NEW.todo_id;
+        changed_step_id := NEW.id;
+    END IF;
+
+    -- 随待办事项级联删除的步骤找不到所属待办事项，客户端按待办事项的墓碑一起删除
+    SELECT user_id INTO owner_id FROM todos WHERE id = step_todo_id;
+    IF owner_id IS NOT NULL THEN
+        PERFORM record_sync_change(owner_id, 'step', changed_step_id, TG_OP = 'DELETE');
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION sync_tag_change() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        IF OLD.user_id IS NOT NULL THEN
+            PERFORM record_sync_change(OLD.user_id, 'tag', OLD.id, TRUE);
+        END IF;
+    ELSIF NEW.user_id IS NOT NULL THEN
+        PERFORM record_sync_change(NEW.user_id, 'tag', NEW.id, FALSE);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_todos_sync ON todos;
+CREATE TRIGGER trg_todos_sync
+    AFTER INSERT OR UPDATE OR DELETE ON todos
+    FOR EACH ROW EXECUTE FUNCTION sync_todo_change();
+
+DROP TRIGGER IF EXISTS trg_steps_sync ON steps;
+CREATE TRIGGER trg_steps_sync
+    AFTER INSERT OR UPDATE OR DELETE ON steps
+    FOR EACH ROW EXECUTE FUNCTION sync_step_change();
+
+DROP TRIGGER IF EXISTS trg_tags_sync ON tags;
+CREATE TRIGGER trg_tags_sync
+    AFTER INSERT OR UPDATE OR DELETE ON tags
+    FOR EACH ROW EXECUTE FUNCTION sync_tag_change();
+
+COMMIT;
@@ -0,0 +1,24 @@
+-- 添加标签目录
+-- 这个脚本为每个用户建立标签目录（颜色、描述），并登记已有待办事项中的标签
+
+-- 标签目录
+CREATE TABLE IF NOT EXISTS tags (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(30) NOT NULL,
+    color VARCHAR(20),
+    description TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, name)
+);
+
+-- 把已有待办事项中使用的标签登记到标签目录
+INSERT INTO tags (user_id, name)
+SELECT DISTINCT todos.user_id, t.name
+FROM todos, jsonb_array_elements_text(
+    CASE WHEN jsonb_typeof(todos.tags) = 'array' THEN todos.tags ELSE '[]'::jsonb END
+) AS t(name)
+WHERE todos.user_id IS NOT NULL AND length(t.name) BETWEEN 1 AND 30
+ON CONFLICT (user_id, name) DO NOTHING;
+
+COMMIT;
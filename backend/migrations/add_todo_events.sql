@@ -0,0 +1,97 @@
+-- 添加变更事件日志和事件触发器
+-- 这个脚本让待办事项和步骤的每次写入都记录到短期保存的事件日志，并通过 NOTIFY todo_events
+-- 通知所有后端实例，用于 SSE / WebSocket 实时推送和断线重连补发
+
+-- user_id 不设外键：删除用户时级联删除待办事项仍会写入事件
+CREATE TABLE IF NOT EXISTS todo_events (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    type VARCHAR(30) NOT NULL,
+    todo_id INTEGER NOT NULL,
+    step_id INTEGER,
+    version INTEGER,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_todo_events_user_id ON todo_events(user_id, id);
+CREATE INDEX IF NOT EXISTS idx_todo_events_created_at ON todo_events(created_at);
+
+CREATE OR REPLACE FUNCTION notify_todo_event(
+    owner_id INTEGER, event_type TEXT, event_todo_id INTEGER, event_step_id INTEGER, event_version INTEGER
+) RETURNS void AS $$
+DECLARE
+    logged todo_events%ROWTYPE;
+BEGIN
+    INSERT INTO todo_events (user_id, type, todo_id, step_id, version)
+    VALUES (owner_id, event_type, event_todo_id, event_step_id, event_version)
+    RETURNING * INTO logged;
+
+    -- 与其他 TIMESTAMP 列一样按 UTC 输出
+    PERFORM pg_notify('todo_events', json_build_object(
+        'id', logged.id,
+        'userId', logged.user_id,
+        'type', logged.type,
+        'todoId', logged.todo_id,
+        'stepId', logged.step_id,
+        'version', logged.version,
+        'createdAt', to_char(logged.created_at, 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"')
+    )::text);
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION publish_todo_event() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        IF OLD.user_id IS NOT NULL THEN
+            PERFORM notify_todo_event(OLD.user_id, 'todo.deleted', OLD.id, NULL, OLD.version);
+        END IF;
+    -- 只有 search_vector 变化时版本号不变，不发布事件
+    ELSIF NEW.user_id IS NOT NULL AND (TG_OP = 'INSERT' OR NEW.version <> OLD.version) THEN
+        PERFORM notify_todo_event(
+            NEW.user_id,
+            CASE TG_OP WHEN 'INSERT' THEN 'todo.created' ELSE 'todo.updated' END,
+            NEW.id, NULL, NEW.version
+        );
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION publish_step_event() RETURNS trigger AS $$
+DECLARE
+    step_todo_id INTEGER;
+    changed_step_id INTEGER;
+    owner_id INTEGER;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        step_todo_id := OLD.todo_id;
+        changed_step_id := OLD.id;
+    ELSE
+        step_todo_id := NEW.todo_id;
+        changed_step_id := NEW.id;
+    END IF;
+
+    -- 随待办事项级联删除的步骤找不到所属待办事项，由 todo.deleted 事件覆盖
+    SELECT user_id INTO owner_id FROM todos WHERE id = step_todo_id;
+    IF owner_id IS NOT NULL THEN
+        PERFORM notify_todo_event(
+            owner_id,
+            'step.' || CASE TG_OP WHEN 'INSERT' THEN 'created' WHEN 'UPDATE' THEN 'updated' ELSE 'deleted' END,
+            step_todo_id, changed_step_id, NULL
+        );
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_todos_events ON todos;
+CREATE TRIGGER trg_todos_events
+    AFTER INSERT OR UPDATE OR DELETE ON todos
+    FOR EACH ROW EXECUTE FUNCTION publish_todo_event();
+
+DROP TRIGGER IF EXISTS trg_steps_events ON steps;
+CREATE TRIGGER trg_steps_events
+    AFTER INSERT OR UPDATE OR DELETE ON steps
+    FOR EACH ROW EXECUTE FUNCTION publish_step_event();
+
+COMMIT;
@@ -0,0 +1,41 @@
+-- 添加待办事项版本号
+-- 这个脚本为 todos 添加 version 列，每次写入（包括步骤变化）时递增，
+-- 用于 ETag / If-Match 乐观并发控制
+
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
+-- 除 search_vector 外任何列变化都递增版本号；调用方显式递增时保持不变
+CREATE OR REPLACE FUNCTION bump_todo_version() RETURNS trigger AS $$
+BEGIN
+    IF (to_jsonb(NEW) - 'search_vector' - 'version') IS DISTINCT FROM (to_jsonb(OLD) - 'search_vector' - 'version') THEN
+        NEW.version := OLD.version + 1;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- 步骤属于待办事项的表示，步骤变化时递增所属待办事项的版本号
+CREATE OR REPLACE FUNCTION touch_todo_version() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE todos SET version = version + 1 WHERE id = NEW.todo_id;
+    ELSIF TG_OP = 'DELETE' THEN
+        UPDATE todos SET version = version + 1 WHERE id = OLD.todo_id;
+    ELSE
+        UPDATE todos SET version = version + 1 WHERE id IN (OLD.todo_id, NEW.todo_id);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_todos_version ON todos;
+CREATE TRIGGER trg_todos_version
+    BEFORE UPDATE ON todos
+    FOR EACH ROW EXECUTE FUNCTION bump_todo_version();
+
+DROP TRIGGER IF EXISTS trg_steps_todo_version ON steps;
+CREATE TRIGGER trg_steps_todo_version
+    AFTER INSERT OR UPDATE OR DELETE ON steps
+    FOR EACH ROW EXECUTE FUNCTION touch_todo_version();
+
+COMMIT;
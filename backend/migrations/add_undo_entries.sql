@@ -0,0 +1,18 @@
+-- 添加撤销记录
+-- 这个脚本为每次修改保存修改前的待办事项快照（含步骤）和修改后的版本号，
+-- 在撤销窗口内可以通过 POST /api/v2/undo/{token} 恢复
+
+CREATE TABLE IF NOT EXISTS undo_entries (
+    id SERIAL PRIMARY KEY,
+    token VARCHAR(64) NOT NULL UNIQUE,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    action VARCHAR(30) NOT NULL,
+    items JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_undo_entries_user_expires ON undo_entries(user_id, expires_at);
+
+COMMIT;
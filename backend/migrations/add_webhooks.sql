@@ -0,0 +1,125 @@
+-- 添加 webhook 订阅、投递队列和触发器
+-- 这个脚本让待办事项的创建、修改、完成和删除在同一个事务中加入 webhook 投递队列，
+-- 后台投递时用 HMAC-SHA256 签名，失败后按指数退避重试；过期事件由后台任务定期加入队列
+
+-- Webhook 订阅：user_id 为空表示管理员配置的、接收所有用户事件的订阅；events 为空表示所有事件
+CREATE TABLE IF NOT EXISTS webhooks (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    secret VARCHAR(64) NOT NULL,
+    events TEXT[] NOT NULL DEFAULT '{}',
+    description VARCHAR(100) NOT NULL DEFAULT '',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    consecutive_failures INTEGER NOT NULL DEFAULT 0,
+    disabled_reason TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhooks_user_id ON webhooks(user_id);
+
+-- Webhook 投递队列，同时作为投递日志：pending 的投递按 next_attempt_at 重试
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    event_type VARCHAR(30) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_until TIMESTAMP,
+    response_code INTEGER,
+    response_body TEXT,
+    error TEXT,
+    duration_ms INTEGER,
+    redelivery_of BIGINT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_attempt_at TIMESTAMP,
+    delivered_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id, id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_pending ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+
+-- 已经发送过 todo.overdue 事件的待办事项和截止时间，截止时间修改后再次过期时重新发送
+CREATE TABLE IF NOT EXISTS webhook_overdue_notices (
+    todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+    due_date TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (todo_id, due_date)
+);
+
+-- 待办事项在 webhook 负载中的表示，字段名与 API 一致，时间按 UTC 输出
+CREATE OR REPLACE FUNCTION webhook_todo_json(t todos) RETURNS jsonb AS $$
+    SELECT jsonb_build_object(
+        'id', t.id,
+        'uuid', t.uuid,
+        'task', t.task,
+        'description', COALESCE(t.description, ''),
+        'done', COALESCE(t.done, FALSE),
+        'priority', t.priority,
+        'category', t.category,
+        'status', t.status,
+        'dueDate', to_char(t.due_date, 'YYYY-MM-DD"T"HH24:MI:SS"Z"'),
+        'tags', COALESCE(t.tags, '[]'::jsonb),
+        'userId', t.user_id,
+        'version', t.version,
+        'createdAt', to_char(t.created_at, 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"'),
+        'updatedAt', to_char(t.updated_at, 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"'),
+        'completedAt', to_char(t.completed_at, 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"')
+    );
+$$ LANGUAGE sql STABLE;
+
+-- 为订阅了该事件的 webhook（用户自己的和管理员的全局订阅）各加入一条投递
+CREATE OR REPLACE FUNCTION enqueue_webhook_event(owner_id INTEGER, kind TEXT, todo JSONB) RETURNS void AS $$
+DECLARE
+    payload JSONB;
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM webhooks WHERE enabled AND (user_id = owner_id OR user_id IS NULL)
+    ) THEN
+        RETURN;
+    END IF;
+
+    payload := jsonb_build_object(
+        'id', uuid_generate_v7(),
+        'type', kind,
+        'createdAt', to_char(NOW() AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"'),
+        'userId', owner_id,
+        'todo', todo
+    );
+    INSERT INTO webhook_deliveries (webhook_id, event_type, payload)
+    SELECT id, kind, payload FROM webhooks
+    WHERE enabled AND (user_id = owner_id OR user_id IS NULL)
+      AND (cardinality(events) = 0 OR kind = ANY(events));
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION enqueue_todo_webhooks() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        IF OLD.user_id IS NOT NULL THEN
+            PERFORM enqueue_webhook_event(OLD.user_id, 'todo.deleted', webhook_todo_json(OLD));
+        END IF;
+    ELSIF NEW.user_id IS NOT NULL THEN
+        IF TG_OP = 'INSERT' THEN
+            PERFORM enqueue_webhook_event(NEW.user_id, 'todo.created', webhook_todo_json(NEW));
+        -- 只有 search_vector 变化时版本号不变，不发送事件
+        ELSIF NEW.version <> OLD.version THEN
+            PERFORM enqueue_webhook_event(NEW.user_id, 'todo.updated', webhook_todo_json(NEW));
+            IF NEW.done AND NOT COALESCE(OLD.done, FALSE) THEN
+                PERFORM enqueue_webhook_event(NEW.user_id, 'todo.completed', webhook_todo_json(NEW));
+            END IF;
+        END IF;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_todos_webhooks ON todos;
+CREATE TRIGGER trg_todos_webhooks
+    AFTER INSERT OR UPDATE OR DELETE ON todos
+    FOR EACH ROW EXECUTE FUNCTION enqueue_todo_webhooks();
+
+COMMIT;
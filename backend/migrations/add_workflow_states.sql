@@ -0,0 +1,121 @@
+-- 添加看板工作流状态
+-- 这个脚本为待办事项增加可配置的工作流状态（待办 → 进行中 → 审核 → 完成）
+
+-- 工作流状态（看板列）
+CREATE TABLE IF NOT EXISTS workflow_states (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    key VARCHAR(30) NOT NULL,
+    name VARCHAR(50) NOT NULL,
+    position INTEGER NOT NULL DEFAULT 0,
+    counts_as_done BOOLEAN NOT NULL DEFAULT FALSE,
+    wip_limit INTEGER,
+    color VARCHAR(20),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, key)
+);
+
+ALTER TABLE todos
+ADD COLUMN IF NOT EXISTS status VARCHAR(30);
+
+ALTER TABLE todos
+ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS todo_status_transitions (
+    id SERIAL PRIMARY KEY,
+    todo_id INTEGER REFERENCES todos(id) ON DELETE CASCADE,
+    from_status VARCHAR(30),
+    to_status VARCHAR(30) NOT NULL,
+    transitioned_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_todos_status ON todos(user_id, status);
+CREATE INDEX IF NOT EXISTS idx_todo_status_transitions_todo_id ON todo_status_transitions(todo_id);
+
+-- 保持 status、done、completed_at 一致，并记录状态流转
+CREATE OR REPLACE FUNCTION sync_todo_status() RETURNS trigger AS $$
+DECLARE
+    state_done BOOLEAN;
+    status_set BOOLEAN;
+    done_changed BOOLEAN;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        status_set := NEW.status IS NOT NULL;
+        done_changed := FALSE;
+    ELSE
+        status_set := NEW.status IS NOT NULL AND NEW.status IS DISTINCT FROM OLD.status;
+        done_changed := NEW.done IS DISTINCT FROM OLD.done;
+    END IF;
+
+    -- 显式修改了状态：完成标记跟随状态
+    IF status_set THEN
+        SELECT counts_as_done INTO state_done
+        FROM workflow_states WHERE user_id = NEW.user_id AND key = NEW.status;
+        IF FOUND THEN
+            NEW.done := state_done;
+        END IF;
+    -- 只修改了完成标记（或没有状态）：状态跟随完成标记
+    ELSIF NEW.status IS NULL OR (done_changed AND NOT EXISTS (
+        SELECT 1 FROM workflow_states
+        WHERE user_id = NEW.user_id AND key = NEW.status AND counts_as_done = NEW.done
+    )) THEN
+        NEW.status := (
+            SELECT key FROM workflow_states
+            WHERE user_id = NEW.user_id AND counts_as_done = NEW.done
+            ORDER BY position, id LIMIT 1
+        );
+        IF NEW.status IS NULL THEN
+            NEW.status := CASE WHEN NEW.done THEN 'done' ELSE 'backlog' END;
+        END IF;
+    END IF;
+
+    IF TG_OP = 'INSERT' THEN
+        NEW.status_changed_at := COALESCE(NEW.status_changed_at, NOW());
+        IF NEW.done THEN
+            NEW.completed_at := COALESCE(NEW.completed_at, NOW());
+        ELSE
+            NEW.completed_at := NULL;
+        END IF;
+    ELSE
+        IF NEW.status IS DISTINCT FROM OLD.status THEN
+            NEW.status_changed_at := NOW();
+        END IF;
+        IF NEW.done AND NOT OLD.done THEN
+            NEW.completed_at := NOW();
+        ELSIF NOT NEW.done THEN
+            NEW.completed_at := NULL;
+        END IF;
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION record_todo_status_transition() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO todo_status_transitions (todo_id, from_status, to_status, transitioned_at)
+        VALUES (NEW.id, NULL, NEW.status, NEW.status_changed_at);
+    ELSIF NEW.status IS DISTINCT FROM OLD.status THEN
+        INSERT INTO todo_status_transitions (todo_id, from_status, to_status, transitioned_at)
+        VALUES (NEW.id, OLD.status, NEW.status, NEW.status_changed_at);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_todos_sync_status ON todos;
+CREATE TRIGGER trg_todos_sync_status
+    BEFORE INSERT OR UPDATE ON todos
+    FOR EACH ROW EXECUTE FUNCTION sync_todo_status();
+
+DROP TRIGGER IF EXISTS trg_todos_status_transition ON todos;
+CREATE TRIGGER trg_todos_status_transition
+    AFTER INSERT OR UPDATE OF status ON todos
+    FOR EACH ROW EXECUTE FUNCTION record_todo_status_transition();
+
+-- 为旧数据回填状态
+UPDATE todos SET status = CASE WHEN done THEN 'done' ELSE 'backlog' END
+WHERE status IS NULL;
+
+COMMIT;
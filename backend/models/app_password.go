@@ -0,0 +1,142 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxAppPasswordName 应用专用密码名称的最大长度
+const maxAppPasswordName = 50
+
+var (
+	// ErrAppPasswordNotFound 应用专用密码不存在或不属于当前用户
+	ErrAppPasswordNotFound = errors.New("app password not found")
+	// ErrInvalidAppPasswordName 应用专用密码的名称为空或过长
+	ErrInvalidAppPasswordName = errors.New("invalid app password name")
+	// ErrInvalidCredentials 用户名或应用专用密码错误
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// AppPassword 应用专用密码。明文密码只在创建时返回一次
+type AppPassword struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"userId"`
+	Name       string     `json:"name"`
+	Password   string     `json:"password,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+// AppPasswordModel 处理应用专用密码相关的数据库操作
+type AppPasswordModel struct {
+	DB *sql.DB
+}
+
+// NewAppPasswordModel 创建一个新的AppPasswordModel实例
+func NewAppPasswordModel(db *sql.DB) *AppPasswordModel {
+	return &AppPasswordModel{DB: db}
+}
+
+// hashAppPassword 应用专用密码是 130 位的随机值，不存在字典攻击，用 SHA-256 摘要即可按摘要直接查找，
+// 不需要 bcrypt（CalDAV 客户端每个请求都会携带密码）
+func hashAppPassword(password string) string {
+	sum := sha256.Sum256([]byte(strings.ReplaceAll(strings.ToLower(password), "-", "")))
+	return hex.EncodeToString(sum[:])
+}
+
+// newAppPassword 生成随机密码，形如 abcd-efgh-ijkl-mnop-qrst-uvwx-yz
+func newAppPassword() (string, error) {
+	buf := make([]byte, 17)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate app password failed: %w", err)
+	}
+	raw := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf))[:26]
+	var groups []string
+	for len(raw) > 4 {
+		groups = append(groups, raw[:4])
+		raw = raw[4:]
+	}
+	return strings.Join(append(groups, raw), "-"), nil
+}
+
+// Create 为用户创建应用专用密码，返回的 Password 是唯一一次可以看到的明文
+func (m *AppPasswordModel) Create(userID int, name string) (*AppPassword, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len([]rune(name)) > maxAppPasswordName {
+		return nil, ErrInvalidAppPasswordName
+	}
+	password, err := newAppPassword()
+	if err != nil {
+		return nil, err
+	}
+
+	ap := &AppPassword{UserID: userID, Name: name, Password: password}
+	err = m.DB.QueryRow(
+		"INSERT INTO app_passwords (user_id, name, password_hash) VALUES ($1, $2, $3) RETURNING id, created_at",
+		userID, name, hashAppPassword(password),
+	).Scan(&ap.ID, &ap.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("create app password failed: %w", err)
+	}
+	return ap, nil
+}
+
+// List 列出用户的应用专用密码（不包含密码）
+func (m *AppPasswordModel) List(userID int) ([]AppPassword, error) {
+	rows, err := m.DB.Query(
+		"SELECT id, user_id, name, created_at, last_used_at FROM app_passwords WHERE user_id = $1 ORDER BY id",
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query app passwords failed: %w", err)
+	}
+	defer rows.Close()
+
+	passwords := []AppPassword{}
+	for rows.Next() {
+		var ap AppPassword
+		if err := rows.Scan(&ap.ID, &ap.UserID, &ap.Name, &ap.CreatedAt, &ap.LastUsedAt); err != nil {
+			return nil, fmt.Errorf("scan app password failed: %w", err)
+		}
+		passwords = append(passwords, ap)
+	}
+	return passwords, rows.Err()
+}
+
+// Delete 撤销应用专用密码，使用它的客户端立即失去访问权限
+func (m *AppPasswordModel) Delete(userID, id int) error {
+	result, err := m.DB.Exec("DELETE FROM app_passwords WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return fmt.Errorf("delete app password failed: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrAppPasswordNotFound
+	}
+	return nil
+}
+
+// Authenticate 校验用户名和应用专用密码，返回用户ID并记录最近使用时间
+func (m *AppPasswordModel) Authenticate(username, password string) (int, error) {
+	var userID int
+	err := m.DB.QueryRow(
+		`UPDATE app_passwords SET last_used_at = NOW()
+		 FROM users
+		 WHERE users.id = app_passwords.user_id AND users.username = $1 AND app_passwords.password_hash = $2
+		 RETURNING users.id`,
+		username, hashAppPassword(password),
+	).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrInvalidCredentials
+		}
+		return 0, fmt.Errorf("authenticate app password failed: %w", err)
+	}
+	return userID, nil
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrAttachmentNotFound 附件不存在或不属于该用户
+var ErrAttachmentNotFound = errors.New("attachment not found")
+
+// Attachment 待办事项的附件。列表中不包含内容，下载时才读取 Data
+type Attachment struct {
+	ID          int       `json:"id"`
+	TodoID      int       `json:"todoId"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"contentType"`
+	Size        int       `json:"size"`
+	Data        []byte    `json:"-"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// AttachmentModel 处理附件相关的数据库操作
+type AttachmentModel struct {
+	DB *sql.DB
+}
+
+// NewAttachmentModel 创建一个新的AttachmentModel实例
+func NewAttachmentModel(db *sql.DB) *AttachmentModel {
+	return &AttachmentModel{DB: db}
+}
+
+// insertAttachment 保存附件，填充ID和创建时间
+func insertAttachment(db execer, a *Attachment) error {
+	a.Size = len(a.Data)
+	err := db.QueryRow(
+		`INSERT INTO todo_attachments (todo_id, filename, content_type, size, data)
+		 VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`,
+		a.TodoID, a.Filename, a.ContentType, a.Size, a.Data,
+	).Scan(&a.ID, &a.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert attachment failed: %w", err)
+	}
+	return nil
+}
+
+// List 列出用户某个待办事项的附件（不包含内容），待办事项不属于该用户时返回 ErrTodoNotFound
+func (m *AttachmentModel) List(userID, todoID int) ([]Attachment, error) {
+	var exists bool
+	err := m.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM todos WHERE id = $1 AND user_id = $2)", todoID, userID).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("get todo failed: %w", err)
+	}
+	if !exists {
+		return nil, ErrTodoNotFound
+	}
+
+	rows, err := m.DB.Query(
+		`SELECT id, todo_id, filename, content_type, size, created_at
+		 FROM todo_attachments WHERE todo_id = $1 ORDER BY id`,
+		todoID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query attachments failed: %w", err)
+	}
+	defer rows.Close()
+
+	attachments := []Attachment{}
+	for rows.Next() {
+		var a Attachment
+		if err := rows.Scan(&a.ID, &a.TodoID, &a.Filename, &a.ContentType, &a.Size, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan attachment failed: %w", err)
+		}
+		attachments = append(attachments, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query attachments failed: %w", err)
+	}
+	return attachments, nil
+}
+
+// Get 获取用户的一个附件，包含内容
+func (m *AttachmentModel) Get(userID, todoID, id int) (*Attachment, error) {
+	var a Attachment
+	err := m.DB.QueryRow(
+		`SELECT a.id, a.todo_id, a.filename, a.content_type, a.size, a.data, a.created_at
+		 FROM todo_attachments a JOIN todos t ON t.id = a.todo_id
+		 WHERE a.id = $1 AND a.todo_id = $2 AND t.user_id = $3`,
+		id, todoID, userID,
+	).Scan(&a.ID, &a.TodoID, &a.Filename, &a.ContentType, &a.Size, &a.Data, &a.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrAttachmentNotFound
+		}
+		return nil, fmt.Errorf("get attachment failed: %w", err)
+	}
+	return &a, nil
+}
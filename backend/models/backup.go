@@ -0,0 +1,612 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// BackupFormat 备份文件的格式标识
+const BackupFormat = "todolist-backup"
+
+// BackupVersion 当前的备份格式版本。格式变化时递增，并在 upgradeBackup 中转换旧版本
+const BackupVersion = 1
+
+// 恢复模式：merge 保留账户中已有的数据，跳过重复项；replace 先清空账户中的数据
+const (
+	RestoreModeMerge   = "merge"
+	RestoreModeReplace = "replace"
+)
+
+var (
+	// ErrInvalidBackup 备份文件格式错误或包含无效数据
+	ErrInvalidBackup = errors.New("invalid backup")
+	// ErrUnsupportedBackupVersion 备份文件的版本比当前支持的版本新
+	ErrUnsupportedBackupVersion = errors.New("unsupported backup version")
+	// ErrInvalidRestoreMode 恢复模式不是 merge 或 replace
+	ErrInvalidRestoreMode = errors.New("invalid restore mode")
+)
+
+// BackupProfile 备份中的用户资料，只用于识别来源账户，恢复时不会修改目标账户的资料
+type BackupProfile struct {
+	UUID          string    `json:"uuid"`
+	Username      string    `json:"username"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"emailVerified"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// Backup 一个用户账户的完整备份。各实体中的ID是来源环境中的ID，恢复时重新分配
+type Backup struct {
+	Format         string                  `json:"format"`
+	Version        int                     `json:"version"`
+	ExportedAt     time.Time               `json:"exportedAt"`
+	Profile        BackupProfile           `json:"profile"`
+	Categories     []Category              `json:"categories"`
+	WorkflowStates []WorkflowState         `json:"workflowStates"`
+	CustomFields   []CustomFieldDefinition `json:"customFields"`
+	Tags           []Tag                   `json:"tags"`
+	SavedFilters   []SavedFilter           `json:"savedFilters"`
+	Todos          []Todo                  `json:"todos"` // 包含步骤
+}
+
+// RestoreCount 一类实体的恢复结果
+type RestoreCount struct {
+	Created int `json:"created"`
+	Skipped int `json:"skipped"` // 账户中已经存在（名称、key 或 UUID 相同）
+}
+
+// RestoreReport 恢复的结果。TodoIDs 和 StepIDs 把备份中的ID映射到新ID（跳过的项不在其中）
+type RestoreReport struct {
+	Mode            string       `json:"mode"`
+	Categories      RestoreCount `json:"categories"`
+	WorkflowStates  RestoreCount `json:"workflowStates"`
+	CustomFields    RestoreCount `json:"customFields"`
+	Tags            RestoreCount `json:"tags"`
+	SavedFilters    RestoreCount `json:"savedFilters"`
+	Todos           RestoreCount `json:"todos"`
+	Steps           RestoreCount `json:"steps"`
+	TodoIDs         map[int]int  `json:"todoIds"`
+	StepIDs         map[int]int  `json:"stepIds"`
+	ReassignedUUIDs int          `json:"reassignedUuids"` // UUID 已被其他账户使用而重新生成的待办事项和步骤
+	ClearedStatuses int          `json:"clearedStatuses"` // 状态不存在、改为由完成标记推导的待办事项
+	DeletedTodos    int          `json:"deletedTodos"`    // replace 模式下删除的待办事项
+}
+
+// BackupModel 处理账户备份和恢复
+type BackupModel struct {
+	DB *sql.DB
+}
+
+// NewBackupModel 创建一个新的BackupModel实例
+func NewBackupModel(db *sql.DB) *BackupModel {
+	return &BackupModel{DB: db}
+}
+
+// Export 导出用户账户的全部数据。所有读取在同一个可重复读快照中进行，备份内部保持一致
+func (m *BackupModel) Export(userID int) (*Backup, error) {
+	tx, err := m.DB.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	backup := &Backup{Format: BackupFormat, Version: BackupVersion, ExportedAt: time.Now().UTC()}
+
+	err = tx.QueryRow(
+		"SELECT uuid, username, email, email_verified, created_at FROM users WHERE id = $1",
+		userID,
+	).Scan(&backup.Profile.UUID, &backup.Profile.Username, &backup.Profile.Email,
+		&backup.Profile.EmailVerified, &backup.Profile.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("get user failed: %w", err)
+	}
+
+	if backup.Categories, err = exportCategories(tx, userID); err != nil {
+		return nil, err
+	}
+	if backup.WorkflowStates, err = exportStates(tx, userID); err != nil {
+		return nil, err
+	}
+	if backup.CustomFields, err = getCustomFieldDefinitions(tx, userID); err != nil {
+		return nil, err
+	}
+	if backup.Tags, err = queryTags(tx, userID, nil); err != nil {
+		return nil, err
+	}
+	if backup.SavedFilters, err = exportSavedFilters(tx, userID); err != nil {
+		return nil, err
+	}
+	if backup.Todos, err = exportTodos(tx, userID); err != nil {
+		return nil, err
+	}
+
+	return backup, tx.Commit()
+}
+
+func exportCategories(tx *sql.Tx, userID int) ([]Category, error) {
+	rows, err := tx.Query("SELECT "+categoryColumns+" FROM categories WHERE user_id = $1 ORDER BY position, id", userID)
+	if err != nil {
+		return nil, fmt.Errorf("query categories failed: %w", err)
+	}
+	defer rows.Close()
+
+	categories := []Category{}
+	for rows.Next() {
+		category, err := scanCategory(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan category failed: %w", err)
+		}
+		categories = append(categories, category)
+	}
+	return categories, rows.Err()
+}
+
+func exportStates(tx *sql.Tx, userID int) ([]WorkflowState, error) {
+	rows, err := tx.Query("SELECT "+stateColumns+" FROM workflow_states WHERE user_id = $1 ORDER BY position, id", userID)
+	if err != nil {
+		return nil, fmt.Errorf("query workflow states failed: %w", err)
+	}
+	defer rows.Close()
+
+	states := []WorkflowState{}
+	for rows.Next() {
+		state, err := scanState(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan workflow state failed: %w", err)
+		}
+		states = append(states, state)
+	}
+	return states, rows.Err()
+}
+
+func exportSavedFilters(tx *sql.Tx, userID int) ([]SavedFilter, error) {
+	rows, err := tx.Query("SELECT "+savedFilterColumns+" FROM saved_filters WHERE user_id = $1 ORDER BY position, id", userID)
+	if err != nil {
+		return nil, fmt.Errorf("query saved filters failed: %w", err)
+	}
+	defer rows.Close()
+
+	filters := []SavedFilter{}
+	for rows.Next() {
+		filter, err := scanSavedFilter(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan saved filter failed: %w", err)
+		}
+		filters = append(filters, filter)
+	}
+	return filters, rows.Err()
+}
+
+// exportTodos 读取用户的全部待办事项和步骤
+func exportTodos(tx *sql.Tx, userID int) ([]Todo, error) {
+	rows, err := tx.Query("SELECT "+TodoColumns+" FROM todos WHERE user_id = $1 ORDER BY id", userID)
+	if err != nil {
+		return nil, fmt.Errorf("query todos failed: %w", err)
+	}
+	defer rows.Close()
+
+	todos := []Todo{}
+	index := map[int]int{}
+	for rows.Next() {
+		todo, err := ScanTodo(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan todo failed: %w", err)
+		}
+		index[todo.ID] = len(todos)
+		todos = append(todos, todo)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate todos failed: %w", err)
+	}
+	rows.Close()
+
+	stepRows, err := tx.Query(
+		"SELECT "+StepColumns+" FROM steps WHERE todo_id IN (SELECT id FROM todos WHERE user_id = $1) ORDER BY todo_id, id",
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query steps failed: %w", err)
+	}
+	defer stepRows.Close()
+	for stepRows.Next() {
+		var step Step
+		if err := stepRows.Scan(&step.ID, &step.UUID, &step.TodoID, &step.Content, &step.Completed, &step.ClientID); err != nil {
+			return nil, fmt.Errorf("scan step failed: %w", err)
+		}
+		if i, ok := index[step.TodoID]; ok {
+			todos[i].Steps = append(todos[i].Steps, step)
+		}
+	}
+	if err := stepRows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate steps failed: %w", err)
+	}
+
+	return todos, nil
+}
+
+// ValidateBackup 校验备份的格式和版本，把旧版本转换为当前版本，并校验其中的数据。
+// 返回的错误包装 ErrInvalidBackup 或 ErrUnsupportedBackupVersion
+func ValidateBackup(backup *Backup) error {
+	if backup.Format != BackupFormat {
+		return fmt.Errorf("%w: format must be %q", ErrInvalidBackup, BackupFormat)
+	}
+	if backup.Version < 1 {
+		return fmt.Errorf("%w: missing version", ErrInvalidBackup)
+	}
+	if backup.Version > BackupVersion {
+		return fmt.Errorf("%w: version %d, supported up to %d", ErrUnsupportedBackupVersion, backup.Version, BackupVersion)
+	}
+	upgradeBackup(backup)
+
+	for i := range backup.Categories {
+		if err := validateCategory(&backup.Categories[i]); err != nil {
+			return fmt.Errorf("%w: category %q: %v", ErrInvalidBackup, backup.Categories[i].Name, err)
+		}
+	}
+	// 长度限制与数据库的列定义一致，超出时返回 ErrInvalidBackup 而不是在写入时失败
+	for _, state := range backup.WorkflowStates {
+		if !KeyPattern.MatchString(state.Key) || state.Name == "" || len([]rune(state.Name)) > 50 ||
+			len([]rune(state.Color)) > maxColorLength {
+			return fmt.Errorf("%w: workflow state %q", ErrInvalidBackup, state.Key)
+		}
+	}
+	for _, def := range backup.CustomFields {
+		if !KeyPattern.MatchString(def.Key) || def.Name == "" || len([]rune(def.Name)) > 50 || !IsValidFieldType(def.Type) {
+			return fmt.Errorf("%w: custom field %q", ErrInvalidBackup, def.Key)
+		}
+	}
+	for i := range backup.Tags {
+		backup.Tags[i].Name = strings.TrimSpace(backup.Tags[i].Name)
+		if backup.Tags[i].Name == "" || len([]rune(backup.Tags[i].Name)) > maxTagLength {
+			return fmt.Errorf("%w: tag %q: %v", ErrInvalidBackup, backup.Tags[i].Name, ErrInvalidTag)
+		}
+		if len([]rune(backup.Tags[i].Color)) > maxColorLength {
+			return fmt.Errorf("%w: tag %q has invalid color", ErrInvalidBackup, backup.Tags[i].Name)
+		}
+	}
+	for i := range backup.SavedFilters {
+		if err := validateSavedFilter(&backup.SavedFilters[i]); err != nil {
+			return fmt.Errorf("%w: saved filter %q: %v", ErrInvalidBackup, backup.SavedFilters[i].Name, err)
+		}
+	}
+
+	for i := range backup.Todos {
+		todo := &backup.Todos[i]
+		var err error
+		if strings.TrimSpace(todo.Task) == "" {
+			return fmt.Errorf("%w: todo %d has no task", ErrInvalidBackup, todo.ID)
+		}
+		if todo.Priority != "" && !IsValidPriority(todo.Priority) {
+			return fmt.Errorf("%w: todo %d has invalid priority", ErrInvalidBackup, todo.ID)
+		}
+		if todo.Tags, err = NormalizeTags(todo.Tags); err != nil {
+			return fmt.Errorf("%w: todo %d: %v", ErrInvalidBackup, todo.ID, err)
+		}
+		if todo.UUID, err = normalizeClientUUID(todo.UUID); err != nil {
+			return fmt.Errorf("%w: todo %d: %v", ErrInvalidBackup, todo.ID, err)
+		}
+		if todo.Category != "" {
+			// 恢复时待办事项的分类会登记到分类目录，使用与分类相同的名称规则
+			category := Category{Name: todo.Category}
+			if err := validateCategory(&category); err != nil {
+				return fmt.Errorf("%w: todo %d has invalid category %q", ErrInvalidBackup, todo.ID, todo.Category)
+			}
+			todo.Category = category.Name
+		}
+		// 自定义字段的值按备份中的字段定义校验，未定义的字段（包括格式无效的 key）被拒绝
+		if todo.CustomFields, err = ValidateCustomFields(backup.CustomFields, todo.CustomFields, false); err != nil {
+			return fmt.Errorf("%w: todo %d: %v", ErrInvalidBackup, todo.ID, err)
+		}
+		for j := range todo.Steps {
+			if todo.Steps[j].UUID, err = normalizeClientUUID(todo.Steps[j].UUID); err != nil {
+				return fmt.Errorf("%w: step %d: %v", ErrInvalidBackup, todo.Steps[j].ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// upgradeBackup 把旧版本的备份转换为当前版本（目前只有版本 1）
+func upgradeBackup(backup *Backup) {
+	backup.Version = BackupVersion
+}
+
+// Restore 把备份恢复到用户账户，所有写入在一个事务中完成，失败时账户保持不变。
+// 分类、工作流状态、自定义字段、标签和过滤器按名称或 key 去重；待办事项和步骤按 UUID 去重，
+// UUID 已被其他账户使用时重新生成。所有实体使用新分配的ID，用户资料不会被修改。
+// 客户端ID只对原来的设备有意义，恢复时不保留。
+func (m *BackupModel) Restore(userID int, backup *Backup, mode string) (*RestoreReport, error) {
+	if mode == "" {
+		mode = RestoreModeMerge
+	}
+	if mode != RestoreModeMerge && mode != RestoreModeReplace {
+		return nil, ErrInvalidRestoreMode
+	}
+	if err := ValidateBackup(backup); err != nil {
+		return nil, err
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	// 锁定用户，避免同一账户的两次恢复交错执行
+	var id int
+	if err := tx.QueryRow("SELECT id FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("lock user failed: %w", err)
+	}
+
+	report := &RestoreReport{Mode: mode, TodoIDs: map[int]int{}, StepIDs: map[int]int{}}
+
+	if mode == RestoreModeReplace {
+		if report.DeletedTodos, err = clearAccount(tx, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := restoreSettings(tx, userID, backup, report); err != nil {
+		return nil, err
+	}
+	if err := restoreTodos(tx, userID, backup.Todos, report); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit transaction failed: %w", err)
+	}
+	return report, nil
+}
+
+// clearAccount 删除用户的待办事项（级联删除步骤）和所有设置，返回删除的待办事项数
+func clearAccount(tx *sql.Tx, userID int) (int, error) {
+	result, err := tx.Exec("DELETE FROM todos WHERE user_id = $1", userID)
+	if err != nil {
+		return 0, fmt.Errorf("delete todos failed: %w", err)
+	}
+	deleted, _ := result.RowsAffected()
+
+	for _, table := range []string{"tags", "saved_filters", "custom_field_definitions", "categories", "workflow_states"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE user_id = $1", userID); err != nil {
+			return 0, fmt.Errorf("delete %s failed: %w", table, err)
+		}
+	}
+	return int(deleted), nil
+}
+
+// countInsert 执行 ON CONFLICT DO NOTHING 的插入，按是否插入了行计入 created 或 skipped
+func countInsert(tx *sql.Tx, count *RestoreCount, query string, args ...interface{}) error {
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		count.Created++
+	} else {
+		count.Skipped++
+	}
+	return nil
+}
+
+// backupTime 备份中缺失的时间（零值）由数据库使用默认值
+func backupTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+// restoreSettings 恢复分类、工作流状态、自定义字段、标签和保存的过滤器
+func restoreSettings(tx *sql.Tx, userID int, backup *Backup, report *RestoreReport) error {
+	for _, c := range backup.Categories {
+		err := countInsert(tx, &report.Categories,
+			`INSERT INTO categories (user_id, name, icon, color, default_priority, position, created_at)
+			 VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), $6, COALESCE($7, NOW()))
+			 ON CONFLICT (user_id, name) DO NOTHING`,
+			userID, c.Name, c.Icon, c.Color, c.DefaultPriority, c.Position, backupTime(c.CreatedAt),
+		)
+		if err != nil {
+			return fmt.Errorf("restore category failed: %w", err)
+		}
+	}
+
+	for _, s := range backup.WorkflowStates {
+		err := countInsert(tx, &report.WorkflowStates,
+			`INSERT INTO workflow_states (user_id, key, name, position, counts_as_done, wip_limit, color, created_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), COALESCE($8, NOW()))
+			 ON CONFLICT (user_id, key) DO NOTHING`,
+			userID, s.Key, s.Name, s.Position, s.CountsAsDone, s.WIPLimit, s.Color, backupTime(s.CreatedAt),
+		)
+		if err != nil {
+			return fmt.Errorf("restore workflow state failed: %w", err)
+		}
+	}
+
+	for _, def := range backup.CustomFields {
+		optionsJSON, err := json.Marshal(def.Options)
+		if err != nil {
+			return fmt.Errorf("marshal options failed: %w", err)
+		}
+		err = countInsert(tx, &report.CustomFields,
+			`INSERT INTO custom_field_definitions (user_id, key, name, type, options, required, position, created_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, COALESCE($8, NOW()))
+			 ON CONFLICT (user_id, key) DO NOTHING`,
+			userID, def.Key, def.Name, def.Type, string(optionsJSON), def.Required, def.Position, backupTime(def.CreatedAt),
+		)
+		if err != nil {
+			return fmt.Errorf("restore custom field failed: %w", err)
+		}
+	}
+
+	for _, tag := range backup.Tags {
+		err := countInsert(tx, &report.Tags,
+			`INSERT INTO tags (user_id, name, color, description, created_at)
+			 VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), COALESCE($5, NOW()))
+			 ON CONFLICT (user_id, name) DO NOTHING`,
+			userID, tag.Name, tag.Color, tag.Description, backupTime(tag.CreatedAt),
+		)
+		if err != nil {
+			return fmt.Errorf("restore tag failed: %w", err)
+		}
+	}
+
+	for _, f := range backup.SavedFilters {
+		err := countInsert(tx, &report.SavedFilters,
+			`INSERT INTO saved_filters (user_id, name, icon, criteria, pinned, position, created_at, updated_at)
+			 VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, COALESCE($7, NOW()), NOW())
+			 ON CONFLICT (user_id, name) DO NOTHING`,
+			userID, f.Name, f.Icon, string(f.Criteria), f.Pinned, f.Position, backupTime(f.CreatedAt),
+		)
+		if err != nil {
+			return fmt.Errorf("restore saved filter failed: %w", err)
+		}
+	}
+
+	// 备份中没有分类或状态时（例如清空后恢复旧备份）使用默认设置
+	if err := ensureDefaultCategories(tx, userID); err != nil {
+		return err
+	}
+	return ensureDefaultStates(tx, userID)
+}
+
+// restoreTodos 恢复待办事项和步骤。待办事项使用的分类不存在时登记到分类中，
+// 状态不存在时清空，由 sync_todo_status 触发器按完成标记推导
+func restoreTodos(tx *sql.Tx, userID int, todos []Todo, report *RestoreReport) error {
+	categories := make([]string, 0, len(todos))
+	for i := range todos {
+		if todos[i].Category == "" {
+			todos[i].Category = defaultCategoryName
+		}
+		categories = append(categories, todos[i].Category)
+	}
+	_, err := tx.Exec(
+		`INSERT INTO categories (user_id, name, position)
+		 SELECT DISTINCT $1::int, name, 100 FROM unnest($2::text[]) AS name
+		 ON CONFLICT (user_id, name) DO NOTHING`,
+		userID, pq.Array(categories),
+	)
+	if err != nil {
+		return fmt.Errorf("register categories failed: %w", err)
+	}
+
+	states := map[string]bool{}
+	rows, err := tx.Query("SELECT key FROM workflow_states WHERE user_id = $1", userID)
+	if err != nil {
+		return fmt.Errorf("query workflow states failed: %w", err)
+	}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan workflow state failed: %w", err)
+		}
+		states[key] = true
+	}
+	rows.Close()
+
+	for _, todo := range todos {
+		owner, err := uuidOwner(tx, "todos", "user_id", todo.UUID)
+		if err != nil {
+			return err
+		}
+		if owner == userID {
+			report.Todos.Skipped++
+			report.Steps.Skipped += len(todo.Steps)
+			continue
+		}
+		if owner != 0 {
+			todo.UUID = ""
+			report.ReassignedUUIDs++
+		}
+		if todo.Status != "" && !states[todo.Status] {
+			todo.Status = ""
+			report.ClearedStatuses++
+		}
+		if todo.Priority == "" {
+			todo.Priority = "medium"
+		}
+
+		tagsJSON, customFieldsJSON, err := snapshotJSON(todo)
+		if err != nil {
+			return err
+		}
+		var newID int
+		err = tx.QueryRow(`
+			INSERT INTO todos (
+				task, description, done, priority, category, due_date, reminder, estimated_time,
+				tags, user_id, status, status_changed_at, custom_fields, created_at, updated_at,
+				completed_at, uuid
+			) VALUES (
+				$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, ''), $12, $13,
+				COALESCE($14, NOW()), NOW(), $15, COALESCE(NULLIF($16, '')::uuid, uuid_generate_v7())
+			)
+			RETURNING id
+		`,
+			todo.Task, todo.Description, todo.Done, todo.Priority, todo.Category, todo.DueDate,
+			todo.Reminder, todo.EstimatedTime, tagsJSON, userID, todo.Status, todo.StatusChangedAt,
+			customFieldsJSON, backupTime(todo.CreatedAt), todo.CompletedAt, todo.UUID,
+		).Scan(&newID)
+		if err != nil {
+			return fmt.Errorf("restore todo failed: %w", err)
+		}
+		report.Todos.Created++
+		if todo.ID != 0 {
+			report.TodoIDs[todo.ID] = newID
+		}
+
+		for _, step := range todo.Steps {
+			if owner, err := uuidOwner(tx, "steps", "todo_id", step.UUID); err != nil {
+				return err
+			} else if owner != 0 {
+				step.UUID = ""
+				report.ReassignedUUIDs++
+			}
+			var stepID int
+			if err := tx.QueryRow(insertStepQuery, newID, step.Content, step.Completed, "", step.UUID).Scan(&stepID, &step.UUID); err != nil {
+				return fmt.Errorf("restore step failed: %w", err)
+			}
+			report.Steps.Created++
+			if step.ID != 0 {
+				report.StepIDs[step.ID] = stepID
+			}
+		}
+
+		if err := syncTagCatalog(tx, userID, todo.Tags); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uuidOwner 返回使用该 UUID 的行的 owner 列（待办事项的用户ID或步骤的待办事项ID），未使用时返回 0
+func uuidOwner(db execer, table, ownerColumn, uuid string) (int, error) {
+	if uuid == "" {
+		return 0, nil
+	}
+	var owner sql.NullInt64
+	err := db.QueryRow("SELECT "+ownerColumn+" FROM "+table+" WHERE uuid = $1", uuid).Scan(&owner)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("check %s uuid failed: %w", table, err)
+	}
+	if !owner.Valid {
+		return -1, nil
+	}
+	return int(owner.Int64), nil
+}
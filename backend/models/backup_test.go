@@ -0,0 +1,87 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func validBackup() *Backup {
+	return &Backup{
+		Format:       BackupFormat,
+		Version:      BackupVersion,
+		Categories:   []Category{{Name: " work "}},
+		Tags:         []Tag{{Name: "home"}},
+		SavedFilters: []SavedFilter{{Name: "today"}},
+		Todos: []Todo{{
+			ID:       7,
+			UUID:     "0190A6E2-3C4B-7D8E-9F01-23456789ABCD",
+			Task:     "write report",
+			Category: " work",
+			Tags:     []string{" a ", "a", ""},
+			Steps:    []Step{{ID: 9, Content: "outline"}},
+		}},
+	}
+}
+
+func TestValidateBackup(t *testing.T) {
+	backup := validBackup()
+	if err := ValidateBackup(backup); err != nil {
+		t.Fatalf("ValidateBackup: %v", err)
+	}
+	// 名称、分类、标签和 UUID 被规范化，缺失的过滤条件使用空对象
+	if backup.Categories[0].Name != "work" || backup.Todos[0].Category != "work" || len(backup.Todos[0].Tags) != 1 ||
+		backup.Todos[0].UUID != "0190a6e2-3c4b-7d8e-9f01-23456789abcd" ||
+		string(backup.SavedFilters[0].Criteria) != "{}" {
+		t.Errorf("backup not normalized: %+v", backup)
+	}
+
+	cases := []struct {
+		name   string
+		modify func(*Backup)
+		want   error
+	}{
+		{"format", func(b *Backup) { b.Format = "other" }, ErrInvalidBackup},
+		{"missing version", func(b *Backup) { b.Version = 0 }, ErrInvalidBackup},
+		{"future version", func(b *Backup) { b.Version = BackupVersion + 1 }, ErrUnsupportedBackupVersion},
+		{"category", func(b *Backup) { b.Categories[0].DefaultPriority = "urgent" }, ErrInvalidBackup},
+		{"saved filter", func(b *Backup) { b.SavedFilters[0].Criteria = json.RawMessage("[]") }, ErrInvalidBackup},
+		{"task", func(b *Backup) { b.Todos[0].Task = " " }, ErrInvalidBackup},
+		{"uuid", func(b *Backup) { b.Todos[0].Steps[0].UUID = "42" }, ErrInvalidBackup},
+		// key 会出现在排序表达式中，只接受与 API 相同的格式
+		{"custom field key", func(b *Backup) {
+			b.CustomFields = []CustomFieldDefinition{{Key: "a'||pg_sleep(9)||'", Name: "x", Type: FieldTypeText}}
+		}, ErrInvalidBackup},
+		{"workflow state key", func(b *Backup) { b.WorkflowStates = []WorkflowState{{Key: "Done", Name: "Done"}} }, ErrInvalidBackup},
+		{"todo custom field key", func(b *Backup) { b.Todos[0].CustomFields = map[string]interface{}{"x'": 1} }, ErrInvalidBackup},
+		// 长度超过数据库列定义的值
+		{"todo category", func(b *Backup) { b.Todos[0].Category = strings.Repeat("c", 21) }, ErrInvalidBackup},
+		{"custom field name", func(b *Backup) {
+			b.CustomFields = []CustomFieldDefinition{{Key: "size", Name: strings.Repeat("n", 51), Type: FieldTypeText}}
+		}, ErrInvalidBackup},
+		{"workflow state color", func(b *Backup) {
+			b.WorkflowStates = []WorkflowState{{Key: "done", Name: "Done", Color: strings.Repeat("f", 21)}}
+		}, ErrInvalidBackup},
+		{"tag color", func(b *Backup) { b.Tags[0].Color = strings.Repeat("f", 21) }, ErrInvalidBackup},
+		{"todo custom field value", func(b *Backup) {
+			b.CustomFields = []CustomFieldDefinition{{Key: "points", Name: "Points", Type: FieldTypeNumber}}
+			b.Todos[0].CustomFields = map[string]interface{}{"points": "many"}
+		}, ErrInvalidBackup},
+		{"undefined todo custom field", func(b *Backup) { b.Todos[0].CustomFields = map[string]interface{}{"points": 1} }, ErrInvalidBackup},
+	}
+	for _, c := range cases {
+		backup := validBackup()
+		c.modify(backup)
+		if err := ValidateBackup(backup); !errors.Is(err, c.want) {
+			t.Errorf("%s: error = %v, want %v", c.name, err, c.want)
+		}
+	}
+}
+
+func TestRestoreInvalidMode(t *testing.T) {
+	m := &BackupModel{}
+	if _, err := m.Restore(1, validBackup(), "overwrite"); err != ErrInvalidRestoreMode {
+		t.Errorf("Restore error = %v, want ErrInvalidRestoreMode", err)
+	}
+}
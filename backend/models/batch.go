@@ -0,0 +1,435 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaxBatchSize 一次批量操作最多包含的待办事项数量
+const MaxBatchSize = 200
+
+// 批量操作模式
+const (
+	BatchAtomic     = "atomic"      // 所有项在同一个事务中，任意一项失败则全部回滚
+	BatchBestEffort = "best-effort" // 每一项独立生效，失败的项不影响其他项
+)
+
+// 批量操作中单项的结果状态
+const (
+	BatchItemUpdated    = "updated"
+	BatchItemDeleted    = "deleted"
+	BatchItemNotFound   = "not_found"   // 不存在或不属于当前用户
+	BatchItemConflict   = "conflict"    // 版本号与期望不一致
+	BatchItemFailed     = "failed"      // 写入失败
+	BatchItemRolledBack = "rolled_back" // 原子模式下因其他项失败而回滚
+)
+
+// NullableTime 区分JSON中缺省的字段（Set 为 false）和显式的 null（Set 为 true，Value 为 nil）
+type NullableTime struct {
+	Set   bool
+	Value *time.Time
+}
+
+// UnmarshalJSON 实现 json.Unmarshaler
+func (n *NullableTime) UnmarshalJSON(data []byte) error {
+	n.Set = true
+	return json.Unmarshal(data, &n.Value)
+}
+
+// NullableInt 区分JSON中缺省的字段和显式的 null
+type NullableInt struct {
+	Set   bool
+	Value *int
+}
+
+// UnmarshalJSON 实现 json.Unmarshaler
+func (n *NullableInt) UnmarshalJSON(data []byte) error {
+	n.Set = true
+	return json.Unmarshal(data, &n.Value)
+}
+
+// TodoBatchUpdate 批量更新的内容，未提供的字段保持不变
+type TodoBatchUpdate struct {
+	Task          *string      `json:"task"`
+	Description   *string      `json:"description"`
+	Done          *bool        `json:"done"`
+	Priority      *string      `json:"priority"`
+	Category      *string      `json:"category"`
+	DueDate       NullableTime `json:"dueDate"` // null 清除截止日期
+	Reminder      *bool        `json:"reminder"`
+	EstimatedTime NullableInt  `json:"estimatedTime"`
+	Status        *string      `json:"status"`
+
+	AddTags    []string `json:"addTags"`
+	RemoveTags []string `json:"removeTags"`
+
+	AddSteps             []string `json:"addSteps"`             // 追加的步骤内容
+	CompleteSteps        *bool    `json:"completeSteps"`        // 把所有步骤标记为完成/未完成
+	RemoveCompletedSteps bool     `json:"removeCompletedSteps"` // 删除已完成的步骤
+}
+
+// BatchItemResult 批量操作中一项的结果
+type BatchItemResult struct {
+	ID      int    `json:"id"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	Version int    `json:"version,omitempty"` // 写入后的版本号；冲突时为当前版本号
+}
+
+// BatchResult 批量操作的结果，Results 与请求中的ID顺序一致
+type BatchResult struct {
+	Mode      string            `json:"mode"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Results   []BatchItemResult `json:"results"`
+}
+
+// IsValidBatchMode 判断批量操作模式是否有效
+func IsValidBatchMode(mode string) bool {
+	return mode == BatchAtomic || mode == BatchBestEffort
+}
+
+// uniqueIDs 去除重复的ID并保持顺序
+func uniqueIDs(ids []int) []int {
+	seen := make(map[int]bool, len(ids))
+	unique := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// validateBatchRequest 校验批量操作的ID数量、模式和版本号
+func validateBatchRequest(ids []int, versions map[int]int, mode string) error {
+	if len(ids) == 0 {
+		return &TodoFieldError{Field: "todoIds", Message: "no todo IDs provided"}
+	}
+	if len(ids) > MaxBatchSize {
+		return &TodoFieldError{Field: "todoIds", Message: fmt.Sprintf("at most %d todos per batch", MaxBatchSize)}
+	}
+	if !IsValidBatchMode(mode) {
+		return &TodoFieldError{Field: "mode", Message: "mode must be atomic or best-effort"}
+	}
+	requested := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		requested[id] = true
+	}
+	for id := range versions {
+		if !requested[id] {
+			return &TodoFieldError{Field: "versions", Message: fmt.Sprintf("todo %d is not in todoIds", id)}
+		}
+	}
+	return nil
+}
+
+// prepare 校验并规范化批量更新的内容，返回 SET 子句（参数从 $1 开始）
+func (u *TodoBatchUpdate) prepare(db execer, userID int) ([]string, []interface{}, error) {
+	var setParts []string
+	var args []interface{}
+	set := func(column string, value interface{}) {
+		args = append(args, value)
+		setParts = append(setParts, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	if u.Task != nil {
+		task := strings.TrimSpace(*u.Task)
+		if task == "" {
+			return nil, nil, &TodoFieldError{Field: "task", Message: "task is required"}
+		}
+		set("task", task)
+	}
+	if u.Description != nil {
+		set("description", *u.Description)
+	}
+	if u.Done != nil {
+		set("done", *u.Done)
+	}
+	if u.Priority != nil {
+		if !IsValidPriority(*u.Priority) {
+			return nil, nil, &TodoFieldError{Field: "priority", Message: "priority must be low, medium or high"}
+		}
+		set("priority", *u.Priority)
+	}
+	if u.Category != nil {
+		todo := Todo{UserID: userID, Category: *u.Category, Priority: "medium"}
+		if *u.Category == "" {
+			return nil, nil, &TodoFieldError{Field: "category", Message: "category is required"}
+		}
+		if err := resolveTodoCategory(db, &todo); err != nil {
+			return nil, nil, err
+		}
+		set("category", todo.Category)
+	}
+	if u.DueDate.Set {
+		set("due_date", u.DueDate.Value)
+	}
+	if u.Reminder != nil {
+		set("reminder", *u.Reminder)
+	}
+	if u.EstimatedTime.Set {
+		if u.EstimatedTime.Value != nil && *u.EstimatedTime.Value < 0 {
+			return nil, nil, &TodoFieldError{Field: "estimatedTime", Message: "estimated time must not be negative"}
+		}
+		set("estimated_time", u.EstimatedTime.Value)
+	}
+	if u.Status != nil {
+		if err := ensureDefaultStates(db, userID); err != nil {
+			return nil, nil, err
+		}
+		if _, err := getStateByKey(db, userID, *u.Status); err != nil {
+			return nil, nil, err
+		}
+		set("status", *u.Status)
+	}
+
+	// 标签增删合并为一次 tags 赋值：先追加再移除，追加后去重并保留顺序
+	var err error
+	if u.AddTags, err = NormalizeTags(u.AddTags); err != nil {
+		return nil, nil, err
+	}
+	if u.RemoveTags, err = NormalizeTags(u.RemoveTags); err != nil {
+		return nil, nil, err
+	}
+	tagsExpr := "tags"
+	if len(u.AddTags) > 0 {
+		tagsJSON, _ := json.Marshal(u.AddTags)
+		args = append(args, string(tagsJSON))
+		tagsExpr = fmt.Sprintf(`(
+			SELECT COALESCE(jsonb_agg(e ORDER BY pos), '[]'::jsonb)
+			FROM (
+				SELECT DISTINCT ON (e) e, pos
+				FROM jsonb_array_elements_text(COALESCE(tags, '[]'::jsonb) || $%d::jsonb) WITH ORDINALITY AS x(e, pos)
+				ORDER BY e, pos
+			) deduped
+		)`, len(args))
+	}
+	if len(u.RemoveTags) > 0 {
+		tagsJSON, _ := json.Marshal(u.RemoveTags)
+		args = append(args, string(tagsJSON))
+		tagsExpr = fmt.Sprintf("(%s - ARRAY(SELECT jsonb_array_elements_text($%d::jsonb)))", tagsExpr, len(args))
+	}
+	if tagsExpr != "tags" {
+		setParts = append(setParts, "tags = "+tagsExpr)
+	}
+
+	for i, content := range u.AddSteps {
+		u.AddSteps[i] = strings.TrimSpace(content)
+		if u.AddSteps[i] == "" {
+			return nil, nil, &TodoFieldError{Field: fmt.Sprintf("addSteps/%d", i), Message: "step content is required"}
+		}
+	}
+
+	hasStepOps := len(u.AddSteps) > 0 || u.CompleteSteps != nil || u.RemoveCompletedSteps
+	if len(setParts) == 0 && !hasStepOps {
+		return nil, nil, &TodoFieldError{Field: "updates", Message: "no updates provided"}
+	}
+
+	// completed_at 和 status 由触发器同步
+	setParts = append(setParts, "updated_at = NOW()")
+	return setParts, args, nil
+}
+
+// applyStepOps 对一个待办事项执行批量更新中的步骤操作
+func (u *TodoBatchUpdate) applyStepOps(tx *sql.Tx, todoID int) error {
+	if u.CompleteSteps != nil {
+		if _, err := tx.Exec(
+			"UPDATE steps SET completed = $1 WHERE todo_id = $2 AND completed <> $1",
+			*u.CompleteSteps, todoID,
+		); err != nil {
+			return fmt.Errorf("update steps failed: %w", err)
+		}
+	}
+	if u.RemoveCompletedSteps {
+		if _, err := tx.Exec("DELETE FROM steps WHERE todo_id = $1 AND completed", todoID); err != nil {
+			return fmt.Errorf("delete completed steps failed: %w", err)
+		}
+	}
+	for _, content := range u.AddSteps {
+		if _, err := tx.Exec(
+			"INSERT INTO steps (todo_id, content, completed) VALUES ($1, $2, FALSE)",
+			todoID, content,
+		); err != nil {
+			return fmt.Errorf("insert step failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// missingItemResult 写入没有命中行时，区分待办事项不存在和版本冲突
+func missingItemResult(tx *sql.Tx, userID, todoID int) (BatchItemResult, error) {
+	var version int
+	err := tx.QueryRow("SELECT version FROM todos WHERE id = $1 AND user_id = $2", todoID, userID).Scan(&version)
+	if err == sql.ErrNoRows {
+		return BatchItemResult{ID: todoID, Status: BatchItemNotFound, Error: "todo not found"}, nil
+	}
+	if err != nil {
+		return BatchItemResult{}, fmt.Errorf("get todo version failed: %w", err)
+	}
+	return BatchItemResult{ID: todoID, Status: BatchItemConflict, Error: "todo has been modified", Version: version}, nil
+}
+
+// runBatch 在一个事务中逐项执行 apply。原子模式下任意一项失败则回滚整个事务；
+// 尽力模式下每一项使用单独的保存点，失败的项只回滚自身。
+func (m *TodoModel) runBatch(ids []int, mode string, prepare func(tx *sql.Tx) error, apply func(tx *sql.Tx, id int) (BatchItemResult, error)) (*BatchResult, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	if prepare != nil {
+		if err := prepare(tx); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &BatchResult{Mode: mode, Results: make([]BatchItemResult, 0, len(ids))}
+	for _, id := range ids {
+		if mode == BatchBestEffort {
+			if _, err := tx.Exec("SAVEPOINT batch_item"); err != nil {
+				return nil, fmt.Errorf("create savepoint failed: %w", err)
+			}
+		}
+
+		item, err := apply(tx, id)
+		if err != nil {
+			item = BatchItemResult{ID: id, Status: BatchItemFailed, Error: err.Error()}
+		}
+		ok := item.Status == BatchItemUpdated || item.Status == BatchItemDeleted
+
+		if mode == BatchBestEffort {
+			stmt := "RELEASE SAVEPOINT batch_item"
+			if !ok {
+				stmt = "ROLLBACK TO SAVEPOINT batch_item"
+			}
+			if _, err := tx.Exec(stmt); err != nil {
+				return nil, fmt.Errorf("savepoint failed: %w", err)
+			}
+		}
+
+		if ok {
+			result.Succeeded++
+		} else {
+			result.Failed++
+		}
+		result.Results = append(result.Results, item)
+
+		// 原子模式：第一项失败后停止，其余项不再执行
+		if !ok && mode == BatchAtomic {
+			break
+		}
+	}
+
+	if mode == BatchAtomic && result.Failed > 0 {
+		// 已成功的项随事务回滚，未执行的项同样标记为回滚
+		done := make(map[int]bool, len(result.Results))
+		for i := range result.Results {
+			done[result.Results[i].ID] = true
+			if result.Results[i].Status == BatchItemUpdated || result.Results[i].Status == BatchItemDeleted {
+				result.Results[i] = BatchItemResult{ID: result.Results[i].ID, Status: BatchItemRolledBack}
+			}
+		}
+		for _, id := range ids {
+			if !done[id] {
+				result.Results = append(result.Results, BatchItemResult{ID: id, Status: BatchItemRolledBack})
+			}
+		}
+		result.Succeeded = 0
+		return result, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit transaction failed: %w", err)
+	}
+	return result, nil
+}
+
+// BatchUpdateTodos 批量更新用户的待办事项。versions 可选（待办事项ID -> 期望的版本号）。
+// 请求本身无效（数量超限、字段值无效等）时返回错误；单项的失败记录在结果中。
+func (m *TodoModel) BatchUpdateTodos(userID int, ids []int, update *TodoBatchUpdate, versions map[int]int, mode string) (*BatchResult, error) {
+	ids = uniqueIDs(ids)
+	if err := validateBatchRequest(ids, versions, mode); err != nil {
+		return nil, err
+	}
+
+	var setParts []string
+	var args []interface{}
+	prepare := func(tx *sql.Tx) error {
+		var err error
+		if setParts, args, err = update.prepare(tx, userID); err != nil {
+			return err
+		}
+		// 新增的标签登记到标签目录
+		return syncTagCatalog(tx, userID, update.AddTags)
+	}
+
+	apply := func(tx *sql.Tx, id int) (BatchItemResult, error) {
+		var version interface{}
+		if expected, ok := versions[id]; ok {
+			version = expected
+		}
+		n := len(args)
+		query := fmt.Sprintf(
+			"UPDATE todos SET %s WHERE id = $%d AND user_id = $%d AND ($%d::int IS NULL OR version = $%d::int) RETURNING version",
+			strings.Join(setParts, ", "), n+1, n+2, n+3, n+3,
+		)
+		itemArgs := append(append([]interface{}{}, args...), id, userID, version)
+
+		var newVersion int
+		err := tx.QueryRow(query, itemArgs...).Scan(&newVersion)
+		if err == sql.ErrNoRows {
+			return missingItemResult(tx, userID, id)
+		}
+		if err != nil {
+			return BatchItemResult{}, fmt.Errorf("update todo failed: %w", err)
+		}
+
+		if len(update.AddSteps) > 0 || update.CompleteSteps != nil || update.RemoveCompletedSteps {
+			if err := update.applyStepOps(tx, id); err != nil {
+				return BatchItemResult{}, err
+			}
+			// 步骤变化会再次递增版本号
+			if newVersion, err = currentVersion(tx, id); err != nil {
+				return BatchItemResult{}, err
+			}
+		}
+		return BatchItemResult{ID: id, Status: BatchItemUpdated, Version: newVersion}, nil
+	}
+
+	return m.runBatch(ids, mode, prepare, apply)
+}
+
+// BatchDeleteTodos 批量删除用户的待办事项，versions 与 BatchUpdateTodos 相同
+func (m *TodoModel) BatchDeleteTodos(userID int, ids []int, versions map[int]int, mode string) (*BatchResult, error) {
+	ids = uniqueIDs(ids)
+	if err := validateBatchRequest(ids, versions, mode); err != nil {
+		return nil, err
+	}
+
+	apply := func(tx *sql.Tx, id int) (BatchItemResult, error) {
+		var version interface{}
+		if expected, ok := versions[id]; ok {
+			version = expected
+		}
+		// 由于设置了外键约束，删除待办事项时会自动删除相关步骤
+		result, err := tx.Exec(
+			"DELETE FROM todos WHERE id = $1 AND user_id = $2 AND ($3::int IS NULL OR version = $3::int)",
+			id, userID, version,
+		)
+		if err != nil {
+			return BatchItemResult{}, fmt.Errorf("delete todo failed: %w", err)
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			return missingItemResult(tx, userID, id)
+		}
+		return BatchItemResult{ID: id, Status: BatchItemDeleted}, nil
+	}
+
+	return m.runBatch(ids, mode, nil, apply)
+}
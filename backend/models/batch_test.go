@@ -0,0 +1,114 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTodoBatchUpdateDecode(t *testing.T) {
+	var update TodoBatchUpdate
+	if err := json.Unmarshal([]byte(`{"dueDate":null,"estimatedTime":30,"done":true}`), &update); err != nil {
+		t.Fatal(err)
+	}
+	if !update.DueDate.Set || update.DueDate.Value != nil {
+		t.Errorf("dueDate = %+v, want explicit null", update.DueDate)
+	}
+	if !update.EstimatedTime.Set || update.EstimatedTime.Value == nil || *update.EstimatedTime.Value != 30 {
+		t.Errorf("estimatedTime = %+v, want 30", update.EstimatedTime)
+	}
+	if update.Done == nil || !*update.Done || update.Priority != nil {
+		t.Errorf("done/priority = %v/%v", update.Done, update.Priority)
+	}
+
+	var empty TodoBatchUpdate
+	if err := json.Unmarshal([]byte(`{}`), &empty); err != nil {
+		t.Fatal(err)
+	}
+	if empty.DueDate.Set || empty.EstimatedTime.Set {
+		t.Errorf("absent fields decoded as set: %+v", empty)
+	}
+}
+
+func TestValidateBatchRequest(t *testing.T) {
+	tooMany := make([]int, MaxBatchSize+1)
+	for i := range tooMany {
+		tooMany[i] = i + 1
+	}
+
+	tests := []struct {
+		ids      []int
+		versions map[int]int
+		mode     string
+		field    string
+	}{
+		{[]int{1, 2}, map[int]int{2: 3}, BatchAtomic, ""},
+		{[]int{1}, nil, BatchBestEffort, ""},
+		{nil, nil, BatchAtomic, "todoIds"},
+		{tooMany, nil, BatchAtomic, "todoIds"},
+		{[]int{1}, nil, "all-or-nothing", "mode"},
+		{[]int{1}, map[int]int{9: 1}, BatchAtomic, "versions"},
+	}
+
+	for _, tt := range tests {
+		err := validateBatchRequest(tt.ids, tt.versions, tt.mode)
+		if tt.field == "" {
+			if err != nil {
+				t.Errorf("validateBatchRequest(%v, %v, %q) = %v", tt.ids, tt.versions, tt.mode, err)
+			}
+			continue
+		}
+		var fieldErr *TodoFieldError
+		if !errors.As(err, &fieldErr) || fieldErr.Field != tt.field {
+			t.Errorf("validateBatchRequest(%d ids, %v, %q) = %v, want error on %s", len(tt.ids), tt.versions, tt.mode, err, tt.field)
+		}
+	}
+
+	if got := uniqueIDs([]int{3, 1, 3, 2, 1}); !reflect.DeepEqual(got, []int{3, 1, 2}) {
+		t.Errorf("uniqueIDs = %v", got)
+	}
+}
+
+func TestTodoBatchUpdatePrepare(t *testing.T) {
+	high := "high"
+	update := TodoBatchUpdate{
+		Priority:   &high,
+		AddTags:    []string{"Urgent"},
+		RemoveTags: []string{"later"},
+		AddSteps:   []string{"  call back "},
+	}
+	// 不涉及分类和状态时不需要访问数据库
+	setParts, args, err := update.prepare(nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(setParts) != 3 || setParts[0] != "priority = $1" || !strings.HasPrefix(setParts[1], "tags = ") || setParts[2] != "updated_at = NOW()" {
+		t.Errorf("setParts = %v", setParts)
+	}
+	if len(args) != 3 || args[0] != "high" {
+		t.Errorf("args = %v", args)
+	}
+	if update.AddSteps[0] != "call back" {
+		t.Errorf("step content = %q, want trimmed", update.AddSteps[0])
+	}
+
+	invalid := "urgent"
+	tests := []struct {
+		update TodoBatchUpdate
+		field  string
+	}{
+		{TodoBatchUpdate{}, "updates"},
+		{TodoBatchUpdate{Priority: &invalid}, "priority"},
+		{TodoBatchUpdate{AddSteps: []string{" "}}, "addSteps/0"},
+		{TodoBatchUpdate{EstimatedTime: NullableInt{Set: true, Value: new(int)}, Task: new(string)}, "task"},
+	}
+	for _, tt := range tests {
+		_, _, err := tt.update.prepare(nil, 1)
+		var fieldErr *TodoFieldError
+		if !errors.As(err, &fieldErr) || fieldErr.Field != tt.field {
+			t.Errorf("prepare(%+v) = %v, want error on %s", tt.update, err, tt.field)
+		}
+	}
+}
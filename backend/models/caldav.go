@@ -0,0 +1,196 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CalDAVObject CalDAV 日历集合中的一个对象（一个待办事项）。
+// Name 是资源名（URL 的最后一段），UID 是 iCalendar UID；没有映射时分别为 <uuid>.ics 和 <uuid>
+type CalDAVObject struct {
+	Todo Todo
+	Name string
+	UID  string
+}
+
+// CalDAVModel 把 CalDAV 对象映射到待办事项的增删改查
+type CalDAVModel struct {
+	DB           *sql.DB
+	Todos        *TodoModel
+	AppPasswords *AppPasswordModel
+}
+
+// NewCalDAVModel 创建一个新的CalDAVModel实例
+func NewCalDAVModel(db *sql.DB, todos *TodoModel, appPasswords *AppPasswordModel) *CalDAVModel {
+	return &CalDAVModel{DB: db, Todos: todos, AppPasswords: appPasswords}
+}
+
+// caldavObjectQuery 查询待办事项及其资源名和 UID，调用方追加条件
+const caldavObjectQuery = `SELECT ` + TodoColumns + `,
+	COALESCE((SELECT o.name FROM caldav_objects o WHERE o.todo_id = todos.id), uuid::text || '.ics'),
+	COALESCE((SELECT o.uid FROM caldav_objects o WHERE o.todo_id = todos.id), uuid::text)
+	FROM todos WHERE user_id = $1`
+
+// queryObjects 查询用户的 CalDAV 对象（包含步骤）
+func (m *CalDAVModel) queryObjects(userID int, condition string, args ...interface{}) ([]CalDAVObject, error) {
+	rows, err := m.DB.Query(caldavObjectQuery+condition+" ORDER BY id", append([]interface{}{userID}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("query caldav objects failed: %w", err)
+	}
+	defer rows.Close()
+
+	objects := []CalDAVObject{}
+	todos := []Todo{}
+	for rows.Next() {
+		var obj CalDAVObject
+		scanner := extraScanner{rows: rows, extra: []interface{}{&obj.Name, &obj.UID}}
+		if obj.Todo, err = ScanTodo(scanner); err != nil {
+			return nil, fmt.Errorf("scan caldav object failed: %w", err)
+		}
+		objects = append(objects, obj)
+		todos = append(todos, obj.Todo)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate caldav objects failed: %w", err)
+	}
+	rows.Close()
+
+	if err := m.Todos.AttachSteps(todos); err != nil {
+		return nil, err
+	}
+	for i := range objects {
+		objects[i].Todo.Steps = todos[i].Steps
+	}
+	return objects, nil
+}
+
+// extraScanner 在 TodoColumns 之后多扫描几列
+type extraScanner struct {
+	rows  rowScanner
+	extra []interface{}
+}
+
+func (s extraScanner) Scan(dest ...interface{}) error {
+	return s.rows.Scan(append(dest, s.extra...)...)
+}
+
+// queryObject 查询单个对象，不存在时返回 ErrTodoNotFound
+func (m *CalDAVModel) queryObject(userID int, condition string, args ...interface{}) (*CalDAVObject, error) {
+	objects, err := m.queryObjects(userID, condition, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, ErrTodoNotFound
+	}
+	return &objects[0], nil
+}
+
+// Objects 返回用户的全部 CalDAV 对象
+func (m *CalDAVModel) Objects(userID int) ([]CalDAVObject, error) {
+	return m.queryObjects(userID, "")
+}
+
+// Object 根据资源名查找对象
+func (m *CalDAVModel) Object(userID int, name string) (*CalDAVObject, error) {
+	return m.queryObject(userID, ` AND (
+		id IN (SELECT todo_id FROM caldav_objects WHERE user_id = $1 AND name = $2)
+		OR (uuid::text || '.ics' = $2 AND NOT EXISTS (SELECT 1 FROM caldav_objects o WHERE o.todo_id = todos.id))
+	)`, name)
+}
+
+// ObjectByUID 根据 iCalendar UID 查找对象
+func (m *CalDAVModel) ObjectByUID(userID int, uid string) (*CalDAVObject, error) {
+	return m.queryObject(userID, ` AND (
+		id IN (SELECT todo_id FROM caldav_objects WHERE user_id = $1 AND uid = $2)
+		OR (uuid::text = $2 AND NOT EXISTS (SELECT 1 FROM caldav_objects o WHERE o.todo_id = todos.id))
+	)`, uid)
+}
+
+// Create 创建对象。资源名是 <uuid>.ics 且该 UUID 没有被使用时直接作为待办事项的 UUID，
+// 否则记录资源名和 UID 的映射
+func (m *CalDAVModel) Create(userID int, obj *CalDAVObject) error {
+	obj.Todo.UserID = userID
+	obj.Todo.UUID = ""
+	if uuid, err := ParseUUID(strings.TrimSuffix(obj.Name, ".ics")); err == nil {
+		obj.Todo.UUID = uuid
+	}
+
+	err := m.Todos.AddTodo(&obj.Todo)
+	if errors.Is(err, ErrDuplicateUUID) && obj.Todo.UUID != "" {
+		obj.Todo.UUID = ""
+		err = m.Todos.AddTodo(&obj.Todo)
+	}
+	if err != nil {
+		return err
+	}
+
+	if obj.Name == obj.Todo.UUID+".ics" && obj.UID == obj.Todo.UUID {
+		return nil
+	}
+	_, err = m.DB.Exec(
+		"INSERT INTO caldav_objects (todo_id, user_id, name, uid) VALUES ($1, $2, $3, $4)",
+		obj.Todo.ID, userID, obj.Name, obj.UID,
+	)
+	if err != nil {
+		// 映射写入失败时删除刚创建的待办事项，避免出现客户端看不到的对象
+		if delErr := m.Todos.DeleteTodo(obj.Todo.ID, userID); delErr != nil {
+			return fmt.Errorf("create caldav object failed: %v (cleanup: %v)", err, delErr)
+		}
+		return fmt.Errorf("create caldav object failed: %w", err)
+	}
+	return nil
+}
+
+// Update 更新对象对应的待办事项，versions 不为 nil 时检查版本号（If-Match）
+func (m *CalDAVModel) Update(userID int, obj *CalDAVObject, versions []int) error {
+	return m.Todos.UpdateTodoIfMatch(&obj.Todo, userID, versions)
+}
+
+// Delete 删除对象对应的待办事项，versions 不为 nil 时检查版本号（If-Match）
+func (m *CalDAVModel) Delete(userID, todoID int, versions []int) error {
+	return m.Todos.DeleteTodoIfMatch(todoID, userID, versions)
+}
+
+// CTag 返回日历集合的 CTag。使用用户的同步序号，任何待办事项、步骤或标签的变化都会改变它
+func (m *CalDAVModel) CTag(userID int) (string, error) {
+	var seq int64
+	err := m.DB.QueryRow(
+		"SELECT COALESCE((SELECT last_seq FROM sync_sequences WHERE user_id = $1), 0)",
+		userID,
+	).Scan(&seq)
+	if err != nil {
+		return "", fmt.Errorf("get ctag failed: %w", err)
+	}
+	return strconv.FormatInt(seq, 10), nil
+}
+
+// Categories 返回用户的分类名称，用于把 CATEGORIES 区分为分类和标签
+func (m *CalDAVModel) Categories(userID int) ([]string, error) {
+	if err := ensureDefaultCategories(m.DB, userID); err != nil {
+		return nil, err
+	}
+	rows, err := m.DB.Query("SELECT name FROM categories WHERE user_id = $1 ORDER BY position, id", userID)
+	if err != nil {
+		return nil, fmt.Errorf("query categories failed: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("scan category failed: %w", err)
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// Authenticate 使用应用专用密码认证 CalDAV 客户端
+func (m *CalDAVModel) Authenticate(username, password string) (int, error) {
+	return m.AppPasswords.Authenticate(username, password)
+}
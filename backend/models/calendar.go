@@ -0,0 +1,82 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// ErrCalendarFeedNotFound 日历订阅令牌不存在（可能已被轮换）
+var ErrCalendarFeedNotFound = errors.New("calendar feed not found")
+
+// CalendarFeedModel 处理日历订阅令牌相关的数据库操作
+type CalendarFeedModel struct {
+	DB *sql.DB
+}
+
+// NewCalendarFeedModel 创建一个新的CalendarFeedModel实例
+func NewCalendarFeedModel(db *sql.DB) *CalendarFeedModel {
+	return &CalendarFeedModel{DB: db}
+}
+
+// newFeedToken 生成随机的订阅令牌。令牌出现在订阅链接中，是访问订阅的唯一凭据
+func newFeedToken() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate feed token failed: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// GetToken 返回用户的订阅令牌，还没有时创建一个
+func (m *CalendarFeedModel) GetToken(userID int) (string, error) {
+	token, err := newFeedToken()
+	if err != nil {
+		return "", err
+	}
+
+	// 已有令牌时 DO UPDATE 不修改任何值，只为了 RETURNING 已有的令牌
+	err = m.DB.QueryRow(
+		`INSERT INTO calendar_feeds (user_id, token) VALUES ($1, $2)
+		 ON CONFLICT (user_id) DO UPDATE SET token = calendar_feeds.token
+		 RETURNING token`,
+		userID, token,
+	).Scan(&token)
+	if err != nil {
+		return "", fmt.Errorf("get feed token failed: %w", err)
+	}
+	return token, nil
+}
+
+// RotateToken 为用户生成新的订阅令牌，旧的订阅链接立即失效
+func (m *CalendarFeedModel) RotateToken(userID int) (string, error) {
+	token, err := newFeedToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = m.DB.Exec(
+		`INSERT INTO calendar_feeds (user_id, token) VALUES ($1, $2)
+		 ON CONFLICT (user_id) DO UPDATE SET token = EXCLUDED.token, created_at = NOW()`,
+		userID, token,
+	)
+	if err != nil {
+		return "", fmt.Errorf("rotate feed token failed: %w", err)
+	}
+	return token, nil
+}
+
+// UserByToken 根据订阅令牌查找用户ID
+func (m *CalendarFeedModel) UserByToken(token string) (int, error) {
+	var userID int
+	err := m.DB.QueryRow("SELECT user_id FROM calendar_feeds WHERE token = $1", token).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrCalendarFeedNotFound
+		}
+		return 0, fmt.Errorf("get calendar feed failed: %w", err)
+	}
+	return userID, nil
+}
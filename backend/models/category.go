@@ -0,0 +1,371 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxCategoryLength 分类名称的最大长度，与 todos.category VARCHAR(20) 一致
+const maxCategoryLength = 20
+
+// maxCategoryIconLength 分类图标的最大长度，与 categories.icon VARCHAR(20) 一致
+const maxCategoryIconLength = 20
+
+// maxColorLength 颜色的最大长度，与分类、标签和工作流状态的 color VARCHAR(20) 一致
+const maxColorLength = 20
+
+// colorPattern 分类和工作流状态的颜色，#RGB 或 #RRGGBB
+var colorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// defaultCategoryName 未指定分类时使用的默认分类
+const defaultCategoryName = "personal"
+
+var (
+	// ErrUnknownCategory 分类不存在
+	ErrUnknownCategory = errors.New("unknown category")
+	// ErrInvalidCategory 分类定义无效
+	ErrInvalidCategory = errors.New("invalid category")
+	// ErrLastCategory 不能删除用户的最后一个分类
+	ErrLastCategory = errors.New("cannot delete the last category")
+	// ErrDuplicateCategory 用户已有同名分类
+	ErrDuplicateCategory = errors.New("category already exists")
+)
+
+// Category 用户管理的待办事项分类
+type Category struct {
+	ID              int       `json:"id"`
+	UserID          int       `json:"userId"`
+	Name            string    `json:"name"`
+	Icon            string    `json:"icon,omitempty"`
+	Color           string    `json:"color,omitempty"`
+	DefaultPriority string    `json:"defaultPriority,omitempty"` // low, medium, high
+	Position        int       `json:"position"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+// defaultCategories 新用户默认的分类，与原先硬编码的分类保持一致
+var defaultCategories = []Category{
+	{Name: "work", Icon: "💼", Color: "#1890ff", DefaultPriority: "medium", Position: 0},
+	{Name: "personal", Icon: "🏠", Color: "#52c41a", DefaultPriority: "medium", Position: 1},
+	{Name: "study", Icon: "📚", Color: "#722ed1", DefaultPriority: "medium", Position: 2},
+	{Name: "health", Icon: "❤️", Color: "#f5222d", DefaultPriority: "medium", Position: 3},
+}
+
+// IsValidPriority 检查优先级是否有效
+func IsValidPriority(priority string) bool {
+	return priority == "low" || priority == "medium" || priority == "high"
+}
+
+// IsValidColor 检查颜色是否是 #RGB 或 #RRGGBB 格式
+func IsValidColor(color string) bool {
+	return colorPattern.MatchString(color)
+}
+
+// CategoryModel 处理分类相关的数据库操作
+type CategoryModel struct {
+	DB *sql.DB
+}
+
+// NewCategoryModel 创建一个新的CategoryModel实例
+func NewCategoryModel(db *sql.DB) *CategoryModel {
+	return &CategoryModel{DB: db}
+}
+
+const categoryColumns = "id, user_id, name, icon, color, default_priority, position, created_at"
+
+// scanCategory 扫描一行分类
+func scanCategory(row rowScanner) (Category, error) {
+	var category Category
+	var icon, color, defaultPriority sql.NullString
+	err := row.Scan(
+		&category.ID,
+		&category.UserID,
+		&category.Name,
+		&icon,
+		&color,
+		&defaultPriority,
+		&category.Position,
+		&category.CreatedAt,
+	)
+	category.Icon = icon.String
+	category.Color = color.String
+	category.DefaultPriority = defaultPriority.String
+	return category, err
+}
+
+// ensureDefaultCategories 如果用户还没有任何分类，则创建默认分类
+func ensureDefaultCategories(db execer, userID int) error {
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM categories WHERE user_id = $1)", userID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("check categories failed: %w", err)
+	}
+	if exists {
+		return nil
+	}
+
+	for _, category := range defaultCategories {
+		_, err = db.Exec(
+			`INSERT INTO categories (user_id, name, icon, color, default_priority, position)
+			 VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (user_id, name) DO NOTHING`,
+			userID, category.Name, category.Icon, category.Color, category.DefaultPriority, category.Position,
+		)
+		if err != nil {
+			return fmt.Errorf("create default category failed: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// getCategoryByName 根据名称获取用户的分类
+func getCategoryByName(db execer, userID int, name string) (*Category, error) {
+	category, err := scanCategory(db.QueryRow(
+		"SELECT "+categoryColumns+" FROM categories WHERE user_id = $1 AND name = $2",
+		userID, name,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUnknownCategory
+		}
+		return nil, fmt.Errorf("get category failed: %w", err)
+	}
+	return &category, nil
+}
+
+// resolveTodoCategory 校验待办事项的分类，空分类使用默认分类；
+// 未指定优先级时使用分类的默认优先级。
+func resolveTodoCategory(db execer, todo *Todo) error {
+	if err := ensureDefaultCategories(db, todo.UserID); err != nil {
+		return err
+	}
+
+	if todo.Category == "" {
+		err := db.QueryRow(
+			`SELECT name FROM categories WHERE user_id = $1
+			 ORDER BY (name = $2) DESC, position, id LIMIT 1`,
+			todo.UserID, defaultCategoryName,
+		).Scan(&todo.Category)
+		if err != nil {
+			return fmt.Errorf("get default category failed: %w", err)
+		}
+	}
+
+	category, err := getCategoryByName(db, todo.UserID, todo.Category)
+	if err != nil {
+		return err
+	}
+
+	if todo.Priority == "" {
+		todo.Priority = category.DefaultPriority
+		if todo.Priority == "" {
+			todo.Priority = "medium"
+		}
+	}
+
+	return nil
+}
+
+// GetCategories 获取用户的所有分类（按顺序）
+func (m *CategoryModel) GetCategories(userID int) ([]Category, error) {
+	if err := ensureDefaultCategories(m.DB, userID); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.DB.Query(
+		"SELECT "+categoryColumns+" FROM categories WHERE user_id = $1 ORDER BY position, id",
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query categories failed: %w", err)
+	}
+	defer rows.Close()
+
+	categories := []Category{}
+	for rows.Next() {
+		category, err := scanCategory(rows)
+		if err != nil {
+			log.Printf("scan category failed: %v", err)
+			continue
+		}
+		categories = append(categories, category)
+	}
+
+	return categories, nil
+}
+
+// GetCategory 根据名称获取用户的分类
+func (m *CategoryModel) GetCategory(userID int, name string) (*Category, error) {
+	if err := ensureDefaultCategories(m.DB, userID); err != nil {
+		return nil, err
+	}
+	return getCategoryByName(m.DB, userID, name)
+}
+
+// validateCategory 校验分类的名称、图标、颜色和默认优先级
+func validateCategory(category *Category) error {
+	category.Name = strings.TrimSpace(category.Name)
+	if category.Name == "" || len([]rune(category.Name)) > maxCategoryLength {
+		return ErrInvalidCategory
+	}
+	if len([]rune(category.Icon)) > maxCategoryIconLength {
+		return ErrInvalidCategory
+	}
+	if category.Color != "" && !IsValidColor(category.Color) {
+		return ErrInvalidCategory
+	}
+	if category.DefaultPriority != "" && !IsValidPriority(category.DefaultPriority) {
+		return ErrInvalidCategory
+	}
+	return nil
+}
+
+// CreateCategory 创建分类
+func (m *CategoryModel) CreateCategory(category *Category) error {
+	if err := validateCategory(category); err != nil {
+		return err
+	}
+	if err := ensureDefaultCategories(m.DB, category.UserID); err != nil {
+		return err
+	}
+
+	err := m.DB.QueryRow(
+		`INSERT INTO categories (user_id, name, icon, color, default_priority, position)
+		 VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), $6)
+		 RETURNING id, created_at`,
+		category.UserID, category.Name, category.Icon, category.Color, category.DefaultPriority, category.Position,
+	).Scan(&category.ID, &category.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err, "categories_user_id_name_key") {
+			return ErrDuplicateCategory
+		}
+		return fmt.Errorf("create category failed: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateCategory 更新分类；名称变更时同步改写所有待办事项
+func (m *CategoryModel) UpdateCategory(category *Category) error {
+	if err := validateCategory(category); err != nil {
+		return err
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	var oldName string
+	err = tx.QueryRow(
+		"SELECT name FROM categories WHERE id = $1 AND user_id = $2 FOR UPDATE",
+		category.ID, category.UserID,
+	).Scan(&oldName)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrUnknownCategory
+		}
+		return fmt.Errorf("get category failed: %w", err)
+	}
+
+	err = tx.QueryRow(
+		`UPDATE categories SET
+			name = $1,
+			icon = NULLIF($2, ''),
+			color = NULLIF($3, ''),
+			default_priority = NULLIF($4, ''),
+			position = $5
+		WHERE id = $6
+		RETURNING created_at`,
+		category.Name, category.Icon, category.Color, category.DefaultPriority, category.Position, category.ID,
+	).Scan(&category.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err, "categories_user_id_name_key") {
+			return ErrDuplicateCategory
+		}
+		return fmt.Errorf("update category failed: %w", err)
+	}
+
+	if oldName != category.Name {
+		_, err = tx.Exec(
+			"UPDATE todos SET category = $1, updated_at = NOW() WHERE user_id = $2 AND category = $3",
+			category.Name, category.UserID, oldName,
+		)
+		if err != nil {
+			return fmt.Errorf("rename todo categories failed: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction failed: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteCategory 删除分类，并把其中的待办事项改为 reassignTo 分类。
+// reassignTo 为空时使用默认分类（或第一个剩余分类）。返回被改写的待办事项数量。
+func (m *CategoryModel) DeleteCategory(userID, categoryID int, reassignTo string) (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	var name string
+	err = tx.QueryRow(
+		"SELECT name FROM categories WHERE id = $1 AND user_id = $2 FOR UPDATE",
+		categoryID, userID,
+	).Scan(&name)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrUnknownCategory
+		}
+		return 0, fmt.Errorf("get category failed: %w", err)
+	}
+
+	if reassignTo == "" {
+		err = tx.QueryRow(
+			`SELECT name FROM categories
+			 WHERE user_id = $1 AND id <> $2
+			 ORDER BY (name = $3) DESC, position, id
+			 LIMIT 1`,
+			userID, categoryID, defaultCategoryName,
+		).Scan(&reassignTo)
+		if err == sql.ErrNoRows {
+			return 0, ErrLastCategory
+		}
+		if err != nil {
+			return 0, fmt.Errorf("find fallback category failed: %w", err)
+		}
+	} else if reassignTo == name {
+		return 0, ErrUnknownCategory
+	} else if _, err = getCategoryByName(tx, userID, reassignTo); err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(
+		"UPDATE todos SET category = $1, updated_at = NOW() WHERE user_id = $2 AND category = $3",
+		reassignTo, userID, name,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("reassign todos failed: %w", err)
+	}
+	affected, _ := result.RowsAffected()
+
+	if _, err = tx.Exec("DELETE FROM categories WHERE id = $1", categoryID); err != nil {
+		return 0, fmt.Errorf("delete category failed: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit transaction failed: %w", err)
+	}
+
+	return int(affected), nil
+}
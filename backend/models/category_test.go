@@ -0,0 +1,81 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateCategory(t *testing.T) {
+	tests := []struct {
+		category Category
+		valid    bool
+	}{
+		{Category{Name: "work"}, true},
+		{Category{Name: "  旅行  ", Icon: "✈️", Color: "#1890ff", DefaultPriority: "high"}, true},
+		{Category{Name: "home", Color: "#ABC"}, true},
+		{Category{Name: strings.Repeat("分", maxCategoryLength)}, true},
+		{Category{Name: ""}, false},
+		{Category{Name: "   "}, false},
+		{Category{Name: strings.Repeat("x", maxCategoryLength+1)}, false},
+		{Category{Name: "work", Color: "blue"}, false},
+		{Category{Name: "work", Color: "#12345"}, false},
+		{Category{Name: "work", Color: "#1890ffff"}, false},
+		{Category{Name: "work", Icon: strings.Repeat("x", maxCategoryIconLength+1)}, false},
+		{Category{Name: "work", DefaultPriority: "urgent"}, false},
+	}
+	for _, tt := range tests {
+		category := tt.category
+		err := validateCategory(&category)
+		if tt.valid && err != nil {
+			t.Errorf("validateCategory(%+v) = %v", tt.category, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidCategory) {
+			t.Errorf("validateCategory(%+v) = %v, want ErrInvalidCategory", tt.category, err)
+		}
+	}
+
+	category := Category{Name: " work "}
+	if validateCategory(&category); category.Name != "work" {
+		t.Errorf("name not trimmed: %q", category.Name)
+	}
+}
+
+func TestResolveTodoCategory(t *testing.T) {
+	db := openTestDB(t)
+	userID, _ := createLegacyTodo(t, db)
+
+	// 空分类使用默认分类及其默认优先级
+	todo := Todo{UserID: userID}
+	if err := resolveTodoCategory(db, &todo); err != nil {
+		t.Fatal(err)
+	}
+	if todo.Category != defaultCategoryName || todo.Priority != "medium" {
+		t.Errorf("todo = %+v", todo)
+	}
+
+	todo = Todo{UserID: userID, Category: "missing"}
+	if err := resolveTodoCategory(db, &todo); !errors.Is(err, ErrUnknownCategory) {
+		t.Errorf("unknown category error = %v", err)
+	}
+
+	categories := NewCategoryModel(db)
+	work, err := categories.GetCategory(userID, "work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := categories.DeleteCategory(userID, work.ID, "missing"); !errors.Is(err, ErrUnknownCategory) {
+		t.Errorf("reassign to unknown category error = %v", err)
+	}
+	if _, err := categories.DeleteCategory(userID, work.ID, "work"); !errors.Is(err, ErrUnknownCategory) {
+		t.Errorf("reassign to deleted category error = %v", err)
+	}
+
+	if err := categories.CreateCategory(&Category{UserID: userID, Name: " work "}); !errors.Is(err, ErrDuplicateCategory) {
+		t.Errorf("duplicate category error = %v", err)
+	}
+	work.Name = "study"
+	if err := categories.UpdateCategory(work); !errors.Is(err, ErrDuplicateCategory) {
+		t.Errorf("rename to existing category error = %v", err)
+	}
+}
@@ -0,0 +1,442 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+)
+
+// 自定义字段类型
+const (
+	FieldTypeText        = "text"
+	FieldTypeNumber      = "number"
+	FieldTypeDate        = "date"
+	FieldTypeSelect      = "select"
+	FieldTypeMultiSelect = "multi_select"
+	FieldTypeURL         = "url"
+	FieldTypeCheckbox    = "checkbox"
+)
+
+// maxTextFieldLength 文本类型自定义字段的最大长度
+const maxTextFieldLength = 1000
+
+// ErrUnknownCustomField 自定义字段定义不存在
+var ErrUnknownCustomField = errors.New("unknown custom field")
+
+// ErrDuplicateCustomField 用户已有相同 key 的自定义字段
+var ErrDuplicateCustomField = errors.New("custom field already exists")
+
+// CustomFieldError 自定义字段的值校验失败
+type CustomFieldError struct {
+	Key     string
+	Message string
+}
+
+func (e *CustomFieldError) Error() string {
+	return fmt.Sprintf("custom field %q: %s", e.Key, e.Message)
+}
+
+// CustomFieldDefinition 用户定义的待办事项自定义字段
+type CustomFieldDefinition struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"userId"`
+	Key       string    `json:"key"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Options   []string  `json:"options,omitempty"` // select / multi_select 的可选值
+	Required  bool      `json:"required"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// IsValidFieldType 检查自定义字段类型是否受支持
+func IsValidFieldType(fieldType string) bool {
+	switch fieldType {
+	case FieldTypeText, FieldTypeNumber, FieldTypeDate, FieldTypeSelect,
+		FieldTypeMultiSelect, FieldTypeURL, FieldTypeCheckbox:
+		return true
+	}
+	return false
+}
+
+// ValidateCustomFields 根据字段定义校验并规范化自定义字段的值。
+// 值为 null 的字段会被移除；checkRequired 为 true 时检查必填字段。
+func ValidateCustomFields(defs []CustomFieldDefinition, values map[string]interface{}, checkRequired bool) (map[string]interface{}, error) {
+	byKey := make(map[string]CustomFieldDefinition, len(defs))
+	for _, def := range defs {
+		byKey[def.Key] = def
+	}
+
+	normalized := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		def, ok := byKey[key]
+		if !ok {
+			return nil, &CustomFieldError{Key: key, Message: "field is not defined"}
+		}
+		if value == nil {
+			continue
+		}
+
+		v, err := normalizeFieldValue(def, value)
+		if err != nil {
+			return nil, err
+		}
+		normalized[key] = v
+	}
+
+	if checkRequired {
+		for _, def := range defs {
+			if _, ok := normalized[def.Key]; def.Required && !ok {
+				return nil, &CustomFieldError{Key: def.Key, Message: "field is required"}
+			}
+		}
+	}
+
+	return normalized, nil
+}
+
+// normalizeFieldValue 校验单个字段的值并转换为存储格式
+func normalizeFieldValue(def CustomFieldDefinition, value interface{}) (interface{}, error) {
+	invalid := func(msg string) error {
+		return &CustomFieldError{Key: def.Key, Message: msg}
+	}
+
+	switch def.Type {
+	case FieldTypeText:
+		s, ok := value.(string)
+		if !ok {
+			return nil, invalid("expected a string")
+		}
+		if len([]rune(s)) > maxTextFieldLength {
+			return nil, invalid(fmt.Sprintf("must be at most %d characters", maxTextFieldLength))
+		}
+		return s, nil
+
+	case FieldTypeNumber:
+		switch n := value.(type) {
+		case float64:
+			return n, nil
+		case int:
+			return float64(n), nil
+		case json.Number:
+			f, err := n.Float64()
+			if err != nil {
+				return nil, invalid("expected a number")
+			}
+			return f, nil
+		}
+		return nil, invalid("expected a number")
+
+	case FieldTypeDate:
+		s, ok := value.(string)
+		if !ok {
+			return nil, invalid("expected a date string")
+		}
+		if t, err := time.Parse("2006-01-02", s); err == nil {
+			return t.Format("2006-01-02"), nil
+		}
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			return t.Format("2006-01-02"), nil
+		}
+		return nil, invalid("expected a date in YYYY-MM-DD format")
+
+	case FieldTypeSelect:
+		s, ok := value.(string)
+		if !ok || !containsString(def.Options, s) {
+			return nil, invalid("must be one of the defined options")
+		}
+		return s, nil
+
+	case FieldTypeMultiSelect:
+		items, ok := value.([]interface{})
+		if !ok {
+			if strs, isStrings := value.([]string); isStrings {
+				for _, s := range strs {
+					items = append(items, s)
+				}
+				ok = true
+			}
+		}
+		if !ok {
+			return nil, invalid("expected an array of options")
+		}
+		selected := make([]string, 0, len(items))
+		for _, item := range items {
+			s, isString := item.(string)
+			if !isString || !containsString(def.Options, s) {
+				return nil, invalid("must only contain defined options")
+			}
+			if !containsString(selected, s) {
+				selected = append(selected, s)
+			}
+		}
+		return selected, nil
+
+	case FieldTypeURL:
+		s, ok := value.(string)
+		if !ok {
+			return nil, invalid("expected a URL string")
+		}
+		u, err := url.Parse(s)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, invalid("expected an absolute http(s) URL")
+		}
+		return s, nil
+
+	case FieldTypeCheckbox:
+		b, ok := value.(bool)
+		if !ok {
+			return nil, invalid("expected a boolean")
+		}
+		return b, nil
+	}
+
+	return nil, invalid("unsupported field type")
+}
+
+// containsString 检查切片中是否包含指定字符串
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// CustomFieldModel 处理自定义字段定义相关的数据库操作
+type CustomFieldModel struct {
+	DB *sql.DB
+}
+
+// NewCustomFieldModel 创建一个新的CustomFieldModel实例
+func NewCustomFieldModel(db *sql.DB) *CustomFieldModel {
+	return &CustomFieldModel{DB: db}
+}
+
+const customFieldColumns = "id, user_id, key, name, type, options, required, position, created_at"
+
+// scanCustomField 扫描一行自定义字段定义
+func scanCustomField(row rowScanner) (CustomFieldDefinition, error) {
+	var def CustomFieldDefinition
+	var optionsJSON sql.NullString
+	err := row.Scan(
+		&def.ID,
+		&def.UserID,
+		&def.Key,
+		&def.Name,
+		&def.Type,
+		&optionsJSON,
+		&def.Required,
+		&def.Position,
+		&def.CreatedAt,
+	)
+	if err != nil {
+		return def, err
+	}
+
+	if optionsJSON.Valid && optionsJSON.String != "" {
+		if err := json.Unmarshal([]byte(optionsJSON.String), &def.Options); err != nil {
+			log.Printf("parse custom field options failed: %v", err)
+		}
+	}
+
+	return def, nil
+}
+
+// getCustomFieldDefinitions 获取用户的所有自定义字段定义
+func getCustomFieldDefinitions(db execer, userID int) ([]CustomFieldDefinition, error) {
+	rows, err := db.Query(
+		"SELECT "+customFieldColumns+" FROM custom_field_definitions WHERE user_id = $1 ORDER BY position, id",
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query custom fields failed: %w", err)
+	}
+	defer rows.Close()
+
+	defs := []CustomFieldDefinition{}
+	for rows.Next() {
+		def, err := scanCustomField(rows)
+		if err != nil {
+			log.Printf("scan custom field failed: %v", err)
+			continue
+		}
+		defs = append(defs, def)
+	}
+
+	return defs, nil
+}
+
+// GetDefinitions 获取用户的所有自定义字段定义
+func (m *CustomFieldModel) GetDefinitions(userID int) ([]CustomFieldDefinition, error) {
+	return getCustomFieldDefinitions(m.DB, userID)
+}
+
+// GetDefinition 根据key获取自定义字段定义
+func (m *CustomFieldModel) GetDefinition(userID int, key string) (*CustomFieldDefinition, error) {
+	def, err := scanCustomField(m.DB.QueryRow(
+		"SELECT "+customFieldColumns+" FROM custom_field_definitions WHERE user_id = $1 AND key = $2",
+		userID, key,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUnknownCustomField
+		}
+		return nil, fmt.Errorf("get custom field failed: %w", err)
+	}
+	return &def, nil
+}
+
+// CreateDefinition 创建自定义字段定义
+func (m *CustomFieldModel) CreateDefinition(def *CustomFieldDefinition) error {
+	optionsJSON, err := json.Marshal(def.Options)
+	if err != nil {
+		return fmt.Errorf("marshal options failed: %w", err)
+	}
+
+	err = m.DB.QueryRow(
+		`INSERT INTO custom_field_definitions (user_id, key, name, type, options, required, position)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 RETURNING id, created_at`,
+		def.UserID, def.Key, def.Name, def.Type, string(optionsJSON), def.Required, def.Position,
+	).Scan(&def.ID, &def.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err, "custom_field_definitions_user_id_key_key") {
+			return ErrDuplicateCustomField
+		}
+		return fmt.Errorf("create custom field failed: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateDefinition 更新自定义字段定义，key 和类型创建后不可修改。
+// 被移除的选项会从已有待办事项的值中清除。
+func (m *CustomFieldModel) UpdateDefinition(def *CustomFieldDefinition) error {
+	optionsJSON, err := json.Marshal(def.Options)
+	if err != nil {
+		return fmt.Errorf("marshal options failed: %w", err)
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(
+		`UPDATE custom_field_definitions SET
+			name = $1,
+			options = $2,
+			required = $3,
+			position = $4
+		WHERE id = $5 AND user_id = $6
+		RETURNING key, type, created_at`,
+		def.Name, string(optionsJSON), def.Required, def.Position, def.ID, def.UserID,
+	).Scan(&def.Key, &def.Type, &def.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrUnknownCustomField
+		}
+		return fmt.Errorf("update custom field failed: %w", err)
+	}
+
+	switch def.Type {
+	case FieldTypeSelect:
+		_, err = tx.Exec(
+			`UPDATE todos SET custom_fields = custom_fields - $1::text
+			 WHERE user_id = $2 AND custom_fields ? $1
+			 AND NOT ($3::jsonb ? (custom_fields->>$1))`,
+			def.Key, def.UserID, string(optionsJSON),
+		)
+	case FieldTypeMultiSelect:
+		_, err = tx.Exec(
+			`UPDATE todos SET custom_fields = jsonb_set(custom_fields, ARRAY[$1::text], COALESCE((
+				SELECT jsonb_agg(v) FROM jsonb_array_elements_text(custom_fields->$1) v
+				WHERE $3::jsonb ? v
+			), '[]'::jsonb))
+			 WHERE user_id = $2 AND custom_fields ? $1`,
+			def.Key, def.UserID, string(optionsJSON),
+		)
+	}
+	if err != nil {
+		return fmt.Errorf("prune removed options failed: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction failed: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteDefinition 删除自定义字段定义，并从所有待办事项中移除该字段的值
+func (m *CustomFieldModel) DeleteDefinition(userID, id int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	var key string
+	err = tx.QueryRow(
+		"DELETE FROM custom_field_definitions WHERE id = $1 AND user_id = $2 RETURNING key",
+		id, userID,
+	).Scan(&key)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrUnknownCustomField
+		}
+		return fmt.Errorf("delete custom field failed: %w", err)
+	}
+
+	_, err = tx.Exec(
+		"UPDATE todos SET custom_fields = custom_fields - $1::text WHERE user_id = $2 AND custom_fields ? $1",
+		key, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("remove custom field values failed: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction failed: %w", err)
+	}
+
+	return nil
+}
+
+// prepareCustomFields 校验待办事项的自定义字段并序列化为JSON。
+// values 为 nil 时返回 nil，表示不修改已有的值。
+func prepareCustomFields(db execer, userID int, values map[string]interface{}, checkRequired bool) (*string, error) {
+	if values == nil && !checkRequired {
+		return nil, nil
+	}
+
+	defs, err := getCustomFieldDefinitions(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	normalized, err := ValidateCustomFields(defs, values, checkRequired)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return nil, fmt.Errorf("marshal custom fields failed: %w", err)
+	}
+	s := string(data)
+	return &s, nil
+}
+
+// IsCustomFieldError 判断错误是否为自定义字段校验错误
+func IsCustomFieldError(err error) bool {
+	var fieldErr *CustomFieldError
+	return errors.As(err, &fieldErr) || errors.Is(err, ErrUnknownCustomField)
+}
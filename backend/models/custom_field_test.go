@@ -0,0 +1,78 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateCustomFields(t *testing.T) {
+	defs := []CustomFieldDefinition{
+		{Key: "customer", Type: FieldTypeText, Required: true},
+		{Key: "points", Type: FieldTypeNumber},
+		{Key: "deadline", Type: FieldTypeDate},
+		{Key: "size", Type: FieldTypeSelect, Options: []string{"S", "M", "L"}},
+		{Key: "labels", Type: FieldTypeMultiSelect, Options: []string{"a", "b"}},
+		{Key: "ticket", Type: FieldTypeURL},
+		{Key: "billable", Type: FieldTypeCheckbox},
+	}
+
+	values := map[string]interface{}{
+		"customer": "ACME",
+		"points":   float64(3),
+		"deadline": "2024-05-01T10:00:00Z",
+		"size":     "M",
+		"labels":   []interface{}{"a", "b", "a"},
+		"ticket":   "https://example.com/T-1",
+		"billable": true,
+	}
+
+	got, err := ValidateCustomFields(defs, values, true)
+	if err != nil {
+		t.Fatalf("ValidateCustomFields() error = %v", err)
+	}
+
+	want := map[string]interface{}{
+		"customer": "ACME",
+		"points":   float64(3),
+		"deadline": "2024-05-01",
+		"size":     "M",
+		"labels":   []string{"a", "b"},
+		"ticket":   "https://example.com/T-1",
+		"billable": true,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ValidateCustomFields() = %v, want %v", got, want)
+	}
+}
+
+func TestValidateCustomFieldsErrors(t *testing.T) {
+	defs := []CustomFieldDefinition{
+		{Key: "customer", Type: FieldTypeText, Required: true},
+		{Key: "points", Type: FieldTypeNumber},
+		{Key: "size", Type: FieldTypeSelect, Options: []string{"S", "M"}},
+		{Key: "ticket", Type: FieldTypeURL},
+	}
+
+	tests := []struct {
+		name   string
+		values map[string]interface{}
+	}{
+		{"missing required", map[string]interface{}{"points": float64(1)}},
+		{"undefined field", map[string]interface{}{"customer": "x", "unknown": "y"}},
+		{"number as string", map[string]interface{}{"customer": "x", "points": "3"}},
+		{"option not allowed", map[string]interface{}{"customer": "x", "size": "XL"}},
+		{"relative url", map[string]interface{}{"customer": "x", "ticket": "/T-1"}},
+		{"null required", map[string]interface{}{"customer": nil}},
+	}
+
+	for _, tt := range tests {
+		if _, err := ValidateCustomFields(defs, tt.values, true); !IsCustomFieldError(err) {
+			t.Errorf("%s: error = %v, want custom field error", tt.name, err)
+		}
+	}
+
+	// 不检查必填字段时允许缺失
+	if _, err := ValidateCustomFields(defs, map[string]interface{}{"points": float64(1)}, false); err != nil {
+		t.Errorf("ValidateCustomFields() without required check error = %v", err)
+	}
+}
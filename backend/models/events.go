@@ -0,0 +1,221 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// EventChannel 数据库触发器发送变更事件使用的 NOTIFY 频道
+const EventChannel = "todo_events"
+
+// DefaultEventRetention 事件日志默认的保留时间，超过后断线重连的客户端需要重新加载
+const DefaultEventRetention = time.Hour
+
+// eventSubscriberBuffer 每个订阅者的事件缓冲区大小，写满时断开该订阅者
+const eventSubscriberBuffer = 64
+
+// Event 待办事项或步骤的变更事件，由数据库触发器写入事件日志并通过 NOTIFY 发布。
+// Type 为 todo.created、todo.updated、todo.deleted、step.created、step.updated 或 step.deleted
+type Event struct {
+	ID        int64     `json:"id"`
+	UserID    int       `json:"userId"`
+	Type      string    `json:"type"`
+	TodoID    int       `json:"todoId"`
+	StepID    *int      `json:"stepId,omitempty"`
+	Version   *int      `json:"version,omitempty"` // 待办事项事件中写入后的版本号
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// EventBus 把变更事件分发给本实例内订阅了对应用户的连接。
+// 所有实例都监听同一个 NOTIFY 频道，因此任意实例上的写入都会推送到所有实例的订阅者。
+type EventBus struct {
+	DB        *sql.DB
+	Retention time.Duration
+
+	mu          sync.Mutex
+	subscribers map[int]map[chan Event]struct{}
+	lastID      int64 // 已分发的最大事件ID，监听连接重建后从这里补发
+}
+
+// NewEventBus 创建一个新的EventBus实例
+func NewEventBus(db *sql.DB) *EventBus {
+	return &EventBus{
+		DB:          db,
+		Retention:   DefaultEventRetention,
+		subscribers: make(map[int]map[chan Event]struct{}),
+	}
+}
+
+// Subscribe 订阅用户的变更事件，返回事件通道和取消订阅的函数。
+// 订阅者处理过慢、缓冲区写满时通道会被关闭，客户端应带上最后的事件ID重新连接。
+func (b *EventBus) Subscribe(userID int) (<-chan Event, func()) {
+	ch := make(chan Event, eventSubscriberBuffer)
+
+	b.mu.Lock()
+	if b.subscribers[userID] == nil {
+		b.subscribers[userID] = make(map[chan Event]struct{})
+	}
+	b.subscribers[userID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.removeLocked(userID, ch)
+	}
+	return ch, unsubscribe
+}
+
+// removeLocked 移除并关闭订阅者，调用方需持有锁
+func (b *EventBus) removeLocked(userID int, ch chan Event) {
+	subscribers := b.subscribers[userID]
+	if _, ok := subscribers[ch]; !ok {
+		return
+	}
+	delete(subscribers, ch)
+	close(ch)
+	if len(subscribers) == 0 {
+		delete(b.subscribers, userID)
+	}
+}
+
+// Publish 把事件分发给本实例内订阅了该用户的连接
+func (b *EventBus) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if event.ID > b.lastID {
+		b.lastID = event.ID
+	}
+	for ch := range b.subscribers[event.UserID] {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("事件订阅者处理过慢，断开连接，用户ID: %d", event.UserID)
+			b.removeLocked(event.UserID, ch)
+		}
+	}
+}
+
+// EventsSince 从事件日志中读取用户ID大于 lastID 的事件。complete 为 false 表示
+// lastID 之后的部分事件已经超过保留时间被清理，客户端需要重新加载全部数据。
+func (b *EventBus) EventsSince(userID int, lastID int64) ([]Event, bool, error) {
+	var oldest sql.NullInt64
+	if err := b.DB.QueryRow("SELECT MIN(id) FROM todo_events").Scan(&oldest); err != nil {
+		return nil, false, fmt.Errorf("query event log failed: %w", err)
+	}
+	complete := lastID == 0 || (oldest.Valid && lastID >= oldest.Int64-1)
+
+	events, err := b.queryEvents("WHERE user_id = $1 AND id > $2 ORDER BY id", userID, lastID)
+	if err != nil {
+		return nil, false, err
+	}
+	return events, complete, nil
+}
+
+// queryEvents 按条件查询事件日志
+func (b *EventBus) queryEvents(where string, args ...interface{}) ([]Event, error) {
+	rows, err := b.DB.Query(
+		"SELECT id, user_id, type, todo_id, step_id, version, created_at FROM todo_events "+where,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query event log failed: %w", err)
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var event Event
+		var stepID, version sql.NullInt64
+		if err := rows.Scan(&event.ID, &event.UserID, &event.Type, &event.TodoID, &stepID, &version, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan event failed: %w", err)
+		}
+		if stepID.Valid {
+			id := int(stepID.Int64)
+			event.StepID = &id
+		}
+		if version.Valid {
+			v := int(version.Int64)
+			event.Version = &v
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// Prune 清理超过保留时间的事件日志
+func (b *EventBus) Prune() error {
+	_, err := b.DB.Exec(
+		"DELETE FROM todo_events WHERE created_at < NOW() - $1::float8 * INTERVAL '1 second'",
+		b.Retention.Seconds(),
+	)
+	if err != nil {
+		return fmt.Errorf("prune event log failed: %w", err)
+	}
+	return nil
+}
+
+// Listen 在独立的连接上 LISTEN 事件频道，把收到的事件分发给订阅者，并定期清理事件日志。
+// 监听连接断开重建后，从事件日志补发期间错过的事件。调用会一直阻塞，应在单独的 goroutine 中运行。
+func (b *EventBus) Listen(connStr string) error {
+	listener := pq.NewListener(connStr, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("事件监听连接错误: %v", err)
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(EventChannel); err != nil {
+		return fmt.Errorf("listen %s failed: %w", EventChannel, err)
+	}
+
+	pruneTicker := time.NewTicker(time.Minute)
+	defer pruneTicker.Stop()
+
+	for {
+		select {
+		case notification := <-listener.Notify:
+			if notification == nil {
+				// 连接已重建，补发断线期间的事件
+				b.catchUp()
+				continue
+			}
+			var event Event
+			if err := json.Unmarshal([]byte(notification.Extra), &event); err != nil {
+				log.Printf("解析事件失败: %v", err)
+				continue
+			}
+			b.Publish(event)
+		case <-pruneTicker.C:
+			if err := b.Prune(); err != nil {
+				log.Printf("清理事件日志失败: %v", err)
+			}
+		}
+	}
+}
+
+// catchUp 分发事件日志中ID大于已分发最大ID的事件
+func (b *EventBus) catchUp() {
+	b.mu.Lock()
+	lastID := b.lastID
+	b.mu.Unlock()
+	if lastID == 0 {
+		return
+	}
+
+	events, err := b.queryEvents("WHERE id > $1 ORDER BY id", lastID)
+	if err != nil {
+		log.Printf("补发事件失败: %v", err)
+		return
+	}
+	for _, event := range events {
+		b.Publish(event)
+	}
+}
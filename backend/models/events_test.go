@@ -0,0 +1,48 @@
+package models
+
+import "testing"
+
+func TestEventBusFanOut(t *testing.T) {
+	bus := NewEventBus(nil)
+	mine, unsubscribe := bus.Subscribe(1)
+	defer unsubscribe()
+	other, unsubscribeOther := bus.Subscribe(2)
+
+	bus.Publish(Event{ID: 1, UserID: 1, Type: "todo.created", TodoID: 10})
+	if event := <-mine; event.ID != 1 || event.TodoID != 10 {
+		t.Errorf("received %+v", event)
+	}
+	select {
+	case event := <-other:
+		t.Errorf("other user received %+v", event)
+	default:
+	}
+
+	// 取消订阅后通道被关闭，重复取消不会 panic
+	unsubscribeOther()
+	unsubscribeOther()
+	if _, ok := <-other; ok {
+		t.Error("channel still open after unsubscribe")
+	}
+}
+
+func TestEventBusDropsSlowSubscriber(t *testing.T) {
+	bus := NewEventBus(nil)
+	slow, unsubscribe := bus.Subscribe(1)
+	defer unsubscribe()
+
+	for i := 1; i <= eventSubscriberBuffer+1; i++ {
+		bus.Publish(Event{ID: int64(i), UserID: 1, Type: "todo.updated"})
+	}
+
+	received := 0
+	for range slow {
+		received++
+	}
+	if received != eventSubscriberBuffer {
+		t.Errorf("received %d events before disconnect, want %d", received, eventSubscriberBuffer)
+	}
+	if bus.lastID != int64(eventSubscriberBuffer+1) {
+		t.Errorf("lastID = %d", bus.lastID)
+	}
+}
@@ -4,4 +4,7 @@ go 1.24.3
 
 // replace github.com/QMEOWQ/TodoList/backend/models => ../models
 
-require golang.org/x/crypto v0.40.0
+require (
+	github.com/lib/pq v1.10.9
+	golang.org/x/crypto v0.40.0
+)
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// IdempotencyKeyTTL 幂等键和保存的响应的保留时间
+const IdempotencyKeyTTL = 24 * time.Hour
+
+// IdempotencyRecord 已经使用过的幂等键。StatusCode 为 0 表示第一次请求仍在处理中
+type IdempotencyRecord struct {
+	RequestHash string
+	StatusCode  int
+	Header      map[string][]string
+	Body        []byte
+}
+
+// IdempotencyModel 处理幂等键相关的数据库操作
+type IdempotencyModel struct {
+	DB *sql.DB
+}
+
+// NewIdempotencyModel 创建一个新的IdempotencyModel实例
+func NewIdempotencyModel(db *sql.DB) *IdempotencyModel {
+	return &IdempotencyModel{DB: db}
+}
+
+// Reserve 为请求预留幂等键。键未使用过（或已过期）时预留成功，返回 nil；
+// 否则返回已保存的记录，由调用方重放响应或拒绝请求。
+func (m *IdempotencyModel) Reserve(userID int, key, requestHash string) (*IdempotencyRecord, error) {
+	// 顺便清理已过期的键
+	if _, err := m.DB.Exec("DELETE FROM idempotency_keys WHERE user_id = $1 AND expires_at < NOW()", userID); err != nil {
+		return nil, fmt.Errorf("purge idempotency keys failed: %w", err)
+	}
+
+	result, err := m.DB.Exec(`
+		INSERT INTO idempotency_keys (user_id, idempotency_key, request_hash, expires_at)
+		VALUES ($1, $2, $3, NOW() + $4::float8 * INTERVAL '1 second')
+		ON CONFLICT (user_id, idempotency_key) DO NOTHING
+	`, userID, key, requestHash, IdempotencyKeyTTL.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("reserve idempotency key failed: %w", err)
+	}
+	if reserved, err := result.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("reserve idempotency key failed: %w", err)
+	} else if reserved == 1 {
+		return nil, nil
+	}
+
+	var record IdempotencyRecord
+	var statusCode sql.NullInt64
+	var headerJSON []byte
+	err = m.DB.QueryRow(`
+		SELECT request_hash, status_code, response_headers, response_body
+		FROM idempotency_keys
+		WHERE user_id = $1 AND idempotency_key = $2
+	`, userID, key).Scan(&record.RequestHash, &statusCode, &headerJSON, &record.Body)
+	if err == sql.ErrNoRows {
+		// 保存的键刚好被释放，重新预留
+		return m.Reserve(userID, key, requestHash)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get idempotency key failed: %w", err)
+	}
+
+	record.StatusCode = int(statusCode.Int64)
+	if len(headerJSON) > 0 {
+		if err := json.Unmarshal(headerJSON, &record.Header); err != nil {
+			return nil, fmt.Errorf("parse idempotency response headers failed: %w", err)
+		}
+	}
+	return &record, nil
+}
+
+// Complete 保存预留的幂等键对应的响应
+func (m *IdempotencyModel) Complete(userID int, key string, statusCode int, header map[string][]string, body []byte) error {
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return fmt.Errorf("marshal idempotency response headers failed: %w", err)
+	}
+
+	_, err = m.DB.Exec(`
+		UPDATE idempotency_keys
+		SET status_code = $3, response_headers = $4, response_body = $5
+		WHERE user_id = $1 AND idempotency_key = $2
+	`, userID, key, statusCode, string(headerJSON), body)
+	if err != nil {
+		return fmt.Errorf("save idempotency response failed: %w", err)
+	}
+	return nil
+}
+
+// Release 释放预留的幂等键（请求没有产生可重放的响应），之后可以用同一个键重试
+func (m *IdempotencyModel) Release(userID int, key string) error {
+	_, err := m.DB.Exec(
+		"DELETE FROM idempotency_keys WHERE user_id = $1 AND idempotency_key = $2 AND status_code IS NULL",
+		userID, key,
+	)
+	if err != nil {
+		return fmt.Errorf("release idempotency key failed: %w", err)
+	}
+	return nil
+}
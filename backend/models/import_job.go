@@ -0,0 +1,298 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// 导入任务的来源
+const (
+	ImportSourceTodoist       = "todoist"
+	ImportSourceMicrosoftTodo = "microsoft-todo"
+	ImportSourceTodoTxt       = "todotxt"
+)
+
+// 导入任务的状态
+const (
+	ImportStatusPending   = "pending"
+	ImportStatusRunning   = "running"
+	ImportStatusCompleted = "completed"
+	ImportStatusFailed    = "failed"
+)
+
+// 导入报告中每一项的结果
+const (
+	ImportItemCreated = "created"
+	ImportItemSkipped = "skipped" // 之前已经导入过
+	ImportItemFailed  = "failed"
+)
+
+// importJobStaleAfter 执行中的任务超过这个时间没有更新进度时视为已中断（例如服务重启）
+const importJobStaleAfter = 10 * time.Minute
+
+// ErrImportJobNotFound 导入任务不存在或不属于当前用户
+var ErrImportJobNotFound = errors.New("import job not found")
+
+// ImportItem 待导入的一项：转换后的待办事项和它在源文件中的位置（用于报告）
+type ImportItem struct {
+	Ref  string // 例如 "line 12" 或来源中的ID
+	Todo Todo
+}
+
+// ImportItemResult 导入报告中一项的结果；成功创建的项不逐一列出
+type ImportItemResult struct {
+	Ref     string `json:"ref"`
+	Task    string `json:"task"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// ImportReport 导入报告
+type ImportReport struct {
+	CreatedIDs        []int              `json:"createdIds"`
+	CategoriesCreated []string           `json:"categoriesCreated"`
+	Warnings          []string           `json:"warnings"`
+	Items             []ImportItemResult `json:"items"` // 跳过和失败的项
+}
+
+// ImportJob 一次异步导入
+type ImportJob struct {
+	ID         int           `json:"id"`
+	UserID     int           `json:"userId"`
+	Source     string        `json:"source"`
+	Status     string        `json:"status"`
+	Total      int           `json:"total"`
+	Processed  int           `json:"processed"`
+	Created    int           `json:"created"`
+	Skipped    int           `json:"skipped"`
+	Failed     int           `json:"failed"`
+	Error      string        `json:"error,omitempty"`
+	UndoToken  string        `json:"undoToken,omitempty"`
+	Report     *ImportReport `json:"report,omitempty"`
+	CreatedAt  time.Time     `json:"createdAt"`
+	StartedAt  *time.Time    `json:"startedAt,omitempty"`
+	FinishedAt *time.Time    `json:"finishedAt,omitempty"`
+}
+
+// ImportJobModel 处理导入任务相关的数据库操作
+type ImportJobModel struct {
+	DB *sql.DB
+}
+
+// NewImportJobModel 创建一个新的ImportJobModel实例
+func NewImportJobModel(db *sql.DB) *ImportJobModel {
+	return &ImportJobModel{DB: db}
+}
+
+const importJobColumns = `id, user_id, source, status, total, processed, created, skipped, failed,
+	COALESCE(error, ''), COALESCE(undo_token, ''), report, created_at, started_at, finished_at`
+
+// importJobListColumns 列表中不返回报告
+const importJobListColumns = `id, user_id, source, status, total, processed, created, skipped, failed,
+	COALESCE(error, ''), COALESCE(undo_token, ''), NULL::jsonb, created_at, started_at, finished_at`
+
+func scanImportJob(row rowScanner) (*ImportJob, error) {
+	var job ImportJob
+	var report []byte
+	err := row.Scan(&job.ID, &job.UserID, &job.Source, &job.Status, &job.Total, &job.Processed,
+		&job.Created, &job.Skipped, &job.Failed, &job.Error, &job.UndoToken, &report,
+		&job.CreatedAt, &job.StartedAt, &job.FinishedAt)
+	if err != nil {
+		return nil, err
+	}
+	if report != nil {
+		job.Report = &ImportReport{}
+		if err := json.Unmarshal(report, job.Report); err != nil {
+			return nil, fmt.Errorf("unmarshal import report failed: %w", err)
+		}
+	}
+	return &job, nil
+}
+
+// Create 创建等待执行的导入任务
+func (m *ImportJobModel) Create(job *ImportJob) error {
+	job.Status = ImportStatusPending
+	err := m.DB.QueryRow(
+		`INSERT INTO import_jobs (user_id, source, status, total) VALUES ($1, $2, $3, $4)
+		 RETURNING id, created_at`,
+		job.UserID, job.Source, job.Status, job.Total,
+	).Scan(&job.ID, &job.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("create import job failed: %w", err)
+	}
+	return nil
+}
+
+// Get 获取用户的导入任务
+func (m *ImportJobModel) Get(userID, id int) (*ImportJob, error) {
+	job, err := scanImportJob(m.DB.QueryRow(
+		"SELECT "+importJobColumns+" FROM import_jobs WHERE id = $1 AND user_id = $2", id, userID,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrImportJobNotFound
+		}
+		return nil, fmt.Errorf("get import job failed: %w", err)
+	}
+	return job, nil
+}
+
+// List 列出用户最近的导入任务（不包含报告）
+func (m *ImportJobModel) List(userID int) ([]ImportJob, error) {
+	rows, err := m.DB.Query(
+		"SELECT "+importJobListColumns+" FROM import_jobs WHERE user_id = $1 ORDER BY id DESC LIMIT 50",
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query import jobs failed: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []ImportJob{}
+	for rows.Next() {
+		job, err := scanImportJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan import job failed: %w", err)
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, rows.Err()
+}
+
+// Start 把任务标记为执行中
+func (m *ImportJobModel) Start(job *ImportJob) error {
+	now := time.Now()
+	job.Status, job.StartedAt = ImportStatusRunning, &now
+	_, err := m.DB.Exec(
+		"UPDATE import_jobs SET status = $1, started_at = $2, updated_at = $2 WHERE id = $3",
+		job.Status, now, job.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("start import job failed: %w", err)
+	}
+	return nil
+}
+
+// Progress 记录任务的进度
+func (m *ImportJobModel) Progress(job *ImportJob) error {
+	_, err := m.DB.Exec(
+		"UPDATE import_jobs SET processed = $1, created = $2, skipped = $3, failed = $4, updated_at = NOW() WHERE id = $5",
+		job.Processed, job.Created, job.Skipped, job.Failed, job.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("update import job progress failed: %w", err)
+	}
+	return nil
+}
+
+// Finish 结束任务并保存报告；jobErr 不为 nil 时任务失败（已经导入的项保留）
+func (m *ImportJobModel) Finish(job *ImportJob, jobErr error) error {
+	now := time.Now()
+	job.Status, job.FinishedAt = ImportStatusCompleted, &now
+	if jobErr != nil {
+		job.Status, job.Error = ImportStatusFailed, jobErr.Error()
+	}
+	report, err := json.Marshal(job.Report)
+	if err != nil {
+		return fmt.Errorf("marshal import report failed: %w", err)
+	}
+
+	_, err = m.DB.Exec(
+		`UPDATE import_jobs SET status = $1, processed = $2, created = $3, skipped = $4, failed = $5,
+		     error = NULLIF($6, ''), undo_token = NULLIF($7, ''), report = $8, finished_at = $9, updated_at = $9
+		 WHERE id = $10`,
+		job.Status, job.Processed, job.Created, job.Skipped, job.Failed,
+		job.Error, job.UndoToken, string(report), now, job.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("finish import job failed: %w", err)
+	}
+	return nil
+}
+
+// FailInterrupted 把长时间没有更新进度的任务标记为失败。执行任务的服务实例重启后任务不会继续，
+// 启动时调用；仍在其他实例上执行的任务会定期更新进度，不受影响
+func (m *ImportJobModel) FailInterrupted() (int, error) {
+	result, err := m.DB.Exec(
+		`UPDATE import_jobs SET status = $1, error = 'interrupted by server restart', finished_at = NOW(), updated_at = NOW()
+		 WHERE status IN ($2, $3) AND updated_at < $4`,
+		ImportStatusFailed, ImportStatusPending, ImportStatusRunning, time.Now().Add(-importJobStaleAfter),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("fail interrupted import jobs failed: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return int(n), nil
+}
+
+// EnsureCategories 把导入的项目/列表登记为分类。与已有分类只有大小写不同时使用已有分类，
+// 返回名称到实际分类名的映射和新建的分类
+func (m *ImportJobModel) EnsureCategories(userID int, names []string) (map[string]string, []string, error) {
+	if err := ensureDefaultCategories(m.DB, userID); err != nil {
+		return nil, nil, err
+	}
+	rows, err := m.DB.Query("SELECT name FROM categories WHERE user_id = $1", userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("query categories failed: %w", err)
+	}
+	existing := map[string]string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("scan category failed: %w", err)
+		}
+		existing[strings.ToLower(name)] = name
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("query categories failed: %w", err)
+	}
+
+	mapping := map[string]string{}
+	var missing []string
+	for _, name := range names {
+		if _, ok := mapping[name]; ok {
+			continue
+		}
+		if actual, ok := existing[strings.ToLower(name)]; ok {
+			mapping[name] = actual
+			continue
+		}
+		existing[strings.ToLower(name)] = name
+		mapping[name] = name
+		missing = append(missing, name)
+	}
+	if len(missing) == 0 {
+		return mapping, []string{}, nil
+	}
+
+	_, err = m.DB.Exec(
+		`INSERT INTO categories (user_id, name, position)
+		 SELECT $1::int, name, 100 FROM unnest($2::text[]) AS name
+		 ON CONFLICT (user_id, name) DO NOTHING`,
+		userID, pq.Array(missing),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("register categories failed: %w", err)
+	}
+	return mapping, missing, nil
+}
+
+// ClientIDExists 判断用户是否已有该 client_id 的待办事项（导入时用来源ID生成 client_id，重复导入时跳过）
+func (m *ImportJobModel) ClientIDExists(userID int, clientID string) (bool, error) {
+	var exists bool
+	err := m.DB.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM todos WHERE user_id = $1 AND client_id = $2)", userID, clientID,
+	).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("check client id failed: %w", err)
+	}
+	return exists, nil
+}
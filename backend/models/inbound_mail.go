@@ -0,0 +1,146 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// 收件地址相关的错误
+var (
+	ErrInboundAddressNotFound = errors.New("inbound mail address not found")
+	ErrDuplicateInboundMail   = errors.New("inbound mail already received")
+	// ErrInboundMailRejected 邮件内容无法保存（校验失败或违反数据库约束），重新投递也不会成功
+	ErrInboundMailRejected = errors.New("inbound mail rejected")
+)
+
+// InboundMailModel 处理邮件收件地址，以及把收到的邮件保存为待办事项
+type InboundMailModel struct {
+	DB    *sql.DB
+	Todos *TodoModel
+}
+
+// NewInboundMailModel 创建一个新的InboundMailModel实例
+func NewInboundMailModel(db *sql.DB, todos *TodoModel) *InboundMailModel {
+	return &InboundMailModel{DB: db, Todos: todos}
+}
+
+// GetToken 返回用户收件地址的令牌，还没有时创建一个
+func (m *InboundMailModel) GetToken(userID int) (string, error) {
+	token, err := newFeedToken()
+	if err != nil {
+		return "", err
+	}
+
+	// 已有令牌时 DO UPDATE 不修改任何值，只为了 RETURNING 已有的令牌
+	err = m.DB.QueryRow(
+		`INSERT INTO inbound_mail_addresses (user_id, token) VALUES ($1, $2)
+		 ON CONFLICT (user_id) DO UPDATE SET token = inbound_mail_addresses.token
+		 RETURNING token`,
+		userID, token,
+	).Scan(&token)
+	if err != nil {
+		return "", fmt.Errorf("get inbound mail token failed: %w", err)
+	}
+	return token, nil
+}
+
+// RotateToken 为用户生成新的收件地址，旧地址立即失效
+func (m *InboundMailModel) RotateToken(userID int) (string, error) {
+	token, err := newFeedToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = m.DB.Exec(
+		`INSERT INTO inbound_mail_addresses (user_id, token) VALUES ($1, $2)
+		 ON CONFLICT (user_id) DO UPDATE SET token = EXCLUDED.token, created_at = NOW()`,
+		userID, token,
+	)
+	if err != nil {
+		return "", fmt.Errorf("rotate inbound mail token failed: %w", err)
+	}
+	return token, nil
+}
+
+// UserByToken 根据收件地址的令牌查找用户ID
+func (m *InboundMailModel) UserByToken(token string) (int, error) {
+	var userID int
+	err := m.DB.QueryRow("SELECT user_id FROM inbound_mail_addresses WHERE token = $1", token).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrInboundAddressNotFound
+		}
+		return 0, fmt.Errorf("get inbound mail address failed: %w", err)
+	}
+	return userID, nil
+}
+
+// CreateFromMail 为用户创建邮件对应的待办事项并保存附件。todo.ClientID 由邮件的 Message-ID 生成，
+// 同一封邮件重复投递时返回 ErrDuplicateInboundMail
+func (m *InboundMailModel) CreateFromMail(userID int, todo *Todo, attachments []Attachment) error {
+	todo.UserID = userID
+	if todo.ClientID != "" {
+		var exists bool
+		err := m.DB.QueryRow(
+			"SELECT EXISTS (SELECT 1 FROM todos WHERE user_id = $1 AND client_id = $2)",
+			userID, todo.ClientID,
+		).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("check inbound mail failed: %w", err)
+		}
+		if exists {
+			return ErrDuplicateInboundMail
+		}
+	}
+
+	if err := m.Todos.AddTodo(todo); err != nil {
+		return rejectInboundMail(err)
+	}
+	if len(attachments) == 0 {
+		return nil
+	}
+
+	err := m.addAttachments(todo.ID, attachments)
+	if err != nil {
+		// 附件保存失败时删除刚创建的待办事项，临时错误时发件服务器会稍后重试整封邮件
+		if delErr := m.Todos.DeleteTodo(todo.ID, userID); delErr != nil {
+			return fmt.Errorf("save attachments failed: %v (cleanup: %v)", err, delErr)
+		}
+		return rejectInboundMail(fmt.Errorf("save attachments failed: %w", err))
+	}
+	return nil
+}
+
+// rejectInboundMail 把重试也无法成功的错误（校验错误、数据错误和约束错误）包装为 ErrInboundMailRejected
+func rejectInboundMail(err error) error {
+	var fieldErr *TodoFieldError
+	var pqErr *pq.Error
+	switch {
+	case errors.Is(err, ErrInvalidTag), errors.Is(err, ErrUnknownCategory), errors.Is(err, ErrUnknownStatus),
+		errors.As(err, &fieldErr):
+	case errors.As(err, &pqErr) && (pqErr.Code.Class() == "22" || pqErr.Code.Class() == "23"):
+	default:
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrInboundMailRejected, err)
+}
+
+// addAttachments 在一个事务中保存待办事项的所有附件
+func (m *InboundMailModel) addAttachments(todoID int, attachments []Attachment) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	for i := range attachments {
+		attachments[i].TodoID = todoID
+		if err := insertAttachment(tx, &attachments[i]); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
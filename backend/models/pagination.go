@@ -0,0 +1,260 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// 游标分页的默认和最大每页数量
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 200
+)
+
+// cursorTimeLayout 游标中时间戳的格式，与 TIMESTAMP 列的精度一致
+const cursorTimeLayout = "2006-01-02T15:04:05.999999"
+
+// ErrInvalidCursor 游标无法解析，或不属于当前的排序方式
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// SortKey 排序键。Expr 必须是不为 NULL 的表达式（可以用 COALESCE 加哨兵值），
+// 这样才能用于键集分页的比较；Cast 是游标值绑定为参数时使用的类型。
+type SortKey struct {
+	Expr      string
+	Desc      bool
+	Cast      string // timestamp, integer, text, real
+	NullsLast bool   // 仅用于 ORDER BY，适用于只能偏移分页的排序
+}
+
+// Keyset 一种排序方式及其游标编码。最后一个排序键必须唯一（通常是 id），保证翻页稳定。
+type Keyset struct {
+	Name       string // 写入游标，防止游标被用于其他排序
+	Keys       []SortKey
+	OffsetOnly bool // 排序键可能为 NULL 或无法精确比较时，游标退化为偏移量
+}
+
+// PageRequest 列表请求的分页参数
+type PageRequest struct {
+	Cursor    string
+	Limit     int
+	WithTotal bool
+}
+
+// PageInfo 列表响应的分页信息
+type PageInfo struct {
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"nextCursor,omitempty"`
+	HasMore    bool   `json:"hasMore"`
+	Total      *int   `json:"total,omitempty"`
+}
+
+// cursorPayload 游标的内容，编码为 base64url(JSON)，对客户端不透明
+type cursorPayload struct {
+	Sort   string        `json:"s"`
+	Values []interface{} `json:"v,omitempty"`
+	Offset int           `json:"o,omitempty"`
+}
+
+// PageLimit 返回规范化后的每页数量
+func (p PageRequest) PageLimit() int {
+	if p.Limit < 1 {
+		return DefaultPageLimit
+	}
+	if p.Limit > MaxPageLimit {
+		return MaxPageLimit
+	}
+	return p.Limit
+}
+
+// OrderBy 返回 ORDER BY 子句
+func (k Keyset) OrderBy() string {
+	parts := make([]string, 0, len(k.Keys))
+	for _, key := range k.Keys {
+		part := key.Expr
+		if key.Desc {
+			part += " DESC"
+		} else {
+			part += " ASC"
+		}
+		if key.NullsLast {
+			part += " NULLS LAST"
+		}
+		parts = append(parts, part)
+	}
+	return "ORDER BY " + strings.Join(parts, ", ")
+}
+
+// After 解析游标，返回“位于游标之后”的条件及其参数（占位符从 argIndex 开始），
+// 以及偏移分页时的偏移量。空游标表示第一页。
+func (k Keyset) After(cursor string, argIndex int) (string, []interface{}, int, error) {
+	if cursor == "" {
+		return "", nil, 0, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", nil, 0, ErrInvalidCursor
+	}
+	var payload cursorPayload
+	if err := json.Unmarshal(raw, &payload); err != nil || payload.Sort != k.Name {
+		return "", nil, 0, ErrInvalidCursor
+	}
+
+	if k.OffsetOnly {
+		if payload.Offset < 0 || len(payload.Values) != 0 {
+			return "", nil, 0, ErrInvalidCursor
+		}
+		return "", nil, payload.Offset, nil
+	}
+
+	if len(payload.Values) != len(k.Keys) {
+		return "", nil, 0, ErrInvalidCursor
+	}
+	for i, key := range k.Keys {
+		if !validCursorValue(key.Cast, payload.Values[i]) {
+			return "", nil, 0, ErrInvalidCursor
+		}
+	}
+
+	// (a, b, id) 在游标之后：a 更靠后，或 a 相同且 b 更靠后，……
+	placeholders := make([]string, len(k.Keys))
+	for i, key := range k.Keys {
+		placeholders[i] = fmt.Sprintf("$%d::%s", argIndex+i, key.Cast)
+	}
+	var disjuncts []string
+	for i, key := range k.Keys {
+		var conj []string
+		for j := 0; j < i; j++ {
+			conj = append(conj, fmt.Sprintf("%s = %s", k.Keys[j].Expr, placeholders[j]))
+		}
+		op := ">"
+		if key.Desc {
+			op = "<"
+		}
+		conj = append(conj, fmt.Sprintf("%s %s %s", key.Expr, op, placeholders[i]))
+		disjuncts = append(disjuncts, "("+strings.Join(conj, " AND ")+")")
+	}
+
+	return "(" + strings.Join(disjuncts, " OR ") + ")", payload.Values, 0, nil
+}
+
+// validCursorValue 检查游标中的值是否符合排序键的类型
+func validCursorValue(cast string, value interface{}) bool {
+	switch cast {
+	case "timestamp":
+		s, ok := value.(string)
+		if !ok {
+			return false
+		}
+		if s == "infinity" || s == "-infinity" {
+			return true
+		}
+		_, err := time.Parse(cursorTimeLayout, s)
+		return err == nil
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "real":
+		_, ok := value.(float64)
+		return ok
+	case "text":
+		_, ok := value.(string)
+		return ok
+	}
+	return false
+}
+
+// Cursor 根据最后一行的排序键值（或偏移量）生成下一页的游标
+func (k Keyset) Cursor(values []interface{}, offset int) string {
+	payload := cursorPayload{Sort: k.Name}
+	if k.OffsetOnly {
+		payload.Offset = offset
+	} else {
+		payload.Values = make([]interface{}, len(values))
+		for i, value := range values {
+			if t, ok := value.(time.Time); ok {
+				value = t.Format(cursorTimeLayout)
+			}
+			payload.Values[i] = value
+		}
+	}
+	raw, _ := json.Marshal(payload)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// PriorityRankExpr 把优先级映射为可比较的整数
+const PriorityRankExpr = "CASE WHEN priority = 'high' THEN 1 WHEN priority = 'medium' THEN 2 WHEN priority = 'low' THEN 3 ELSE 4 END"
+
+// PriorityRank 与 PriorityRankExpr 相同的映射，用于生成游标
+func PriorityRank(priority string) int {
+	switch priority {
+	case "high":
+		return 1
+	case "medium":
+		return 2
+	case "low":
+		return 3
+	}
+	return 4
+}
+
+// defaultTodoKeyset GetAllTodos 使用的排序：优先级，再按创建时间倒序
+var defaultTodoKeyset = Keyset{
+	Name: "default",
+	Keys: []SortKey{
+		{Expr: PriorityRankExpr, Cast: "integer"},
+		{Expr: "created_at", Desc: true, Cast: "timestamp"},
+		{Expr: "id", Desc: true, Cast: "integer"},
+	},
+}
+
+// BuildPageQuery 组合分页查询：where 中的参数占用 $1..$len(args)
+func BuildPageQuery(selectFrom, where string, args []interface{}, keyset Keyset, page PageRequest) (string, []interface{}, int, error) {
+	cond, cursorArgs, offset, err := keyset.After(page.Cursor, len(args)+1)
+	if err != nil {
+		return "", nil, 0, err
+	}
+	if cond != "" {
+		if where == "" {
+			where = "WHERE " + cond
+		} else {
+			where += " AND " + cond
+		}
+	}
+
+	query := fmt.Sprintf("%s %s %s LIMIT %d OFFSET %d",
+		selectFrom, where, keyset.OrderBy(), page.PageLimit()+1, offset)
+	return query, append(args, cursorArgs...), offset, nil
+}
+
+// FinishPage 根据多查询的一行判断是否还有下一页，返回保留的行数和分页信息；
+// lastValues 返回保留的最后一行的排序键值
+func FinishPage(keyset Keyset, page PageRequest, fetched, offset int, lastValues func(i int) []interface{}) (int, PageInfo) {
+	limit := page.PageLimit()
+	info := PageInfo{Limit: limit}
+	if fetched <= limit {
+		return fetched, info
+	}
+
+	info.HasMore = true
+	if keyset.OffsetOnly {
+		info.NextCursor = keyset.Cursor(nil, offset+limit)
+	} else {
+		info.NextCursor = keyset.Cursor(lastValues(limit-1), 0)
+	}
+	return limit, info
+}
+
+// countRows 执行计数查询，用于可选的总数
+func countRows(db execer, query string, args ...interface{}) (*int, error) {
+	var total int
+	if err := db.QueryRow(query, args...).Scan(&total); err != nil {
+		return nil, fmt.Errorf("count query failed: %w", err)
+	}
+	return &total, nil
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestKeysetCursorRoundTrip(t *testing.T) {
+	created := time.Date(2024, 5, 1, 10, 30, 0, 123456000, time.UTC)
+	cursor := defaultTodoKeyset.Cursor([]interface{}{PriorityRank("medium"), created, 42}, 0)
+
+	cond, args, offset, err := defaultTodoKeyset.After(cursor, 2)
+	if err != nil {
+		t.Fatalf("After() error = %v", err)
+	}
+
+	wantCond := "((" + PriorityRankExpr + " > $2::integer) OR (" +
+		PriorityRankExpr + " = $2::integer AND created_at < $3::timestamp) OR (" +
+		PriorityRankExpr + " = $2::integer AND created_at = $3::timestamp AND id < $4::integer))"
+	if cond != wantCond {
+		t.Errorf("After() cond =\n  %s\nwant\n  %s", cond, wantCond)
+	}
+	if want := []interface{}{float64(2), "2024-05-01T10:30:00.123456", float64(42)}; !reflect.DeepEqual(args, want) {
+		t.Errorf("After() args = %#v, want %#v", args, want)
+	}
+	if offset != 0 {
+		t.Errorf("After() offset = %d, want 0", offset)
+	}
+}
+
+func TestKeysetCursorErrors(t *testing.T) {
+	other := Keyset{Name: "other", Keys: []SortKey{{Expr: "id", Cast: "integer"}}}
+	tests := map[string]string{
+		"not base64":   "%%%",
+		"other sort":   other.Cursor([]interface{}{1}, 0),
+		"wrong arity":  defaultTodoKeyset.Cursor([]interface{}{1, 2}, 0),
+		"wrong type":   defaultTodoKeyset.Cursor([]interface{}{1, "yesterday", 3}, 0),
+		"float for id": defaultTodoKeyset.Cursor([]interface{}{1, "infinity", 1.5}, 0),
+	}
+	for name, cursor := range tests {
+		if _, _, _, err := defaultTodoKeyset.After(cursor, 1); err != ErrInvalidCursor {
+			t.Errorf("%s: After() error = %v, want ErrInvalidCursor", name, err)
+		}
+	}
+
+	offsetKeyset := Keyset{Name: "rank", Keys: []SortKey{{Expr: "rank"}}, OffsetOnly: true}
+	if _, _, offset, err := offsetKeyset.After(offsetKeyset.Cursor(nil, 40), 1); err != nil || offset != 40 {
+		t.Errorf("offset cursor = %d, %v, want 40, nil", offset, err)
+	}
+}
@@ -0,0 +1,197 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// maxSavedFilterNameLength 保存的过滤器名称的最大长度
+const maxSavedFilterNameLength = 50
+
+// maxSavedFilterIconLength 图标的最大长度，与 saved_filters.icon VARCHAR(20) 一致
+const maxSavedFilterIconLength = 20
+
+var (
+	// ErrSavedFilterNotFound 保存的过滤器不存在
+	ErrSavedFilterNotFound = errors.New("saved filter not found")
+	// ErrInvalidSavedFilter 保存的过滤器定义无效
+	ErrInvalidSavedFilter = errors.New("invalid saved filter")
+	// ErrDuplicateSavedFilter 用户已有同名的过滤器
+	ErrDuplicateSavedFilter = errors.New("saved filter already exists")
+)
+
+// SavedFilter 用户保存的过滤条件（智能列表）
+type SavedFilter struct {
+	ID        int             `json:"id"`
+	UserID    int             `json:"userId"`
+	Name      string          `json:"name"`
+	Icon      string          `json:"icon,omitempty"`
+	Criteria  json.RawMessage `json:"criteria"` // 序列化的过滤参数，由 handlers 解析
+	Pinned    bool            `json:"pinned"`
+	Position  int             `json:"position"`
+	CreatedAt time.Time       `json:"createdAt"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+}
+
+// SavedFilterModel 处理保存的过滤器相关的数据库操作
+type SavedFilterModel struct {
+	DB *sql.DB
+}
+
+// NewSavedFilterModel 创建一个新的SavedFilterModel实例
+func NewSavedFilterModel(db *sql.DB) *SavedFilterModel {
+	return &SavedFilterModel{DB: db}
+}
+
+const savedFilterColumns = "id, user_id, name, icon, criteria, pinned, position, created_at, updated_at"
+
+// scanSavedFilter 扫描一行保存的过滤器
+func scanSavedFilter(row rowScanner) (SavedFilter, error) {
+	var filter SavedFilter
+	var icon sql.NullString
+	var criteria []byte
+	err := row.Scan(
+		&filter.ID,
+		&filter.UserID,
+		&filter.Name,
+		&icon,
+		&criteria,
+		&filter.Pinned,
+		&filter.Position,
+		&filter.CreatedAt,
+		&filter.UpdatedAt,
+	)
+	filter.Icon = icon.String
+	filter.Criteria = json.RawMessage(criteria)
+	return filter, err
+}
+
+// validateSavedFilter 校验过滤器名称和图标，并确保条件是一个JSON对象
+func validateSavedFilter(filter *SavedFilter) error {
+	filter.Name = strings.TrimSpace(filter.Name)
+	if filter.Name == "" || len([]rune(filter.Name)) > maxSavedFilterNameLength {
+		return ErrInvalidSavedFilter
+	}
+	if len([]rune(filter.Icon)) > maxSavedFilterIconLength {
+		return ErrInvalidSavedFilter
+	}
+	if len(filter.Criteria) == 0 {
+		filter.Criteria = json.RawMessage("{}")
+	}
+	var criteria map[string]interface{}
+	if err := json.Unmarshal(filter.Criteria, &criteria); err != nil || criteria == nil {
+		return ErrInvalidSavedFilter
+	}
+	return nil
+}
+
+// GetFilters 获取用户保存的所有过滤器（置顶的排在前面）
+func (m *SavedFilterModel) GetFilters(userID int) ([]SavedFilter, error) {
+	rows, err := m.DB.Query(
+		"SELECT "+savedFilterColumns+" FROM saved_filters WHERE user_id = $1 ORDER BY pinned DESC, position, id",
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query saved filters failed: %w", err)
+	}
+	defer rows.Close()
+
+	filters := []SavedFilter{}
+	for rows.Next() {
+		filter, err := scanSavedFilter(rows)
+		if err != nil {
+			log.Printf("scan saved filter failed: %v", err)
+			continue
+		}
+		filters = append(filters, filter)
+	}
+
+	return filters, nil
+}
+
+// GetFilter 根据ID获取用户保存的过滤器
+func (m *SavedFilterModel) GetFilter(userID, filterID int) (*SavedFilter, error) {
+	filter, err := scanSavedFilter(m.DB.QueryRow(
+		"SELECT "+savedFilterColumns+" FROM saved_filters WHERE id = $1 AND user_id = $2",
+		filterID, userID,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrSavedFilterNotFound
+		}
+		return nil, fmt.Errorf("get saved filter failed: %w", err)
+	}
+	return &filter, nil
+}
+
+// CreateFilter 保存过滤器
+func (m *SavedFilterModel) CreateFilter(filter *SavedFilter) error {
+	if err := validateSavedFilter(filter); err != nil {
+		return err
+	}
+
+	err := m.DB.QueryRow(
+		`INSERT INTO saved_filters (user_id, name, icon, criteria, pinned, position)
+		 VALUES ($1, $2, NULLIF($3, ''), $4::jsonb, $5, $6)
+		 RETURNING id, created_at, updated_at`,
+		filter.UserID, filter.Name, filter.Icon, string(filter.Criteria), filter.Pinned, filter.Position,
+	).Scan(&filter.ID, &filter.CreatedAt, &filter.UpdatedAt)
+	if err != nil {
+		if isUniqueViolation(err, "saved_filters_user_id_name_key") {
+			return ErrDuplicateSavedFilter
+		}
+		return fmt.Errorf("create saved filter failed: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateFilter 更新保存的过滤器
+func (m *SavedFilterModel) UpdateFilter(filter *SavedFilter) error {
+	if err := validateSavedFilter(filter); err != nil {
+		return err
+	}
+
+	err := m.DB.QueryRow(
+		`UPDATE saved_filters SET
+			name = $1,
+			icon = NULLIF($2, ''),
+			criteria = $3::jsonb,
+			pinned = $4,
+			position = $5,
+			updated_at = NOW()
+		WHERE id = $6 AND user_id = $7
+		RETURNING created_at, updated_at`,
+		filter.Name, filter.Icon, string(filter.Criteria), filter.Pinned, filter.Position, filter.ID, filter.UserID,
+	).Scan(&filter.CreatedAt, &filter.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrSavedFilterNotFound
+		}
+		if isUniqueViolation(err, "saved_filters_user_id_name_key") {
+			return ErrDuplicateSavedFilter
+		}
+		return fmt.Errorf("update saved filter failed: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteFilter 删除保存的过滤器
+func (m *SavedFilterModel) DeleteFilter(userID, filterID int) error {
+	result, err := m.DB.Exec("DELETE FROM saved_filters WHERE id = $1 AND user_id = $2", filterID, userID)
+	if err != nil {
+		return fmt.Errorf("delete saved filter failed: %w", err)
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrSavedFilterNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateSavedFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		criteria string
+		valid    bool
+	}{
+		{"Today", `{"due":"today"}`, true},
+		{"  Work  ", ``, true},
+		{strings.Repeat("筛", maxSavedFilterNameLength), `{}`, true},
+		{"", `{}`, false},
+		{"   ", `{}`, false},
+		{strings.Repeat("x", maxSavedFilterNameLength+1), `{}`, false},
+		{"Array", `["due"]`, false},
+		{"Null", `null`, false},
+		{"String", `"today"`, false},
+		{"Broken", `{"due":`, false},
+	}
+	for _, tt := range tests {
+		filter := SavedFilter{Name: tt.name, Criteria: json.RawMessage(tt.criteria)}
+		err := validateSavedFilter(&filter)
+		if tt.valid && err != nil {
+			t.Errorf("validateSavedFilter(%q, %s) = %v", tt.name, tt.criteria, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidSavedFilter) {
+			t.Errorf("validateSavedFilter(%q, %s) = %v, want ErrInvalidSavedFilter", tt.name, tt.criteria, err)
+		}
+	}
+
+	if err := validateSavedFilter(&SavedFilter{Name: "Icon", Icon: strings.Repeat("x", maxSavedFilterIconLength+1)}); !errors.Is(err, ErrInvalidSavedFilter) {
+		t.Errorf("long icon error = %v", err)
+	}
+
+	// 名称去掉空白，空条件保存为空对象
+	filter := SavedFilter{Name: " Work "}
+	if err := validateSavedFilter(&filter); err != nil || filter.Name != "Work" || string(filter.Criteria) != "{}" {
+		t.Errorf("filter = %+v, %v", filter, err)
+	}
+}
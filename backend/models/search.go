@@ -0,0 +1,222 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"log"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// SearchResult 全文搜索的一条结果，Type 为 todo 或 step
+type SearchResult struct {
+	Type          string  `json:"type"`
+	TodoID        int     `json:"todoId"`
+	StepID        int     `json:"stepId,omitempty"`
+	Task          string  `json:"task"`
+	TaskHighlight string  `json:"taskHighlight"`
+	Snippet       string  `json:"snippet,omitempty"` // 描述或步骤内容的高亮片段
+	Done          bool    `json:"done"`
+	Rank          float64 `json:"rank"`
+}
+
+// SearchModel 处理全文搜索相关的数据库操作
+type SearchModel struct {
+	DB *sql.DB
+}
+
+// NewSearchModel 创建一个新的SearchModel实例
+func NewSearchModel(db *sql.DB) *SearchModel {
+	return &SearchModel{DB: db}
+}
+
+// snippetLength 高亮片段的最大字符数
+const snippetLength = 120
+
+// isCJK 判断字符是否按 n-gram 切分，范围与数据库函数 cjk_ngrams 保持一致
+func isCJK(r rune) bool {
+	return (r >= 0x3040 && r <= 0x30ff) ||
+		(r >= 0x3400 && r <= 0x4dbf) ||
+		(r >= 0x4e00 && r <= 0x9fff) ||
+		(r >= 0xac00 && r <= 0xd7af)
+}
+
+// SearchTerms 把搜索输入切分为词：连续的字母数字为一个词（转小写），
+// 连续的中日韩文字单独成词，其余字符作为分隔符
+func SearchTerms(input string) []string {
+	var terms []string
+	var current []rune
+	currentCJK := false
+
+	flush := func() {
+		if len(current) > 0 {
+			terms = append(terms, string(current))
+			current = current[:0]
+		}
+	}
+
+	for _, r := range input {
+		switch {
+		case isCJK(r):
+			if !currentCJK {
+				flush()
+			}
+			currentCJK = true
+			current = append(current, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if currentCJK {
+				flush()
+			}
+			currentCJK = false
+			current = append(current, unicode.ToLower(r))
+		default:
+			flush()
+		}
+	}
+	flush()
+
+	return terms
+}
+
+// BuildTSQuery 把搜索输入转换为 to_tsquery('simple', ...) 的查询文本。
+// 普通词按前缀匹配；中日韩文字拆成与 cjk_ngrams 一致的二元组并要求全部出现。
+// 输入中没有可搜索的词时返回空字符串。
+func BuildTSQuery(input string) string {
+	var parts []string
+	for _, term := range SearchTerms(input) {
+		runes := []rune(term)
+		if !isCJK(runes[0]) {
+			parts = append(parts, term+":*")
+			continue
+		}
+		if len(runes) == 1 {
+			parts = append(parts, term)
+			continue
+		}
+		for i := 0; i+1 < len(runes); i++ {
+			parts = append(parts, string(runes[i:i+2]))
+		}
+	}
+	return strings.Join(parts, " & ")
+}
+
+// Highlight 用 <mark> 标记 text 中出现的搜索词（不区分大小写），其余内容做HTML转义。
+// maxLen > 0 时截取第一个匹配附近最多 maxLen 个字符的片段。
+// 数据库的 ts_headline 无法处理 n-gram 切分的中文，所以在这里完成高亮。
+func Highlight(text string, terms []string, maxLen int) string {
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	// 长词优先匹配
+	sorted := make([][]rune, 0, len(terms))
+	for _, term := range terms {
+		if term != "" {
+			sorted = append(sorted, []rune(strings.ToLower(term)))
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+
+	marked := make([]bool, len(runes))
+	first := -1
+	for i := 0; i < len(runes); i++ {
+		for _, term := range sorted {
+			if i+len(term) <= len(runes) && string(lower[i:i+len(term)]) == string(term) {
+				for j := i; j < i+len(term); j++ {
+					marked[j] = true
+				}
+				if first == -1 {
+					first = i
+				}
+				break
+			}
+		}
+	}
+
+	start, end := 0, len(runes)
+	if maxLen > 0 && len(runes) > maxLen {
+		if first > maxLen/4 {
+			start = first - maxLen/4
+		}
+		end = start + maxLen
+		if end > len(runes) {
+			end, start = len(runes), len(runes)-maxLen
+		}
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	for i := start; i < end; {
+		j := i
+		for j < end && marked[j] == marked[i] {
+			j++
+		}
+		segment := html.EscapeString(string(runes[i:j]))
+		if marked[i] {
+			b.WriteString("<mark>" + segment + "</mark>")
+		} else {
+			b.WriteString(segment)
+		}
+		i = j
+	}
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// Search 同时搜索用户的待办事项和步骤，按相关度排序。
+// 待办事项的 search_vector 已包含步骤内容，步骤结果用于定位具体匹配的步骤。
+func (m *SearchModel) Search(userID int, input string, limit int) ([]SearchResult, error) {
+	results := []SearchResult{}
+	tsquery := BuildTSQuery(input)
+	if tsquery == "" {
+		return results, nil
+	}
+
+	rows, err := m.DB.Query(
+		`WITH q AS (SELECT to_tsquery('simple', $2) AS query)
+		SELECT 'todo' AS kind, t.id AS todo_id, 0 AS step_id, t.task, COALESCE(t.description, '') AS body,
+		       t.done, ts_rank(t.search_vector, q.query) AS rank
+		FROM todos t, q
+		WHERE t.user_id = $1 AND t.search_vector @@ q.query
+		UNION ALL
+		SELECT 'step', t.id, s.id, t.task, s.content, s.completed,
+		       ts_rank(search_document(s.content), q.query) * 0.5
+		FROM steps s
+		JOIN todos t ON t.id = s.todo_id, q
+		WHERE t.user_id = $1 AND search_document(s.content) @@ q.query
+		ORDER BY rank DESC, todo_id DESC, step_id
+		LIMIT $3`,
+		userID, tsquery, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+	defer rows.Close()
+
+	terms := SearchTerms(input)
+	for rows.Next() {
+		var result SearchResult
+		var body string
+		var rank float32
+		if err := rows.Scan(&result.Type, &result.TodoID, &result.StepID, &result.Task, &body, &result.Done, &rank); err != nil {
+			log.Printf("scan search result failed: %v", err)
+			continue
+		}
+		result.Rank = float64(rank)
+		result.TaskHighlight = Highlight(result.Task, terms, 0)
+		if body != "" {
+			result.Snippet = Highlight(body, terms, snippetLength)
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildTSQuery(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"Quarterly Report", "quarterly:* & report:*"},
+		{"e-mail & (boss)", "e:* & mail:* & boss:*"},
+		{"待办事项", "待办 & 办事 & 事项"},
+		{"买菜", "买菜"},
+		{"写 report 周报", "写 & report:* & 周报"},
+		{"Go语言", "go:* & 语言"},
+		{"!!! '", ""},
+	}
+
+	for _, tt := range tests {
+		if got := BuildTSQuery(tt.input); got != tt.want {
+			t.Errorf("BuildTSQuery(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	if got, want := SearchTerms("Go语言 v2"), []string{"go", "语言", "v2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SearchTerms() = %v, want %v", got, want)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		text   string
+		terms  []string
+		maxLen int
+		want   string
+	}{
+		{"Send the Report", []string{"report"}, 0, "Send the <mark>Report</mark>"},
+		{"<b>待办事项</b>", []string{"待办事项"}, 0, "&lt;b&gt;<mark>待办事项</mark>&lt;/b&gt;"},
+		{"repo reports", []string{"repo", "reports"}, 0, "<mark>repo</mark> <mark>reports</mark>"},
+		// 截取片段时在匹配前保留 maxLen/4 个字符
+		{"0123456789abcdefghij0123456789", []string{"f"}, 8, "…de<mark>f</mark>ghij0…"},
+		{"0123456789abcdefghij", []string{"f"}, 8, "…cde<mark>f</mark>ghij"},
+	}
+
+	for _, tt := range tests {
+		if got := Highlight(tt.text, tt.terms, tt.maxLen); got != tt.want {
+			t.Errorf("Highlight(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 同步变更涉及的实体，对应 sync_changes.entity
+const (
+	SyncEntityTodo = "todo"
+	SyncEntityStep = "step"
+	SyncEntityTag  = "tag"
+)
+
+// syncTokenPrefix 同步令牌的版本前缀，令牌格式变化时递增
+const syncTokenPrefix = "v1:"
+
+// ErrInvalidSyncToken 同步令牌格式错误或不属于当前用户
+var ErrInvalidSyncToken = errors.New("invalid sync token")
+
+// EncodeSyncToken 把同步序号编码为不透明的同步令牌
+func EncodeSyncToken(seq int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(syncTokenPrefix + strconv.FormatInt(seq, 10)))
+}
+
+// DecodeSyncToken 解析同步令牌，空令牌表示从头同步（序号 0）
+func DecodeSyncToken(token string) (int64, error) {
+	if token == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || !strings.HasPrefix(string(raw), syncTokenPrefix) {
+		return 0, ErrInvalidSyncToken
+	}
+	seq, err := strconv.ParseInt(strings.TrimPrefix(string(raw), syncTokenPrefix), 10, 64)
+	if err != nil || seq < 0 {
+		return 0, ErrInvalidSyncToken
+	}
+	return seq, nil
+}
+
+// SyncDeleted 自上次同步以来被删除的实体ID（墓碑）
+type SyncDeleted struct {
+	Todos []int `json:"todos"`
+	Steps []int `json:"steps"`
+	Tags  []int `json:"tags"`
+}
+
+// SyncChanges 一次增量同步的结果。Full 为 true 表示这是完整快照，客户端应先清空本地数据；
+// HasMore 为 true 表示还有更多变更，客户端应立即用 Token 继续拉取。
+type SyncChanges struct {
+	Token   string      `json:"token"`
+	Full    bool        `json:"full"`
+	HasMore bool        `json:"hasMore"`
+	Todos   []Todo      `json:"todos"`
+	Steps   []Step      `json:"steps"`
+	Tags    []Tag       `json:"tags"`
+	Deleted SyncDeleted `json:"deleted"`
+}
+
+// SyncModel 处理离线同步相关的数据库操作
+type SyncModel struct {
+	DB *sql.DB
+}
+
+// NewSyncModel 创建一个新的SyncModel实例
+func NewSyncModel(db *sql.DB) *SyncModel {
+	return &SyncModel{DB: db}
+}
+
+// Changes 返回用户在同步序号 since 之后的变更，最多 limit 个实体。since 为 0 时返回完整快照。
+// 每个实体只返回当前状态；同一实体多次修改只出现一次。所有读取在同一个可重复读快照中进行，
+// 同步序号由触发器在用户级行锁下分配，快照中看到的序号总是连续的前缀，不会漏掉并发提交的变更。
+func (m *SyncModel) Changes(userID int, since int64, limit int) (*SyncChanges, error) {
+	tx, err := m.DB.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	var lastSeq int64
+	err = tx.QueryRow(
+		"SELECT COALESCE((SELECT last_seq FROM sync_sequences WHERE user_id = $1), 0)",
+		userID,
+	).Scan(&lastSeq)
+	if err != nil {
+		return nil, fmt.Errorf("get sync sequence failed: %w", err)
+	}
+	if since > lastSeq {
+		return nil, ErrInvalidSyncToken
+	}
+
+	changes := &SyncChanges{
+		Todos:   []Todo{},
+		Steps:   []Step{},
+		Tags:    []Tag{},
+		Deleted: SyncDeleted{Todos: []int{}, Steps: []int{}, Tags: []int{}},
+	}
+
+	if since == 0 {
+		changes.Full = true
+		if err := loadSyncEntities(tx, userID, changes, nil, nil, nil); err != nil {
+			return nil, err
+		}
+		changes.Token = EncodeSyncToken(lastSeq)
+		return changes, tx.Commit()
+	}
+
+	rows, err := tx.Query(`
+		SELECT entity, entity_id, seq, deleted FROM sync_changes
+		WHERE user_id = $1 AND seq > $2
+		ORDER BY seq
+		LIMIT $3
+	`, userID, since, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("query sync changes failed: %w", err)
+	}
+	defer rows.Close()
+
+	changed := map[string][]int{}
+	seq := lastSeq
+	count := 0
+	for rows.Next() {
+		var entity string
+		var entityID int
+		var changeSeq int64
+		var deleted bool
+		if err := rows.Scan(&entity, &entityID, &changeSeq, &deleted); err != nil {
+			return nil, fmt.Errorf("scan sync change failed: %w", err)
+		}
+		if count == limit {
+			changes.HasMore = true
+			break
+		}
+		count++
+		seq = changeSeq
+		if deleted {
+			changes.Deleted.add(entity, entityID)
+			continue
+		}
+		changed[entity] = append(changed[entity], entityID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate sync changes failed: %w", err)
+	}
+	rows.Close()
+	if !changes.HasMore {
+		seq = lastSeq
+	}
+
+	if len(changed) > 0 {
+		if err := loadSyncEntities(tx, userID, changes,
+			changed[SyncEntityTodo], changed[SyncEntityStep], changed[SyncEntityTag]); err != nil {
+			return nil, err
+		}
+		// 记录为修改但已经读不到的实体（例如随待办事项级联删除的步骤）按删除处理
+		changes.Deleted.addMissing(SyncEntityTodo, changed[SyncEntityTodo], todoIDs(changes.Todos))
+		changes.Deleted.addMissing(SyncEntityStep, changed[SyncEntityStep], stepIDs(changes.Steps))
+		changes.Deleted.addMissing(SyncEntityTag, changed[SyncEntityTag], tagIDs(changes.Tags))
+	}
+
+	changes.Token = EncodeSyncToken(seq)
+	return changes, tx.Commit()
+}
+
+// loadSyncEntities 读取用户的待办事项、步骤和标签的当前状态；某类ID为 nil 时读取该类的全部实体，
+// 为空切片时不读取。待办事项中不包含步骤，步骤单独返回。
+func loadSyncEntities(tx *sql.Tx, userID int, changes *SyncChanges, todoIDs, stepIDs, tagIDs []int) error {
+	full := todoIDs == nil && stepIDs == nil && tagIDs == nil
+
+	if full || len(todoIDs) > 0 {
+		rows, err := tx.Query(
+			"SELECT "+TodoColumns+" FROM todos WHERE user_id = $1 AND ($2::int[] IS NULL OR id = ANY($2::int[])) ORDER BY id",
+			userID, syncIDsArg(todoIDs),
+		)
+		if err != nil {
+			return fmt.Errorf("query todos failed: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			todo, err := ScanTodo(rows)
+			if err != nil {
+				return fmt.Errorf("scan todo failed: %w", err)
+			}
+			changes.Todos = append(changes.Todos, todo)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("iterate todos failed: %w", err)
+		}
+		rows.Close()
+	}
+
+	if full || len(stepIDs) > 0 {
+		rows, err := tx.Query(
+			"SELECT "+StepColumns+" FROM steps WHERE todo_id IN (SELECT id FROM todos WHERE user_id = $1) "+
+				"AND ($2::int[] IS NULL OR id = ANY($2::int[])) ORDER BY todo_id, id",
+			userID, syncIDsArg(stepIDs),
+		)
+		if err != nil {
+			return fmt.Errorf("query steps failed: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var step Step
+			if err := rows.Scan(&step.ID, &step.UUID, &step.TodoID, &step.Content, &step.Completed, &step.ClientID); err != nil {
+				return fmt.Errorf("scan step failed: %w", err)
+			}
+			changes.Steps = append(changes.Steps, step)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("iterate steps failed: %w", err)
+		}
+		rows.Close()
+	}
+
+	if full || len(tagIDs) > 0 {
+		var ids []int
+		if !full {
+			ids = tagIDs
+		}
+		tags, err := queryTags(tx, userID, ids)
+		if err != nil {
+			return err
+		}
+		changes.Tags = append(changes.Tags, tags...)
+	}
+
+	return nil
+}
+
+// syncIDsArg nil 表示不按ID过滤（SQL NULL）
+func syncIDsArg(ids []int) interface{} {
+	if ids == nil {
+		return nil
+	}
+	return intArrayLiteral(ids)
+}
+
+// add 记录一个被删除的实体
+func (d *SyncDeleted) add(entity string, id int) {
+	switch entity {
+	case SyncEntityTodo:
+		d.Todos = append(d.Todos, id)
+	case SyncEntityStep:
+		d.Steps = append(d.Steps, id)
+	case SyncEntityTag:
+		d.Tags = append(d.Tags, id)
+	}
+}
+
+// addMissing 把 changed 中没有出现在 found 里的ID记录为删除
+func (d *SyncDeleted) addMissing(entity string, changed, found []int) {
+	present := make(map[int]bool, len(found))
+	for _, id := range found {
+		present[id] = true
+	}
+	for _, id := range changed {
+		if !present[id] {
+			d.add(entity, id)
+		}
+	}
+}
+
+func todoIDs(todos []Todo) []int {
+	ids := make([]int, len(todos))
+	for i, todo := range todos {
+		ids[i] = todo.ID
+	}
+	return ids
+}
+
+func stepIDs(steps []Step) []int {
+	ids := make([]int, len(steps))
+	for i, step := range steps {
+		ids[i] = step.ID
+	}
+	return ids
+}
+
+func tagIDs(tags []Tag) []int {
+	ids := make([]int, len(tags))
+	for i, tag := range tags {
+		ids[i] = tag.ID
+	}
+	return ids
+}
+
+// TodoByClientID 根据客户端生成的ID查找用户的待办事项（包含步骤）
+func (m *SyncModel) TodoByClientID(userID int, clientID string) (*Todo, error) {
+	todo, err := ScanTodo(m.DB.QueryRow(
+		"SELECT "+TodoColumns+" FROM todos WHERE user_id = $1 AND client_id = $2",
+		userID, clientID,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTodoNotFound
+		}
+		return nil, fmt.Errorf("get todo by client id failed: %w", err)
+	}
+	if todo.Steps, err = stepsOf(m.DB, todo.ID); err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
+
+// StepByClientID 根据客户端生成的ID查找待办事项下的步骤
+func (m *SyncModel) StepByClientID(todoID int, clientID string) (*Step, error) {
+	return m.queryStep("WHERE todo_id = $1 AND client_id = $2", todoID, clientID)
+}
+
+// GetStep 获取属于用户的步骤
+func (m *SyncModel) GetStep(userID, stepID int) (*Step, error) {
+	return m.queryStep("WHERE id = $1 AND todo_id IN (SELECT id FROM todos WHERE user_id = $2)", stepID, userID)
+}
+
+// queryStep 按条件查询单个步骤
+func (m *SyncModel) queryStep(where string, args ...interface{}) (*Step, error) {
+	var step Step
+	err := m.DB.QueryRow("SELECT "+StepColumns+" FROM steps "+where, args...).
+		Scan(&step.ID, &step.UUID, &step.TodoID, &step.Content, &step.Completed, &step.ClientID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrStepNotFound
+		}
+		return nil, fmt.Errorf("get step failed: %w", err)
+	}
+	return &step, nil
+}
+
+// UpdateStep 更新步骤的内容和完成状态
+func (m *SyncModel) UpdateStep(step *Step) error {
+	result, err := m.DB.Exec(
+		"UPDATE steps SET content = $1, completed = $2 WHERE id = $3 AND todo_id = $4",
+		step.Content, step.Completed, step.ID, step.TodoID,
+	)
+	if err != nil {
+		return fmt.Errorf("update step failed: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrStepNotFound
+	}
+	return nil
+}
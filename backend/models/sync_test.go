@@ -0,0 +1,36 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSyncTokenRoundTrip(t *testing.T) {
+	for _, seq := range []int64{0, 1, 42, 1 << 40} {
+		got, err := DecodeSyncToken(EncodeSyncToken(seq))
+		if err != nil || got != seq {
+			t.Errorf("round trip %d = %d, %v", seq, got, err)
+		}
+	}
+
+	if seq, err := DecodeSyncToken(""); err != nil || seq != 0 {
+		t.Errorf("empty token = %d, %v, want 0", seq, err)
+	}
+	for _, token := range []string{"42", "not base64!", EncodeSyncToken(-1)[:4]} {
+		if _, err := DecodeSyncToken(token); err != ErrInvalidSyncToken {
+			t.Errorf("DecodeSyncToken(%q) error = %v, want ErrInvalidSyncToken", token, err)
+		}
+	}
+}
+
+func TestSyncDeletedAddMissing(t *testing.T) {
+	deleted := SyncDeleted{Todos: []int{}, Steps: []int{}, Tags: []int{}}
+	deleted.add(SyncEntityTodo, 9)
+	deleted.addMissing(SyncEntityStep, []int{1, 2, 3}, []int{2})
+	deleted.addMissing(SyncEntityTag, []int{5}, []int{5})
+
+	want := SyncDeleted{Todos: []int{9}, Steps: []int{1, 3}, Tags: []int{}}
+	if !reflect.DeepEqual(deleted, want) {
+		t.Errorf("deleted = %+v, want %+v", deleted, want)
+	}
+}
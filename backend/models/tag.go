@@ -0,0 +1,324 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// maxTagLength 标签名称的最大长度
+const maxTagLength = 30
+
+var (
+	// ErrTagNotFound 标签不存在
+	ErrTagNotFound = errors.New("tag not found")
+	// ErrInvalidTag 标签名称无效
+	ErrInvalidTag = errors.New("invalid tag name")
+	// ErrDuplicateTag 标签目录中已有同名标签
+	ErrDuplicateTag = errors.New("tag already exists")
+)
+
+// Tag 表示用户标签目录中的一个标签
+type Tag struct {
+	ID          int       `json:"id"`
+	UserID      int       `json:"userId"`
+	Name        string    `json:"name"`
+	Color       string    `json:"color,omitempty"`
+	Description string    `json:"description,omitempty"`
+	UsageCount  int       `json:"usageCount"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// TagModel 处理标签目录相关的数据库操作
+type TagModel struct {
+	DB *sql.DB
+}
+
+// NewTagModel 创建一个新的TagModel实例
+func NewTagModel(db *sql.DB) *TagModel {
+	return &TagModel{DB: db}
+}
+
+// NormalizeTags 去除标签两端空白、丢弃空标签并去重（保留首次出现的顺序）
+func NormalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		if len([]rune(tag)) > maxTagLength {
+			return nil, ErrInvalidTag
+		}
+		if !containsString(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized, nil
+}
+
+// syncTagCatalog 把待办事项中用到的标签登记到用户的标签目录
+func syncTagCatalog(db execer, userID int, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	tagsJSON, err := json.Marshal(tags)
+	if err != nil {
+		return fmt.Errorf("marshal tags failed: %w", err)
+	}
+
+	_, err = db.Exec(
+		`INSERT INTO tags (user_id, name)
+		 SELECT $1, jsonb_array_elements_text($2::jsonb)
+		 ON CONFLICT (user_id, name) DO NOTHING`,
+		userID, string(tagsJSON),
+	)
+	if err != nil {
+		return fmt.Errorf("sync tag catalog failed: %w", err)
+	}
+
+	return nil
+}
+
+// SyncCatalog 把标签登记到用户的标签目录
+func (m *TagModel) SyncCatalog(userID int, tags []string) error {
+	return syncTagCatalog(m.DB, userID, tags)
+}
+
+// GetTags 获取用户的标签目录及每个标签的使用次数
+func (m *TagModel) GetTags(userID int) ([]Tag, error) {
+	return queryTags(m.DB, userID, nil)
+}
+
+// queryTags 查询用户的标签及使用次数，ids 不为 nil 时只返回其中的标签
+func queryTags(db execer, userID int, ids []int) ([]Tag, error) {
+	var idsArg interface{}
+	if ids != nil {
+		idsArg = intArrayLiteral(ids)
+	}
+
+	rows, err := db.Query(
+		`WITH usage AS (
+			SELECT t.name, COUNT(*) AS cnt
+			FROM todos, jsonb_array_elements_text(todos.tags) AS t(name)
+			WHERE todos.user_id = $1
+			GROUP BY t.name
+		)
+		SELECT tags.id, tags.user_id, tags.name, tags.color, tags.description,
+		       COALESCE(usage.cnt, 0), tags.created_at
+		FROM tags
+		LEFT JOIN usage ON usage.name = tags.name
+		WHERE tags.user_id = $1 AND ($2::int[] IS NULL OR tags.id = ANY($2::int[]))
+		ORDER BY tags.name`,
+		userID, idsArg,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query tags failed: %w", err)
+	}
+	defer rows.Close()
+
+	tags := []Tag{}
+	for rows.Next() {
+		tag, err := scanTag(rows)
+		if err != nil {
+			log.Printf("scan tag failed: %v", err)
+			continue
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
+
+// scanTag 扫描一行标签（包含使用次数）
+func scanTag(row rowScanner) (Tag, error) {
+	var tag Tag
+	var color, description sql.NullString
+	err := row.Scan(
+		&tag.ID,
+		&tag.UserID,
+		&tag.Name,
+		&color,
+		&description,
+		&tag.UsageCount,
+		&tag.CreatedAt,
+	)
+	tag.Color = color.String
+	tag.Description = description.String
+	return tag, err
+}
+
+// CreateTag 在标签目录中创建标签
+func (m *TagModel) CreateTag(tag *Tag) error {
+	tag.Name = strings.TrimSpace(tag.Name)
+	if tag.Name == "" || len([]rune(tag.Name)) > maxTagLength {
+		return ErrInvalidTag
+	}
+
+	err := m.DB.QueryRow(
+		`INSERT INTO tags (user_id, name, color, description)
+		 VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''))
+		 RETURNING id, created_at`,
+		tag.UserID, tag.Name, tag.Color, tag.Description,
+	).Scan(&tag.ID, &tag.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err, "tags_user_id_name_key") {
+			return ErrDuplicateTag
+		}
+		return fmt.Errorf("create tag failed: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateTag 更新标签的颜色和描述，名称通过 RenameTag 修改
+func (m *TagModel) UpdateTag(tag *Tag) error {
+	err := m.DB.QueryRow(
+		`UPDATE tags SET color = NULLIF($1, ''), description = NULLIF($2, '')
+		 WHERE id = $3 AND user_id = $4
+		 RETURNING name, created_at`,
+		tag.Color, tag.Description, tag.ID, tag.UserID,
+	).Scan(&tag.Name, &tag.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrTagNotFound
+		}
+		return fmt.Errorf("update tag failed: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteTag 从标签目录中删除标签，并从所有待办事项中移除该标签
+func (m *TagModel) DeleteTag(userID, tagID int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	var name string
+	err = tx.QueryRow(
+		"DELETE FROM tags WHERE id = $1 AND user_id = $2 RETURNING name",
+		tagID, userID,
+	).Scan(&name)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrTagNotFound
+		}
+		return fmt.Errorf("delete tag failed: %w", err)
+	}
+
+	_, err = tx.Exec(
+		"UPDATE todos SET tags = tags - $1::text, updated_at = NOW() WHERE user_id = $2 AND tags ? $1::text",
+		name, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("remove tag from todos failed: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction failed: %w", err)
+	}
+
+	return nil
+}
+
+// RenameTag 重命名标签；如果新名称已存在，则等同于合并
+func (m *TagModel) RenameTag(userID int, from, to string) (int, error) {
+	return m.MergeTags(userID, []string{from}, to)
+}
+
+// MergeTags 在一个事务中把 sources 标签合并到 target：
+// 改写所有待办事项中的标签（去重并保留顺序），并更新标签目录。
+// 返回被改写的待办事项数量。
+func (m *TagModel) MergeTags(userID int, sources []string, target string) (int, error) {
+	target = strings.TrimSpace(target)
+	if target == "" || len([]rune(target)) > maxTagLength {
+		return 0, ErrInvalidTag
+	}
+
+	var filtered []string
+	for _, source := range sources {
+		if source != target && !containsString(filtered, source) {
+			filtered = append(filtered, source)
+		}
+	}
+	if len(filtered) == 0 {
+		return 0, nil
+	}
+	sourcesJSON, err := json.Marshal(filtered)
+	if err != nil {
+		return 0, fmt.Errorf("marshal tags failed: %w", err)
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	var found int
+	err = tx.QueryRow(
+		"SELECT COUNT(*) FROM tags WHERE user_id = $1 AND $2::jsonb ? name",
+		userID, string(sourcesJSON),
+	).Scan(&found)
+	if err != nil {
+		return 0, fmt.Errorf("check source tags failed: %w", err)
+	}
+	if found == 0 {
+		return 0, ErrTagNotFound
+	}
+
+	result, err := tx.Exec(
+		`UPDATE todos SET tags = (
+			SELECT COALESCE(jsonb_agg(name ORDER BY pos), '[]'::jsonb)
+			FROM (
+				SELECT DISTINCT ON (name) name, pos
+				FROM (
+					SELECT CASE WHEN $2::jsonb ? e THEN $3 ELSE e END AS name, pos
+					FROM jsonb_array_elements_text(todos.tags) WITH ORDINALITY AS x(e, pos)
+				) renamed
+				ORDER BY name, pos
+			) deduped
+		), updated_at = NOW()
+		WHERE user_id = $1 AND tags ?| ARRAY(SELECT jsonb_array_elements_text($2::jsonb))`,
+		userID, string(sourcesJSON), target,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("rewrite todo tags failed: %w", err)
+	}
+	affected, _ := result.RowsAffected()
+
+	// 目标标签不存在时，沿用第一个源标签的颜色和描述
+	_, err = tx.Exec(
+		`INSERT INTO tags (user_id, name, color, description)
+		 SELECT user_id, $3, color, description FROM tags
+		 WHERE user_id = $1 AND $2::jsonb ? name
+		 ORDER BY id LIMIT 1
+		 ON CONFLICT (user_id, name) DO NOTHING`,
+		userID, string(sourcesJSON), target,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("create target tag failed: %w", err)
+	}
+
+	_, err = tx.Exec(
+		"DELETE FROM tags WHERE user_id = $1 AND $2::jsonb ? name",
+		userID, string(sourcesJSON),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("delete source tags failed: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit transaction failed: %w", err)
+	}
+
+	return int(affected), nil
+}
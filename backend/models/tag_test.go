@@ -0,0 +1,104 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tags, err := NormalizeTags([]string{" work ", "", "home", "work", "  ", "Work"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 只去掉空白和完全相同的重复项，大小写不同的标签是不同的标签
+	if want := []string{"work", "home", "Work"}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("NormalizeTags = %q, want %q", tags, want)
+	}
+
+	if tags, err := NormalizeTags(nil); err != nil || tags == nil || len(tags) != 0 {
+		t.Errorf("NormalizeTags(nil) = %#v, %v", tags, err)
+	}
+	// 长度按字符计算
+	if _, err := NormalizeTags([]string{strings.Repeat("标", maxTagLength)}); err != nil {
+		t.Errorf("tag of %d runes rejected: %v", maxTagLength, err)
+	}
+	if _, err := NormalizeTags([]string{"ok", strings.Repeat("x", maxTagLength+1)}); !errors.Is(err, ErrInvalidTag) {
+		t.Errorf("long tag error = %v", err)
+	}
+}
+
+func TestTagNameValidation(t *testing.T) {
+	// 名称无效时在访问数据库之前返回
+	m := NewTagModel(nil)
+	for _, name := range []string{"", "   ", strings.Repeat("x", maxTagLength+1)} {
+		if err := m.CreateTag(&Tag{UserID: 1, Name: name}); !errors.Is(err, ErrInvalidTag) {
+			t.Errorf("CreateTag(%q) error = %v", name, err)
+		}
+		if _, err := m.MergeTags(1, []string{"a"}, name); !errors.Is(err, ErrInvalidTag) {
+			t.Errorf("MergeTags into %q error = %v", name, err)
+		}
+	}
+
+	// 源标签都等于目标标签时什么都不做
+	if affected, err := m.RenameTag(1, "same", " same "); affected != 0 || err != nil {
+		t.Errorf("RenameTag to itself = %d, %v", affected, err)
+	}
+}
+
+func TestMergeTagsDedup(t *testing.T) {
+	db := openTestDB(t)
+	userID, todo := createLegacyTodo(t, db)
+	if _, err := db.Exec(`UPDATE todos SET tags = '["a", "x", "b", "c"]' WHERE id = $1`, todo.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := syncTagCatalog(db, userID, []string{"a", "x", "b", "c"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tagsOf := func() []string {
+		t.Helper()
+		got, err := NewTodoModel(db).GetTodoByID(todo.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got.Tags
+	}
+
+	// 重命名为已存在的标签时去重，保留第一次出现的位置
+	m := NewTagModel(db)
+	if affected, err := m.RenameTag(userID, "a", "b"); err != nil || affected != 1 {
+		t.Fatalf("RenameTag = %d, %v", affected, err)
+	}
+	if got := tagsOf(); !reflect.DeepEqual(got, []string{"b", "x", "c"}) {
+		t.Errorf("tags after rename = %q", got)
+	}
+
+	if affected, err := m.MergeTags(userID, []string{"x", "c", "missing"}, "merged"); err != nil || affected != 1 {
+		t.Fatalf("MergeTags = %d, %v", affected, err)
+	}
+	if got := tagsOf(); !reflect.DeepEqual(got, []string{"b", "merged"}) {
+		t.Errorf("tags after merge = %q", got)
+	}
+
+	catalog, err := m.GetTags(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tag := range catalog {
+		names = append(names, tag.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"b", "merged"}) {
+		t.Errorf("catalog = %q", names)
+	}
+
+	if _, err := m.RenameTag(userID, "missing", "other"); !errors.Is(err, ErrTagNotFound) {
+		t.Errorf("rename unknown tag error = %v", err)
+	}
+
+	if err := m.CreateTag(&Tag{UserID: userID, Name: " merged "}); !errors.Is(err, ErrDuplicateTag) {
+		t.Errorf("duplicate tag error = %v", err)
+	}
+}
@@ -3,36 +3,123 @@ package models
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
+var (
+	// ErrTodoNotFound 待办事项不存在
+	ErrTodoNotFound = errors.New("todo not found")
+	// ErrVersionConflict 待办事项已被修改，版本号与 If-Match 不一致
+	ErrVersionConflict = errors.New("todo version conflict")
+	// ErrStepNotFound 步骤不存在或不属于当前用户
+	ErrStepNotFound = errors.New("step not found")
+)
+
 // Step 表示一个任务步骤
 type Step struct {
 	ID        int    `json:"id"`
+	UUID      string `json:"uuid"` // 公开的 UUIDv7 标识，创建时可以由客户端提供
 	TodoID    int    `json:"todoId"`
 	Content   string `json:"content"`
 	Completed bool   `json:"completed"`
+	ClientID  string `json:"clientId,omitempty"` // 离线客户端生成的ID
 }
 
+// StepColumns 查询步骤时使用的列，顺序与 Step 的字段一致
+const StepColumns = "id, uuid, todo_id, content, completed, COALESCE(client_id, '')"
+
 // todo 表示一个待办事项
 type Todo struct {
-	ID            int        `json:"id"`
-	Task          string     `json:"task"`
-	Description   string     `json:"description,omitempty"`
-	Done          bool       `json:"done"`
-	Priority      string     `json:"priority"` // low, medium, high
-	Category      string     `json:"category"` // work, personal, study, health, etc.
-	DueDate       *time.Time `json:"dueDate,omitempty"`
-	Reminder      bool       `json:"reminder"`
-	EstimatedTime *int       `json:"estimatedTime,omitempty"` // 预估时间（分钟）
-	Tags          []string   `json:"tags,omitempty"`
-	Steps         []Step     `json:"steps,omitempty"`
-	UserID        int        `json:"userId"`
-	CreatedAt     time.Time  `json:"createdAt"`
-	UpdatedAt     time.Time  `json:"updatedAt"`
-	CompletedAt   *time.Time `json:"completedAt,omitempty"`
+	ID              int                    `json:"id"`
+	UUID            string                 `json:"uuid"` // 公开的 UUIDv7 标识，创建时可以由客户端提供
+	Task            string                 `json:"task"`
+	Description     string                 `json:"description,omitempty"`
+	Done            bool                   `json:"done"`
+	Priority        string                 `json:"priority"` // low, medium, high
+	Category        string                 `json:"category"` // work, personal, study, health, etc.
+	DueDate         *time.Time             `json:"dueDate,omitempty"`
+	Reminder        bool                   `json:"reminder"`
+	EstimatedTime   *int                   `json:"estimatedTime,omitempty"` // 预估时间（分钟）
+	Tags            []string               `json:"tags,omitempty"`
+	Steps           []Step                 `json:"steps,omitempty"`
+	UserID          int                    `json:"userId"`
+	Status          string                 `json:"status"` // 工作流状态，对应 workflow_states.key
+	StatusChangedAt *time.Time             `json:"statusChangedAt,omitempty"`
+	CustomFields    map[string]interface{} `json:"customFields,omitempty"`
+	CreatedAt       time.Time              `json:"createdAt"`
+	UpdatedAt       time.Time              `json:"updatedAt"`
+	CompletedAt     *time.Time             `json:"completedAt,omitempty"`
+	Version         int                    `json:"version"`            // 每次写入递增，用于乐观并发控制
+	ClientID        string                 `json:"clientId,omitempty"` // 离线客户端生成的ID
+}
+
+// TodoColumns 查询完整待办事项时使用的列，顺序与 ScanTodo 保持一致
+const TodoColumns = `id, uuid, task, description, done, priority, category, due_date,
+		       reminder, estimated_time, tags, user_id, status, status_changed_at,
+		       custom_fields, created_at, updated_at, completed_at, version,
+		       COALESCE(client_id, '')`
+
+// rowScanner 兼容 *sql.Row 和 *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// ScanTodo 按 TodoColumns 的顺序扫描一行待办事项（不包含步骤）
+func ScanTodo(row rowScanner) (Todo, error) {
+	var todo Todo
+	var description, tagsJSON, status, customFieldsJSON sql.NullString
+
+	err := row.Scan(
+		&todo.ID,
+		&todo.UUID,
+		&todo.Task,
+		&description,
+		&todo.Done,
+		&todo.Priority,
+		&todo.Category,
+		&todo.DueDate,
+		&todo.Reminder,
+		&todo.EstimatedTime,
+		&tagsJSON,
+		&todo.UserID,
+		&status,
+		&todo.StatusChangedAt,
+		&customFieldsJSON,
+		&todo.CreatedAt,
+		&todo.UpdatedAt,
+		&todo.CompletedAt,
+		&todo.Version,
+		&todo.ClientID,
+	)
+	if err != nil {
+		return todo, err
+	}
+
+	todo.Description = description.String
+	todo.Status = status.String
+
+	// 解析标签JSON
+	if tagsJSON.Valid && tagsJSON.String != "" {
+		if err := json.Unmarshal([]byte(tagsJSON.String), &todo.Tags); err != nil {
+			log.Printf("parse tags failed: %v", err)
+			todo.Tags = []string{}
+		}
+	}
+
+	// 解析自定义字段JSON
+	if customFieldsJSON.Valid && customFieldsJSON.String != "" && customFieldsJSON.String != "{}" {
+		if err := json.Unmarshal([]byte(customFieldsJSON.String), &todo.CustomFields); err != nil {
+			log.Printf("parse custom fields failed: %v", err)
+		}
+	}
+
+	return todo, nil
 }
 
 // TodoModel 处理Todo相关的数据库操作
@@ -45,14 +132,18 @@ func NewTodoModel(db *sql.DB) *TodoModel {
 	return &TodoModel{DB: db}
 }
 
-// GetAllTodos 获取所有待办事项
+// GetAllTodos 获取所有待办事项（包含步骤）
 func (m *TodoModel) GetAllTodos(userID int) ([]Todo, error) {
+	return m.GetTodos(userID, true)
+}
+
+// GetTodos 获取所有待办事项，withSteps 为 false 时不加载步骤
+func (m *TodoModel) GetTodos(userID int, withSteps bool) ([]Todo, error) {
 	var todos []Todo
 
 	// 查询指定用户的所有待办事项，包含新字段
 	query := `
-		SELECT id, task, description, done, priority, category, due_date,
-		       reminder, estimated_time, tags, created_at, updated_at, completed_at
+		SELECT ` + TodoColumns + `
 		FROM todos
 		WHERE user_id = $1
 		ORDER BY
@@ -73,41 +164,19 @@ func (m *TodoModel) GetAllTodos(userID int) ([]Todo, error) {
 
 	// 处理查询结果
 	for rows.Next() {
-		var todo Todo
-		var tagsJSON sql.NullString
-
-		scanErr := rows.Scan(
-			&todo.ID,
-			&todo.Task,
-			&todo.Description,
-			&todo.Done,
-			&todo.Priority,
-			&todo.Category,
-			&todo.DueDate,
-			&todo.Reminder,
-			&todo.EstimatedTime,
-			&tagsJSON,
-			&todo.CreatedAt,
-			&todo.UpdatedAt,
-			&todo.CompletedAt,
-		)
+		todo, scanErr := ScanTodo(rows)
 		if scanErr != nil {
 			log.Printf("scan todo failed: %v", scanErr)
 			continue
 		}
+		todos = append(todos, todo)
+	}
 
-		// 解析标签JSON
-		if tagsJSON.Valid && tagsJSON.String != "" {
-			if err := json.Unmarshal([]byte(tagsJSON.String), &todo.Tags); err != nil {
-				log.Printf("parse tags failed: %v", err)
-				todo.Tags = []string{}
-			}
+	// 一次查询加载所有任务的步骤
+	if withSteps {
+		if err := m.AttachSteps(todos); err != nil {
+			log.Printf("获取步骤失败: %v", err)
 		}
-
-		todo.UserID = userID
-		// 获取该任务的所有步骤
-		todo.Steps, _ = m.GetStepsByTodoID(todo.ID)
-		todos = append(todos, todo)
 	}
 
 	return todos, nil
@@ -130,6 +199,24 @@ func (m *TodoModel) AddTodo(todo *Todo) error {
 		}
 	}()
 
+	// 校验客户端提供的 UUID
+	if todo.UUID, err = normalizeClientUUID(todo.UUID); err != nil {
+		return err
+	}
+	for i := range todo.Steps {
+		if todo.Steps[i].UUID, err = normalizeClientUUID(todo.Steps[i].UUID); err != nil {
+			return err
+		}
+	}
+
+	// 规范化标签并登记到标签目录
+	if todo.Tags, err = NormalizeTags(todo.Tags); err != nil {
+		return err
+	}
+	if err = syncTagCatalog(tx, todo.UserID, todo.Tags); err != nil {
+		return err
+	}
+
 	// 序列化标签为JSON
 	var tagsJSON string
 	if len(todo.Tags) > 0 {
@@ -142,6 +229,27 @@ func (m *TodoModel) AddTodo(todo *Todo) error {
 		tagsJSON = "[]" // 空数组而不是空字符串
 	}
 
+	// 校验分类，未指定时使用默认分类和分类的默认优先级
+	if err = resolveTodoCategory(tx, todo); err != nil {
+		return err
+	}
+
+	// 确保用户拥有工作流状态，并校验指定的状态
+	if err = ensureDefaultStates(tx, todo.UserID); err != nil {
+		return err
+	}
+	if todo.Status != "" {
+		if _, err = getStateByKey(tx, todo.UserID, todo.Status); err != nil {
+			return err
+		}
+	}
+
+	// 校验自定义字段
+	customFieldsJSON, err := prepareCustomFields(tx, todo.UserID, todo.CustomFields, true)
+	if err != nil {
+		return err
+	}
+
 	// 插入待办事项
 	var todoID int
 	log.Printf("插入任务: %s, 描述: %s, 用户ID: %d", todo.Task, todo.Description, todo.UserID)
@@ -149,9 +257,12 @@ func (m *TodoModel) AddTodo(todo *Todo) error {
 	query := `
 		INSERT INTO todos (
 			task, description, done, priority, category, due_date,
-			reminder, estimated_time, tags, user_id, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW(), NOW())
-		RETURNING id
+			reminder, estimated_time, tags, user_id, status, custom_fields, client_id, uuid, created_at, updated_at
+		) VALUES (
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, ''), $12, NULLIF($13, ''),
+			COALESCE(NULLIF($14, '')::uuid, uuid_generate_v7()), NOW(), NOW()
+		)
+		RETURNING id, uuid, status, completed_at, version
 	`
 
 	err = tx.QueryRow(
@@ -166,9 +277,16 @@ func (m *TodoModel) AddTodo(todo *Todo) error {
 		todo.EstimatedTime,
 		tagsJSON,
 		todo.UserID,
-	).Scan(&todoID)
+		todo.Status,
+		*customFieldsJSON,
+		todo.ClientID,
+		todo.UUID,
+	).Scan(&todoID, &todo.UUID, &todo.Status, &todo.CompletedAt, &todo.Version)
 
 	if err != nil {
+		if isUniqueViolation(err, "idx_todos_uuid") {
+			return ErrDuplicateUUID
+		}
 		return fmt.Errorf("insert todo failed: %w", err)
 	}
 
@@ -184,11 +302,14 @@ func (m *TodoModel) AddTodo(todo *Todo) error {
 
 			log.Printf("插入步骤 %d: %s", i+1, todo.Steps[i].Content)
 			err = tx.QueryRow(
-				"INSERT INTO steps (todo_id, content, completed) VALUES ($1, $2, $3) RETURNING id",
-				todoID, todo.Steps[i].Content, todo.Steps[i].Completed,
-			).Scan(&stepID)
+				insertStepQuery,
+				todoID, todo.Steps[i].Content, todo.Steps[i].Completed, todo.Steps[i].ClientID, todo.Steps[i].UUID,
+			).Scan(&stepID, &todo.Steps[i].UUID)
 
 			if err != nil {
+				if isUniqueViolation(err, "idx_steps_uuid") {
+					return ErrDuplicateUUID
+				}
 				return fmt.Errorf("insert step failed: %w", err)
 			}
 
@@ -207,8 +328,31 @@ func (m *TodoModel) AddTodo(todo *Todo) error {
 	return nil
 }
 
+// versionsArg 把允许的版本号转换为查询参数，nil 表示不检查版本（SQL NULL）
+func versionsArg(versions []int) interface{} {
+	if versions == nil {
+		return nil
+	}
+	return intArrayLiteral(versions)
+}
+
+// currentVersion 读取待办事项当前的版本号
+func currentVersion(db execer, todoID int) (int, error) {
+	var version int
+	if err := db.QueryRow("SELECT version FROM todos WHERE id = $1", todoID).Scan(&version); err != nil {
+		return 0, fmt.Errorf("get todo version failed: %w", err)
+	}
+	return version, nil
+}
+
 // UpdateTodo 更新一个待办事项
 func (m *TodoModel) UpdateTodo(todo *Todo, userID int) error {
+	return m.UpdateTodoIfMatch(todo, userID, nil)
+}
+
+// UpdateTodoIfMatch 仅当待办事项的当前版本号在 versions 中时更新（versions 为 nil 时不检查），
+// 版本不匹配时返回 ErrVersionConflict。更新成功后 todo.Version 为新的版本号。
+func (m *TodoModel) UpdateTodoIfMatch(todo *Todo, userID int, versions []int) error {
 	// 首先检查待办事项是否属于该用户
 	var ownerID int
 	err := m.DB.QueryRow("SELECT user_id FROM todos WHERE id = $1", todo.ID).Scan(&ownerID)
@@ -227,6 +371,16 @@ func (m *TodoModel) UpdateTodo(todo *Todo, userID int) error {
 		return fmt.Errorf("begin transaction failed: %w", err)
 	}
 
+	// 规范化标签并登记到标签目录
+	if todo.Tags, err = NormalizeTags(todo.Tags); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = syncTagCatalog(tx, userID, todo.Tags); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	// 序列化标签为JSON
 	var tagsJSON string
 	if len(todo.Tags) > 0 {
@@ -240,7 +394,34 @@ func (m *TodoModel) UpdateTodo(todo *Todo, userID int) error {
 		tagsJSON = "[]" // 空数组而不是空字符串
 	}
 
-	// 更新待办事项
+	// 校验分类
+	todo.UserID = userID
+	if err = resolveTodoCategory(tx, todo); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// 校验工作流状态；未提供状态时由 done 推导。迁移前的用户可能还没有工作流状态，先创建默认状态
+	if todo.Status != "" {
+		if err = ensureDefaultStates(tx, userID); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err = getStateByKey(tx, userID, todo.Status); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// 校验自定义字段；未提供时保留原有的值
+	customFieldsJSON, err := prepareCustomFields(tx, userID, todo.CustomFields, todo.CustomFields != nil)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// 更新待办事项（status 与 done、completed_at 的一致性由 sync_todo_status 触发器维护）
+	var updatedFieldsJSON string
 	updateQuery := `
 		UPDATE todos SET
 			task = $1,
@@ -252,12 +433,14 @@ func (m *TodoModel) UpdateTodo(todo *Todo, userID int) error {
 			reminder = $7,
 			estimated_time = $8,
 			tags = $9,
-			updated_at = NOW(),
-			completed_at = CASE WHEN $3 = true AND done = false THEN NOW() ELSE completed_at END
-		WHERE id = $10 AND user_id = $11
+			status = COALESCE(NULLIF($12, ''), status),
+			custom_fields = COALESCE($13::jsonb, custom_fields),
+			updated_at = NOW()
+		WHERE id = $10 AND user_id = $11 AND ($14::int[] IS NULL OR version = ANY($14::int[]))
+		RETURNING done, status, completed_at, custom_fields, version
 	`
 
-	_, err = tx.Exec(
+	err = tx.QueryRow(
 		updateQuery,
 		todo.Task,
 		todo.Description,
@@ -270,13 +453,27 @@ func (m *TodoModel) UpdateTodo(todo *Todo, userID int) error {
 		tagsJSON,
 		todo.ID,
 		userID,
-	)
+		todo.Status,
+		customFieldsJSON,
+		versionsArg(versions),
+	).Scan(&todo.Done, &todo.Status, &todo.CompletedAt, &updatedFieldsJSON, &todo.Version)
 
 	if err != nil {
 		tx.Rollback()
+		if err == sql.ErrNoRows {
+			// 所有权已经校验过，没有更新到行说明版本号不匹配
+			return ErrVersionConflict
+		}
 		return fmt.Errorf("update todo failed: %w", err)
 	}
 
+	todo.CustomFields = nil
+	if updatedFieldsJSON != "{}" {
+		if err := json.Unmarshal([]byte(updatedFieldsJSON), &todo.CustomFields); err != nil {
+			log.Printf("parse custom fields failed: %v", err)
+		}
+	}
+
 	// 如果提供了步骤，则更新步骤
 	if todo.Steps != nil {
 		// 删除旧步骤
@@ -303,6 +500,12 @@ func (m *TodoModel) UpdateTodo(todo *Todo, userID int) error {
 
 			todo.Steps[i].ID = stepID
 		}
+
+		// 步骤变化会再次递增版本号
+		if todo.Version, err = currentVersion(tx, todo.ID); err != nil {
+			tx.Rollback()
+			return err
+		}
 	}
 
 	// 提交事务
@@ -328,8 +531,59 @@ func (m *TodoModel) ToggleTodo(id int) error {
 	return nil
 }
 
+// VersionConflict 批量操作中版本号与期望不一致的待办事项，Current 为 0 表示已被删除
+type VersionConflict struct {
+	ID       int `json:"id"`
+	Expected int `json:"expected"`
+	Current  int `json:"current"`
+}
+
+// LockTodoVersions 在事务中锁定用户的待办事项（SELECT ... FOR UPDATE），
+// 返回版本号与 expected（待办事项ID -> 期望的版本号）不一致的项
+func LockTodoVersions(tx *sql.Tx, userID int, expected map[int]int) ([]VersionConflict, error) {
+	ids := make([]int, 0, len(expected))
+	for id := range expected {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	rows, err := tx.Query(
+		"SELECT id, version FROM todos WHERE user_id = $1 AND id = ANY($2::int[]) ORDER BY id FOR UPDATE",
+		userID, intArrayLiteral(ids),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("lock todos failed: %w", err)
+	}
+	defer rows.Close()
+
+	current := make(map[int]int, len(ids))
+	for rows.Next() {
+		var id, version int
+		if err := rows.Scan(&id, &version); err != nil {
+			return nil, fmt.Errorf("scan todo version failed: %w", err)
+		}
+		current[id] = version
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("lock todos failed: %w", err)
+	}
+
+	var conflicts []VersionConflict
+	for _, id := range ids {
+		if current[id] != expected[id] {
+			conflicts = append(conflicts, VersionConflict{ID: id, Expected: expected[id], Current: current[id]})
+		}
+	}
+	return conflicts, nil
+}
+
 // DeleteTodo 删除待办事项
 func (m *TodoModel) DeleteTodo(id int, userID int) error {
+	return m.DeleteTodoIfMatch(id, userID, nil)
+}
+
+// DeleteTodoIfMatch 仅当待办事项的当前版本号在 versions 中时删除（versions 为 nil 时不检查）
+func (m *TodoModel) DeleteTodoIfMatch(id int, userID int, versions []int) error {
 	// 首先检查待办事项是否属于该用户
 	var ownerID int
 	err := m.DB.QueryRow("SELECT user_id FROM todos WHERE id = $1", id).Scan(&ownerID)
@@ -343,26 +597,44 @@ func (m *TodoModel) DeleteTodo(id int, userID int) error {
 	}
 
 	// 由于设置了外键约束，删除待办事项时会自动删除相关步骤
-	_, err = m.DB.Exec(
-		"DELETE FROM todos WHERE id = $1 AND user_id = $2", id, userID,
+	result, err := m.DB.Exec(
+		"DELETE FROM todos WHERE id = $1 AND user_id = $2 AND ($3::int[] IS NULL OR version = ANY($3::int[]))",
+		id, userID, versionsArg(versions),
 	)
 	if err != nil {
 		return fmt.Errorf("delete todo failed: %w", err)
 	}
+	if affected, _ := result.RowsAffected(); affected == 0 && versions != nil {
+		return ErrVersionConflict
+	}
 
 	return nil
 }
 
+// insertStepQuery 插入步骤，没有提供 UUID 时由数据库生成
+const insertStepQuery = `
+	INSERT INTO steps (todo_id, content, completed, client_id, uuid)
+	VALUES ($1, $2, $3, NULLIF($4, ''), COALESCE(NULLIF($5, '')::uuid, uuid_generate_v7()))
+	RETURNING id, uuid`
+
 // AddStep 添加步骤
 func (m *TodoModel) AddStep(step *Step) error {
 	var stepID int
 
-	err := m.DB.QueryRow(
-		"INSERT INTO steps (todo_id, content, completed) VALUES ($1, $2, $3) RETURNING id",
-		step.TodoID, step.Content, step.Completed,
-	).Scan(&stepID)
+	uuid, err := normalizeClientUUID(step.UUID)
+	if err != nil {
+		return err
+	}
+
+	err = m.DB.QueryRow(
+		insertStepQuery,
+		step.TodoID, step.Content, step.Completed, step.ClientID, uuid,
+	).Scan(&stepID, &step.UUID)
 
 	if err != nil {
+		if isUniqueViolation(err, "idx_steps_uuid") {
+			return ErrDuplicateUUID
+		}
 		return fmt.Errorf("insert step failed: %w", err)
 	}
 
@@ -414,20 +686,16 @@ func (m *TodoModel) DeleteStep(id int, todoID int) error {
 
 // GetTodoByID 根据ID获取单个待办事项
 func (m *TodoModel) GetTodoByID(id int) (*Todo, error) {
-	var todo Todo
-
 	// 查询待办事项
-	err := m.DB.QueryRow(
-		"SELECT id, task, description, done FROM todos WHERE id = $1",
+	todo, err := ScanTodo(m.DB.QueryRow(
+		"SELECT "+TodoColumns+" FROM todos WHERE id = $1",
 		id,
-	).Scan(
-		&todo.ID,
-		&todo.Task,
-		&todo.Description,
-		&todo.Done,
-	)
+	))
 
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTodoNotFound
+		}
 		return nil, fmt.Errorf("get todo by id failed: %w", err)
 	}
 
@@ -443,12 +711,66 @@ func (m *TodoModel) GetTodoByID(id int) (*Todo, error) {
 	return &todo, nil
 }
 
+// GetStepsByTodoIDs 一次查询获取多个待办事项的步骤，按待办事项ID分组
+func (m *TodoModel) GetStepsByTodoIDs(todoIDs []int) (map[int][]Step, error) {
+	stepsByTodo := make(map[int][]Step, len(todoIDs))
+	if len(todoIDs) == 0 {
+		return stepsByTodo, nil
+	}
+
+	rows, err := m.DB.Query(
+		"SELECT "+StepColumns+" FROM steps WHERE todo_id = ANY($1::int[]) ORDER BY todo_id, id",
+		intArrayLiteral(todoIDs),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query steps failed: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var step Step
+		if err := rows.Scan(&step.ID, &step.UUID, &step.TodoID, &step.Content, &step.Completed, &step.ClientID); err != nil {
+			log.Printf("scan step failed: %v", err)
+			continue
+		}
+		stepsByTodo[step.TodoID] = append(stepsByTodo[step.TodoID], step)
+	}
+
+	return stepsByTodo, nil
+}
+
+// AttachSteps 为一组待办事项批量加载步骤（只执行一次查询）
+func (m *TodoModel) AttachSteps(todos []Todo) error {
+	ids := make([]int, len(todos))
+	for i, todo := range todos {
+		ids[i] = todo.ID
+	}
+
+	stepsByTodo, err := m.GetStepsByTodoIDs(ids)
+	if err != nil {
+		return err
+	}
+	for i := range todos {
+		todos[i].Steps = stepsByTodo[todos[i].ID]
+	}
+	return nil
+}
+
+// intArrayLiteral 把整数ID格式化为 PostgreSQL 数组字面量，例如 {1,2,3}
+func intArrayLiteral(ids []int) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.Itoa(id)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
 // GetStepsByTodoID 根据待办事项ID获取所有步骤
 func (m *TodoModel) GetStepsByTodoID(todoID int) ([]Step, error) {
 	var steps []Step
 
 	rows, err := m.DB.Query(
-		"SELECT id, todo_id, content, completed FROM steps WHERE todo_id = $1 ORDER BY id",
+		"SELECT "+StepColumns+" FROM steps WHERE todo_id = $1 ORDER BY id",
 		todoID,
 	)
 	if err != nil {
@@ -460,9 +782,11 @@ func (m *TodoModel) GetStepsByTodoID(todoID int) ([]Step, error) {
 		var step Step
 		scanErr := rows.Scan(
 			&step.ID,
+			&step.UUID,
 			&step.TodoID,
 			&step.Content,
 			&step.Completed,
+			&step.ClientID,
 		)
 		if scanErr != nil {
 			log.Printf("scan step failed: %v", scanErr)
@@ -473,3 +797,95 @@ func (m *TodoModel) GetStepsByTodoID(todoID int) ([]Step, error) {
 
 	return steps, nil
 }
+
+// ListTodos 按 GetAllTodos 的顺序分页获取用户的待办事项，withSteps 为 false 时不加载步骤
+func (m *TodoModel) ListTodos(userID int, page PageRequest, withSteps bool) ([]Todo, PageInfo, error) {
+	query, args, offset, err := BuildPageQuery(
+		"SELECT "+TodoColumns+" FROM todos", "WHERE user_id = $1", []interface{}{userID},
+		defaultTodoKeyset, page,
+	)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	rows, err := m.DB.Query(query, args...)
+	if err != nil {
+		return nil, PageInfo{}, fmt.Errorf("query todos failed: %w", err)
+	}
+	defer rows.Close()
+
+	todos := []Todo{}
+	for rows.Next() {
+		todo, err := ScanTodo(rows)
+		if err != nil {
+			log.Printf("scan todo failed: %v", err)
+			continue
+		}
+		todos = append(todos, todo)
+	}
+
+	n, info := FinishPage(defaultTodoKeyset, page, len(todos), offset, func(i int) []interface{} {
+		return []interface{}{PriorityRank(todos[i].Priority), todos[i].CreatedAt, todos[i].ID}
+	})
+	todos = todos[:n]
+
+	if withSteps {
+		if err := m.AttachSteps(todos); err != nil {
+			return nil, PageInfo{}, err
+		}
+	}
+
+	if page.WithTotal {
+		if info.Total, err = countRows(m.DB, "SELECT COUNT(*) FROM todos WHERE user_id = $1", userID); err != nil {
+			return nil, PageInfo{}, err
+		}
+	}
+
+	return todos, info, nil
+}
+
+// stepKeyset 步骤按ID顺序排列
+var stepKeyset = Keyset{
+	Name: "steps",
+	Keys: []SortKey{{Expr: "id", Cast: "integer"}},
+}
+
+// ListSteps 分页获取待办事项的步骤
+func (m *TodoModel) ListSteps(todoID int, page PageRequest) ([]Step, PageInfo, error) {
+	query, args, offset, err := BuildPageQuery(
+		"SELECT "+StepColumns+" FROM steps", "WHERE todo_id = $1", []interface{}{todoID},
+		stepKeyset, page,
+	)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	rows, err := m.DB.Query(query, args...)
+	if err != nil {
+		return nil, PageInfo{}, fmt.Errorf("query steps failed: %w", err)
+	}
+	defer rows.Close()
+
+	steps := []Step{}
+	for rows.Next() {
+		var step Step
+		if err := rows.Scan(&step.ID, &step.UUID, &step.TodoID, &step.Content, &step.Completed, &step.ClientID); err != nil {
+			log.Printf("scan step failed: %v", err)
+			continue
+		}
+		steps = append(steps, step)
+	}
+
+	n, info := FinishPage(stepKeyset, page, len(steps), offset, func(i int) []interface{} {
+		return []interface{}{steps[i].ID}
+	})
+	steps = steps[:n]
+
+	if page.WithTotal {
+		if info.Total, err = countRows(m.DB, "SELECT COUNT(*) FROM steps WHERE todo_id = $1", todoID); err != nil {
+			return nil, PageInfo{}, err
+		}
+	}
+
+	return steps, info, nil
+}
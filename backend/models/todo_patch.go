@@ -0,0 +1,266 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// TodoFieldError 部分更新时某个字段的值无效
+type TodoFieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *TodoFieldError) Error() string {
+	return fmt.Sprintf("field %q: %s", e.Field, e.Message)
+}
+
+// patchableTodoFields 可以通过 PATCH 修改的字段（JSON 字段名），顺序即 SET 子句的顺序。
+// steps 不对应列，由 syncPatchedSteps 增量同步。
+var patchableTodoFields = []string{
+	"task", "description", "done", "priority", "category", "dueDate",
+	"reminder", "estimatedTime", "tags", "status", "customFields", "steps",
+}
+
+// IsPatchableTodoField 判断字段是否可以通过 PATCH 修改
+func IsPatchableTodoField(field string) bool {
+	for _, f := range patchableTodoFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// PatchTodo 只更新 fields（JSON 字段名）中列出的字段，其余列保持不变。
+// todo 中应包含打补丁后的完整值；steps 按ID增量同步：带ID的步骤更新内容和完成状态，
+// 列表中缺少的已有步骤被删除，没有ID的步骤被插入。versions 的含义与 UpdateTodoIfMatch 相同。
+// 成功后 todo 被刷新为数据库中的最新状态（包括步骤和版本号）。
+func (m *TodoModel) PatchTodo(todo *Todo, userID int, fields []string, versions []int) error {
+	var ownerID int
+	err := m.DB.QueryRow("SELECT user_id FROM todos WHERE id = $1", todo.ID).Scan(&ownerID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrTodoNotFound
+		}
+		return fmt.Errorf("verify todo ownership failed: %w", err)
+	}
+	if ownerID != userID {
+		return fmt.Errorf("unauthorized: todo does not belong to user")
+	}
+
+	touched := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		if !IsPatchableTodoField(field) {
+			return &TodoFieldError{Field: field, Message: "field cannot be modified"}
+		}
+		touched[field] = true
+	}
+
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	todo.UserID = userID
+	var setParts []string
+	var args []interface{}
+	set := func(column string, value interface{}) {
+		args = append(args, value)
+		setParts = append(setParts, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	for _, field := range patchableTodoFields {
+		if !touched[field] {
+			continue
+		}
+		switch field {
+		case "task":
+			todo.Task = strings.TrimSpace(todo.Task)
+			if todo.Task == "" {
+				return &TodoFieldError{Field: field, Message: "task is required"}
+			}
+			set("task", todo.Task)
+		case "description":
+			set("description", todo.Description)
+		case "done":
+			set("done", todo.Done)
+		case "priority":
+			if !IsValidPriority(todo.Priority) {
+				return &TodoFieldError{Field: field, Message: "priority must be low, medium or high"}
+			}
+			set("priority", todo.Priority)
+		case "category":
+			if err := resolveTodoCategory(tx, todo); err != nil {
+				return err
+			}
+			set("category", todo.Category)
+		case "dueDate":
+			set("due_date", todo.DueDate)
+		case "reminder":
+			set("reminder", todo.Reminder)
+		case "estimatedTime":
+			if todo.EstimatedTime != nil && *todo.EstimatedTime < 0 {
+				return &TodoFieldError{Field: field, Message: "estimated time must not be negative"}
+			}
+			set("estimated_time", todo.EstimatedTime)
+		case "tags":
+			if todo.Tags, err = NormalizeTags(todo.Tags); err != nil {
+				return err
+			}
+			if err := syncTagCatalog(tx, userID, todo.Tags); err != nil {
+				return err
+			}
+			tagsJSON, err := json.Marshal(todo.Tags)
+			if err != nil {
+				return fmt.Errorf("marshal tags failed: %w", err)
+			}
+			if len(todo.Tags) == 0 {
+				tagsJSON = []byte("[]")
+			}
+			set("tags", string(tagsJSON))
+		case "status":
+			if todo.Status == "" {
+				return &TodoFieldError{Field: field, Message: "status is required"}
+			}
+			// 迁移前的用户可能还没有工作流状态，先创建默认状态
+			if err := ensureDefaultStates(tx, userID); err != nil {
+				return err
+			}
+			if _, err := getStateByKey(tx, userID, todo.Status); err != nil {
+				return err
+			}
+			set("status", todo.Status)
+		case "customFields":
+			customFieldsJSON, err := prepareCustomFields(tx, userID, todo.CustomFields, true)
+			if err != nil {
+				return err
+			}
+			args = append(args, *customFieldsJSON)
+			setParts = append(setParts, fmt.Sprintf("custom_fields = $%d::jsonb", len(args)))
+		}
+	}
+	setParts = append(setParts, "updated_at = NOW()")
+
+	// 更新列（status 与 done、completed_at 的一致性由 sync_todo_status 触发器维护）
+	args = append(args, todo.ID, userID, versionsArg(versions))
+	n := len(args)
+	query := fmt.Sprintf(
+		"UPDATE todos SET %s WHERE id = $%d AND user_id = $%d AND ($%d::int[] IS NULL OR version = ANY($%d::int[])) RETURNING %s",
+		strings.Join(setParts, ", "), n-2, n-1, n, n, TodoColumns,
+	)
+	steps := todo.Steps
+	updated, err := ScanTodo(tx.QueryRow(query, args...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrVersionConflict
+		}
+		return fmt.Errorf("patch todo failed: %w", err)
+	}
+
+	if touched["steps"] {
+		if err := syncPatchedSteps(tx, todo.ID, steps); err != nil {
+			return err
+		}
+		// 步骤变化会再次递增版本号
+		if updated.Version, err = currentVersion(tx, todo.ID); err != nil {
+			return err
+		}
+	}
+
+	if updated.Steps, err = stepsOf(tx, todo.ID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction failed: %w", err)
+	}
+
+	*todo = updated
+	return nil
+}
+
+// syncPatchedSteps 把待办事项的步骤同步为 steps：只写入有变化的步骤
+func syncPatchedSteps(tx *sql.Tx, todoID int, steps []Step) error {
+	existing, err := stepsOf(tx, todoID)
+	if err != nil {
+		return err
+	}
+	current := make(map[int]Step, len(existing))
+	for _, step := range existing {
+		current[step.ID] = step
+	}
+
+	kept := make(map[int]bool, len(steps))
+	for i, step := range steps {
+		field := fmt.Sprintf("steps/%d", i)
+		content := strings.TrimSpace(step.Content)
+		if content == "" {
+			return &TodoFieldError{Field: field, Message: "step content is required"}
+		}
+
+		if step.ID == 0 {
+			if _, err := tx.Exec(
+				"INSERT INTO steps (todo_id, content, completed) VALUES ($1, $2, $3)",
+				todoID, content, step.Completed,
+			); err != nil {
+				return fmt.Errorf("insert step failed: %w", err)
+			}
+			continue
+		}
+
+		old, ok := current[step.ID]
+		if !ok {
+			return &TodoFieldError{Field: field, Message: fmt.Sprintf("step %d does not belong to this todo", step.ID)}
+		}
+		if kept[step.ID] {
+			return &TodoFieldError{Field: field, Message: fmt.Sprintf("step %d appears more than once", step.ID)}
+		}
+		kept[step.ID] = true
+
+		if old.Content != content || old.Completed != step.Completed {
+			if _, err := tx.Exec(
+				"UPDATE steps SET content = $1, completed = $2 WHERE id = $3 AND todo_id = $4",
+				content, step.Completed, step.ID, todoID,
+			); err != nil {
+				return fmt.Errorf("update step failed: %w", err)
+			}
+		}
+	}
+
+	for _, step := range existing {
+		if kept[step.ID] {
+			continue
+		}
+		if _, err := tx.Exec("DELETE FROM steps WHERE id = $1 AND todo_id = $2", step.ID, todoID); err != nil {
+			return fmt.Errorf("delete step failed: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// stepsOf 在事务中读取待办事项的步骤
+func stepsOf(db execer, todoID int) ([]Step, error) {
+	rows, err := db.Query(
+		"SELECT "+StepColumns+" FROM steps WHERE todo_id = $1 ORDER BY id",
+		todoID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query steps failed: %w", err)
+	}
+	defer rows.Close()
+
+	var steps []Step
+	for rows.Next() {
+		var step Step
+		if err := rows.Scan(&step.ID, &step.UUID, &step.TodoID, &step.Content, &step.Completed, &step.ClientID); err != nil {
+			return nil, fmt.Errorf("scan step failed: %w", err)
+		}
+		steps = append(steps, step)
+	}
+	return steps, rows.Err()
+}
@@ -0,0 +1,408 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// DefaultUndoWindow 撤销记录默认的有效期
+const DefaultUndoWindow = 10 * time.Minute
+
+// 撤销记录对应的操作
+const (
+	UndoActionCreate      = "create"
+	UndoActionUpdate      = "update"
+	UndoActionDelete      = "delete"
+	UndoActionBatchUpdate = "batch_update"
+	UndoActionBatchDelete = "batch_delete"
+	UndoActionImport      = "import"
+)
+
+var (
+	// ErrUndoNotFound 撤销令牌不存在或不属于当前用户
+	ErrUndoNotFound = errors.New("undo entry not found")
+	// ErrUndoExpired 撤销记录已超过撤销窗口
+	ErrUndoExpired = errors.New("undo entry expired")
+	// ErrUndoUsed 撤销记录已经使用过
+	ErrUndoUsed = errors.New("undo entry already used")
+)
+
+// UndoConflictError 受影响的待办事项在修改之后又被编辑过，撤销会覆盖这些编辑
+type UndoConflictError struct {
+	Conflicts []VersionConflict
+}
+
+func (e *UndoConflictError) Error() string {
+	return fmt.Sprintf("undo conflict: %d todos modified afterwards", len(e.Conflicts))
+}
+
+// UndoItem 撤销记录中的一个待办事项，描述它的逆操作：
+// Before 为 nil 表示修改创建了它，撤销时删除；VersionAfter 为 0 表示修改删除了它，撤销时重新创建；
+// 否则撤销时把它恢复为 Before（包括步骤）
+type UndoItem struct {
+	TodoID       int   `json:"todoId"`
+	Before       *Todo `json:"before,omitempty"`
+	VersionAfter int   `json:"versionAfter"`
+}
+
+// UndoResult 撤销的结果
+type UndoResult struct {
+	Action     string `json:"action"`
+	Restored   []Todo `json:"restored"`   // 被恢复或重新创建的待办事项（当前状态）
+	DeletedIDs []int  `json:"deletedIds"` // 被删除的待办事项（撤销创建）
+}
+
+// UndoModel 处理撤销记录相关的数据库操作
+type UndoModel struct {
+	DB     *sql.DB
+	Window time.Duration // 撤销窗口，超过后撤销记录失效
+}
+
+// NewUndoModel 创建一个新的UndoModel实例，window 不大于 0 时使用 DefaultUndoWindow
+func NewUndoModel(db *sql.DB, window time.Duration) *UndoModel {
+	if window <= 0 {
+		window = DefaultUndoWindow
+	}
+	return &UndoModel{DB: db, Window: window}
+}
+
+// Snapshot 读取用户的待办事项（包含步骤），作为修改前的快照；不存在或不属于用户的ID被忽略
+func (m *UndoModel) Snapshot(userID int, ids []int) (map[int]Todo, error) {
+	snapshot := make(map[int]Todo, len(ids))
+	if len(ids) == 0 {
+		return snapshot, nil
+	}
+
+	todos, err := queryOwnedTodos(m.DB, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	if err := NewTodoModel(m.DB).AttachSteps(todos); err != nil {
+		return nil, err
+	}
+	for _, todo := range todos {
+		snapshot[todo.ID] = todo
+	}
+	return snapshot, nil
+}
+
+// Record 在修改完成后保存撤销记录并返回撤销令牌。before 是修改前的快照，ids 是修改涉及的待办事项，
+// 修改后的版本号在这里读取，撤销时用来检测之后的编辑。没有可撤销的内容时返回空令牌。
+func (m *UndoModel) Record(userID int, action string, before map[int]Todo, ids []int) (string, error) {
+	after, err := ownedTodoVersions(m.DB, userID, ids)
+	if err != nil {
+		return "", err
+	}
+
+	items := buildUndoItems(before, after, ids)
+	if len(items) == 0 {
+		return "", nil
+	}
+	itemsJSON, err := json.Marshal(items)
+	if err != nil {
+		return "", fmt.Errorf("marshal undo items failed: %w", err)
+	}
+
+	token, err := newUndoToken()
+	if err != nil {
+		return "", err
+	}
+
+	// 顺便清理该用户已过期的撤销记录
+	if _, err := m.DB.Exec("DELETE FROM undo_entries WHERE user_id = $1 AND expires_at < NOW()", userID); err != nil {
+		return "", fmt.Errorf("purge undo entries failed: %w", err)
+	}
+
+	_, err = m.DB.Exec(`
+		INSERT INTO undo_entries (token, user_id, action, items, expires_at)
+		VALUES ($1, $2, $3, $4, NOW() + $5::float8 * INTERVAL '1 second')
+	`, token, userID, action, string(itemsJSON), m.Window.Seconds())
+	if err != nil {
+		return "", fmt.Errorf("insert undo entry failed: %w", err)
+	}
+
+	return token, nil
+}
+
+// buildUndoItems 根据修改前的快照和修改后的版本号生成逆操作，跳过修改前后都不存在或没有变化的项
+func buildUndoItems(before map[int]Todo, after map[int]int, ids []int) []UndoItem {
+	var items []UndoItem
+	for _, id := range uniqueIDs(ids) {
+		item := UndoItem{TodoID: id, VersionAfter: after[id]}
+		if todo, ok := before[id]; ok {
+			if todo.Version == item.VersionAfter {
+				continue
+			}
+			item.Before = &todo
+		} else if item.VersionAfter == 0 {
+			continue
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].TodoID < items[j].TodoID })
+	return items
+}
+
+// Undo 在一个事务中执行撤销记录的逆操作。任何受影响的待办事项在修改之后又被编辑过时
+// 返回 *UndoConflictError，不做任何修改；每条记录只能使用一次。
+func (m *UndoModel) Undo(userID int, token string) (*UndoResult, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	var action string
+	var itemsJSON []byte
+	var expired bool
+	var usedAt *time.Time
+	err = tx.QueryRow(`
+		SELECT action, items, expires_at < NOW(), used_at
+		FROM undo_entries
+		WHERE token = $1 AND user_id = $2
+		FOR UPDATE
+	`, token, userID).Scan(&action, &itemsJSON, &expired, &usedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUndoNotFound
+		}
+		return nil, fmt.Errorf("get undo entry failed: %w", err)
+	}
+	if usedAt != nil {
+		return nil, ErrUndoUsed
+	}
+	if expired {
+		return nil, ErrUndoExpired
+	}
+
+	var items []UndoItem
+	if err := json.Unmarshal(itemsJSON, &items); err != nil {
+		return nil, fmt.Errorf("parse undo items failed: %w", err)
+	}
+
+	// 锁定受影响的待办事项，版本号必须仍是修改后的版本（被删除的项必须仍不存在）
+	expected := make(map[int]int, len(items))
+	for _, item := range items {
+		expected[item.TodoID] = item.VersionAfter
+	}
+	conflicts, err := LockTodoVersions(tx, userID, expected)
+	if err != nil {
+		return nil, err
+	}
+	if len(conflicts) > 0 {
+		return nil, &UndoConflictError{Conflicts: conflicts}
+	}
+
+	result := &UndoResult{Action: action, Restored: []Todo{}, DeletedIDs: []int{}}
+	var restoredIDs []int
+	for _, item := range items {
+		switch {
+		case item.Before == nil:
+			if _, err := tx.Exec("DELETE FROM todos WHERE id = $1 AND user_id = $2", item.TodoID, userID); err != nil {
+				return nil, fmt.Errorf("delete todo failed: %w", err)
+			}
+			result.DeletedIDs = append(result.DeletedIDs, item.TodoID)
+			continue
+		case item.VersionAfter == 0:
+			err = recreateTodo(tx, userID, *item.Before)
+		default:
+			err = restoreTodo(tx, userID, *item.Before)
+		}
+		if err != nil {
+			return nil, err
+		}
+		restoredIDs = append(restoredIDs, item.TodoID)
+	}
+
+	if _, err := tx.Exec("UPDATE undo_entries SET used_at = NOW() WHERE token = $1", token); err != nil {
+		return nil, fmt.Errorf("mark undo entry used failed: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit transaction failed: %w", err)
+	}
+
+	restored, err := m.Snapshot(userID, restoredIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range restoredIDs {
+		if todo, ok := restored[id]; ok {
+			result.Restored = append(result.Restored, todo)
+		}
+	}
+	return result, nil
+}
+
+// restoreTodo 把仍然存在的待办事项恢复为快照中的内容，步骤有变化时按快照重建（保留原来的步骤ID）
+func restoreTodo(db execer, userID int, todo Todo) error {
+	tagsJSON, customFieldsJSON, err := snapshotJSON(todo)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		UPDATE todos SET
+			task = $1, description = $2, done = $3, priority = $4, category = $5, due_date = $6,
+			reminder = $7, estimated_time = $8, tags = $9, status = NULLIF($10, ''), custom_fields = $11,
+			completed_at = $12, updated_at = NOW()
+		WHERE id = $13 AND user_id = $14
+	`,
+		todo.Task, todo.Description, todo.Done, todo.Priority, todo.Category, todo.DueDate,
+		todo.Reminder, todo.EstimatedTime, tagsJSON, todo.Status, customFieldsJSON,
+		todo.CompletedAt, todo.ID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("restore todo failed: %w", err)
+	}
+
+	current, err := stepsOf(db, todo.ID)
+	if err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(current, todo.Steps) {
+		if _, err := db.Exec("DELETE FROM steps WHERE todo_id = $1", todo.ID); err != nil {
+			return fmt.Errorf("delete steps failed: %w", err)
+		}
+		if err := insertSnapshotSteps(db, todo); err != nil {
+			return err
+		}
+	}
+
+	return syncTagCatalog(db, userID, todo.Tags)
+}
+
+// recreateTodo 按快照重新创建已删除的待办事项（保留原来的ID和步骤ID）。
+// 版本号从删除前的版本继续递增，避免旧的 ETag 与重新创建的待办事项匹配。
+func recreateTodo(db execer, userID int, todo Todo) error {
+	tagsJSON, customFieldsJSON, err := snapshotJSON(todo)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO todos (
+			id, task, description, done, priority, category, due_date, reminder, estimated_time,
+			tags, user_id, status, status_changed_at, custom_fields, created_at, updated_at,
+			completed_at, version, client_id, uuid
+		) VALUES (
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NULLIF($12, ''), $13, $14, $15, NOW(), $16, $17,
+			NULLIF($18, ''), COALESCE(NULLIF($19, '')::uuid, uuid_generate_v7())
+		)
+	`,
+		todo.ID, todo.Task, todo.Description, todo.Done, todo.Priority, todo.Category, todo.DueDate,
+		todo.Reminder, todo.EstimatedTime, tagsJSON, userID, todo.Status, todo.StatusChangedAt,
+		customFieldsJSON, todo.CreatedAt, todo.CompletedAt, todo.Version+1, todo.ClientID, todo.UUID,
+	)
+	if err != nil {
+		return fmt.Errorf("recreate todo failed: %w", err)
+	}
+
+	if err := insertSnapshotSteps(db, todo); err != nil {
+		return err
+	}
+	return syncTagCatalog(db, userID, todo.Tags)
+}
+
+// insertSnapshotSteps 按快照插入步骤，保留原来的步骤ID
+func insertSnapshotSteps(db execer, todo Todo) error {
+	for _, step := range todo.Steps {
+		_, err := db.Exec(
+			`INSERT INTO steps (id, todo_id, content, completed, client_id, uuid)
+			 VALUES ($1, $2, $3, $4, NULLIF($5, ''), COALESCE(NULLIF($6, '')::uuid, uuid_generate_v7()))`,
+			step.ID, todo.ID, step.Content, step.Completed, step.ClientID, step.UUID,
+		)
+		if err != nil {
+			return fmt.Errorf("insert step failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// snapshotJSON 序列化快照中的标签和自定义字段
+func snapshotJSON(todo Todo) (string, string, error) {
+	tags := todo.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	tagsJSON, err := json.Marshal(tags)
+	if err != nil {
+		return "", "", fmt.Errorf("marshal tags failed: %w", err)
+	}
+
+	customFields := todo.CustomFields
+	if customFields == nil {
+		customFields = map[string]interface{}{}
+	}
+	customFieldsJSON, err := json.Marshal(customFields)
+	if err != nil {
+		return "", "", fmt.Errorf("marshal custom fields failed: %w", err)
+	}
+	return string(tagsJSON), string(customFieldsJSON), nil
+}
+
+// queryOwnedTodos 查询属于用户的一组待办事项（不包含步骤）
+func queryOwnedTodos(db execer, userID int, ids []int) ([]Todo, error) {
+	rows, err := db.Query(
+		"SELECT "+TodoColumns+" FROM todos WHERE user_id = $1 AND id = ANY($2::int[]) ORDER BY id",
+		userID, intArrayLiteral(ids),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query todos failed: %w", err)
+	}
+	defer rows.Close()
+
+	var todos []Todo
+	for rows.Next() {
+		todo, err := ScanTodo(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan todo failed: %w", err)
+		}
+		todos = append(todos, todo)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query todos failed: %w", err)
+	}
+	return todos, nil
+}
+
+// ownedTodoVersions 读取属于用户的待办事项的当前版本号，不存在的ID不在结果中
+func ownedTodoVersions(db execer, userID int, ids []int) (map[int]int, error) {
+	versions := make(map[int]int, len(ids))
+	if len(ids) == 0 {
+		return versions, nil
+	}
+
+	rows, err := db.Query(
+		"SELECT id, version FROM todos WHERE user_id = $1 AND id = ANY($2::int[])",
+		userID, intArrayLiteral(ids),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query todo versions failed: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, version int
+		if err := rows.Scan(&id, &version); err != nil {
+			return nil, fmt.Errorf("scan todo version failed: %w", err)
+		}
+		versions[id] = version
+	}
+	return versions, rows.Err()
+}
+
+// newUndoToken 生成随机的撤销令牌
+func newUndoToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate undo token failed: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,33 @@
+package models
+
+import "testing"
+
+func TestBuildUndoItems(t *testing.T) {
+	before := map[int]Todo{
+		1: {ID: 1, Task: "edited", Version: 3},
+		2: {ID: 2, Task: "deleted", Version: 5},
+		4: {ID: 4, Task: "unchanged", Version: 2},
+	}
+	after := map[int]int{1: 4, 3: 1, 4: 2}
+
+	// 5 修改前后都不存在（例如不属于用户），重复的ID只记录一次
+	items := buildUndoItems(before, after, []int{4, 3, 2, 1, 5, 1})
+	if len(items) != 3 {
+		t.Fatalf("items = %+v, want 3 items", items)
+	}
+
+	updated, deleted, created := items[0], items[1], items[2]
+	if updated.TodoID != 1 || updated.Before == nil || updated.Before.Task != "edited" || updated.VersionAfter != 4 {
+		t.Errorf("updated item = %+v", updated)
+	}
+	if deleted.TodoID != 2 || deleted.Before == nil || deleted.VersionAfter != 0 {
+		t.Errorf("deleted item = %+v", deleted)
+	}
+	if created.TodoID != 3 || created.Before != nil || created.VersionAfter != 1 {
+		t.Errorf("created item = %+v", created)
+	}
+
+	if items := buildUndoItems(before, after, []int{4}); len(items) != 0 {
+		t.Errorf("unchanged todo produced undo items: %+v", items)
+	}
+}
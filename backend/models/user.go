@@ -14,6 +14,7 @@ import (
 // User 表示系统用户
 type User struct {
 	ID                    int        `json:"id"`
+	UUID                  string     `json:"uuid"`
 	Username              string     `json:"username"`
 	Password              string     `json:"-"` // 不在json中返回密码
 	Email                 string     `json:"email"`
@@ -27,6 +28,7 @@ type User struct {
 // UserResponse 要返回给客户端的信息
 type UserResponse struct {
 	ID            int       `json:"id"`
+	UUID          string    `json:"uuid"`
 	Username      string    `json:"username"`
 	Email         string    `json:"email"`
 	IsAdmin       bool      `json:"isAdmin"`
@@ -38,6 +40,7 @@ type UserResponse struct {
 func (u *User) ToResponse() UserResponse {
 	return UserResponse{
 		ID:            u.ID,
+		UUID:          u.UUID,
 		Username:      u.Username,
 		Email:         u.Email,
 		IsAdmin:       u.IsAdmin,
@@ -91,9 +94,9 @@ func (m *UserModel) CreateUser(user *User) error {
 	// 插入用户记录
 	user.CreateAt = time.Now()
 	err = m.DB.QueryRow(
-		"INSERT INTO users (username, password, email, is_admin, created_at, email_verified) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
+		"INSERT INTO users (username, password, email, is_admin, created_at, email_verified) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, uuid",
 		user.Username, string(hashedPassword), user.Email, user.IsAdmin, user.CreateAt, user.EmailVerified,
-	).Scan(&user.ID)
+	).Scan(&user.ID, &user.UUID)
 
 	if err != nil {
 		return fmt.Errorf("failed to create user: %w", err)
@@ -107,10 +110,10 @@ func (m *UserModel) GetUserByUsername(username string) (*User, error) {
 	var user User
 
 	err := m.DB.QueryRow(
-		"SELECT id, username, password, email, is_admin, created_at, email_verified FROM users WHERE username = $1",
+		"SELECT id, uuid, username, password, email, is_admin, created_at, email_verified FROM users WHERE username = $1",
 		username,
 	).Scan(
-		&user.ID, &user.Username, &user.Password, &user.Email, &user.IsAdmin, &user.CreateAt, &user.EmailVerified,
+		&user.ID, &user.UUID, &user.Username, &user.Password, &user.Email, &user.IsAdmin, &user.CreateAt, &user.EmailVerified,
 	)
 
 	if err != nil {
@@ -128,7 +131,7 @@ func (m *UserModel) GetAllUsers() ([]UserResponse, error) {
 	var users []UserResponse
 
 	rows, err := m.DB.Query(
-		"SELECT id, username, email, is_admin, created_at, email_verified FROM users",
+		"SELECT id, uuid, username, email, is_admin, created_at, email_verified FROM users",
 	)
 	if err != nil {
 		return nil, fmt.Errorf("admin, failed to query users: %w", err)
@@ -138,7 +141,7 @@ func (m *UserModel) GetAllUsers() ([]UserResponse, error) {
 	for rows.Next() {
 		var user UserResponse
 		err := rows.Scan(
-			&user.ID, &user.Username, &user.Email, &user.IsAdmin, &user.CreatedAt, &user.EmailVerified,
+			&user.ID, &user.UUID, &user.Username, &user.Email, &user.IsAdmin, &user.CreatedAt, &user.EmailVerified,
 		)
 		if err != nil {
 			log.Printf("scan user failed: %v", err)
@@ -337,3 +340,50 @@ func (m *UserModel) VerifyCode(email, code, purpose string) error {
 
 	return nil
 }
+
+// userKeyset 用户按ID顺序排列
+var userKeyset = Keyset{
+	Name: "users",
+	Keys: []SortKey{{Expr: "id", Cast: "integer"}},
+}
+
+// ListUsers 分页获取所有用户（仅管理员可用）
+func (m *UserModel) ListUsers(page PageRequest) ([]UserResponse, PageInfo, error) {
+	query, args, offset, err := BuildPageQuery(
+		"SELECT id, uuid, username, email, is_admin, created_at, email_verified FROM users", "", nil,
+		userKeyset, page,
+	)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	rows, err := m.DB.Query(query, args...)
+	if err != nil {
+		return nil, PageInfo{}, fmt.Errorf("admin, failed to query users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []UserResponse{}
+	for rows.Next() {
+		var user UserResponse
+		err := rows.Scan(&user.ID, &user.UUID, &user.Username, &user.Email, &user.IsAdmin, &user.CreatedAt, &user.EmailVerified)
+		if err != nil {
+			log.Printf("scan user failed: %v", err)
+			continue
+		}
+		users = append(users, user)
+	}
+
+	n, info := FinishPage(userKeyset, page, len(users), offset, func(i int) []interface{} {
+		return []interface{}{users[i].ID}
+	})
+	users = users[:n]
+
+	if page.WithTotal {
+		if info.Total, err = countRows(m.DB, "SELECT COUNT(*) FROM users"); err != nil {
+			return nil, PageInfo{}, err
+		}
+	}
+
+	return users, info, nil
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrInvalidUUID UUID 格式错误
+	ErrInvalidUUID = errors.New("invalid uuid")
+	// ErrDuplicateUUID 客户端提供的 UUID 已被其他待办事项或步骤使用
+	ErrDuplicateUUID = errors.New("uuid already in use")
+	// ErrInvalidID 路径中的ID既不是整数也不是 UUID
+	ErrInvalidID = errors.New("invalid id")
+	// ErrUserNotFound 用户不存在
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// ParseUUID 校验 8-4-4-4-12 格式的 UUID 并转换为小写
+func ParseUUID(s string) (string, error) {
+	if len(s) != 36 {
+		return "", ErrInvalidUUID
+	}
+	for i, c := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return "", ErrInvalidUUID
+			}
+		default:
+			if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+				return "", ErrInvalidUUID
+			}
+		}
+	}
+	return strings.ToLower(s), nil
+}
+
+// normalizeClientUUID 校验客户端提供的 UUID，空字符串表示由数据库生成
+func normalizeClientUUID(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	return ParseUUID(s)
+}
+
+// isUniqueViolation 判断错误是否违反了指定的唯一索引
+func isUniqueViolation(err error, index string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == index
+}
+
+// resolvePublicID 把整数ID或 UUID 解析为表中的整数ID，UUID 不存在时返回 notFound
+func resolvePublicID(db execer, table, ref string, notFound error) (int, error) {
+	if id, err := strconv.Atoi(ref); err == nil {
+		return id, nil
+	}
+	uuid, err := ParseUUID(ref)
+	if err != nil {
+		return 0, ErrInvalidID
+	}
+
+	var id int
+	if err := db.QueryRow("SELECT id FROM "+table+" WHERE uuid = $1", uuid).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, notFound
+		}
+		return 0, fmt.Errorf("resolve %s uuid failed: %w", table, err)
+	}
+	return id, nil
+}
+
+// ResolveTodoID 把待办事项的整数ID或 UUID 解析为整数ID
+func (m *TodoModel) ResolveTodoID(ref string) (int, error) {
+	return resolvePublicID(m.DB, "todos", ref, ErrTodoNotFound)
+}
+
+// TodoUUIDOwner 返回使用该 UUID 的待办事项所属的用户ID，UUID 未被使用时返回 0
+func (m *TodoModel) TodoUUIDOwner(uuid string) (int, error) {
+	return uuidOwner(m.DB, "todos", "user_id", uuid)
+}
+
+// ResolveStepID 把步骤的整数ID或 UUID 解析为整数ID
+func (m *TodoModel) ResolveStepID(ref string) (int, error) {
+	return resolvePublicID(m.DB, "steps", ref, ErrStepNotFound)
+}
+
+// ResolveUserID 把用户的整数ID或 UUID 解析为整数ID
+func (m *UserModel) ResolveUserID(ref string) (int, error) {
+	return resolvePublicID(m.DB, "users", ref, ErrUserNotFound)
+}
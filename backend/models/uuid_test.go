@@ -0,0 +1,35 @@
+package models
+
+import "testing"
+
+func TestParseUUID(t *testing.T) {
+	got, err := ParseUUID("0190A6E2-3C4B-7D8E-9F01-23456789ABCD")
+	if err != nil || got != "0190a6e2-3c4b-7d8e-9f01-23456789abcd" {
+		t.Errorf("ParseUUID = %q, %v", got, err)
+	}
+
+	for _, s := range []string{
+		"",
+		"42",
+		"0190a6e23c4b7d8e9f0123456789abcd",
+		"0190a6e2-3c4b-7d8e-9f01-23456789abcg",
+		"0190a6e2_3c4b-7d8e-9f01-23456789abcd",
+	} {
+		if _, err := ParseUUID(s); err != ErrInvalidUUID {
+			t.Errorf("ParseUUID(%q) error = %v, want ErrInvalidUUID", s, err)
+		}
+	}
+}
+
+func TestTodoUUIDOwner(t *testing.T) {
+	db := openTestDB(t)
+	userID, todo := createLegacyTodo(t, db)
+	m := NewTodoModel(db)
+
+	if owner, err := m.TodoUUIDOwner(todo.UUID); err != nil || owner != userID {
+		t.Errorf("TodoUUIDOwner = %d, %v, want %d", owner, err, userID)
+	}
+	if owner, err := m.TodoUUIDOwner("00000000-0000-7000-8000-000000000000"); err != nil || owner != 0 {
+		t.Errorf("TodoUUIDOwner(unused) = %d, %v", owner, err)
+	}
+}
@@ -0,0 +1,413 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Webhook 事件类型。todo.overdue 由后台任务在截止时间过后发送一次
+const (
+	WebhookEventTodoCreated   = "todo.created"
+	WebhookEventTodoUpdated   = "todo.updated"
+	WebhookEventTodoCompleted = "todo.completed"
+	WebhookEventTodoDeleted   = "todo.deleted"
+	WebhookEventTodoOverdue   = "todo.overdue"
+)
+
+// WebhookEvents 可以订阅的事件类型
+var WebhookEvents = []string{
+	WebhookEventTodoCreated, WebhookEventTodoUpdated, WebhookEventTodoCompleted,
+	WebhookEventTodoDeleted, WebhookEventTodoOverdue,
+}
+
+// Webhook 投递的状态
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed" // 重试次数用完
+)
+
+// 订阅的限制
+const (
+	maxWebhookURL         = 2048
+	maxWebhookDescription = 100
+)
+
+var (
+	// ErrWebhookNotFound webhook 不存在或不属于当前用户
+	ErrWebhookNotFound = errors.New("webhook not found")
+	// ErrWebhookDeliveryNotFound 投递不存在或不属于该 webhook
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+	// ErrInvalidWebhookURL URL 不是 http 或 https 的绝对地址，或者用户的 webhook 指向内网地址
+	ErrInvalidWebhookURL = errors.New("invalid webhook url")
+	// ErrInvalidWebhookEvent 订阅了未知的事件类型
+	ErrInvalidWebhookEvent = errors.New("invalid webhook event")
+	// ErrInvalidWebhookDescription 描述过长
+	ErrInvalidWebhookDescription = errors.New("invalid webhook description")
+	// ErrWebhookDisabled webhook 已停用，不能重新投递
+	ErrWebhookDisabled = errors.New("webhook is disabled")
+)
+
+// Webhook 一个 webhook 订阅。UserID 为空表示管理员配置的全局订阅，接收所有用户的事件。
+// 签名密钥只在创建和轮换时返回
+type Webhook struct {
+	ID                  int       `json:"id"`
+	UserID              *int      `json:"userId,omitempty"`
+	URL                 string    `json:"url"`
+	Secret              string    `json:"secret,omitempty"`
+	Events              []string  `json:"events"` // 为空表示所有事件
+	Description         string    `json:"description"`
+	Enabled             bool      `json:"enabled"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	DisabledReason      string    `json:"disabledReason,omitempty"`
+	CreatedAt           time.Time `json:"createdAt"`
+	UpdatedAt           time.Time `json:"updatedAt"`
+}
+
+// WebhookUpdate 修改 webhook 的请求，nil 的字段保持不变。重新启用时清零连续失败次数
+type WebhookUpdate struct {
+	URL          *string   `json:"url"`
+	Events       *[]string `json:"events"`
+	Description  *string   `json:"description"`
+	Enabled      *bool     `json:"enabled"`
+	RotateSecret bool      `json:"rotateSecret"` // 生成新的签名密钥
+}
+
+// WebhookDelivery 一次投递及最近一次尝试的结果。列表中不包含负载和响应内容
+type WebhookDelivery struct {
+	ID            int64           `json:"id"`
+	WebhookID     int             `json:"webhookId"`
+	EventType     string          `json:"eventType"`
+	Payload       json.RawMessage `json:"payload,omitempty"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	NextAttemptAt *time.Time      `json:"nextAttemptAt,omitempty"` // 仅 pending
+	ResponseCode  *int            `json:"responseCode,omitempty"`
+	ResponseBody  string          `json:"responseBody,omitempty"`
+	Error         string          `json:"error,omitempty"`
+	DurationMs    *int            `json:"durationMs,omitempty"`
+	RedeliveryOf  *int64          `json:"redeliveryOf,omitempty"`
+	CreatedAt     time.Time       `json:"createdAt"`
+	LastAttemptAt *time.Time      `json:"lastAttemptAt,omitempty"`
+	DeliveredAt   *time.Time      `json:"deliveredAt,omitempty"`
+}
+
+// WebhookModel 处理 webhook 订阅和投递日志相关的数据库操作。
+// 方法中的 userID 为 0 时操作管理员的全局订阅
+type WebhookModel struct {
+	DB *sql.DB
+}
+
+// NewWebhookModel 创建一个新的WebhookModel实例
+func NewWebhookModel(db *sql.DB) *WebhookModel {
+	return &WebhookModel{DB: db}
+}
+
+// webhookOwner 订阅的所有者条件，$1 为 userID（0 表示全局订阅）
+const webhookOwner = "user_id IS NOT DISTINCT FROM NULLIF($1::int, 0)"
+
+const webhookColumns = `id, user_id, url, events, description, enabled, consecutive_failures,
+	COALESCE(disabled_reason, ''), created_at, updated_at`
+
+func scanWebhook(row rowScanner) (*Webhook, error) {
+	var hook Webhook
+	var userID sql.NullInt64
+	err := row.Scan(&hook.ID, &userID, &hook.URL, pq.Array(&hook.Events), &hook.Description, &hook.Enabled,
+		&hook.ConsecutiveFailures, &hook.DisabledReason, &hook.CreatedAt, &hook.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if userID.Valid {
+		id := int(userID.Int64)
+		hook.UserID = &id
+	}
+	if hook.Events == nil {
+		hook.Events = []string{}
+	}
+	return &hook, nil
+}
+
+// newWebhookSecret 生成签名密钥
+func newWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate webhook secret failed: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+// validateWebhookURL 只接受 http 和 https 的绝对地址。userID 不为 0（用户的 webhook）时还拒绝
+// 直接写成内网 IP 或 localhost 的地址；域名解析到的地址在投递时由 WebhookDispatcher 检查
+func validateWebhookURL(raw string, userID int) (string, error) {
+	raw = strings.TrimSpace(raw)
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(raw) > maxWebhookURL {
+		return "", ErrInvalidWebhookURL
+	}
+	if userID != 0 && webhookHostBlocked(u.Hostname()) {
+		return "", ErrInvalidWebhookURL
+	}
+	return raw, nil
+}
+
+// normalizeWebhookEvents 校验并去重事件类型
+func normalizeWebhookEvents(events []string) ([]string, error) {
+	normalized := []string{}
+	for _, event := range events {
+		event = strings.TrimSpace(event)
+		known := false
+		for _, e := range WebhookEvents {
+			known = known || e == event
+		}
+		if !known {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidWebhookEvent, event)
+		}
+		duplicate := false
+		for _, e := range normalized {
+			duplicate = duplicate || e == event
+		}
+		if !duplicate {
+			normalized = append(normalized, event)
+		}
+	}
+	return normalized, nil
+}
+
+// validateWebhookDescription 描述最多 100 个字符
+func validateWebhookDescription(description string) (string, error) {
+	description = strings.TrimSpace(description)
+	if len([]rune(description)) > maxWebhookDescription {
+		return "", ErrInvalidWebhookDescription
+	}
+	return description, nil
+}
+
+// List 列出用户的 webhook（不包含签名密钥）
+func (m *WebhookModel) List(userID int) ([]Webhook, error) {
+	rows, err := m.DB.Query("SELECT "+webhookColumns+" FROM webhooks WHERE "+webhookOwner+" ORDER BY id", userID)
+	if err != nil {
+		return nil, fmt.Errorf("query webhooks failed: %w", err)
+	}
+	defer rows.Close()
+
+	hooks := []Webhook{}
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan webhook failed: %w", err)
+		}
+		hooks = append(hooks, *hook)
+	}
+	return hooks, rows.Err()
+}
+
+// Get 获取用户的 webhook（不包含签名密钥）
+func (m *WebhookModel) Get(userID, id int) (*Webhook, error) {
+	hook, err := scanWebhook(m.DB.QueryRow(
+		"SELECT "+webhookColumns+" FROM webhooks WHERE "+webhookOwner+" AND id = $2", userID, id,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, fmt.Errorf("get webhook failed: %w", err)
+	}
+	return hook, nil
+}
+
+// Create 创建 webhook 并生成签名密钥，返回的 Secret 是唯一一次可以看到的密钥（之后只能轮换）
+func (m *WebhookModel) Create(userID int, hook *Webhook) error {
+	var err error
+	if hook.URL, err = validateWebhookURL(hook.URL, userID); err != nil {
+		return err
+	}
+	if hook.Events, err = normalizeWebhookEvents(hook.Events); err != nil {
+		return err
+	}
+	if hook.Description, err = validateWebhookDescription(hook.Description); err != nil {
+		return err
+	}
+	if hook.Secret, err = newWebhookSecret(); err != nil {
+		return err
+	}
+
+	hook.Enabled = true
+	if userID != 0 {
+		hook.UserID = &userID
+	}
+	err = m.DB.QueryRow(
+		`INSERT INTO webhooks (user_id, url, secret, events, description)
+		 VALUES (NULLIF($1::int, 0), $2, $3, $4, $5)
+		 RETURNING id, created_at, updated_at`,
+		userID, hook.URL, hook.Secret, pq.Array(hook.Events), hook.Description,
+	).Scan(&hook.ID, &hook.CreatedAt, &hook.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("create webhook failed: %w", err)
+	}
+	return nil
+}
+
+// Update 修改 webhook。轮换密钥时返回的 Secret 为新的密钥，旧密钥立即失效
+func (m *WebhookModel) Update(userID, id int, update WebhookUpdate) (*Webhook, error) {
+	hook, err := m.Get(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if update.URL != nil {
+		if hook.URL, err = validateWebhookURL(*update.URL, userID); err != nil {
+			return nil, err
+		}
+	}
+	if update.Events != nil {
+		if hook.Events, err = normalizeWebhookEvents(*update.Events); err != nil {
+			return nil, err
+		}
+	}
+	if update.Description != nil {
+		if hook.Description, err = validateWebhookDescription(*update.Description); err != nil {
+			return nil, err
+		}
+	}
+	if update.Enabled != nil {
+		if *update.Enabled && !hook.Enabled {
+			hook.ConsecutiveFailures, hook.DisabledReason = 0, ""
+		}
+		hook.Enabled = *update.Enabled
+	}
+	if update.RotateSecret {
+		if hook.Secret, err = newWebhookSecret(); err != nil {
+			return nil, err
+		}
+	}
+
+	err = m.DB.QueryRow(
+		`UPDATE webhooks SET url = $3, events = $4, description = $5, enabled = $6,
+		     consecutive_failures = $7, disabled_reason = NULLIF($8, ''),
+		     secret = COALESCE(NULLIF($9, ''), secret), updated_at = NOW()
+		 WHERE `+webhookOwner+` AND id = $2
+		 RETURNING updated_at`,
+		userID, id, hook.URL, pq.Array(hook.Events), hook.Description, hook.Enabled,
+		hook.ConsecutiveFailures, hook.DisabledReason, hook.Secret,
+	).Scan(&hook.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, fmt.Errorf("update webhook failed: %w", err)
+	}
+	return hook, nil
+}
+
+// Delete 删除 webhook 及其投递日志
+func (m *WebhookModel) Delete(userID, id int) error {
+	result, err := m.DB.Exec("DELETE FROM webhooks WHERE "+webhookOwner+" AND id = $2", userID, id)
+	if err != nil {
+		return fmt.Errorf("delete webhook failed: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+const webhookDeliveryListColumns = `id, webhook_id, event_type, NULL::jsonb, status, attempts,
+	CASE WHEN status = 'pending' THEN next_attempt_at END, response_code, NULL, COALESCE(error, ''),
+	duration_ms, redelivery_of, created_at, last_attempt_at, delivered_at`
+
+const webhookDeliveryColumns = `id, webhook_id, event_type, payload, status, attempts,
+	CASE WHEN status = 'pending' THEN next_attempt_at END, response_code, response_body, COALESCE(error, ''),
+	duration_ms, redelivery_of, created_at, last_attempt_at, delivered_at`
+
+func scanWebhookDelivery(row rowScanner) (*WebhookDelivery, error) {
+	var d WebhookDelivery
+	var payload []byte
+	var body sql.NullString
+	err := row.Scan(&d.ID, &d.WebhookID, &d.EventType, &payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+		&d.ResponseCode, &body, &d.Error, &d.DurationMs, &d.RedeliveryOf, &d.CreatedAt, &d.LastAttemptAt, &d.DeliveredAt)
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		d.Payload = payload
+	}
+	d.ResponseBody = body.String
+	return &d, nil
+}
+
+// Deliveries 列出 webhook 最近的投递（最多 limit 条，新的在前），status 不为空时只列出该状态的投递
+func (m *WebhookModel) Deliveries(userID, webhookID int, status string, limit int) ([]WebhookDelivery, error) {
+	if _, err := m.Get(userID, webhookID); err != nil {
+		return nil, err
+	}
+	rows, err := m.DB.Query(
+		"SELECT "+webhookDeliveryListColumns+` FROM webhook_deliveries
+		 WHERE webhook_id = $1 AND ($2 = '' OR status = $2)
+		 ORDER BY id DESC LIMIT $3`,
+		webhookID, status, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query webhook deliveries failed: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan webhook delivery failed: %w", err)
+		}
+		deliveries = append(deliveries, *d)
+	}
+	return deliveries, rows.Err()
+}
+
+// Delivery 获取一次投递，包含负载和最近一次的响应内容
+func (m *WebhookModel) Delivery(userID, webhookID int, id int64) (*WebhookDelivery, error) {
+	if _, err := m.Get(userID, webhookID); err != nil {
+		return nil, err
+	}
+	d, err := scanWebhookDelivery(m.DB.QueryRow(
+		"SELECT "+webhookDeliveryColumns+" FROM webhook_deliveries WHERE webhook_id = $1 AND id = $2",
+		webhookID, id,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrWebhookDeliveryNotFound
+		}
+		return nil, fmt.Errorf("get webhook delivery failed: %w", err)
+	}
+	return d, nil
+}
+
+// Redeliver 以相同的负载重新投递（新的投递立即进入队列，负载中的事件ID不变，接收方可以据此去重）
+func (m *WebhookModel) Redeliver(userID, webhookID int, id int64) (*WebhookDelivery, error) {
+	hook, err := m.Get(userID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	if !hook.Enabled {
+		return nil, ErrWebhookDisabled
+	}
+	d, err := scanWebhookDelivery(m.DB.QueryRow(
+		`INSERT INTO webhook_deliveries (webhook_id, event_type, payload, redelivery_of)
+		 SELECT webhook_id, event_type, payload, id FROM webhook_deliveries WHERE webhook_id = $1 AND id = $2
+		 RETURNING `+webhookDeliveryColumns,
+		webhookID, id,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrWebhookDeliveryNotFound
+		}
+		return nil, fmt.Errorf("redeliver webhook failed: %w", err)
+	}
+	return d, nil
+}
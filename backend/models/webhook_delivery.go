@@ -0,0 +1,430 @@
+package models
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Webhook 投递的参数
+const (
+	WebhookMaxAttempts       = 10               // 每次投递最多尝试的次数，之后标记为 failed
+	WebhookDisableAfter      = 20               // 连续失败这么多次后自动停用 webhook
+	webhookBaseBackoff       = 30 * time.Second // 第一次重试的等待时间，之后每次翻倍
+	webhookMaxBackoff        = 6 * time.Hour
+	webhookTimeout           = 10 * time.Second
+	webhookLockDuration      = 2 * time.Minute // 领取的投递在这段时间内不会被其他实例重复领取
+	webhookBatchSize         = 20
+	webhookPollInterval      = 5 * time.Second
+	webhookOverdueInterval   = time.Minute
+	webhookOverdueWindow     = 7 * 24 * time.Hour // 只为截止时间在这段时间内的待办事项发送过期事件
+	webhookDeliveryRetention = 30 * 24 * time.Hour
+	webhookResponseBodyLimit = 2048 // 投递日志中保存的响应内容长度
+)
+
+// 投递请求的请求头
+const (
+	WebhookSignatureHeader = "X-TodoList-Signature"
+	WebhookEventHeader     = "X-TodoList-Event"
+	WebhookDeliveryHeader  = "X-TodoList-Delivery"
+)
+
+// SignWebhook 计算负载的签名：HMAC-SHA256(secret, "<timestamp>.<body>") 的十六进制。
+// 请求头为 X-TodoList-Signature: t=<timestamp>,v1=<signature>，接收方应同时检查时间戳防止重放
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff 第 attempt 次尝试失败后到下一次尝试的等待时间
+func webhookBackoff(attempt int) time.Duration {
+	delay := webhookBaseBackoff
+	for i := 1; i < attempt && delay < webhookMaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > webhookMaxBackoff {
+		delay = webhookMaxBackoff
+	}
+	return delay
+}
+
+// ErrWebhookAddressBlocked 投递地址解析到了回环、内网、链路本地等地址
+var ErrWebhookAddressBlocked = errors.New("webhook destination address is not allowed")
+
+// webhookSharedAddressSpace 运营商级 NAT 地址（RFC 6598），netip 不把它算作私有地址
+var webhookSharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// webhookAddressBlocked 判断地址是否属于不允许投递的范围：回环、私有、链路本地、未指定和组播地址
+func webhookAddressBlocked(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() ||
+		webhookSharedAddressSpace.Contains(ip)
+}
+
+// webhookHostBlocked 判断 URL 中的主机名是否直接指向不允许的地址（IP 字面量或 localhost）
+func webhookHostBlocked(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip, err := netip.ParseAddr(host)
+	return err == nil && webhookAddressBlocked(ip)
+}
+
+// webhookDialControl 在建立连接前检查实际连接的地址，域名解析后的地址和 DNS 重绑定同样会被拦截。
+// allowed 中的网段不受限制
+func webhookDialControl(allowed []netip.Prefix) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		ip, err := netip.ParseAddr(host)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrWebhookAddressBlocked, host)
+		}
+		ip = ip.Unmap()
+		for _, prefix := range allowed {
+			if prefix.Contains(ip) {
+				return nil
+			}
+		}
+		if webhookAddressBlocked(ip) {
+			return fmt.Errorf("%w: %s", ErrWebhookAddressBlocked, ip)
+		}
+		return nil
+	}
+}
+
+// newWebhookClient 创建投递使用的 HTTP 客户端：不跟随重定向（3xx 响应视为失败），不使用代理，
+// 连接时检查目标地址
+func newWebhookClient(allowed []netip.Prefix) *http.Client {
+	dialer := &net.Dialer{Timeout: webhookTimeout, Control: webhookDialControl(allowed)}
+	return &http.Client{
+		Timeout: webhookTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: webhookTimeout,
+			MaxIdleConnsPerHost: 2,
+			IdleConnTimeout:     time.Minute,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// webhookAttempt 领取的一次投递尝试
+type webhookAttempt struct {
+	id        int64
+	webhookID int
+	eventType string
+	payload   []byte
+	attempts  int // 包含本次尝试
+	url       string
+	secret    string
+	global    bool // 管理员的全局 webhook
+}
+
+// webhookResult 一次尝试的结果；err 不为空或状态码不是 2xx 时视为失败
+type webhookResult struct {
+	code     int
+	body     string
+	err      error
+	duration time.Duration
+}
+
+func (r webhookResult) ok() bool {
+	return r.err == nil && r.code >= 200 && r.code < 300
+}
+
+// WebhookDispatcher 从数据库中的投递队列领取到期的投递并发送。多个实例可以同时运行，
+// 领取时用 SKIP LOCKED 和 locked_until 避免重复投递。
+// 投递不会连接回环、内网和链路本地地址，避免用户通过 webhook 和投递日志访问内部服务；
+// 管理员的全局 webhook 使用 GlobalClient，可以访问允许列表中的网段（例如内网的 CI）
+type WebhookDispatcher struct {
+	DB           *sql.DB
+	Client       *http.Client
+	GlobalClient *http.Client
+}
+
+// NewWebhookDispatcher 创建一个新的WebhookDispatcher实例，allowedNetworks 是全局 webhook 额外允许的网段
+func NewWebhookDispatcher(db *sql.DB, allowedNetworks ...netip.Prefix) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		DB:           db,
+		Client:       newWebhookClient(nil),
+		GlobalClient: newWebhookClient(allowedNetworks),
+	}
+}
+
+// Run 定期投递到期的 webhook、为过期的待办事项加入 todo.overdue 事件并清理旧的投递日志。
+// 调用会一直阻塞，应在单独的 goroutine 中运行
+func (d *WebhookDispatcher) Run() {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	var lastOverdue, lastPrune time.Time
+	for range ticker.C {
+		if time.Since(lastOverdue) >= webhookOverdueInterval {
+			lastOverdue = time.Now()
+			if _, err := d.EnqueueOverdue(); err != nil {
+				log.Printf("加入过期事件失败: %v", err)
+			}
+		}
+		if _, err := d.DeliverDue(); err != nil {
+			log.Printf("投递 webhook 失败: %v", err)
+		}
+		if time.Since(lastPrune) >= time.Hour {
+			lastPrune = time.Now()
+			if err := d.Prune(); err != nil {
+				log.Printf("清理 webhook 投递日志失败: %v", err)
+			}
+		}
+	}
+}
+
+// DeliverDue 分批领取并发送到期的投递，直到队列中没有到期的投递，返回发送的次数
+func (d *WebhookDispatcher) DeliverDue() (int, error) {
+	total := 0
+	for {
+		attempts, err := d.claim()
+		if err != nil {
+			return total, err
+		}
+
+		var wg sync.WaitGroup
+		for _, attempt := range attempts {
+			wg.Add(1)
+			go func(attempt webhookAttempt) {
+				defer wg.Done()
+				if err := d.record(attempt, d.send(attempt)); err != nil {
+					log.Printf("保存 webhook 投递结果失败: %v", err)
+				}
+			}(attempt)
+		}
+		wg.Wait()
+
+		total += len(attempts)
+		if len(attempts) < webhookBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// claim 领取一批到期的投递（只包括启用的 webhook），同时增加尝试次数
+func (d *WebhookDispatcher) claim() ([]webhookAttempt, error) {
+	rows, err := d.DB.Query(`
+		WITH claimed AS (
+			UPDATE webhook_deliveries SET
+				attempts = attempts + 1,
+				locked_until = NOW() + $1::float8 * INTERVAL '1 second'
+			WHERE id IN (
+				SELECT d.id FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+				WHERE d.status = 'pending' AND d.next_attempt_at <= NOW()
+				  AND (d.locked_until IS NULL OR d.locked_until < NOW()) AND w.enabled
+				ORDER BY d.next_attempt_at, d.id
+				LIMIT $2
+				FOR UPDATE OF d SKIP LOCKED
+			)
+			RETURNING id, webhook_id, event_type, payload, attempts
+		)
+		SELECT c.id, c.webhook_id, c.event_type, c.payload, c.attempts, w.url, w.secret, w.user_id IS NULL
+		FROM claimed c JOIN webhooks w ON w.id = c.webhook_id
+		ORDER BY c.id
+	`, webhookLockDuration.Seconds(), webhookBatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("claim webhook deliveries failed: %w", err)
+	}
+	defer rows.Close()
+
+	var attempts []webhookAttempt
+	for rows.Next() {
+		var a webhookAttempt
+		if err := rows.Scan(&a.id, &a.webhookID, &a.eventType, &a.payload, &a.attempts, &a.url, &a.secret, &a.global); err != nil {
+			return nil, fmt.Errorf("scan webhook delivery failed: %w", err)
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
+
+// send 发送一次投递
+func (d *WebhookDispatcher) send(attempt webhookAttempt) webhookResult {
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequest(http.MethodPost, attempt.url, bytes.NewReader(attempt.payload))
+	if err != nil {
+		return webhookResult{err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "TodoList-Webhooks/1.0")
+	req.Header.Set(WebhookEventHeader, attempt.eventType)
+	req.Header.Set(WebhookDeliveryHeader, strconv.FormatInt(attempt.id, 10))
+	req.Header.Set(WebhookSignatureHeader,
+		fmt.Sprintf("t=%d,v1=%s", timestamp, SignWebhook(attempt.secret, timestamp, attempt.payload)))
+
+	client := d.Client
+	if attempt.global {
+		client = d.GlobalClient
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return webhookResult{err: err, duration: time.Since(start)}
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseBodyLimit))
+	// 读完剩余内容以便复用连接，但不无限等待
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	return webhookResult{
+		code:     resp.StatusCode,
+		body:     strings.ReplaceAll(strings.ToValidUTF8(string(body), "�"), "\x00", ""),
+		duration: time.Since(start),
+	}
+}
+
+// record 保存一次尝试的结果：成功时清零 webhook 的连续失败次数；失败时按指数退避安排重试，
+// 尝试次数用完后标记为 failed，webhook 连续失败达到 WebhookDisableAfter 次时自动停用
+func (d *WebhookDispatcher) record(attempt webhookAttempt, result webhookResult) error {
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	var code interface{}
+	if result.code != 0 {
+		code = result.code
+	}
+	errText := ""
+	switch {
+	case result.err != nil:
+		errText = result.err.Error()
+	case !result.ok():
+		errText = fmt.Sprintf("unexpected status %d", result.code)
+	}
+
+	status, next := WebhookDeliveryDelivered, time.Duration(0)
+	if !result.ok() {
+		status, next = WebhookDeliveryPending, webhookBackoff(attempt.attempts)
+		if attempt.attempts >= WebhookMaxAttempts {
+			status = WebhookDeliveryFailed
+		}
+	}
+	_, err = tx.Exec(`
+		UPDATE webhook_deliveries SET
+			status = $2,
+			response_code = $3,
+			response_body = NULLIF($4, ''),
+			error = NULLIF($5, ''),
+			duration_ms = $6,
+			last_attempt_at = NOW(),
+			next_attempt_at = NOW() + $7::float8 * INTERVAL '1 second',
+			locked_until = NULL,
+			delivered_at = CASE WHEN $2 = 'delivered' THEN NOW() END
+		WHERE id = $1
+	`, attempt.id, status, code, result.body, errText, result.duration.Milliseconds(), next.Seconds())
+	if err != nil {
+		return fmt.Errorf("update webhook delivery failed: %w", err)
+	}
+
+	if result.ok() {
+		_, err = tx.Exec("UPDATE webhooks SET consecutive_failures = 0 WHERE id = $1 AND consecutive_failures > 0", attempt.webhookID)
+	} else {
+		var disabled bool
+		err = tx.QueryRow(`
+			UPDATE webhooks SET
+				consecutive_failures = consecutive_failures + 1,
+				enabled = enabled AND consecutive_failures + 1 < $2,
+				disabled_reason = CASE WHEN enabled AND consecutive_failures + 1 >= $2 THEN $3 ELSE disabled_reason END,
+				updated_at = CASE WHEN enabled AND consecutive_failures + 1 >= $2 THEN NOW() ELSE updated_at END
+			WHERE id = $1
+			RETURNING NOT enabled AND consecutive_failures = $2
+		`, attempt.webhookID, WebhookDisableAfter,
+			fmt.Sprintf("disabled after %d consecutive failed deliveries", WebhookDisableAfter),
+		).Scan(&disabled)
+		if err == nil && disabled {
+			log.Printf("webhook %d 连续失败 %d 次，已自动停用", attempt.webhookID, WebhookDisableAfter)
+		}
+		if err == sql.ErrNoRows {
+			// webhook 在投递期间被删除
+			err = nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("update webhook failures failed: %w", err)
+	}
+	return tx.Commit()
+}
+
+// EnqueueOverdue 为截止时间已过、尚未完成的待办事项加入一次 todo.overdue 事件，返回加入的待办事项数。
+// 只考虑截止时间晚于订阅创建时间的待办事项，新建订阅时不会收到大量旧的过期事件；
+// webhook_overdue_notices 的主键保证多个实例同时运行时每个截止时间只发送一次
+func (d *WebhookDispatcher) EnqueueOverdue() (int, error) {
+	rows, err := d.DB.Query(`
+		WITH noticed AS (
+			INSERT INTO webhook_overdue_notices (todo_id, due_date)
+			SELECT t.id, t.due_date FROM todos t
+			WHERE NOT COALESCE(t.done, FALSE) AND t.user_id IS NOT NULL
+			  AND t.due_date <= NOW() AND t.due_date > NOW() - $1::float8 * INTERVAL '1 second'
+			  AND EXISTS (
+				SELECT 1 FROM webhooks w
+				WHERE w.enabled AND (w.user_id = t.user_id OR w.user_id IS NULL)
+				  AND (cardinality(w.events) = 0 OR $2 = ANY(w.events))
+				  AND t.due_date > w.created_at
+			  )
+			ON CONFLICT DO NOTHING
+			RETURNING todo_id
+		)
+		SELECT enqueue_webhook_event(t.user_id, $2, webhook_todo_json(t))
+		FROM todos t JOIN noticed n ON n.todo_id = t.id
+	`, webhookOverdueWindow.Seconds(), WebhookEventTodoOverdue)
+	if err != nil {
+		return 0, fmt.Errorf("enqueue overdue webhooks failed: %w", err)
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		n++
+	}
+	return n, rows.Err()
+}
+
+// Prune 清理超过保留时间的投递日志（不包括待投递的）和过期通知记录
+func (d *WebhookDispatcher) Prune() error {
+	_, err := d.DB.Exec(
+		"DELETE FROM webhook_deliveries WHERE status <> 'pending' AND created_at < NOW() - $1::float8 * INTERVAL '1 second'",
+		webhookDeliveryRetention.Seconds(),
+	)
+	if err != nil {
+		return fmt.Errorf("prune webhook deliveries failed: %w", err)
+	}
+	// 截止时间早于过期事件窗口的待办事项不会再被检查
+	_, err = d.DB.Exec(
+		"DELETE FROM webhook_overdue_notices WHERE due_date < NOW() - $1::float8 * INTERVAL '1 second'",
+		webhookOverdueWindow.Seconds(),
+	)
+	if err != nil {
+		return fmt.Errorf("prune webhook overdue notices failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignWebhook(t *testing.T) {
+	// echo -n '1700000000.{"a":1}' | openssl dgst -sha256 -hmac whsec_test
+	got := SignWebhook("whsec_test", 1700000000, []byte(`{"a":1}`))
+	if want := "38877139021993b830af32feea6e18a8da83eb2f6e49ee50bd9e4cf4ca4d3789"; got != want {
+		t.Fatalf("signature = %q, want %q", got, want)
+	}
+	if got == SignWebhook("whsec_test", 1700000001, []byte(`{"a":1}`)) || got == SignWebhook("other", 1700000000, []byte(`{"a":1}`)) {
+		t.Error("signature does not depend on timestamp and secret")
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{4, 4 * time.Minute},
+		{WebhookMaxAttempts, 256 * time.Minute},
+		{20, webhookMaxBackoff},
+	}
+	for _, tt := range tests {
+		if got := webhookBackoff(tt.attempt); got != tt.want {
+			t.Errorf("webhookBackoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookValidation(t *testing.T) {
+	for _, raw := range []string{"https://chat.example.com/hooks/1", " http://ci:8080/todo ", "https://93.184.216.34/hook"} {
+		if _, err := validateWebhookURL(raw, 1); err != nil {
+			t.Errorf("validateWebhookURL(%q) = %v", raw, err)
+		}
+	}
+	for _, raw := range []string{"", "ftp://example.com", "/relative", "https://", "https://" + strings.Repeat("a", maxWebhookURL)} {
+		if _, err := validateWebhookURL(raw, 1); !errors.Is(err, ErrInvalidWebhookURL) {
+			t.Errorf("validateWebhookURL(%q) = %v", raw, err)
+		}
+	}
+	// 用户的 webhook 不能直接指向内网地址，管理员的全局 webhook 在投递时按允许列表检查
+	for _, raw := range []string{"http://127.0.0.1:8080/", "http://169.254.169.254/latest/meta-data", "http://[::1]/",
+		"http://10.0.0.5/hook", "http://LOCALHOST:3000", "http://api.localhost./"} {
+		if _, err := validateWebhookURL(raw, 1); !errors.Is(err, ErrInvalidWebhookURL) {
+			t.Errorf("user validateWebhookURL(%q) = %v", raw, err)
+		}
+		if _, err := validateWebhookURL(raw, 0); err != nil {
+			t.Errorf("admin validateWebhookURL(%q) = %v", raw, err)
+		}
+	}
+
+	events, err := normalizeWebhookEvents([]string{"todo.created", " todo.overdue", "todo.created"})
+	if err != nil || strings.Join(events, ",") != "todo.created,todo.overdue" {
+		t.Errorf("events = %v, %v", events, err)
+	}
+	if events, err := normalizeWebhookEvents(nil); err != nil || events == nil || len(events) != 0 {
+		t.Errorf("empty events = %#v, %v", events, err)
+	}
+	if _, err := normalizeWebhookEvents([]string{"step.created"}); !errors.Is(err, ErrInvalidWebhookEvent) {
+		t.Errorf("unknown event = %v", err)
+	}
+}
+
+func TestWebhookAddressBlocked(t *testing.T) {
+	blocked := []string{"127.0.0.1", "127.8.9.10", "::1", "10.1.2.3", "172.16.0.1", "172.31.255.255", "192.168.1.1",
+		"169.254.169.254", "fe80::1", "fc00::1", "fd12:3456::1", "0.0.0.0", "::", "100.64.0.1", "224.0.0.1",
+		"ff02::1", "::ffff:127.0.0.1", "::ffff:10.0.0.1"}
+	for _, addr := range blocked {
+		if !webhookAddressBlocked(netip.MustParseAddr(addr)) {
+			t.Errorf("%s is not blocked", addr)
+		}
+	}
+	for _, addr := range []string{"93.184.216.34", "8.8.8.8", "172.32.0.1", "100.128.0.1", "2606:4700:4700::1111"} {
+		if webhookAddressBlocked(netip.MustParseAddr(addr)) {
+			t.Errorf("%s is blocked", addr)
+		}
+	}
+
+	control := webhookDialControl([]netip.Prefix{netip.MustParsePrefix("10.20.0.0/16")})
+	for address, allowed := range map[string]bool{
+		"93.184.216.34:443": true, "10.20.1.1:80": true, "[::ffff:10.20.1.1]:80": true,
+		"10.21.0.1:80": false, "127.0.0.1:8080": false, "[::1]:80": false, "169.254.169.254:80": false,
+	} {
+		err := control("tcp", address, nil)
+		if allowed && err != nil || !allowed && !errors.Is(err, ErrWebhookAddressBlocked) {
+			t.Errorf("control(%s) = %v", address, err)
+		}
+	}
+}
+
+func TestWebhookDispatcherSend(t *testing.T) {
+	payload := []byte(`{"type":"todo.created","todo":{"id":1}}`)
+	var header http.Header
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		body, _ = io.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/ok":
+			w.WriteHeader(http.StatusNoContent)
+		case "/moved":
+			http.Redirect(w, r, "/ok", http.StatusFound)
+		default:
+			http.Error(w, "boom\x00", http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	// 测试服务器在回环地址上：用户的 webhook 被拦截，允许列表中的全局 webhook 可以投递
+	d := NewWebhookDispatcher(nil, netip.MustParsePrefix("127.0.0.0/8"))
+	attempt := webhookAttempt{id: 42, eventType: "todo.created", payload: payload, secret: "whsec_test", url: server.URL + "/ok"}
+	if result := d.send(attempt); result.ok() || !errors.Is(result.err, ErrWebhookAddressBlocked) {
+		t.Fatalf("loopback result = %+v", result)
+	}
+	if header != nil {
+		t.Fatal("blocked delivery reached the server")
+	}
+
+	attempt.global = true
+	result := d.send(attempt)
+	if !result.ok() || result.code != http.StatusNoContent {
+		t.Fatalf("result = %+v", result)
+	}
+	if string(body) != string(payload) || header.Get(WebhookEventHeader) != "todo.created" || header.Get(WebhookDeliveryHeader) != "42" {
+		t.Errorf("request = %v %s", header, body)
+	}
+	var timestamp int64
+	var signature string
+	if _, err := fmt.Sscanf(strings.Replace(header.Get(WebhookSignatureHeader), ",v1=", " ", 1), "t=%d %s", &timestamp, &signature); err != nil {
+		t.Fatalf("signature header = %q: %v", header.Get(WebhookSignatureHeader), err)
+	}
+	if signature != SignWebhook("whsec_test", timestamp, payload) {
+		t.Errorf("signature %q does not verify", signature)
+	}
+
+	// 不跟随重定向
+	attempt.url = server.URL + "/moved"
+	if result := d.send(attempt); result.ok() || result.code != http.StatusFound {
+		t.Errorf("redirect result = %+v", result)
+	}
+
+	attempt.url = server.URL + "/fail"
+	if result := d.send(attempt); result.ok() || result.code != http.StatusInternalServerError || strings.Contains(result.body, "\x00") {
+		t.Errorf("failure result = %+v", result)
+	}
+
+	attempt.url = "http://127.0.0.1:1/unreachable"
+	if result := d.send(attempt); result.ok() || result.err == nil {
+		t.Errorf("unreachable result = %+v", result)
+	}
+}
@@ -0,0 +1,497 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+)
+
+// KeyPattern 工作流状态和自定义字段的 key：以小写字母开头，只包含小写字母、数字和下划线，最长 30 个字符。
+// 所有写入 key 的入口（API、备份恢复、导入）都要用它校验
+var KeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,29}$`)
+
+var (
+	// ErrUnknownStatus 指定的工作流状态不存在
+	ErrUnknownStatus = errors.New("unknown workflow status")
+	// ErrWIPLimitReached 目标列已达到在制品（WIP）上限
+	ErrWIPLimitReached = errors.New("wip limit reached")
+	// ErrLastState 不能删除用户的最后一个工作流状态
+	ErrLastState = errors.New("cannot delete the last workflow state")
+	// ErrDuplicateState 用户已有相同 key 的工作流状态
+	ErrDuplicateState = errors.New("workflow state already exists")
+)
+
+// WorkflowState 表示看板中的一个工作流状态（列）
+type WorkflowState struct {
+	ID           int       `json:"id"`
+	UserID       int       `json:"userId"`
+	Key          string    `json:"key"`
+	Name         string    `json:"name"`
+	Position     int       `json:"position"`
+	CountsAsDone bool      `json:"countsAsDone"`
+	WIPLimit     *int      `json:"wipLimit,omitempty"`
+	Color        string    `json:"color,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// StatusTransition 记录一次状态流转，用于计算周期时间
+type StatusTransition struct {
+	ID             int       `json:"id"`
+	TodoID         int       `json:"todoId"`
+	FromStatus     *string   `json:"fromStatus"`
+	ToStatus       string    `json:"toStatus"`
+	TransitionedAt time.Time `json:"transitionedAt"`
+}
+
+// BoardColumn 看板中的一列
+type BoardColumn struct {
+	State     WorkflowState `json:"state"`
+	Todos     []Todo        `json:"todos"`
+	Count     int           `json:"count"`
+	OverLimit bool          `json:"overLimit"`
+}
+
+// defaultStates 新用户默认的工作流：待办 → 进行中 → 审核 → 完成
+var defaultStates = []WorkflowState{
+	{Key: "backlog", Name: "待办", Position: 0},
+	{Key: "in_progress", Name: "进行中", Position: 1},
+	{Key: "review", Name: "审核", Position: 2},
+	{Key: "done", Name: "完成", Position: 3, CountsAsDone: true},
+}
+
+// WorkflowModel 处理工作流状态相关的数据库操作
+type WorkflowModel struct {
+	DB *sql.DB
+}
+
+// NewWorkflowModel 创建一个新的WorkflowModel实例
+func NewWorkflowModel(db *sql.DB) *WorkflowModel {
+	return &WorkflowModel{DB: db}
+}
+
+// execer 兼容 *sql.DB 和 *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// ensureDefaultStates 如果用户还没有任何工作流状态，则创建默认状态
+func ensureDefaultStates(db execer, userID int) error {
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM workflow_states WHERE user_id = $1)", userID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("check workflow states failed: %w", err)
+	}
+	if exists {
+		return nil
+	}
+
+	for _, state := range defaultStates {
+		_, err = db.Exec(
+			`INSERT INTO workflow_states (user_id, key, name, position, counts_as_done)
+			 VALUES ($1, $2, $3, $4, $5) ON CONFLICT (user_id, key) DO NOTHING`,
+			userID, state.Key, state.Name, state.Position, state.CountsAsDone,
+		)
+		if err != nil {
+			return fmt.Errorf("create default workflow state failed: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// scanState 扫描一行工作流状态
+func scanState(row rowScanner) (WorkflowState, error) {
+	var state WorkflowState
+	var color sql.NullString
+	err := row.Scan(
+		&state.ID,
+		&state.UserID,
+		&state.Key,
+		&state.Name,
+		&state.Position,
+		&state.CountsAsDone,
+		&state.WIPLimit,
+		&color,
+		&state.CreatedAt,
+	)
+	state.Color = color.String
+	return state, err
+}
+
+const stateColumns = "id, user_id, key, name, position, counts_as_done, wip_limit, color, created_at"
+
+// getStateByKey 根据key获取用户的工作流状态
+func getStateByKey(db execer, userID int, key string) (*WorkflowState, error) {
+	state, err := scanState(db.QueryRow(
+		"SELECT "+stateColumns+" FROM workflow_states WHERE user_id = $1 AND key = $2",
+		userID, key,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrUnknownStatus
+		}
+		return nil, fmt.Errorf("get workflow state failed: %w", err)
+	}
+	return &state, nil
+}
+
+// GetStates 获取用户的所有工作流状态（按顺序）
+func (m *WorkflowModel) GetStates(userID int) ([]WorkflowState, error) {
+	if err := ensureDefaultStates(m.DB, userID); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.DB.Query(
+		"SELECT "+stateColumns+" FROM workflow_states WHERE user_id = $1 ORDER BY position, id",
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query workflow states failed: %w", err)
+	}
+	defer rows.Close()
+
+	states := []WorkflowState{}
+	for rows.Next() {
+		state, err := scanState(rows)
+		if err != nil {
+			log.Printf("scan workflow state failed: %v", err)
+			continue
+		}
+		states = append(states, state)
+	}
+
+	return states, nil
+}
+
+// GetState 根据key获取用户的工作流状态
+func (m *WorkflowModel) GetState(userID int, key string) (*WorkflowState, error) {
+	if err := ensureDefaultStates(m.DB, userID); err != nil {
+		return nil, err
+	}
+	return getStateByKey(m.DB, userID, key)
+}
+
+// CreateState 创建工作流状态
+func (m *WorkflowModel) CreateState(state *WorkflowState) error {
+	if err := ensureDefaultStates(m.DB, state.UserID); err != nil {
+		return err
+	}
+
+	err := m.DB.QueryRow(
+		`INSERT INTO workflow_states (user_id, key, name, position, counts_as_done, wip_limit, color)
+		 VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))
+		 RETURNING id, created_at`,
+		state.UserID, state.Key, state.Name, state.Position, state.CountsAsDone, state.WIPLimit, state.Color,
+	).Scan(&state.ID, &state.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err, "workflow_states_user_id_key_key") {
+			return ErrDuplicateState
+		}
+		return fmt.Errorf("create workflow state failed: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateState 更新工作流状态，key 一旦创建不可修改
+func (m *WorkflowModel) UpdateState(state *WorkflowState) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction failed: %w", err)
+	}
+
+	var key string
+	err = tx.QueryRow(
+		`UPDATE workflow_states SET
+			name = $1,
+			position = $2,
+			counts_as_done = $3,
+			wip_limit = $4,
+			color = NULLIF($5, '')
+		WHERE id = $6 AND user_id = $7
+		RETURNING key, created_at`,
+		state.Name, state.Position, state.CountsAsDone, state.WIPLimit, state.Color, state.ID, state.UserID,
+	).Scan(&key, &state.CreatedAt)
+	if err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return ErrUnknownStatus
+		}
+		return fmt.Errorf("update workflow state failed: %w", err)
+	}
+	state.Key = key
+
+	// “是否算作完成”可能被修改，同步该列中待办事项的完成状态
+	_, err = tx.Exec(
+		"UPDATE todos SET done = $1, updated_at = NOW() WHERE user_id = $2 AND status = $3 AND done <> $1",
+		state.CountsAsDone, state.UserID, key,
+	)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("sync todos done flag failed: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction failed: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteState 删除工作流状态，并把其中的待办事项移动到 moveTo 状态。
+// moveTo 为空时，移动到完成标记相同的第一个其他状态。
+func (m *WorkflowModel) DeleteState(userID, stateID int, moveTo string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	state, err := scanState(tx.QueryRow(
+		"SELECT "+stateColumns+" FROM workflow_states WHERE id = $1 AND user_id = $2",
+		stateID, userID,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrUnknownStatus
+		}
+		return fmt.Errorf("get workflow state failed: %w", err)
+	}
+
+	if moveTo == "" {
+		err = tx.QueryRow(
+			`SELECT key FROM workflow_states
+			 WHERE user_id = $1 AND id <> $2
+			 ORDER BY (counts_as_done = $3) DESC, position, id
+			 LIMIT 1`,
+			userID, stateID, state.CountsAsDone,
+		).Scan(&moveTo)
+		if err == sql.ErrNoRows {
+			return ErrLastState
+		}
+		if err != nil {
+			return fmt.Errorf("find fallback state failed: %w", err)
+		}
+	} else if moveTo == state.Key {
+		return ErrUnknownStatus
+	} else if _, err = getStateByKey(tx, userID, moveTo); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE todos SET status = $1, updated_at = NOW() WHERE user_id = $2 AND status = $3",
+		moveTo, userID, state.Key,
+	)
+	if err != nil {
+		return fmt.Errorf("move todos failed: %w", err)
+	}
+
+	if _, err = tx.Exec("DELETE FROM workflow_states WHERE id = $1", stateID); err != nil {
+		return fmt.Errorf("delete workflow state failed: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction failed: %w", err)
+	}
+
+	return nil
+}
+
+// SetTodoStatus 将待办事项移动到指定状态。
+// 目标列达到WIP上限时返回 ErrWIPLimitReached，force 为 true 时忽略上限。
+func (m *WorkflowModel) SetTodoStatus(todoID, userID int, status string, force bool) (*Todo, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	var ownerID int
+	var current sql.NullString
+	err = tx.QueryRow("SELECT user_id, status FROM todos WHERE id = $1 FOR UPDATE", todoID).Scan(&ownerID, &current)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTodoNotFound
+		}
+		return nil, fmt.Errorf("verify todo ownership failed: %w", err)
+	}
+	if ownerID != userID {
+		return nil, fmt.Errorf("unauthorized: todo does not belong to user")
+	}
+
+	state, err := getStateByKey(tx, userID, status)
+	if err != nil {
+		return nil, err
+	}
+
+	if current.String != status && state.WIPLimit != nil && !force {
+		var count int
+		err = tx.QueryRow(
+			"SELECT COUNT(*) FROM todos WHERE user_id = $1 AND status = $2",
+			userID, status,
+		).Scan(&count)
+		if err != nil {
+			return nil, fmt.Errorf("count todos in state failed: %w", err)
+		}
+		if count >= *state.WIPLimit {
+			return nil, ErrWIPLimitReached
+		}
+	}
+
+	todo, err := ScanTodo(tx.QueryRow(
+		"UPDATE todos SET status = $1, updated_at = NOW() WHERE id = $2 RETURNING "+TodoColumns,
+		status, todoID,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("update todo status failed: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit transaction failed: %w", err)
+	}
+
+	return &todo, nil
+}
+
+// GetBoard 获取按工作流状态分组的看板视图
+func (m *WorkflowModel) GetBoard(userID int) ([]BoardColumn, error) {
+	states, err := m.GetStates(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]BoardColumn, len(states))
+	index := make(map[string]int, len(states))
+	firstOpen, firstDone := -1, -1
+	for i, state := range states {
+		columns[i] = BoardColumn{State: state, Todos: []Todo{}}
+		index[state.Key] = i
+		if state.CountsAsDone && firstDone == -1 {
+			firstDone = i
+		}
+		if !state.CountsAsDone && firstOpen == -1 {
+			firstOpen = i
+		}
+	}
+
+	rows, err := m.DB.Query(
+		`SELECT `+TodoColumns+`
+		FROM todos
+		WHERE user_id = $1
+		ORDER BY
+			CASE
+				WHEN priority = 'high' THEN 1
+				WHEN priority = 'medium' THEN 2
+				WHEN priority = 'low' THEN 3
+				ELSE 4
+			END,
+			created_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query board todos failed: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		todo, err := ScanTodo(rows)
+		if err != nil {
+			log.Printf("scan todo failed: %v", err)
+			continue
+		}
+
+		// 状态不在当前工作流中的待办事项，按完成标记放入第一列
+		i, ok := index[todo.Status]
+		if !ok {
+			i = firstOpen
+			if todo.Done && firstDone != -1 {
+				i = firstDone
+			}
+			if i == -1 {
+				i = 0
+			}
+		}
+		columns[i].Todos = append(columns[i].Todos, todo)
+	}
+
+	for i := range columns {
+		columns[i].Count = len(columns[i].Todos)
+		if limit := columns[i].State.WIPLimit; limit != nil {
+			columns[i].OverLimit = columns[i].Count > *limit
+		}
+	}
+
+	return columns, nil
+}
+
+// GetTransitions 获取待办事项的状态流转记录，待办事项不存在或不属于该用户时返回 ErrTodoNotFound
+func (m *WorkflowModel) GetTransitions(todoID, userID int) ([]StatusTransition, error) {
+	var exists bool
+	err := m.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM todos WHERE id = $1 AND user_id = $2)", todoID, userID).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("get todo failed: %w", err)
+	}
+	if !exists {
+		return nil, ErrTodoNotFound
+	}
+
+	rows, err := m.DB.Query(
+		`SELECT t.id, t.todo_id, t.from_status, t.to_status, t.transitioned_at
+		 FROM todo_status_transitions t
+		 JOIN todos ON todos.id = t.todo_id
+		 WHERE t.todo_id = $1 AND todos.user_id = $2
+		 ORDER BY t.transitioned_at, t.id`,
+		todoID, userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query transitions failed: %w", err)
+	}
+	defer rows.Close()
+
+	transitions := []StatusTransition{}
+	for rows.Next() {
+		var t StatusTransition
+		if err := rows.Scan(&t.ID, &t.TodoID, &t.FromStatus, &t.ToStatus, &t.TransitionedAt); err != nil {
+			log.Printf("scan transition failed: %v", err)
+			continue
+		}
+		transitions = append(transitions, t)
+	}
+
+	return transitions, nil
+}
+
+// CycleTime 根据流转记录计算周期时间：从第一次离开初始状态到第一次进入完成状态。
+// 尚未开始或尚未完成时返回 nil。
+func CycleTime(transitions []StatusTransition, states []WorkflowState) *time.Duration {
+	if len(states) == 0 {
+		return nil
+	}
+
+	doneKeys := make(map[string]bool)
+	for _, state := range states {
+		if state.CountsAsDone {
+			doneKeys[state.Key] = true
+		}
+	}
+	initial := states[0].Key
+
+	var started *time.Time
+	for i := range transitions {
+		t := transitions[i]
+		if started == nil && t.ToStatus != initial {
+			started = &t.TransitionedAt
+		}
+		if started != nil && doneKeys[t.ToStatus] {
+			d := t.TransitionedAt.Sub(*started)
+			return &d
+		}
+	}
+
+	return nil
+}